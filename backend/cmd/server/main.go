@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/api"
+	"github.com/dshills/specbuilder/backend/internal/audit"
+	"github.com/dshills/specbuilder/backend/internal/compiler"
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/jobs"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/repository/sqlite"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+)
+
+//go:embed schemas/ProjectImplementationSpec.schema.json
+var specSchemaJSON string
+
+func loadSpecSchema() (string, error) {
+	return specSchemaJSON, nil
+}
+
+func logConfig() {
+	log.Println("=== SpecBuilder Configuration ===")
+
+	// Log SPECBUILDER_* env vars
+	envVars := []struct {
+		name         string
+		defaultValue string
+	}{
+		{"SPECBUILDER_API_PORT", "8080"},
+		{"SPECBUILDER_DB_PATH", "data/specbuilder.db"},
+		{"SPECBUILDER_CORS_ORIGINS", "* (allow all)"},
+		{"SPECBUILDER_LLM_PROVIDER", "(auto-detect)"},
+		{"SPECBUILDER_LLM_MODEL", "(auto-detect)"},
+		{"SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL", "(not configured)"},
+		{"SPECBUILDER_OLLAMA_NUM_CTX", "(Ollama default)"},
+		{"SPECBUILDER_OLLAMA_KEEP_ALIVE", "(Ollama default)"},
+		{"SPECBUILDER_LLM_CASSETTE", "(disabled)"},
+		{"SPECBUILDER_LLM_CASSETTE_MODE", "replay"},
+		{"SPECBUILDER_LLM_CACHE", "(disabled)"},
+		{"SPECBUILDER_LLM_CACHE_TTL", "24h"},
+		{"SPECBUILDER_GEMINI_CACHE_TTL", "1h"},
+		{"SPECBUILDER_LLM_CONTEXT_WINDOWS", "(built-in table)"},
+		{"SPECBUILDER_LLM_AUDIT", "false"},
+		{"SPECBUILDER_LLM_AUDIT_RETENTION", "168h"},
+		{"SPECBUILDER_LLM_AUDIT_REDACT", "(built-in patterns only)"},
+		{"SPECBUILDER_LLM_ROUTING", "(default model for every role)"},
+		{"SPECBUILDER_PROMPTS_DIR", "(built-in prompts only)"},
+		{"SPECBUILDER_PROMPT_VERSION", "v1"},
+		{"SPECBUILDER_COMPILE_REPAIR_ATTEMPTS", "2"},
+		{"SPECBUILDER_COMPILE_REJECT_INVALID", "false"},
+		{"SPECBUILDER_JOB_WORKERS", "4"},
+		{"SPECBUILDER_JOB_TIMEOUT", "10m"},
+		{"SPECBUILDER_BUDGET_TOKENS", "(no limit)"},
+		{"SPECBUILDER_BUDGET_COST_USD", "(no limit)"},
+		{"SPECBUILDER_BUDGET_PERIOD", "monthly"},
+		{"SPECBUILDER_BUDGET_WARN_AT", "0.8"},
+	}
+
+	for _, ev := range envVars {
+		value := os.Getenv(ev.name)
+		if value == "" {
+			log.Printf("  %s: %s (default)", ev.name, ev.defaultValue)
+		} else {
+			log.Printf("  %s: %s", ev.name, value)
+		}
+	}
+
+	// Log API key availability (not the actual keys)
+	apiKeys := []string{"ANTHROPIC_API_KEY", "GEMINI_API_KEY", "OPENAI_API_KEY", "SPECBUILDER_OPENAI_COMPATIBLE_API_KEY"}
+	var configured []string
+	for _, key := range apiKeys {
+		if os.Getenv(key) != "" {
+			configured = append(configured, key)
+		}
+	}
+	if len(configured) > 0 {
+		log.Printf("  API keys configured: %v", configured)
+	} else {
+		log.Println("  API keys configured: (none)")
+	}
+
+	log.Println("=================================")
+}
+
+// repairPolicyFromEnv reads the compile schema-repair settings.
+func repairPolicyFromEnv() (int, bool) {
+	attempts := compiler.DefaultMaxRepairAttempts
+	if v := os.Getenv("SPECBUILDER_COMPILE_REPAIR_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			attempts = n
+		} else {
+			log.Printf("Warning: invalid SPECBUILDER_COMPILE_REPAIR_ATTEMPTS=%q, using %d", v, attempts)
+		}
+	}
+	reject, _ := strconv.ParseBool(os.Getenv("SPECBUILDER_COMPILE_REJECT_INVALID"))
+	return attempts, reject
+}
+
+// jobOptionsFromEnv reads the background job runner settings.
+func jobOptionsFromEnv() jobs.Options {
+	opts := jobs.Options{Workers: jobs.DefaultWorkers, Timeout: jobs.DefaultTimeout}
+	if v := os.Getenv("SPECBUILDER_JOB_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			opts.Workers = n
+		} else {
+			log.Printf("Warning: invalid SPECBUILDER_JOB_WORKERS=%q, using %d", v, opts.Workers)
+		}
+	}
+	if v := os.Getenv("SPECBUILDER_JOB_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			opts.Timeout = d
+		} else {
+			log.Printf("Warning: invalid SPECBUILDER_JOB_TIMEOUT=%q, using %s", v, opts.Timeout)
+		}
+	}
+	return opts
+}
+
+// serverBudgetFromEnv reads the server-wide LLM budget, or returns nil if
+// no limit is set. Values that don't parse, and budgets that don't pass
+// Budget.Validate, are errors.
+func serverBudgetFromEnv() (*domain.Budget, error) {
+	tokens := os.Getenv("SPECBUILDER_BUDGET_TOKENS")
+	cost := os.Getenv("SPECBUILDER_BUDGET_COST_USD")
+	if tokens == "" && cost == "" {
+		return nil, nil
+	}
+
+	budget := &domain.Budget{Period: domain.BudgetPeriodMonthly}
+	if v := os.Getenv("SPECBUILDER_BUDGET_PERIOD"); v != "" {
+		budget.Period = domain.BudgetPeriod(v)
+	}
+	var err error
+	if tokens != "" {
+		if budget.MaxTokens, err = strconv.Atoi(tokens); err != nil {
+			return nil, fmt.Errorf("SPECBUILDER_BUDGET_TOKENS: %w", err)
+		}
+	}
+	if cost != "" {
+		if budget.MaxCostUSD, err = strconv.ParseFloat(cost, 64); err != nil {
+			return nil, fmt.Errorf("SPECBUILDER_BUDGET_COST_USD: %w", err)
+		}
+	}
+	if v := os.Getenv("SPECBUILDER_BUDGET_WARN_AT"); v != "" {
+		if budget.WarnAt, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("SPECBUILDER_BUDGET_WARN_AT: %w", err)
+		}
+	}
+	if err := budget.Validate(); err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// promptsFromEnv loads the built-in prompts plus any overrides from
+// SPECBUILDER_PROMPTS_DIR, and reads the default prompt version.
+func promptsFromEnv() (*llm.PromptRegistry, llm.PromptVersion, error) {
+	prompts := llm.NewPromptRegistry()
+	if dir := os.Getenv("SPECBUILDER_PROMPTS_DIR"); dir != "" {
+		if err := prompts.LoadDir(dir); err != nil {
+			return nil, "", err
+		}
+	}
+	version := llm.DefaultPromptVersion
+	if v := os.Getenv("SPECBUILDER_PROMPT_VERSION"); v != "" {
+		version = llm.PromptVersion(v)
+	}
+	return prompts, version, nil
+}
+
+// routingFromEnv reads the server-wide model routing: a JSON object mapping
+// roles to {"provider": ..., "model": ...}.
+func routingFromEnv() (domain.ModelRouting, error) {
+	v := os.Getenv("SPECBUILDER_LLM_ROUTING")
+	if v == "" {
+		return nil, nil
+	}
+	var routing domain.ModelRouting
+	if err := json.Unmarshal([]byte(v), &routing); err != nil {
+		return nil, fmt.Errorf("want a JSON object mapping roles to {\"provider\", \"model\"}: %w", err)
+	}
+	return routing, nil
+}
+
+// auditFromEnv reads the LLM audit log settings, or returns nil if the audit
+// log is off.
+func auditFromEnv() (*api.AuditConfig, error) {
+	if on, _ := strconv.ParseBool(os.Getenv("SPECBUILDER_LLM_AUDIT")); !on {
+		return nil, nil
+	}
+	cfg := &api.AuditConfig{Retention: 7 * 24 * time.Hour}
+	if v := os.Getenv("SPECBUILDER_LLM_AUDIT_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			cfg.Retention = d
+		} else {
+			log.Printf("Warning: invalid SPECBUILDER_LLM_AUDIT_RETENTION=%q, using %s", v, cfg.Retention)
+		}
+	}
+	var extra []string
+	if v := os.Getenv("SPECBUILDER_LLM_AUDIT_REDACT"); v != "" {
+		if err := json.Unmarshal([]byte(v), &extra); err != nil {
+			return nil, fmt.Errorf("want a JSON array of regular expressions: %w", err)
+		}
+	}
+	redactor, err := audit.NewRedactor(extra)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Redactor = redactor
+	return cfg, nil
+}
+
+// responseCacheFromEnv reads the LLM response cache settings: "db" stores
+// responses in the database, any other value is a directory to store them in.
+// It returns a nil store if caching is disabled.
+func responseCacheFromEnv(repo *sqlite.SQLiteRepository) (llm.CacheStore, time.Duration) {
+	ttl := llm.DefaultCacheTTL
+	if v := os.Getenv("SPECBUILDER_LLM_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			ttl = d
+		} else {
+			log.Printf("Warning: invalid SPECBUILDER_LLM_CACHE_TTL=%q, using %s", v, ttl)
+		}
+	}
+	switch v := os.Getenv("SPECBUILDER_LLM_CACHE"); v {
+	case "", "off":
+		return nil, ttl
+	case "db":
+		return repo, ttl
+	default:
+		return llm.NewDirCache(v), ttl
+	}
+}
+
+func main() {
+	logConfig()
+
+	port := os.Getenv("SPECBUILDER_API_PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	dbPath := os.Getenv("SPECBUILDER_DB_PATH")
+	if dbPath == "" {
+		// Default to data directory in project root
+		dbPath = filepath.Join("data", "specbuilder.db")
+	}
+
+	// Ensure data directory exists
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+
+	// Initialize repository
+	repo, err := sqlite.New(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer repo.Close()
+
+	// Initialize validator
+	val, err := validator.New()
+	if err != nil {
+		log.Fatalf("Failed to initialize validator: %v", err)
+	}
+
+	// Initialize LLM factory (optional - server works without it for basic CRUD)
+	// Supports: GEMINI_API_KEY (preferred), OPENAI_API_KEY (fallback)
+	var compilerSvc *compiler.Service
+
+	llmFactory := llm.NewFactory()
+	llmFactory.SetResponseCache(responseCacheFromEnv(repo))
+	if llmFactory.Available() {
+		// Load spec schema for compiler
+		specSchema, err := loadSpecSchema()
+		if err != nil {
+			log.Fatalf("Failed to load spec schema: %v", err)
+		}
+		compilerSvc = compiler.NewService(llmFactory, val, specSchema)
+		compilerSvc.SetRepairPolicy(repairPolicyFromEnv())
+		prompts, version, err := promptsFromEnv()
+		if err != nil {
+			log.Fatalf("Failed to load prompts: %v", err)
+		}
+		if err := compilerSvc.SetPrompts(prompts, version); err != nil {
+			log.Fatalf("Invalid SPECBUILDER_PROMPT_VERSION: %v", err)
+		}
+		routing, err := routingFromEnv()
+		if err == nil {
+			err = compilerSvc.SetRouting(routing)
+		}
+		if err != nil {
+			log.Fatalf("Invalid SPECBUILDER_LLM_ROUTING: %v", err)
+		}
+		log.Printf("LLM factory initialized (default: %s/%s)", llmFactory.DefaultProvider(), llmFactory.DefaultModel())
+	} else {
+		log.Println("Warning: No LLM API key set (GEMINI_API_KEY or OPENAI_API_KEY) - compilation endpoints will be disabled")
+	}
+
+	// Initialize background job runner; jobs left running by a previous
+	// process are marked failed so their streams terminate
+	runner := jobs.NewRunner(repo, jobOptionsFromEnv())
+	if err := runner.Recover(context.Background()); err != nil {
+		log.Printf("Warning: failed to recover interrupted jobs: %v", err)
+	}
+
+	// Initialize API handler
+	handler := api.NewHandler(repo, compilerSvc, runner)
+	serverBudget, err := serverBudgetFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid server budget: %v", err)
+	}
+	handler.SetServerBudget(serverBudget)
+	auditCfg, err := auditFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid SPECBUILDER_LLM_AUDIT_REDACT: %v", err)
+	}
+	handler.SetAudit(auditCfg)
+
+	mux := http.NewServeMux()
+
+	// Health check endpoint
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+
+	// Register API routes
+	handler.RegisterRoutes(mux)
+
+	// Apply middleware
+	var h http.Handler = mux
+	h = api.Logger(h)
+	corsOrigins := os.Getenv("SPECBUILDER_CORS_ORIGINS")
+	h = api.CORS(api.CORSConfig{AllowedOrigins: corsOrigins})(h)
+
+	server := &http.Server{
+		Addr:         ":" + port,
+		Handler:      h,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 120 * time.Second, // Longer for compilation
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// Graceful shutdown
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		log.Println("Shutting down server...")
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	log.Printf("Server starting on port %s", port)
+	log.Printf("Database: %s", dbPath)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("Server error: %v", err)
+	}
+	runner.Close()
+	log.Println("Server stopped")
+}
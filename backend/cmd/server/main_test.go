@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/compiler"
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/jobs"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/repository/sqlite"
+)
+
+func TestRepairPolicyFromEnv(t *testing.T) {
+	if attempts, reject := repairPolicyFromEnv(); attempts != compiler.DefaultMaxRepairAttempts || reject {
+		t.Errorf("repairPolicyFromEnv() = %d, %v; want the defaults", attempts, reject)
+	}
+
+	t.Setenv("SPECBUILDER_COMPILE_REPAIR_ATTEMPTS", "0")
+	t.Setenv("SPECBUILDER_COMPILE_REJECT_INVALID", "true")
+	if attempts, reject := repairPolicyFromEnv(); attempts != 0 || !reject {
+		t.Errorf("repairPolicyFromEnv() = %d, %v; want 0, true", attempts, reject)
+	}
+
+	t.Setenv("SPECBUILDER_COMPILE_REPAIR_ATTEMPTS", "-1")
+	if attempts, _ := repairPolicyFromEnv(); attempts != compiler.DefaultMaxRepairAttempts {
+		t.Errorf("repairPolicyFromEnv() attempts = %d, want the default for a negative value", attempts)
+	}
+}
+
+func TestJobOptionsFromEnv(t *testing.T) {
+	if got := jobOptionsFromEnv(); got.Workers != jobs.DefaultWorkers || got.Timeout != jobs.DefaultTimeout {
+		t.Errorf("jobOptionsFromEnv() = %+v, want the defaults", got)
+	}
+
+	t.Setenv("SPECBUILDER_JOB_WORKERS", "8")
+	t.Setenv("SPECBUILDER_JOB_TIMEOUT", "90s")
+	if got := jobOptionsFromEnv(); got.Workers != 8 || got.Timeout != 90*time.Second {
+		t.Errorf("jobOptionsFromEnv() = %+v, want 8 workers and a 90s timeout", got)
+	}
+
+	t.Setenv("SPECBUILDER_JOB_WORKERS", "0")
+	t.Setenv("SPECBUILDER_JOB_TIMEOUT", "soon")
+	if got := jobOptionsFromEnv(); got.Workers != jobs.DefaultWorkers || got.Timeout != jobs.DefaultTimeout {
+		t.Errorf("jobOptionsFromEnv() = %+v, want the defaults for invalid values", got)
+	}
+}
+
+func TestServerBudgetFromEnv(t *testing.T) {
+	if got, err := serverBudgetFromEnv(); got != nil || err != nil {
+		t.Errorf("serverBudgetFromEnv() = %+v, %v; want no budget", got, err)
+	}
+
+	t.Setenv("SPECBUILDER_BUDGET_COST_USD", "25")
+	t.Setenv("SPECBUILDER_BUDGET_PERIOD", "lifetime")
+	t.Setenv("SPECBUILDER_BUDGET_WARN_AT", "0.9")
+	want := domain.Budget{Period: domain.BudgetPeriodLifetime, MaxCostUSD: 25, WarnAt: 0.9}
+	if got, err := serverBudgetFromEnv(); err != nil || got == nil || *got != want {
+		t.Errorf("serverBudgetFromEnv() = %+v, %v; want %+v", got, err, want)
+	}
+
+	for name, env := range map[string][2]string{
+		"bad cost":    {"SPECBUILDER_BUDGET_COST_USD", "5$"},
+		"bad tokens":  {"SPECBUILDER_BUDGET_TOKENS", "10k"},
+		"bad warn at": {"SPECBUILDER_BUDGET_WARN_AT", "90%"},
+		"bad period":  {"SPECBUILDER_BUDGET_PERIOD", "weekly"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			if got, err := serverBudgetFromEnv(); err == nil {
+				t.Errorf("serverBudgetFromEnv() = %+v, want an error for %s=%s", got, env[0], env[1])
+			}
+		})
+	}
+}
+
+func TestResponseCacheFromEnv(t *testing.T) {
+	repo, err := sqlite.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	defer repo.Close()
+
+	if store, ttl := responseCacheFromEnv(repo); store != nil || ttl != llm.DefaultCacheTTL {
+		t.Errorf("responseCacheFromEnv() = %v, %s; want no cache", store, ttl)
+	}
+
+	t.Setenv("SPECBUILDER_LLM_CACHE", "db")
+	t.Setenv("SPECBUILDER_LLM_CACHE_TTL", "1h")
+	if store, ttl := responseCacheFromEnv(repo); store != llm.CacheStore(repo) || ttl != time.Hour {
+		t.Errorf("responseCacheFromEnv() = %T, %s; want the database for an hour", store, ttl)
+	}
+
+	t.Setenv("SPECBUILDER_LLM_CACHE", t.TempDir())
+	t.Setenv("SPECBUILDER_LLM_CACHE_TTL", "-1h")
+	if store, ttl := responseCacheFromEnv(repo); store == nil || store == llm.CacheStore(repo) || ttl != llm.DefaultCacheTTL {
+		t.Errorf("responseCacheFromEnv() = %T, %s; want a directory cache with the default TTL", store, ttl)
+	}
+}
+
+func TestPromptsFromEnv(t *testing.T) {
+	prompts, version, err := promptsFromEnv()
+	if err != nil || version != llm.DefaultPromptVersion || !prompts.Has(llm.DefaultPromptVersion) {
+		t.Fatalf("promptsFromEnv() = %s, %v; want the built-in prompts", version, err)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "v2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "v2", "compiler.txt"), []byte("v2 compiler prompt {{QA_BUNDLE_JSON}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SPECBUILDER_PROMPTS_DIR", dir)
+	t.Setenv("SPECBUILDER_PROMPT_VERSION", "v2")
+	prompts, version, err = promptsFromEnv()
+	if err != nil || version != "v2" || !prompts.Has("v2") {
+		t.Errorf("promptsFromEnv() = %s, %v; want the v2 prompts of the directory", version, err)
+	}
+
+	t.Setenv("SPECBUILDER_PROMPTS_DIR", filepath.Join(dir, "missing"))
+	if _, _, err := promptsFromEnv(); err == nil {
+		t.Error("promptsFromEnv() loaded a missing directory")
+	}
+}
+
+func TestAuditFromEnv(t *testing.T) {
+	if cfg, err := auditFromEnv(); cfg != nil || err != nil {
+		t.Errorf("auditFromEnv() = %+v, %v; want the audit log off", cfg, err)
+	}
+
+	t.Setenv("SPECBUILDER_LLM_AUDIT", "true")
+	t.Setenv("SPECBUILDER_LLM_AUDIT_RETENTION", "48h")
+	t.Setenv("SPECBUILDER_LLM_AUDIT_REDACT", `["ACME-\\d{6}"]`)
+	cfg, err := auditFromEnv()
+	if err != nil || cfg == nil || cfg.Retention != 48*time.Hour {
+		t.Fatalf("auditFromEnv() = %+v, %v; want a 48h retention", cfg, err)
+	}
+	if got := cfg.Redactor.Redact("order ACME-123456"); got == "order ACME-123456" {
+		t.Errorf("Redact() = %q, want the extra pattern masked", got)
+	}
+
+	for _, v := range []string{`ACME-\\d{6}`, `["("]`} {
+		t.Setenv("SPECBUILDER_LLM_AUDIT_REDACT", v)
+		if _, err := auditFromEnv(); err == nil {
+			t.Errorf("auditFromEnv() accepted SPECBUILDER_LLM_AUDIT_REDACT=%s", v)
+		}
+	}
+}
+
+func TestRoutingFromEnv(t *testing.T) {
+	if routing, err := routingFromEnv(); routing != nil || err != nil {
+		t.Errorf("routingFromEnv() = %v, %v; want no routing", routing, err)
+	}
+
+	t.Setenv("SPECBUILDER_LLM_ROUTING", `{"asker": {"provider": "openai", "model": "gpt-4o-mini"}}`)
+	routing, err := routingFromEnv()
+	if err != nil || routing[domain.LLMRoleAsker] != (domain.ModelRef{Provider: "openai", Model: "gpt-4o-mini"}) {
+		t.Errorf("routingFromEnv() = %v, %v; want the asker route", routing, err)
+	}
+
+	t.Setenv("SPECBUILDER_LLM_ROUTING", "asker=openai:gpt-4o-mini")
+	if _, err := routingFromEnv(); err == nil {
+		t.Error("routingFromEnv() accepted a value that isn't JSON")
+	}
+}
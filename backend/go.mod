@@ -8,4 +8,4 @@ require (
 	github.com/santhosh-tekuri/jsonschema/v6 v6.0.2
 )
 
-require golang.org/x/text v0.33.0 // indirect
+require golang.org/x/text v0.33.0
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/audit"
+	"github.com/dshills/specbuilder/backend/internal/compiler"
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// AuditConfig configures the LLM audit log, which keeps the prompt and raw
+// response of every LLM call for debugging.
+type AuditConfig struct {
+	Redactor  *audit.Redactor // Masks secrets and personal data before entries are stored
+	Retention time.Duration   // Entries older than this are deleted; 0 keeps them
+}
+
+// SetAudit turns on the LLM audit log. A nil config turns it off; existing
+// entries can still be listed.
+func (h *Handler) SetAudit(cfg *AuditConfig) {
+	h.audit = cfg
+}
+
+// entry returns the redacted audit entry of a call.
+func (a *AuditConfig) entry(projectID uuid.UUID, call compiler.LLMCall) *domain.LLMAuditEntry {
+	e := &domain.LLMAuditEntry{
+		ID:            uuid.New(),
+		ProjectID:     projectID,
+		Role:          call.Role,
+		Stage:         call.Stage,
+		Provider:      string(call.Provider),
+		Model:         call.Model,
+		PromptVersion: string(call.Request.PromptVersion),
+		Messages:      make([]domain.LLMMessage, len(call.Request.Messages)),
+		Response:      a.Redactor.Redact(call.Content),
+		Outcome:       domain.LLMCallOK,
+		InputTokens:   call.Usage.InputTokens,
+		OutputTokens:  call.Usage.OutputTokens,
+		LatencyMs:     call.Latency.Milliseconds(),
+		StopReason:    call.Usage.StopReason,
+		CacheHit:      call.CacheHit,
+		CreatedAt:     time.Now().UTC(),
+	}
+	for i, m := range call.Request.Messages {
+		e.Messages[i] = domain.LLMMessage{Role: m.Role, Content: a.Redactor.Redact(m.Content)}
+	}
+	switch {
+	case call.Err != nil:
+		e.Outcome = domain.LLMCallFailed
+		e.Error = a.Redactor.Redact(call.Err.Error())
+	case !json.Valid([]byte(call.Content)):
+		e.Outcome = domain.LLMCallInvalidJSON
+	}
+	return e
+}
+
+// prune deletes the entries that are past the retention period.
+func (a *AuditConfig) prune(ctx context.Context, repo repository.Repository) {
+	if a.Retention <= 0 {
+		return
+	}
+	if _, err := repo.DeleteLLMAuditEntriesBefore(ctx, time.Now().Add(-a.Retention)); err != nil {
+		log.Printf("Warning: failed to prune the LLM audit log: %v", err)
+	}
+}
+
+type listLLMCallsResponse struct {
+	Enabled bool                    `json:"enabled"` // Whether new calls are being audited
+	Calls   []*domain.LLMAuditEntry `json:"calls"`
+}
+
+// ListLLMCalls lists a project's LLM audit entries, newest first. Query
+// parameters: limit (default 50), snapshot_id, question_id, role, outcome.
+func (h *Handler) ListLLMCalls(w http.ResponseWriter, r *http.Request) {
+	project := h.loadProject(w, r)
+	if project == nil {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := domain.LLMAuditFilter{
+		Role:    domain.LLMRole(q.Get("role")),
+		Outcome: domain.LLMCallOutcome(q.Get("outcome")),
+	}
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			filter.Limit = parsed
+		}
+	}
+	if s := q.Get("snapshot_id"); s != "" {
+		id, err := parseUUID(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid snapshot ID format")
+			return
+		}
+		filter.SnapshotID = &id
+	}
+	if s := q.Get("question_id"); s != "" {
+		id, err := parseUUID(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid question ID format")
+			return
+		}
+		filter.QuestionID = &id
+	}
+
+	calls, err := h.repo.ListLLMAuditEntries(r.Context(), project.ID, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list LLM calls")
+		return
+	}
+	if calls == nil {
+		calls = []*domain.LLMAuditEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, listLLMCallsResponse{Enabled: h.audit != nil, Calls: calls})
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/jobs"
+	"github.com/google/uuid"
+)
+
+// Budget scopes
+const (
+	budgetScopeProject = "project"
+	budgetScopeServer  = "server"
+)
+
+// budgetStatus is a budget together with the usage counted against it.
+type budgetStatus struct {
+	Scope  string             `json:"scope"` // "project" or "server"
+	Budget *domain.Budget     `json:"budget"`
+	Usage  domain.UsageTotals `json:"usage"`           // Usage in the current period
+	Since  *time.Time         `json:"since,omitempty"` // Start of the current period; absent for a lifetime budget
+
+	// Estimate is the most the refused LLM call, and any calls still in
+	// flight, could add to Usage. Set only when refusing a call.
+	Estimate *domain.UsageTotals `json:"estimate,omitempty"`
+}
+
+// exhausted reports whether a limit of the budget has been reached.
+func (s *budgetStatus) exhausted() bool {
+	return s.Budget.Used(s.Usage) >= 1
+}
+
+// usage summarizes the usage against the budget's most used limit, e.g.
+// "$4.10 of $5.00 this month".
+func (s *budgetStatus) usage() string {
+	tokens := s.Usage.InputTokens + s.Usage.OutputTokens
+	used := fmt.Sprintf("%d of %d tokens", tokens, s.Budget.MaxTokens)
+	if s.byCost() {
+		used = fmt.Sprintf("$%.2f of $%.2f", s.Usage.CostUSD, s.Budget.MaxCostUSD)
+	}
+	if s.Budget.Period == domain.BudgetPeriodMonthly {
+		return used + " this month"
+	}
+	return used + " in total"
+}
+
+// byCost reports whether the cost limit of the budget is its most used.
+func (s *budgetStatus) byCost() bool {
+	b := s.Budget
+	tokens := s.Usage.InputTokens + s.Usage.OutputTokens
+	return b.MaxCostUSD > 0 && (b.MaxTokens == 0 || s.Usage.CostUSD/b.MaxCostUSD >= float64(tokens)/float64(b.MaxTokens))
+}
+
+// name returns the budget's name for messages, e.g. "Project LLM budget".
+func (s *budgetStatus) name() string {
+	if s.Scope == budgetScopeServer {
+		return "Server LLM budget"
+	}
+	return "Project LLM budget"
+}
+
+// SetServerBudget sets a budget on the LLM usage of all projects combined.
+// A nil budget removes the limit.
+func (h *Handler) SetServerBudget(budget *domain.Budget) {
+	h.serverBudget = budget
+}
+
+// budgetStatuses returns the project's budget and the server's, whichever
+// are set, with their usage in the current period.
+func (h *Handler) budgetStatuses(ctx context.Context, project *domain.Project) ([]budgetStatus, error) {
+	var statuses []budgetStatus
+	add := func(scope string, budget *domain.Budget, projectID *uuid.UUID) error {
+		if budget == nil {
+			return nil
+		}
+		since := budget.Start(time.Now())
+		usage, err := h.repo.GetUsageSince(ctx, projectID, since)
+		if err != nil {
+			return err
+		}
+		status := budgetStatus{Scope: scope, Budget: budget, Usage: usage}
+		if !since.IsZero() {
+			status.Since = &since
+		}
+		statuses = append(statuses, status)
+		return nil
+	}
+	if err := add(budgetScopeProject, project.Budget, &project.ID); err != nil {
+		return nil, err
+	}
+	if err := add(budgetScopeServer, h.serverBudget, nil); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// currentBudgets returns the budgets that apply to LLM calls on behalf of
+// project, with their usage. Budgets that cannot be checked are ignored
+// rather than blocking work.
+func (h *Handler) currentBudgets(ctx context.Context, project *domain.Project) []budgetStatus {
+	statuses, err := h.budgetStatuses(ctx, project)
+	if err != nil {
+		log.Printf("Warning: failed to check LLM budget for project %s: %v", project.ID, err)
+		return nil
+	}
+	return statuses
+}
+
+// exhaustedBudget returns the first of budgets that has no room left for
+// LLM calls, or nil.
+func exhaustedBudget(budgets []budgetStatus) *budgetStatus {
+	for i := range budgets {
+		if budgets[i].exhausted() {
+			return &budgets[i]
+		}
+	}
+	return nil
+}
+
+// budgetExceededError refuses an LLM call that could take usage past a
+// budget.
+type budgetExceededError struct {
+	status *budgetStatus
+}
+
+func (e *budgetExceededError) Error() string {
+	return budgetExceededMessage(e.status)
+}
+
+// refusedBudget returns the budget that refused an LLM call if err comes
+// from the refusal, or nil.
+func refusedBudget(err error) *budgetStatus {
+	var refused *budgetExceededError
+	if errors.As(err, &refused) {
+		return refused.status
+	}
+	return nil
+}
+
+// budgetExceededMessage explains why LLM calls are refused.
+func budgetExceededMessage(status *budgetStatus) string {
+	hint := "raise the limit to continue"
+	if status.Budget.Period == domain.BudgetPeriodMonthly {
+		hint = "raise the limit or wait until next month to continue"
+	}
+	if e := status.Estimate; e != nil {
+		more := fmt.Sprintf("%d tokens", e.InputTokens+e.OutputTokens)
+		if status.byCost() {
+			more = fmt.Sprintf("$%.2f", e.CostUSD)
+		}
+		return fmt.Sprintf("%s could be exceeded by the next LLM call (%s, up to %s more); %s", status.name(), status.usage(), more, hint)
+	}
+	return fmt.Sprintf("%s exhausted (%s); %s", status.name(), status.usage(), hint)
+}
+
+// budgetJobError returns the job error for an LLM call refused by status.
+func budgetJobError(status *budgetStatus) *jobs.Error {
+	return &jobs.Error{Code: "budget_exceeded", Message: budgetExceededMessage(status), Details: status}
+}
+
+// writeBudgetExceeded writes a 402 response for an exhausted budget.
+func writeBudgetExceeded(w http.ResponseWriter, status *budgetStatus) {
+	writeJSON(w, http.StatusPaymentRequired, errorResponse{
+		Error:   "budget_exceeded",
+		Message: budgetExceededMessage(status),
+		Details: status,
+	})
+}
+
+// budgetIssueDrafts returns a warning for each budget of project that has
+// reached its warning threshold.
+func (h *Handler) budgetIssueDrafts(ctx context.Context, project *domain.Project) []domain.IssueDraft {
+	statuses, err := h.budgetStatuses(ctx, project)
+	if err != nil {
+		log.Printf("Warning: failed to check LLM budget for project %s: %v", project.ID, err)
+		return nil
+	}
+	var drafts []domain.IssueDraft
+	for _, s := range statuses {
+		if !s.Budget.Warning(s.Usage) {
+			continue
+		}
+		severity := domain.IssueSeverityWarn
+		if s.exhausted() {
+			severity = domain.IssueSeverityError
+		}
+		drafts = append(drafts, domain.IssueDraft{
+			Type:               domain.IssueTypeBudget,
+			Severity:           severity,
+			Message:            fmt.Sprintf("%s %.0f%% used (%s)", s.name(), 100*s.Budget.Used(s.Usage), s.usage()),
+			RelatedSpecPaths:   []string{},
+			RelatedQuestionIDs: []string{},
+		})
+	}
+	return drafts
+}
+
+type setBudgetRequest struct {
+	Budget *domain.Budget `json:"budget"` // null removes the budget
+}
+
+type budgetResponse struct {
+	Budgets []budgetStatus `json:"budgets"`
+}
+
+// GetBudget returns the budgets that apply to a project with their usage in
+// the current period.
+func (h *Handler) GetBudget(w http.ResponseWriter, r *http.Request) {
+	project := h.loadProject(w, r)
+	if project == nil {
+		return
+	}
+	h.writeBudgets(w, r, project)
+}
+
+// SetBudget sets or removes a project's budget.
+func (h *Handler) SetBudget(w http.ResponseWriter, r *http.Request) {
+	project := h.loadProject(w, r)
+	if project == nil {
+		return
+	}
+
+	var req setBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if req.Budget != nil {
+		if err := req.Budget.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, "validation_error", "Invalid budget: "+err.Error())
+			return
+		}
+	}
+
+	project.Budget = req.Budget
+	project.UpdatedAt = time.Now().UTC()
+	if err := h.repo.UpdateProject(r.Context(), project); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to update project")
+		return
+	}
+	h.writeBudgets(w, r, project)
+}
+
+func (h *Handler) writeBudgets(w http.ResponseWriter, r *http.Request, project *domain.Project) {
+	statuses, err := h.budgetStatuses(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get usage")
+		return
+	}
+	if statuses == nil {
+		statuses = []budgetStatus{}
+	}
+	writeJSON(w, http.StatusOK, budgetResponse{Budgets: statuses})
+}
+
+// loadProject loads the project named by the projectId path parameter,
+// writing an error response and returning nil if it can't.
+func (h *Handler) loadProject(w http.ResponseWriter, r *http.Request) *domain.Project {
+	projectID, err := parseUUID(r.PathValue("projectId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid project ID format")
+		return nil
+	}
+	project, err := h.repo.GetProject(r.Context(), projectID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "Project not found")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get project")
+		return nil
+	}
+	return project
+}
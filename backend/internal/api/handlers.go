@@ -9,26 +9,35 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dshills/specbuilder/backend/internal/compiler"
 	"github.com/dshills/specbuilder/backend/internal/diff"
 	"github.com/dshills/specbuilder/backend/internal/domain"
 	"github.com/dshills/specbuilder/backend/internal/export"
+	"github.com/dshills/specbuilder/backend/internal/jobs"
+	"github.com/dshills/specbuilder/backend/internal/lint"
 	"github.com/dshills/specbuilder/backend/internal/llm"
 	"github.com/dshills/specbuilder/backend/internal/repository"
+	"github.com/dshills/specbuilder/backend/internal/trace"
 	"github.com/google/uuid"
 )
 
 // Handler holds dependencies for HTTP handlers.
 type Handler struct {
-	repo     repository.Repository
-	compiler *compiler.Service
+	repo         repository.Repository
+	compiler     *compiler.Service
+	jobs         *jobs.Runner
+	compileLocks projectLocks
+	serverBudget *domain.Budget // Limits the LLM usage of all projects combined
+	audit        *AuditConfig   // nil when the LLM audit log is off
 }
 
-// NewHandler creates a new Handler.
-func NewHandler(repo repository.Repository, comp *compiler.Service) *Handler {
-	return &Handler{repo: repo, compiler: comp}
+// NewHandler creates a new Handler. The streaming endpoints run their work
+// as background jobs on runner.
+func NewHandler(repo repository.Repository, comp *compiler.Service, runner *jobs.Runner) *Handler {
+	return &Handler{repo: repo, compiler: comp, jobs: runner}
 }
 
 // RegisterRoutes registers all API routes on the given mux.
@@ -36,6 +45,12 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Models
 	mux.HandleFunc("GET /models", h.ListModels)
 
+	// Prompts
+	mux.HandleFunc("GET /prompts", h.ListPrompts)
+
+	// Admin
+	mux.HandleFunc("POST /admin/ollama/pull", h.PullOllamaModel)
+
 	// Projects
 	mux.HandleFunc("GET /projects", h.ListProjects)
 	mux.HandleFunc("POST /projects", h.CreateProject)
@@ -62,6 +77,21 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /projects/{projectId}/snapshots", h.ListSnapshots)
 	mux.HandleFunc("GET /projects/{projectId}/snapshots/{snapshotId}", h.GetSnapshot)
 	mux.HandleFunc("GET /projects/{projectId}/snapshots/{snapshotId}/diff", h.DiffSnapshots)
+	mux.HandleFunc("GET /projects/{projectId}/snapshots/{snapshotId}/trace", h.GetSnapshotTrace)
+	mux.HandleFunc("GET /projects/{projectId}/snapshots/{snapshotId}/trace/lookup", h.LookupTrace)
+
+	// Usage
+	mux.HandleFunc("GET /projects/{projectId}/usage", h.GetProjectUsage)
+	mux.HandleFunc("GET /projects/{projectId}/llm-calls", h.ListLLMCalls)
+	mux.HandleFunc("GET /projects/{projectId}/budget", h.GetBudget)
+	mux.HandleFunc("PUT /projects/{projectId}/budget", h.SetBudget)
+	mux.HandleFunc("PUT /projects/{projectId}/prompt-version", h.SetPromptVersion)
+	mux.HandleFunc("PUT /projects/{projectId}/model-routing", h.SetModelRouting)
+
+	// Jobs
+	mux.HandleFunc("GET /projects/{projectId}/jobs", h.ListJobs)
+	mux.HandleFunc("GET /projects/{projectId}/jobs/{jobId}", h.GetJob)
+	mux.HandleFunc("GET /projects/{projectId}/jobs/{jobId}/events", h.JobEvents)
 
 	// Export
 	mux.HandleFunc("GET /projects/{projectId}/export", h.ExportPack)
@@ -95,29 +125,56 @@ type listModelsResponse struct {
 	Providers       []llm.ProviderInfo `json:"providers"`
 	DefaultProvider llm.Provider       `json:"default_provider"`
 	DefaultModel    string             `json:"default_model"`
+	// The model each role is routed to, for the project in the project_id
+	// query parameter if there is one
+	Routing map[domain.LLMRole]compiler.Route `json:"routing"`
 }
 
 func (h *Handler) ListModels(w http.ResponseWriter, r *http.Request) {
 	if h.compiler == nil {
 		writeJSON(w, http.StatusOK, listModelsResponse{
 			Providers: []llm.ProviderInfo{},
+			Routing:   map[domain.LLMRole]compiler.Route{},
 		})
 		return
 	}
 
+	var project *domain.Project
+	if id := r.URL.Query().Get("project_id"); id != "" {
+		projectID, err := parseUUID(id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid project_id format")
+			return
+		}
+		project, err = h.repo.GetProject(r.Context(), projectID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				writeError(w, http.StatusNotFound, "not_found", "Project not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get project")
+			return
+		}
+	}
+
 	factory := h.compiler.Factory()
 	writeJSON(w, http.StatusOK, listModelsResponse{
 		Providers:       factory.ListProviders(),
 		DefaultProvider: factory.DefaultProvider(),
 		DefaultModel:    factory.DefaultModel(),
+		Routing:         h.compiler.Routing(project),
 	})
 }
 
 // Projects
 
 type createProjectRequest struct {
-	Name string `json:"name"`
-	Mode string `json:"mode"` // "basic" or "advanced" (default: advanced)
+	Name   string         `json:"name"`
+	Mode   string         `json:"mode"`   // "basic" or "advanced" (default: advanced)
+	Budget *domain.Budget `json:"budget"` // Optional LLM budget
+
+	PromptVersion llm.PromptVersion   `json:"prompt_version,omitempty"` // Optional: pin a prompt version
+	ModelRouting  domain.ModelRouting `json:"model_routing,omitempty"`  // Optional: route roles to models
 }
 
 // ListProjects
@@ -154,6 +211,20 @@ func (h *Handler) CreateProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "validation_error", "Project name is required. Please provide a name for your project.")
 		return
 	}
+	if req.Budget != nil {
+		if err := req.Budget.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, "validation_error", "Invalid budget: "+err.Error())
+			return
+		}
+	}
+	if err := h.checkPromptVersion(req.PromptVersion); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+	if err := h.checkModelRouting(req.ModelRouting); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", "Invalid model routing: "+err.Error())
+		return
+	}
 
 	// Default to advanced mode
 	mode := domain.ProjectModeAdvanced
@@ -163,11 +234,14 @@ func (h *Handler) CreateProject(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now().UTC()
 	project := &domain.Project{
-		ID:        uuid.New(),
-		Name:      req.Name,
-		Mode:      mode,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:            uuid.New(),
+		Name:          req.Name,
+		Mode:          mode,
+		Budget:        req.Budget,
+		PromptVersion: string(req.PromptVersion),
+		ModelRouting:  req.ModelRouting,
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
 
 	if err := h.repo.CreateProject(r.Context(), project); err != nil {
@@ -370,6 +444,10 @@ type submitAnswerResponse struct {
 	AnswerID   uuid.UUID       `json:"answer_id"`
 	SnapshotID *uuid.UUID      `json:"snapshot_id"`
 	Issues     []*domain.Issue `json:"issues"`
+	// CompileInProgress is set when a compile was running as the answer was
+	// saved. That compile's snapshot won't include the answer unless it read
+	// answers afterwards; its result lists the answers it left out.
+	CompileInProgress bool `json:"compile_in_progress,omitempty"`
 }
 
 func (h *Handler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
@@ -453,9 +531,10 @@ func (h *Handler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	// or POST /projects/{id}/next-questions which includes compilation
 
 	writeJSON(w, http.StatusOK, submitAnswerResponse{
-		AnswerID:   answer.ID,
-		SnapshotID: nil,
-		Issues:     []*domain.Issue{},
+		AnswerID:          answer.ID,
+		SnapshotID:        nil,
+		Issues:            []*domain.Issue{},
+		CompileInProgress: h.compileLocks.Held(projectID),
 	})
 }
 
@@ -500,7 +579,7 @@ func (h *Handler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
 		snapshots = []*domain.SpecSnapshot{}
 	}
 
-	writeJSON(w, http.StatusOK, listSnapshotsResponse{Snapshots: snapshots})
+	writeJSON(w, http.StatusOK, listSnapshotsResponse{Snapshots: h.withUsage(r.Context(), snapshots)})
 }
 
 type getSnapshotResponse struct {
@@ -548,21 +627,208 @@ func (h *Handler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
 		issues = []*domain.Issue{}
 	}
 
+	snapshot = h.withUsage(r.Context(), []*domain.SpecSnapshot{snapshot})[0]
 	writeJSON(w, http.StatusOK, getSnapshotResponse{Snapshot: snapshot, Issues: issues})
 }
 
+// Trace
+
+type snapshotTraceResponse struct {
+	SnapshotID uuid.UUID     `json:"snapshot_id"`
+	Trace      *domain.Trace `json:"trace"`
+}
+
+type traceLookupResponse struct {
+	SnapshotID uuid.UUID           `json:"snapshot_id"`
+	Entries    []domain.TraceEntry `json:"entries"`
+}
+
+// loadProjectSnapshot resolves the projectId/snapshotId path values, writing an
+// error response and returning nil if the snapshot doesn't exist in the project.
+func (h *Handler) loadProjectSnapshot(w http.ResponseWriter, r *http.Request) *domain.SpecSnapshot {
+	projectID, err := parseUUID(r.PathValue("projectId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid project ID format")
+		return nil
+	}
+
+	snapshotID, err := parseUUID(r.PathValue("snapshotId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid snapshot ID format")
+		return nil
+	}
+
+	snapshot, err := h.repo.GetSnapshot(r.Context(), snapshotID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "Snapshot not found")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get snapshot")
+		return nil
+	}
+
+	if snapshot.ProjectID != projectID {
+		writeError(w, http.StatusNotFound, "not_found", "Snapshot not found in this project")
+		return nil
+	}
+	return snapshot
+}
+
+// GetSnapshotTrace returns the compiler trace stored with a snapshot.
+func (h *Handler) GetSnapshotTrace(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.loadProjectSnapshot(w, r)
+	if snapshot == nil {
+		return
+	}
+
+	t, err := trace.Parse(trace.ForSnapshot(snapshot))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to parse trace")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshotTraceResponse{SnapshotID: snapshot.ID, Trace: t})
+}
+
+// LookupTrace answers trace queries for a snapshot:
+//   - ?path=/requirements/functional/3 returns the answers that produced a spec path
+//   - ?answer_id=... or ?question_id=... returns the spec paths an answer influenced
+func (h *Handler) LookupTrace(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	answerID := r.URL.Query().Get("answer_id")
+	questionID := r.URL.Query().Get("question_id")
+
+	if path == "" && answerID == "" && questionID == "" {
+		writeError(w, http.StatusBadRequest, "missing_param", "path, answer_id, or question_id is required")
+		return
+	}
+	if path != "" && (answerID != "" || questionID != "") {
+		writeError(w, http.StatusBadRequest, "validation_error", "path cannot be combined with answer_id or question_id")
+		return
+	}
+
+	snapshot := h.loadProjectSnapshot(w, r)
+	if snapshot == nil {
+		return
+	}
+
+	t, err := trace.Parse(trace.ForSnapshot(snapshot))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to parse trace")
+		return
+	}
+
+	var entries []domain.TraceEntry
+	if path != "" {
+		entries = trace.SourcesForPath(t, path)
+	} else {
+		entries = trace.PathsForAnswer(t, answerID, questionID)
+	}
+
+	writeJSON(w, http.StatusOK, traceLookupResponse{SnapshotID: snapshot.ID, Entries: entries})
+}
+
 // Compilation
 
 type compileRequest struct {
 	Mode           string         `json:"mode"` // latest_answers or specific_answer_versions
 	AnswerVersions map[string]int `json:"answer_versions,omitempty"`
-	Provider       llm.Provider   `json:"provider,omitempty"` // Optional: override default provider
-	Model          string         `json:"model,omitempty"`    // Optional: override default model
+	Provider       llm.Provider   `json:"provider,omitempty"`    // Optional: override default provider
+	Model          string         `json:"model,omitempty"`       // Optional: override default model
+	Incremental    bool           `json:"incremental,omitempty"` // Optional: regenerate only sections affected by changed answers
+	// Optional: the snapshot the client expects to build on. The compile fails
+	// with 409 snapshot_conflict if a newer snapshot exists.
+	ParentSnapshotID *uuid.UUID `json:"parent_snapshot_id,omitempty"`
+	// Optional: compile with 2-5 models in parallel and merge their specs by
+	// majority vote. Provider and Model are ignored when set.
+	Ensemble []compiler.EnsembleMember `json:"ensemble,omitempty"`
+	// Optional: call the model even if the response cache has a response for
+	// the same request. The new response replaces the cached one.
+	NoCache bool `json:"no_cache,omitempty"`
+	// Optional: the prompt version to compile with, instead of the project's
+	PromptVersion llm.PromptVersion `json:"prompt_version,omitempty"`
 }
 
 type compileResponse struct {
-	SnapshotID uuid.UUID       `json:"snapshot_id"`
-	Issues     []*domain.Issue `json:"issues"`
+	SnapshotID         uuid.UUID           `json:"snapshot_id"`
+	Issues             []*domain.Issue     `json:"issues"`
+	AnswersNotIncluded []notIncludedAnswer `json:"answers_not_included"`
+}
+
+// notIncludedAnswer is an answer submitted while a compile ran that the
+// resulting snapshot was not derived from.
+type notIncludedAnswer struct {
+	QuestionID uuid.UUID `json:"question_id"`
+	AnswerID   uuid.UUID `json:"answer_id"`
+	Version    int       `json:"version"`
+}
+
+type snapshotConflictDetails struct {
+	LatestSnapshotID *uuid.UUID `json:"latest_snapshot_id"`
+}
+
+// snapshotConflictMessage explains a snapshot conflict and how to retry.
+func snapshotConflictMessage(latestID *uuid.UUID) string {
+	if latestID == nil {
+		return "The project has no snapshots; retry without parent_snapshot_id"
+	}
+	return fmt.Sprintf("Snapshot %s is now the latest; retry with it as parent_snapshot_id to compile on top of it", latestID)
+}
+
+// snapshotConflictError is a compile failure naming the latest snapshot.
+// Recompiling with it as parent_snapshot_id merges the current answers into
+// that snapshot.
+func snapshotConflictError(latestID *uuid.UUID) error {
+	return &jobs.Error{
+		Code:    "snapshot_conflict",
+		Message: snapshotConflictMessage(latestID),
+		Details: snapshotConflictDetails{LatestSnapshotID: latestID},
+	}
+}
+
+// sameSnapshot reports whether two optional snapshot IDs are equal.
+func sameSnapshot(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// answersNotIncluded returns the latest answers submitted since a compile
+// started that its snapshot was not derived from.
+func (h *Handler) answersNotIncluded(ctx context.Context, projectID uuid.UUID, derivedFrom map[uuid.UUID]int, since time.Time) []notIncludedAnswer {
+	result := []notIncludedAnswer{}
+	answers, err := h.repo.GetLatestAnswersForProject(ctx, projectID)
+	if err != nil {
+		log.Printf("Warning: failed to check answers not included in compile for %s: %v", projectID, err)
+		return result
+	}
+	// Timestamps are stored with second precision
+	since = since.Truncate(time.Second)
+	for _, a := range answers {
+		if a.CreatedAt.Before(since) {
+			continue
+		}
+		if v, ok := derivedFrom[a.QuestionID]; ok && v == a.Version {
+			continue
+		}
+		result = append(result, notIncludedAnswer{QuestionID: a.QuestionID, AnswerID: a.ID, Version: a.Version})
+	}
+	return result
+}
+
+// compileErrorStatus maps runCompile failure codes to HTTP statuses.
+// Codes not listed are internal errors.
+var compileErrorStatus = map[string]int{
+	"not_found":          http.StatusNotFound,
+	"validation_error":   http.StatusBadRequest,
+	"budget_exceeded":    http.StatusPaymentRequired,
+	"snapshot_conflict":  http.StatusConflict,
+	"version_mismatch":   http.StatusUnprocessableEntity,
+	"no_answers":         http.StatusUnprocessableEntity,
+	"validation_failed":  http.StatusUnprocessableEntity,
+	"compilation_failed": http.StatusUnprocessableEntity,
 }
 
 func (h *Handler) Compile(w http.ResponseWriter, r *http.Request) {
@@ -585,40 +851,112 @@ func (h *Handler) Compile(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
 		return
 	}
+	if err := validateEnsemble(req.Ensemble); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+	if err := h.checkPromptVersion(req.PromptVersion); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
 
-	// Get project
-	project, err := h.repo.GetProject(r.Context(), projectID)
+	result, err := h.runCompile(r.Context(), nil, projectID, req)
 	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			writeError(w, http.StatusNotFound, "not_found", "Project not found")
+		var jobErr *jobs.Error
+		if !errors.As(err, &jobErr) {
+			// The request ended while waiting for the compile lock
+			if r.Context().Err() != nil {
+				writeError(w, http.StatusServiceUnavailable, "request_canceled", "Request ended while waiting for another compile of this project")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get project")
+		status, ok := compileErrorStatus[jobErr.Code]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		writeJSON(w, status, errorResponse{Error: jobErr.Code, Message: jobErr.Message, Details: jobErr.Details})
 		return
 	}
 
-	// Get latest answers
-	answers, err := h.repo.GetLatestAnswersForProject(r.Context(), projectID)
+	writeJSON(w, http.StatusOK, compileResponse{
+		SnapshotID:         result.snapshotID,
+		Issues:             result.issues,
+		AnswersNotIncluded: result.AnswersNotIncluded,
+	})
+}
+
+// resolveCompileAnswers returns the answers a compile should use.
+// In latest_answers mode (the default) this is the latest version of every answer.
+// In specific_answer_versions mode, each pinned question_id -> version is resolved
+// through GetAnswerByVersion and replaces the latest answer for that question;
+// all other questions still use their latest answer.
+func (h *Handler) resolveCompileAnswers(ctx context.Context, projectID uuid.UUID, mode domain.CompileMode, versions map[string]int) ([]*domain.Answer, error) {
+	switch mode {
+	case "", domain.CompileModeLatestAnswers, domain.CompileModeSpecificAnswerVersions:
+	default:
+		return nil, fmt.Errorf("%w: unknown compile mode %q", domain.ErrInvalidInput, mode)
+	}
+
+	answers, err := h.repo.GetLatestAnswersForProject(ctx, projectID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get answers")
-		return
+		return nil, err
 	}
 
-	if len(answers) == 0 {
-		writeError(w, http.StatusUnprocessableEntity, "no_answers", "No answers to compile")
-		return
+	if mode != domain.CompileModeSpecificAnswerVersions {
+		return answers, nil
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: answer_versions is required when mode is %s", domain.ErrInvalidInput, domain.CompileModeSpecificAnswerVersions)
+	}
+
+	pinned := make(map[uuid.UUID]*domain.Answer, len(versions))
+	for qidStr, version := range versions {
+		qid, err := parseUUID(qidStr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid question ID %q in answer_versions", domain.ErrInvalidInput, qidStr)
+		}
+		if version < 1 {
+			return nil, fmt.Errorf("%w: answer version for question %s must be at least 1", domain.ErrInvalidInput, qid)
+		}
+		a, err := h.repo.GetAnswerByVersion(ctx, qid, version)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return nil, fmt.Errorf("%w: question %s has no answer version %d", domain.ErrVersionMismatch, qid, version)
+			}
+			return nil, err
+		}
+		if a.ProjectID != projectID {
+			return nil, fmt.Errorf("%w: question %s has no answer version %d", domain.ErrVersionMismatch, qid, version)
+		}
+		pinned[qid] = a
+	}
+
+	result := make([]*domain.Answer, 0, len(answers))
+	for _, a := range answers {
+		if p, ok := pinned[a.QuestionID]; ok {
+			result = append(result, p)
+			continue
+		}
+		result = append(result, a)
 	}
+	return result, nil
+}
 
+// buildQABundles loads the questions for the given answers and pairs them up.
+// Answers whose question no longer exists are skipped.
+func (h *Handler) buildQABundles(ctx context.Context, answers []*domain.Answer) ([]compiler.QABundle, error) {
 	// Collect question IDs and batch fetch questions
 	questionIDs := make([]uuid.UUID, len(answers))
 	for i, a := range answers {
 		questionIDs[i] = a.QuestionID
 	}
 
-	questions, err := h.repo.GetQuestionsByIDs(r.Context(), questionIDs)
+	questions, err := h.repo.GetQuestionsByIDs(ctx, questionIDs)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database_error", "Failed to load questions")
-		return
+		return nil, err
 	}
 
 	// Build question lookup map
@@ -627,7 +965,6 @@ func (h *Handler) Compile(w http.ResponseWriter, r *http.Request) {
 		questionMap[q.ID] = q
 	}
 
-	// Build Q&A bundles
 	qaBundles := make([]compiler.QABundle, 0, len(answers))
 	for _, a := range answers {
 		q, ok := questionMap[a.QuestionID]
@@ -645,111 +982,255 @@ func (h *Handler) Compile(w http.ResponseWriter, r *http.Request) {
 			AnswerVersion: a.Version,
 		})
 	}
+	return qaBundles, nil
+}
 
-	// Get current spec if exists
-	var currentSpec json.RawMessage
-	if latestID, _ := h.repo.GetLatestSnapshotID(r.Context(), projectID); latestID != nil {
-		if snap, err := h.repo.GetSnapshot(r.Context(), *latestID); err == nil {
-			currentSpec = snap.Spec
+// parseAnswerVersionsQuery parses the SSE answer_versions query parameter,
+// formatted as comma-separated "question_id:version" pairs.
+func parseAnswerVersionsQuery(s string) (map[string]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	versions := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		qid, v, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid answer_versions entry %q (expected question_id:version)", pair)
 		}
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid answer version %q for question %s", v, qid)
+		}
+		versions[qid] = version
 	}
+	return versions, nil
+}
 
-	// Compile
-	log.Printf("Compile: calling LLM with %d Q&A bundles (provider: %s, model: %s)", len(qaBundles), req.Provider, req.Model)
-	output, err := h.compiler.Compile(r.Context(), compiler.CompileInput{
-		Project:     project,
-		QABundles:   qaBundles,
-		CurrentSpec: currentSpec,
-		Provider:    req.Provider,
-		Model:       req.Model,
-	})
-	if err != nil {
-		log.Printf("Compile: LLM error: %v", err)
-		writeError(w, http.StatusUnprocessableEntity, "compilation_failed", err.Error())
-		return
+// parseEnsembleQuery parses the CompileStream ensemble param ("provider:model,...").
+func parseEnsembleQuery(s string) ([]compiler.EnsembleMember, error) {
+	if s == "" {
+		return nil, nil
 	}
-	log.Printf("Compile: LLM returned successfully")
-
-	// Create snapshot
-	now := time.Now().UTC()
-	snapshot := &domain.SpecSnapshot{
-		ID:          uuid.New(),
-		ProjectID:   projectID,
-		Spec:        output.Spec,
-		CreatedAt:   now,
-		DerivedFrom: output.DerivedFrom,
-		Compiler:    output.Compiler,
+	var members []compiler.EnsembleMember
+	for _, pair := range strings.Split(s, ",") {
+		provider, model, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid ensemble entry %q (expected provider:model)", pair)
+		}
+		members = append(members, compiler.EnsembleMember{Provider: llm.Provider(provider), Model: model})
 	}
+	return members, nil
+}
 
-	if err := h.repo.CreateSnapshot(r.Context(), snapshot); err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to save snapshot")
-		return
+// validateEnsemble checks an optional ensemble before a compile is queued.
+func validateEnsemble(members []compiler.EnsembleMember) error {
+	if len(members) == 0 {
+		return nil
 	}
+	if len(members) < 2 || len(members) > compiler.MaxEnsembleMembers {
+		return fmt.Errorf("ensemble needs 2 to %d models, got %d", compiler.MaxEnsembleMembers, len(members))
+	}
+	for _, m := range members {
+		if m.Provider == "" || m.Model == "" {
+			return fmt.Errorf("ensemble models need a provider and model")
+		}
+	}
+	return nil
+}
 
-	// Run validation and create issues
-	issueDrafts, err := h.compiler.Validate(r.Context(), project, output.Spec, output.Trace, qaBundles)
-	if err != nil {
-		log.Printf("Warning: spec validation failed for project %s: %v", projectID, err)
-		issueDrafts = nil
+// compileSpec runs a single-model compile, or an ensemble compile if members are given.
+func (h *Handler) compileSpec(ctx context.Context, input compiler.CompileInput, ensemble []compiler.EnsembleMember) (*compiler.CompileOutput, error) {
+	if len(ensemble) > 0 {
+		return h.compiler.CompileEnsemble(ctx, input, ensemble)
 	}
+	return h.compiler.Compile(ctx, input)
+}
 
-	issues := compiler.HydrateIssues(issueDrafts, projectID, snapshot.ID)
-	for _, issue := range issues {
-		if err := h.repo.CreateIssue(r.Context(), issue); err != nil {
-			log.Printf("Warning: failed to save issue %s for snapshot %s: %v", issue.ID, snapshot.ID, err)
+// streamMessage describes a token progress update, e.g.
+// "Writing api... (1200 tokens)", a retry of a failed LLM call, a cache hit,
+// or inputs trimmed to fit the model's context window.
+func streamMessage(p compiler.StreamProgress) string {
+	msg := fmt.Sprintf("Generating... (%d tokens)", p.Tokens)
+	if t := p.Trimmed; t != nil {
+		msg = fmt.Sprintf("Trimmed the inputs to fit the model's %d-token context window: %s", t.ContextWindow, trimSummary(t))
+	} else if p.Cached {
+		msg = "Using cached response for an identical request"
+	} else if r := p.Retry; r != nil && r.Fallback != "" {
+		msg = fmt.Sprintf("%s/%s call failed (%v); falling back to %s...", r.Provider, r.Model, r.Err, r.Fallback)
+	} else if r != nil {
+		msg = fmt.Sprintf("%s call failed (%v); retrying in %s (attempt %d of %d)...",
+			r.Provider, r.Err, r.Delay.Round(100*time.Millisecond), r.Attempt+1, r.MaxAttempts)
+	} else if p.Section != "" {
+		msg = fmt.Sprintf("Writing %s... (%d tokens)", p.Section, p.Tokens)
+	}
+	if p.Model != "" {
+		msg = p.Model + ": " + msg
+	}
+	return msg
+}
+
+// trimSummary lists what was cut from each input, e.g. "answers: 3
+// summarized, 12 dropped; spec: left out api, ui".
+func trimSummary(t *compiler.ContextTrim) string {
+	parts := make([]string, 0, len(t.Inputs))
+	for _, in := range t.Inputs {
+		if in.Name == "spec" {
+			parts = append(parts, "spec: left out "+strings.Join(in.Sections, ", "))
+			continue
+		}
+		var cuts []string
+		if in.Summarized > 0 {
+			cuts = append(cuts, fmt.Sprintf("%d summarized", in.Summarized))
 		}
+		if in.Dropped > 0 {
+			cuts = append(cuts, fmt.Sprintf("%d dropped", in.Dropped))
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s of %d", strings.ReplaceAll(in.Name, "_", " "), strings.Join(cuts, ", "), in.Total))
 	}
+	return strings.Join(parts, "; ")
+}
 
-	// Update project timestamp
-	project.UpdatedAt = now
-	if err := h.repo.UpdateProject(r.Context(), project); err != nil {
-		log.Printf("Warning: failed to update project timestamp for %s: %v", projectID, err)
-	}
+// retryNotice describes a failed LLM call that is about to be retried, or
+// to fail over to the next model in the fallback chain.
+type retryNotice struct {
+	Attempt     int    `json:"attempt"`            // The attempt that failed, from 1
+	MaxAttempts int    `json:"max_attempts"`       // Attempts allowed per call
+	DelayMs     int64  `json:"delay_ms"`           // Wait before the next attempt
+	Error       string `json:"error"`              // Why the attempt failed
+	Fallback    string `json:"fallback,omitempty"` // Set when failing over to another model ("provider/model")
+}
 
-	writeJSON(w, http.StatusOK, compileResponse{
-		SnapshotID: snapshot.ID,
-		Issues:     issues,
-	})
+func newRetryNotice(p compiler.StreamProgress) *retryNotice {
+	if p.Retry == nil {
+		return nil
+	}
+	return &retryNotice{
+		Attempt:     p.Retry.Attempt,
+		MaxAttempts: p.Retry.MaxAttempts,
+		DelayMs:     p.Retry.Delay.Milliseconds(),
+		Error:       p.Retry.Err.Error(),
+		Fallback:    p.Retry.Fallback,
+	}
 }
 
 // CompileStream handles compilation with SSE progress updates.
 // SSE event types: "stage" for progress, "complete" for success, "fail" for failure
 // Note: We use "fail" instead of "error" because "error" is reserved in the EventSource API
 type compileStageEvent struct {
-	Stage      string  `json:"stage"`                 // "preparing", "compiling", "saving", "validating", "complete"
+	Stage      string  `json:"stage"`                 // "preparing", "compiling", "repairing", "merging", "saving", "validating", "complete"
 	Message    string  `json:"message"`               // Human-readable description
 	ElapsedMs  int64   `json:"elapsed_ms"`            // Time elapsed for this stage
 	TotalMs    int64   `json:"total_ms"`              // Total time elapsed since start
 	SnapshotID *string `json:"snapshot_id,omitempty"` // Set when complete
 	IssueCount *int    `json:"issue_count,omitempty"` // Set when complete
+
+	// Set on progress events sent while the model streams its output
+	Tokens  int    `json:"tokens,omitempty"`  // Output tokens generated so far
+	Section string `json:"section,omitempty"` // Spec section being written
+	Model   string `json:"model,omitempty"`   // Ensemble member writing the output
+
+	Retry  *retryNotice `json:"retry,omitempty"`  // Set when a failed LLM call is being retried
+	Cached bool         `json:"cached,omitempty"` // Set when an LLM response came from the response cache
+
+	AnswersNotIncluded []notIncludedAnswer `json:"answers_not_included,omitempty"` // Set when complete
 }
 
 func (h *Handler) CompileStream(w http.ResponseWriter, r *http.Request) {
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	flusher, ok := w.(http.Flusher)
+	sse, ok := newSSEWriter(w)
 	if !ok {
-		http.Error(w, "SSE not supported", http.StatusInternalServerError)
 		return
 	}
 
-	// Helper to send SSE event
-	sendEvent := func(eventType string, data interface{}) {
-		jsonData, _ := json.Marshal(data)
-		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonData)
-		flusher.Flush()
+	// Parse project ID
+	idStr := r.PathValue("projectId")
+	projectID, err := parseUUID(idStr)
+	if err != nil {
+		sse.send("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid project ID format"})
+		return
 	}
 
+	// A reconnecting client resumes its job instead of starting another compile
+	if h.resumeJob(sse, r, projectID, domain.JobKindCompile) {
+		return
+	}
+
+	// Parse query params for compile mode (answer_versions format: "question_id:version,...")
+	answerVersions, err := parseAnswerVersionsQuery(r.URL.Query().Get("answer_versions"))
+	if err != nil {
+		sse.send("fail", map[string]string{"error": "validation_error", "message": err.Error()})
+		return
+	}
+	incremental, _ := strconv.ParseBool(r.URL.Query().Get("incremental"))
+	noCache, _ := strconv.ParseBool(r.URL.Query().Get("no_cache"))
+	promptVersion := llm.PromptVersion(r.URL.Query().Get("prompt_version"))
+	ensemble, err := parseEnsembleQuery(r.URL.Query().Get("ensemble"))
+	if err == nil {
+		err = validateEnsemble(ensemble)
+	}
+	if err == nil {
+		err = h.checkPromptVersion(promptVersion)
+	}
+	if err != nil {
+		sse.send("fail", map[string]string{"error": "validation_error", "message": err.Error()})
+		return
+	}
+
+	params := compileRequest{
+		Mode:           r.URL.Query().Get("mode"),
+		AnswerVersions: answerVersions,
+		Provider:       llm.Provider(r.URL.Query().Get("provider")),
+		Model:          r.URL.Query().Get("model"),
+		Incremental:    incremental,
+		Ensemble:       ensemble,
+		NoCache:        noCache,
+		PromptVersion:  promptVersion,
+	}
+	if p := r.URL.Query().Get("parent_snapshot_id"); p != "" {
+		parentID, err := parseUUID(p)
+		if err != nil {
+			sse.send("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid parent_snapshot_id format"})
+			return
+		}
+		params.ParentSnapshotID = &parentID
+	}
+
+	if h.compiler == nil {
+		sse.send("fail", map[string]string{"error": "service_unavailable", "message": "Compilation service not configured"})
+		return
+	}
+
+	if _, err := h.repo.GetProject(r.Context(), projectID); err != nil {
+		sse.send("fail", map[string]string{"error": "not_found", "message": "Project not found"})
+		return
+	}
+
+	queued := compileStageEvent{Stage: "preparing", Message: "Waiting for another job on this project to finish..."}
+	h.startJob(sse, r, projectID, domain.JobKindCompile, params, queued, func(ctx context.Context, emit jobs.EmitFunc) (any, error) {
+		return h.runCompile(ctx, emit, projectID, params)
+	})
+}
+
+// compileResult is the outcome of runCompile: the "complete" event payload,
+// plus what the synchronous compile response needs.
+type compileResult struct {
+	compileStageEvent
+	snapshotID uuid.UUID
+	issues     []*domain.Issue
+}
+
+// runCompile compiles a project for both the synchronous and the streaming
+// endpoints, emitting stage events as it goes if emit is set. Failures are
+// *jobs.Error values, except when ctx ends while waiting for the compile lock.
+func (h *Handler) runCompile(ctx context.Context, emit jobs.EmitFunc, projectID uuid.UUID, params compileRequest) (*compileResult, error) {
 	startTime := time.Now()
 	stageStart := startTime
 
 	sendStage := func(stage, message string) {
+		if emit == nil {
+			return
+		}
 		now := time.Now()
-		sendEvent("stage", compileStageEvent{
+		emit("stage", compileStageEvent{
 			Stage:     stage,
 			Message:   message,
 			ElapsedMs: now.Sub(stageStart).Milliseconds(),
@@ -757,101 +1238,117 @@ func (h *Handler) CompileStream(w http.ResponseWriter, r *http.Request) {
 		})
 		stageStart = now
 	}
-
-	// Parse project ID
-	idStr := r.PathValue("projectId")
-	projectID, err := parseUUID(idStr)
-	if err != nil {
-		sendEvent("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid project ID format"})
-		return
+	// Token progress and retries while the model runs; stays within the current stage.
+	// Without it the model's output is not streamed.
+	var sendTokens compiler.StreamFunc
+	if emit != nil {
+		sendTokens = func(p compiler.StreamProgress) {
+			now := time.Now()
+			emit("stage", compileStageEvent{
+				Stage:     p.Stage,
+				Message:   streamMessage(p),
+				ElapsedMs: now.Sub(stageStart).Milliseconds(),
+				TotalMs:   now.Sub(startTime).Milliseconds(),
+				Tokens:    p.Tokens,
+				Section:   p.Section,
+				Model:     p.Model,
+				Retry:     newRetryNotice(p),
+				Cached:    p.Cached,
+			})
+		}
 	}
 
-	// Parse query params for provider/model
-	provider := llm.Provider(r.URL.Query().Get("provider"))
-	model := r.URL.Query().Get("model")
-
 	// Stage 1: Preparing
 	sendStage("preparing", "Loading project and answers...")
 
-	if h.compiler == nil {
-		sendEvent("fail", map[string]string{"error": "service_unavailable", "message": "Compilation service not configured"})
-		return
-	}
-
-	project, err := h.repo.GetProject(r.Context(), projectID)
+	project, err := h.repo.GetProject(ctx, projectID)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "not_found", "message": "Project not found"})
-		return
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, jobs.Fail("not_found", "Project not found")
+		}
+		return nil, jobs.Fail("internal_error", "Failed to get project")
 	}
 
-	answers, err := h.repo.GetLatestAnswersForProject(r.Context(), projectID)
+	// Serialize compiles per project so each one builds on the previous snapshot
+	unlock, err := h.compileLocks.Lock(ctx, projectID)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "internal_error", "message": "Failed to get answers"})
-		return
+		return nil, err
 	}
+	defer unlock()
+	compileStart := time.Now().UTC()
 
-	if len(answers) == 0 {
-		sendEvent("fail", map[string]string{"error": "no_answers", "message": "No answers to compile"})
-		return
+	budgets := h.currentBudgets(ctx, project)
+	if status := exhaustedBudget(budgets); status != nil {
+		return nil, budgetJobError(status)
 	}
-
-	// Collect question IDs and batch fetch questions
-	questionIDs := make([]uuid.UUID, len(answers))
-	for i, a := range answers {
-		questionIDs[i] = a.QuestionID
+	ctx, usage := h.trackUsage(ctx, projectID, budgets)
+	defer usage.save(ctx, h.repo, nil)
+	if params.NoCache {
+		ctx = llm.WithoutCache(ctx)
 	}
 
-	questions, err := h.repo.GetQuestionsByIDs(r.Context(), questionIDs)
+	answers, err := h.resolveCompileAnswers(ctx, projectID, domain.CompileMode(params.Mode), params.AnswerVersions)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "database_error", "message": "Failed to load questions"})
-		return
+		switch {
+		case errors.Is(err, domain.ErrVersionMismatch):
+			return nil, jobs.Fail("version_mismatch", err.Error())
+		case errors.Is(err, domain.ErrInvalidInput):
+			return nil, jobs.Fail("validation_error", err.Error())
+		default:
+			return nil, jobs.Fail("internal_error", "Failed to get answers")
+		}
 	}
 
-	// Build question lookup map
-	questionMap := make(map[uuid.UUID]*domain.Question, len(questions))
-	for _, q := range questions {
-		questionMap[q.ID] = q
+	if len(answers) == 0 {
+		return nil, jobs.Fail("no_answers", "No answers to compile")
 	}
 
-	// Build Q&A bundles
-	qaBundles := make([]compiler.QABundle, 0, len(answers))
-	for _, a := range answers {
-		q, ok := questionMap[a.QuestionID]
-		if !ok {
-			continue
-		}
-		qaBundles = append(qaBundles, compiler.QABundle{
-			QuestionID:    q.ID,
-			QuestionText:  q.Text,
-			QuestionType:  string(q.Type),
-			QuestionTags:  q.Tags,
-			QuestionPaths: q.SpecPaths,
-			AnswerID:      a.ID,
-			AnswerValue:   a.Value,
-			AnswerVersion: a.Version,
-		})
+	qaBundles, err := h.buildQABundles(ctx, answers)
+	if err != nil {
+		return nil, jobs.Fail("database_error", "Failed to load questions")
 	}
 
-	var currentSpec json.RawMessage
-	if latestID, _ := h.repo.GetLatestSnapshotID(r.Context(), projectID); latestID != nil {
-		if snap, err := h.repo.GetSnapshot(r.Context(), *latestID); err == nil {
+	var currentSpec, previousTrace json.RawMessage
+	var previousDerivedFrom map[uuid.UUID]int
+	latestID, _ := h.repo.GetLatestSnapshotID(ctx, projectID)
+	if params.ParentSnapshotID != nil && !sameSnapshot(params.ParentSnapshotID, latestID) {
+		return nil, snapshotConflictError(latestID)
+	}
+	if latestID != nil {
+		if snap, err := h.repo.GetSnapshot(ctx, *latestID); err == nil {
 			currentSpec = snap.Spec
+			previousDerivedFrom = snap.DerivedFrom
+			previousTrace = trace.ForSnapshot(snap)
 		}
 	}
 
 	// Stage 2: Compiling
 	sendStage("compiling", fmt.Sprintf("Generating spec from %d Q&A pairs...", len(qaBundles)))
+	log.Printf("Compile: calling LLM with %d Q&A bundles (provider: %s, model: %s, ensemble: %d)", len(qaBundles), params.Provider, params.Model, len(params.Ensemble))
 
-	output, err := h.compiler.Compile(r.Context(), compiler.CompileInput{
+	output, err := h.compileSpec(ctx, compiler.CompileInput{
 		Project:     project,
 		QABundles:   qaBundles,
 		CurrentSpec: currentSpec,
-		Provider:    provider,
-		Model:       model,
-	})
+		Provider:    params.Provider,
+		Model:       params.Model,
+		Progress:    sendStage,
+		Stream:      sendTokens,
+
+		PromptVersion:       params.PromptVersion,
+		Incremental:         params.Incremental,
+		PreviousDerivedFrom: previousDerivedFrom,
+		PreviousTrace:       previousTrace,
+	}, params.Ensemble)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "compilation_failed", "message": err.Error()})
-		return
+		log.Printf("Compile: LLM error: %v", err)
+		if status := refusedBudget(err); status != nil {
+			return nil, budgetJobError(status)
+		}
+		if errors.Is(err, domain.ErrValidationFailed) {
+			return nil, jobs.Fail("validation_failed", err.Error())
+		}
+		return nil, jobs.Fail("compilation_failed", err.Error())
 	}
 
 	// Stage 3: Saving
@@ -859,51 +1356,79 @@ func (h *Handler) CompileStream(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now().UTC()
 	snapshot := &domain.SpecSnapshot{
-		ID:          uuid.New(),
-		ProjectID:   projectID,
-		Spec:        output.Spec,
-		CreatedAt:   now,
-		DerivedFrom: output.DerivedFrom,
-		Compiler:    output.Compiler,
-	}
-
-	if err := h.repo.CreateSnapshot(r.Context(), snapshot); err != nil {
-		sendEvent("fail", map[string]string{"error": "internal_error", "message": "Failed to save snapshot"})
-		return
+		ID:               uuid.New(),
+		ProjectID:        projectID,
+		ParentSnapshotID: latestID,
+		Spec:             output.Spec,
+		CreatedAt:        now,
+		DerivedFrom:      output.DerivedFrom,
+		Compiler:         output.Compiler,
+		Trace:            output.Trace,
+	}
+
+	if err := h.repo.CreateSnapshot(ctx, snapshot); err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			// Another server process saved a snapshot while this compile ran
+			latestID, _ := h.repo.GetLatestSnapshotID(ctx, projectID)
+			return nil, snapshotConflictError(latestID)
+		}
+		return nil, jobs.Fail("internal_error", "Failed to save snapshot")
 	}
 
 	// Stage 4: Validating
 	sendStage("validating", "Analyzing specification for issues...")
 
-	issueDrafts, err := h.compiler.Validate(r.Context(), project, output.Spec, output.Trace, qaBundles)
+	issueDrafts, err := h.compiler.Validate(ctx, compiler.ValidateInput{
+		Project:       project,
+		Spec:          output.Spec,
+		Trace:         output.Trace,
+		QABundles:     qaBundles,
+		Provider:      params.Provider,
+		Model:         params.Model,
+		PromptVersion: llm.PromptVersion(output.Compiler.PromptVersion),
+	})
 	if err != nil {
 		log.Printf("Warning: spec validation failed for project %s: %v", projectID, err)
 		issueDrafts = nil // Validation is optional
 	}
+	issueDrafts = append(compiler.SchemaIssueDrafts(output.Validation.Errors), issueDrafts...)
+	issueDrafts = append(issueDrafts, compiler.TraceIssueDrafts(output.Spec, output.Trace, qaBundles)...)
+	issueDrafts = append(issueDrafts, lint.Spec(output.Spec)...)
+	issueDrafts = append(issueDrafts, output.Disagreements...)
+
+	// Save usage first so budget warnings count this compile
+	usage.save(ctx, h.repo, &snapshot.ID)
+	issueDrafts = append(issueDrafts, h.budgetIssueDrafts(ctx, project)...)
 
 	issues := compiler.HydrateIssues(issueDrafts, projectID, snapshot.ID)
 	for _, issue := range issues {
-		if err := h.repo.CreateIssue(r.Context(), issue); err != nil {
+		if err := h.repo.CreateIssue(ctx, issue); err != nil {
 			log.Printf("Warning: failed to save issue %s for snapshot %s: %v", issue.ID, snapshot.ID, err)
 		}
 	}
 
 	project.UpdatedAt = now
-	if err := h.repo.UpdateProject(r.Context(), project); err != nil {
+	if err := h.repo.UpdateProject(ctx, project); err != nil {
 		log.Printf("Warning: failed to update project timestamp for %s: %v", projectID, err)
 	}
 
 	// Stage 5: Complete
 	snapshotIDStr := snapshot.ID.String()
 	issueCount := len(issues)
-	sendEvent("complete", compileStageEvent{
-		Stage:      "complete",
-		Message:    fmt.Sprintf("Compilation complete with %d issues", issueCount),
-		ElapsedMs:  time.Since(stageStart).Milliseconds(),
-		TotalMs:    time.Since(startTime).Milliseconds(),
-		SnapshotID: &snapshotIDStr,
-		IssueCount: &issueCount,
-	})
+	return &compileResult{
+		compileStageEvent: compileStageEvent{
+			Stage:      "complete",
+			Message:    fmt.Sprintf("Compilation complete with %d issues", issueCount),
+			ElapsedMs:  time.Since(stageStart).Milliseconds(),
+			TotalMs:    time.Since(startTime).Milliseconds(),
+			SnapshotID: &snapshotIDStr,
+			IssueCount: &issueCount,
+
+			AnswersNotIncluded: h.answersNotIncluded(ctx, projectID, snapshot.DerivedFrom, compileStart),
+		},
+		snapshotID: snapshot.ID,
+		issues:     issues,
+	}, nil
 }
 
 // Next Questions
@@ -971,8 +1496,16 @@ func (h *Handler) GenerateNextQuestions(w http.ResponseWriter, r *http.Request)
 		currentIssues, _ = h.repo.ListIssuesForSnapshot(r.Context(), *latestID)
 	}
 
+	budgets := h.currentBudgets(r.Context(), project)
+	if status := exhaustedBudget(budgets); status != nil {
+		writeBudgetExceeded(w, status)
+		return
+	}
+	ctx, usage := h.trackUsage(r.Context(), projectID, budgets)
+	defer usage.save(ctx, h.repo, nil)
+
 	// Run planner
-	planOutput, err := h.compiler.Plan(r.Context(), compiler.PlanInput{
+	planOutput, err := h.compiler.Plan(ctx, compiler.PlanInput{
 		Project:           project,
 		CurrentSpec:       currentSpec,
 		CurrentIssues:     currentIssues,
@@ -981,12 +1514,16 @@ func (h *Handler) GenerateNextQuestions(w http.ResponseWriter, r *http.Request)
 		Mode:              mode,
 	})
 	if err != nil {
+		if status := refusedBudget(err); status != nil {
+			writeBudgetExceeded(w, status)
+			return
+		}
 		writeError(w, http.StatusUnprocessableEntity, "planner_failed", err.Error())
 		return
 	}
 
 	// Run asker with planner suggestions
-	askOutput, err := h.compiler.Ask(r.Context(), compiler.AskInput{
+	askOutput, err := h.compiler.Ask(ctx, compiler.AskInput{
 		Project:            project,
 		PlannerSuggestions: planOutput.Suggestions,
 		CurrentSpec:        currentSpec,
@@ -995,6 +1532,10 @@ func (h *Handler) GenerateNextQuestions(w http.ResponseWriter, r *http.Request)
 		Mode:               mode,
 	})
 	if err != nil {
+		if status := refusedBudget(err); status != nil {
+			writeBudgetExceeded(w, status)
+			return
+		}
 		writeError(w, http.StatusUnprocessableEntity, "asker_failed", err.Error())
 		return
 	}
@@ -1032,6 +1573,7 @@ func (h *Handler) GenerateNextQuestions(w http.ResponseWriter, r *http.Request)
 		}
 		newQuestions = append(newQuestions, q)
 	}
+	usage.linkQuestions(newQuestions)
 
 	writeJSON(w, http.StatusOK, nextQuestionsResponse{Questions: newQuestions})
 }
@@ -1045,34 +1587,76 @@ type nextQuestionsStageEvent struct {
 	ElapsedMs     int64  `json:"elapsed_ms"`               // Time elapsed for this stage
 	TotalMs       int64  `json:"total_ms"`                 // Total time elapsed since start
 	QuestionCount *int   `json:"question_count,omitempty"` // Set when complete
+	Tokens        int    `json:"tokens,omitempty"`         // Output tokens generated so far, while streaming
+	Section       string `json:"section,omitempty"`        // Output section being written, while streaming
+
+	Retry   *retryNotice          `json:"retry,omitempty"`   // Set when a failed LLM call is being retried
+	Cached  bool                  `json:"cached,omitempty"`  // Set when an LLM response came from the response cache
+	Trimmed *compiler.ContextTrim `json:"trimmed,omitempty"` // Set when LLM inputs were cut to fit the model's context window
 }
 
-func (h *Handler) NextQuestionsStream(w http.ResponseWriter, r *http.Request) {
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+// nextQuestionsJobParams records the parameters of a next-questions job.
+type nextQuestionsJobParams struct {
+	Count    int          `json:"count"`
+	Provider llm.Provider `json:"provider,omitempty"`
+	Model    string       `json:"model,omitempty"`
+}
 
-	flusher, ok := w.(http.Flusher)
+func (h *Handler) NextQuestionsStream(w http.ResponseWriter, r *http.Request) {
+	sse, ok := newSSEWriter(w)
 	if !ok {
-		http.Error(w, "SSE not supported", http.StatusInternalServerError)
 		return
 	}
 
-	// Helper to send SSE event
-	sendEvent := func(eventType string, data interface{}) {
-		jsonData, _ := json.Marshal(data)
-		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonData)
-		flusher.Flush()
+	// Parse project ID
+	idStr := r.PathValue("projectId")
+	projectID, err := parseUUID(idStr)
+	if err != nil {
+		sse.send("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid project ID format"})
+		return
+	}
+
+	if h.resumeJob(sse, r, projectID, domain.JobKindNextQuestions) {
+		return
 	}
 
+	// Parse query params
+	params := nextQuestionsJobParams{
+		Count:    5,
+		Provider: llm.Provider(r.URL.Query().Get("provider")),
+		Model:    r.URL.Query().Get("model"),
+	}
+	if c := r.URL.Query().Get("count"); c != "" {
+		if parsed, err := strconv.Atoi(c); err == nil && parsed > 0 && parsed <= 50 {
+			params.Count = parsed
+		}
+	}
+
+	if h.compiler == nil {
+		sse.send("fail", map[string]string{"error": "service_unavailable", "message": "LLM service not configured"})
+		return
+	}
+
+	if _, err := h.repo.GetProject(r.Context(), projectID); err != nil {
+		sse.send("fail", map[string]string{"error": "not_found", "message": "Project not found"})
+		return
+	}
+
+	queued := nextQuestionsStageEvent{Stage: "preparing", Message: "Waiting for another job on this project to finish..."}
+	h.startJob(sse, r, projectID, domain.JobKindNextQuestions, params, queued, func(ctx context.Context, emit jobs.EmitFunc) (any, error) {
+		return h.runNextQuestions(ctx, emit, projectID, params)
+	})
+}
+
+// runNextQuestions performs a next-questions job. Its result is the
+// "complete" event payload.
+func (h *Handler) runNextQuestions(ctx context.Context, emit jobs.EmitFunc, projectID uuid.UUID, params nextQuestionsJobParams) (any, error) {
 	startTime := time.Now()
 	stageStart := startTime
 
 	sendStage := func(stage, message string) {
 		now := time.Now()
-		sendEvent("stage", nextQuestionsStageEvent{
+		emit("stage", nextQuestionsStageEvent{
 			Stage:     stage,
 			Message:   message,
 			ElapsedMs: now.Sub(stageStart).Milliseconds(),
@@ -1080,37 +1664,28 @@ func (h *Handler) NextQuestionsStream(w http.ResponseWriter, r *http.Request) {
 		})
 		stageStart = now
 	}
-
-	// Parse project ID
-	idStr := r.PathValue("projectId")
-	projectID, err := parseUUID(idStr)
-	if err != nil {
-		sendEvent("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid project ID format"})
-		return
-	}
-
-	// Parse query params
-	count := 5
-	if c := r.URL.Query().Get("count"); c != "" {
-		if parsed, err := strconv.Atoi(c); err == nil && parsed > 0 && parsed <= 50 {
-			count = parsed
-		}
+	// Token progress and retries while the model runs; stays within the current stage
+	sendTokens := func(p compiler.StreamProgress) {
+		now := time.Now()
+		emit("stage", nextQuestionsStageEvent{
+			Stage:     p.Stage,
+			Message:   streamMessage(p),
+			ElapsedMs: now.Sub(stageStart).Milliseconds(),
+			TotalMs:   now.Sub(startTime).Milliseconds(),
+			Tokens:    p.Tokens,
+			Section:   p.Section,
+			Retry:     newRetryNotice(p),
+			Cached:    p.Cached,
+			Trimmed:   p.Trimmed,
+		})
 	}
-	provider := llm.Provider(r.URL.Query().Get("provider"))
-	model := r.URL.Query().Get("model")
 
 	// Stage 1: Preparing
 	sendStage("preparing", "Loading project and existing questions...")
 
-	if h.compiler == nil {
-		sendEvent("fail", map[string]string{"error": "service_unavailable", "message": "LLM service not configured"})
-		return
-	}
-
-	project, err := h.repo.GetProject(r.Context(), projectID)
+	project, err := h.repo.GetProject(ctx, projectID)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "not_found", "message": "Project not found"})
-		return
+		return nil, jobs.Fail("not_found", "Project not found")
 	}
 
 	// Convert project mode to compiler mode
@@ -1120,62 +1695,75 @@ func (h *Handler) NextQuestionsStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get existing questions and answers
-	questions, _ := h.repo.ListQuestions(r.Context(), projectID, nil, nil)
-	answers, _ := h.repo.GetLatestAnswersForProject(r.Context(), projectID)
+	questions, _ := h.repo.ListQuestions(ctx, projectID, nil, nil)
+	answers, _ := h.repo.GetLatestAnswersForProject(ctx, projectID)
 
 	// Get current spec and issues
 	var currentSpec json.RawMessage
 	var currentIssues []*domain.Issue
-	if latestID, _ := h.repo.GetLatestSnapshotID(r.Context(), projectID); latestID != nil {
-		if snap, err := h.repo.GetSnapshot(r.Context(), *latestID); err == nil {
+	if latestID, _ := h.repo.GetLatestSnapshotID(ctx, projectID); latestID != nil {
+		if snap, err := h.repo.GetSnapshot(ctx, *latestID); err == nil {
 			currentSpec = snap.Spec
 		}
-		currentIssues, _ = h.repo.ListIssuesForSnapshot(r.Context(), *latestID)
+		currentIssues, _ = h.repo.ListIssuesForSnapshot(ctx, *latestID)
+	}
+
+	budgets := h.currentBudgets(ctx, project)
+	if status := exhaustedBudget(budgets); status != nil {
+		return nil, budgetJobError(status)
 	}
+	ctx, usage := h.trackUsage(ctx, projectID, budgets)
+	defer usage.save(ctx, h.repo, nil)
 
 	// Stage 2: Planning
 	sendStage("planning", "Analyzing spec gaps and prioritizing questions...")
 
-	planOutput, err := h.compiler.Plan(r.Context(), compiler.PlanInput{
+	planOutput, err := h.compiler.Plan(ctx, compiler.PlanInput{
 		Project:           project,
 		CurrentSpec:       currentSpec,
 		CurrentIssues:     currentIssues,
 		ExistingQuestions: questions,
 		LatestAnswers:     answers,
 		Mode:              mode,
-		Provider:          provider,
-		Model:             model,
+		Provider:          params.Provider,
+		Model:             params.Model,
+		Stream:            sendTokens,
 	})
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "planner_failed", "message": err.Error()})
-		return
+		if status := refusedBudget(err); status != nil {
+			return nil, budgetJobError(status)
+		}
+		return nil, jobs.Fail("planner_failed", err.Error())
 	}
 
 	// Stage 3: Asking
 	sendStage("asking", "Generating clarifying questions...")
 
-	askOutput, err := h.compiler.Ask(r.Context(), compiler.AskInput{
+	askOutput, err := h.compiler.Ask(ctx, compiler.AskInput{
 		Project:            project,
 		PlannerSuggestions: planOutput.Suggestions,
 		CurrentSpec:        currentSpec,
 		ExistingQuestions:  questions,
 		LatestAnswers:      answers,
 		Mode:               mode,
-		Provider:           provider,
-		Model:              model,
+		Provider:           params.Provider,
+		Model:              params.Model,
+		Stream:             sendTokens,
 	})
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "asker_failed", "message": err.Error()})
-		return
+		if status := refusedBudget(err); status != nil {
+			return nil, budgetJobError(status)
+		}
+		return nil, jobs.Fail("asker_failed", err.Error())
 	}
 
 	// Stage 4: Saving
 	sendStage("saving", "Persisting new questions...")
 
 	now := time.Now().UTC()
-	newQuestions := make([]*domain.Question, 0, count)
+	newQuestions := make([]*domain.Question, 0, params.Count)
 	for i, aq := range askOutput.Questions {
-		if i >= count {
+		if i >= params.Count {
 			break
 		}
 
@@ -1199,21 +1787,22 @@ func (h *Handler) NextQuestionsStream(w http.ResponseWriter, r *http.Request) {
 			CreatedAt: now,
 		}
 
-		if err := h.repo.CreateQuestion(r.Context(), q); err != nil {
+		if err := h.repo.CreateQuestion(ctx, q); err != nil {
 			continue
 		}
 		newQuestions = append(newQuestions, q)
 	}
+	usage.linkQuestions(newQuestions)
 
 	// Stage 5: Complete
 	questionCount := len(newQuestions)
-	sendEvent("complete", nextQuestionsStageEvent{
+	return nextQuestionsStageEvent{
 		Stage:         "complete",
 		Message:       fmt.Sprintf("Generated %d new questions", questionCount),
 		ElapsedMs:     time.Since(stageStart).Milliseconds(),
 		TotalMs:       time.Since(startTime).Milliseconds(),
 		QuestionCount: &questionCount,
-	})
+	}, nil
 }
 
 // Suggestions
@@ -1230,6 +1819,11 @@ type suggestionItem struct {
 }
 
 func (h *Handler) GenerateSuggestions(w http.ResponseWriter, r *http.Request) {
+	if h.compiler == nil {
+		writeError(w, http.StatusServiceUnavailable, "service_unavailable", "LLM service not configured")
+		return
+	}
+
 	projectIDStr := r.PathValue("projectId")
 	projectID, err := parseUUID(projectIDStr)
 	if err != nil {
@@ -1288,8 +1882,16 @@ func (h *Handler) GenerateSuggestions(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	budgets := h.currentBudgets(r.Context(), project)
+	if status := exhaustedBudget(budgets); status != nil {
+		writeBudgetExceeded(w, status)
+		return
+	}
+	ctx, usage := h.trackUsage(r.Context(), projectID, budgets)
+	defer usage.save(ctx, h.repo, nil)
+
 	// Call suggester
-	suggestOutput, err := h.compiler.Suggest(r.Context(), compiler.SuggestInput{
+	suggestOutput, err := h.compiler.Suggest(ctx, compiler.SuggestInput{
 		Project:             project,
 		UnansweredQuestions: unanswered,
 		LatestAnswers:       answers,
@@ -1299,6 +1901,10 @@ func (h *Handler) GenerateSuggestions(w http.ResponseWriter, r *http.Request) {
 		Model:               model,
 	})
 	if err != nil {
+		if status := refusedBudget(err); status != nil {
+			writeBudgetExceeded(w, status)
+			return
+		}
 		writeError(w, http.StatusUnprocessableEntity, "suggester_failed", err.Error())
 		return
 	}
@@ -1327,34 +1933,68 @@ type suggestionsStageEvent struct {
 	TotalMs         int64            `json:"total_ms"`                   // Total time elapsed since start
 	SuggestionCount *int             `json:"suggestion_count,omitempty"` // Set when complete
 	Suggestions     []suggestionItem `json:"suggestions,omitempty"`      // Set when complete
+	Tokens          int              `json:"tokens,omitempty"`           // Output tokens generated so far, while streaming
+
+	Retry   *retryNotice          `json:"retry,omitempty"`   // Set when a failed LLM call is being retried
+	Cached  bool                  `json:"cached,omitempty"`  // Set when an LLM response came from the response cache
+	Trimmed *compiler.ContextTrim `json:"trimmed,omitempty"` // Set when LLM inputs were cut to fit the model's context window
 }
 
-func (h *Handler) SuggestionsStream(w http.ResponseWriter, r *http.Request) {
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+// suggestionsJobParams records the parameters of a suggestions job.
+type suggestionsJobParams struct {
+	Provider llm.Provider `json:"provider,omitempty"`
+	Model    string       `json:"model,omitempty"`
+}
 
-	flusher, ok := w.(http.Flusher)
+func (h *Handler) SuggestionsStream(w http.ResponseWriter, r *http.Request) {
+	sse, ok := newSSEWriter(w)
 	if !ok {
-		http.Error(w, "SSE not supported", http.StatusInternalServerError)
 		return
 	}
 
-	// Helper to send SSE event
-	sendEvent := func(eventType string, data interface{}) {
-		jsonData, _ := json.Marshal(data)
-		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonData)
-		flusher.Flush()
+	// Parse project ID
+	projectIDStr := r.PathValue("projectId")
+	projectID, err := parseUUID(projectIDStr)
+	if err != nil {
+		sse.send("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid project ID format"})
+		return
+	}
+
+	if h.resumeJob(sse, r, projectID, domain.JobKindSuggestions) {
+		return
+	}
+
+	// Parse query params for provider/model
+	params := suggestionsJobParams{
+		Provider: llm.Provider(r.URL.Query().Get("provider")),
+		Model:    r.URL.Query().Get("model"),
+	}
+
+	if h.compiler == nil {
+		sse.send("fail", map[string]string{"error": "service_unavailable", "message": "LLM service not configured"})
+		return
+	}
+
+	if _, err := h.repo.GetProject(r.Context(), projectID); err != nil {
+		sse.send("fail", map[string]string{"error": "not_found", "message": "Project not found"})
+		return
 	}
 
+	queued := suggestionsStageEvent{Stage: "preparing", Message: "Waiting for another job on this project to finish..."}
+	h.startJob(sse, r, projectID, domain.JobKindSuggestions, params, queued, func(ctx context.Context, emit jobs.EmitFunc) (any, error) {
+		return h.runSuggestions(ctx, emit, projectID, params)
+	})
+}
+
+// runSuggestions performs a suggestions job. Its result is the "complete"
+// event payload, including the suggestions.
+func (h *Handler) runSuggestions(ctx context.Context, emit jobs.EmitFunc, projectID uuid.UUID, params suggestionsJobParams) (any, error) {
 	startTime := time.Now()
 	stageStart := startTime
 
 	sendStage := func(stage, message string) {
 		now := time.Now()
-		sendEvent("stage", suggestionsStageEvent{
+		emit("stage", suggestionsStageEvent{
 			Stage:     stage,
 			Message:   message,
 			ElapsedMs: now.Sub(stageStart).Milliseconds(),
@@ -1362,31 +2002,27 @@ func (h *Handler) SuggestionsStream(w http.ResponseWriter, r *http.Request) {
 		})
 		stageStart = now
 	}
-
-	// Parse project ID
-	projectIDStr := r.PathValue("projectId")
-	projectID, err := parseUUID(projectIDStr)
-	if err != nil {
-		sendEvent("fail", map[string]string{"error": "invalid_uuid", "message": "Invalid project ID format"})
-		return
+	// Token progress and retries while the model runs; stays within the current stage
+	sendTokens := func(p compiler.StreamProgress) {
+		now := time.Now()
+		emit("stage", suggestionsStageEvent{
+			Stage:     p.Stage,
+			Message:   streamMessage(p),
+			ElapsedMs: now.Sub(stageStart).Milliseconds(),
+			TotalMs:   now.Sub(startTime).Milliseconds(),
+			Tokens:    p.Tokens,
+			Retry:     newRetryNotice(p),
+			Cached:    p.Cached,
+			Trimmed:   p.Trimmed,
+		})
 	}
 
-	// Parse query params for provider/model
-	provider := llm.Provider(r.URL.Query().Get("provider"))
-	model := r.URL.Query().Get("model")
-
 	// Stage 1: Preparing
 	sendStage("preparing", "Loading project and unanswered questions...")
 
-	if h.compiler == nil {
-		sendEvent("fail", map[string]string{"error": "service_unavailable", "message": "LLM service not configured"})
-		return
-	}
-
-	project, err := h.repo.GetProject(r.Context(), projectID)
+	project, err := h.repo.GetProject(ctx, projectID)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "not_found", "message": "Project not found"})
-		return
+		return nil, jobs.Fail("not_found", "Project not found")
 	}
 
 	// Convert project mode to compiler mode
@@ -1396,10 +2032,9 @@ func (h *Handler) SuggestionsStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get all questions and filter for unanswered
-	questions, err := h.repo.ListQuestions(r.Context(), projectID, nil, nil)
+	questions, err := h.repo.ListQuestions(ctx, projectID, nil, nil)
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "internal_error", "message": "Failed to list questions"})
-		return
+		return nil, jobs.Fail("internal_error", "Failed to list questions")
 	}
 
 	unanswered := make([]*domain.Question, 0)
@@ -1411,42 +2046,51 @@ func (h *Handler) SuggestionsStream(w http.ResponseWriter, r *http.Request) {
 
 	if len(unanswered) == 0 {
 		suggestionCount := 0
-		sendEvent("complete", suggestionsStageEvent{
+		return suggestionsStageEvent{
 			Stage:           "complete",
 			Message:         "No unanswered questions to suggest",
 			ElapsedMs:       time.Since(stageStart).Milliseconds(),
 			TotalMs:         time.Since(startTime).Milliseconds(),
 			SuggestionCount: &suggestionCount,
-		})
-		return
+		}, nil
 	}
 
 	// Get latest answers for context
-	answers, _ := h.repo.GetLatestAnswersForProject(r.Context(), projectID)
+	answers, _ := h.repo.GetLatestAnswersForProject(ctx, projectID)
 
 	// Get current spec if available
 	var currentSpec json.RawMessage
-	if snapshotID, err := h.repo.GetLatestSnapshotID(r.Context(), projectID); err == nil && snapshotID != nil {
-		if snapshot, err := h.repo.GetSnapshot(r.Context(), *snapshotID); err == nil {
+	if snapshotID, err := h.repo.GetLatestSnapshotID(ctx, projectID); err == nil && snapshotID != nil {
+		if snapshot, err := h.repo.GetSnapshot(ctx, *snapshotID); err == nil {
 			currentSpec = snapshot.Spec
 		}
 	}
 
+	budgets := h.currentBudgets(ctx, project)
+	if status := exhaustedBudget(budgets); status != nil {
+		return nil, budgetJobError(status)
+	}
+	ctx, usage := h.trackUsage(ctx, projectID, budgets)
+	defer usage.save(ctx, h.repo, nil)
+
 	// Stage 2: Suggesting
 	sendStage("suggesting", fmt.Sprintf("Generating suggestions for %d questions...", len(unanswered)))
 
-	suggestOutput, err := h.compiler.Suggest(r.Context(), compiler.SuggestInput{
+	suggestOutput, err := h.compiler.Suggest(ctx, compiler.SuggestInput{
 		Project:             project,
 		UnansweredQuestions: unanswered,
 		LatestAnswers:       answers,
 		CurrentSpec:         currentSpec,
 		Mode:                mode,
-		Provider:            provider,
-		Model:               model,
+		Provider:            params.Provider,
+		Model:               params.Model,
+		Stream:              sendTokens,
 	})
 	if err != nil {
-		sendEvent("fail", map[string]string{"error": "suggester_failed", "message": err.Error()})
-		return
+		if status := refusedBudget(err); status != nil {
+			return nil, budgetJobError(status)
+		}
+		return nil, jobs.Fail("suggester_failed", err.Error())
 	}
 
 	// Stage 3: Complete - include suggestions in response
@@ -1461,14 +2105,14 @@ func (h *Handler) SuggestionsStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	suggestionCount := len(suggestions)
-	sendEvent("complete", suggestionsStageEvent{
+	return suggestionsStageEvent{
 		Stage:           "complete",
 		Message:         fmt.Sprintf("Generated %d suggestions", suggestionCount),
 		ElapsedMs:       time.Since(stageStart).Milliseconds(),
 		TotalMs:         time.Since(startTime).Milliseconds(),
 		SuggestionCount: &suggestionCount,
 		Suggestions:     suggestions,
-	})
+	}, nil
 }
 
 // Diff
@@ -1629,12 +2273,6 @@ func (h *Handler) ExportPack(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	// Extract trace from spec JSON (trace is embedded in the ProjectImplementationSpec)
-	var specWithTrace struct {
-		Trace json.RawMessage `json:"trace"`
-	}
-	_ = json.Unmarshal(snapshot.Spec, &specWithTrace)
-
 	// Determine export format from query parameter
 	format := export.ExportFormat(r.URL.Query().Get("format"))
 	if format == "" {
@@ -1645,7 +2283,7 @@ func (h *Handler) ExportPack(w http.ResponseWriter, r *http.Request) {
 	input := export.Input{
 		Project:   project,
 		Snapshot:  snapshot,
-		Trace:     specWithTrace.Trace,
+		Trace:     trace.ForSnapshot(snapshot),
 		QABundles: qaBundles,
 	}
 
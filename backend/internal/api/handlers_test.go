@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -15,7 +16,7 @@ import (
 
 func setupHandler() (*Handler, *mock.Repository) {
 	repo := mock.New()
-	handler := NewHandler(repo, nil) // No compiler for basic tests
+	handler := NewHandler(repo, nil, nil) // No compiler or job runner for basic tests
 	return handler, repo
 }
 
@@ -323,6 +324,72 @@ func TestSubmitAnswer(t *testing.T) {
 	}
 }
 
+func TestSubmitAnswerDuringCompile(t *testing.T) {
+	handler, repo := setupHandler()
+
+	projectID := uuid.New()
+	questionID := uuid.New()
+	repo.CreateProject(nil, &domain.Project{ID: projectID, Name: "Test Project", CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()})
+	repo.CreateQuestion(nil, &domain.Question{ID: questionID, ProjectID: projectID, Text: "Test Question", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusUnanswered, CreatedAt: time.Now().UTC()})
+
+	submit := func() submitAnswerResponse {
+		t.Helper()
+		body := `{"question_id": "` + questionID.String() + `", "value": "My answer"}`
+		req := httptest.NewRequest("POST", "/projects/"+projectID.String()+"/answers", bytes.NewBufferString(body))
+		req.SetPathValue("projectId", projectID.String())
+		w := httptest.NewRecorder()
+		handler.SubmitAnswer(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("SubmitAnswer() status = %d, body = %s", w.Code, w.Body.String())
+		}
+		var resp submitAnswerResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	if submit().CompileInProgress {
+		t.Error("CompileInProgress set with no compile running")
+	}
+
+	unlock, err := handler.compileLocks.Lock(context.Background(), projectID)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer unlock()
+	if !submit().CompileInProgress {
+		t.Error("CompileInProgress not set while a compile holds the project lock")
+	}
+}
+
+func TestProjectLocksRelease(t *testing.T) {
+	var locks projectLocks
+	projectID := uuid.New()
+
+	if locks.Held(projectID) || len(locks.locks) != 0 {
+		t.Fatalf("Held() on an unlocked project left %d lock entries", len(locks.locks))
+	}
+
+	unlock, err := locks.Lock(context.Background(), projectID)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := locks.Lock(ctx, projectID); err == nil {
+		t.Fatal("Lock() with a canceled context succeeded while the lock was held")
+	}
+	if !locks.Held(projectID) {
+		t.Error("Held() = false while the lock is held")
+	}
+
+	unlock()
+	if locks.Held(projectID) || len(locks.locks) != 0 {
+		t.Errorf("%d lock entries left after the lock was released", len(locks.locks))
+	}
+}
+
 func TestAnswerVersioning(t *testing.T) {
 	handler, repo := setupHandler()
 
@@ -397,19 +464,22 @@ func TestListSnapshots(t *testing.T) {
 	}
 	repo.CreateProject(nil, project)
 
-	// Create snapshots
+	// Create snapshots, each compiled on top of the previous one
+	var parentID *uuid.UUID
 	for i := 0; i < 3; i++ {
 		snapshot := &domain.SpecSnapshot{
-			ID:        uuid.New(),
-			ProjectID: projectID,
-			Spec:      json.RawMessage(`{"version": ` + string(rune('0'+i)) + `}`),
-			CreatedAt: time.Now().UTC(),
+			ID:               uuid.New(),
+			ProjectID:        projectID,
+			ParentSnapshotID: parentID,
+			Spec:             json.RawMessage(`{"version": ` + string(rune('0'+i)) + `}`),
+			CreatedAt:        time.Now().UTC(),
 			Compiler: domain.CompilerConfig{
 				Model:         "gpt-4o",
 				PromptVersion: "v1",
 			},
 		}
 		repo.CreateSnapshot(nil, snapshot)
+		parentID = &snapshot.ID
 	}
 
 	req := httptest.NewRequest("GET", "/projects/"+projectID.String()+"/snapshots", nil)
@@ -538,11 +608,12 @@ func TestDiffSnapshots(t *testing.T) {
 		Compiler:  domain.CompilerConfig{Model: "gpt-4o", PromptVersion: "v1"},
 	}
 	targetSnapshot := &domain.SpecSnapshot{
-		ID:        targetID,
-		ProjectID: projectID,
-		Spec:      json.RawMessage(`{"product": {"name": "Updated Test"}}`),
-		CreatedAt: time.Now().UTC(),
-		Compiler:  domain.CompilerConfig{Model: "gpt-4o", PromptVersion: "v1"},
+		ID:               targetID,
+		ProjectID:        projectID,
+		ParentSnapshotID: &baseID,
+		Spec:             json.RawMessage(`{"product": {"name": "Updated Test"}}`),
+		CreatedAt:        time.Now().UTC(),
+		Compiler:         domain.CompilerConfig{Model: "gpt-4o", PromptVersion: "v1"},
 	}
 	repo.CreateSnapshot(nil, baseSnapshot)
 	repo.CreateSnapshot(nil, targetSnapshot)
@@ -635,6 +706,28 @@ func TestCompileWithoutCompiler(t *testing.T) {
 	}
 }
 
+func TestGenerateSuggestionsWithoutCompiler(t *testing.T) {
+	handler, repo := setupHandler()
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	repo.CreateProject(nil, &domain.Project{ID: projectID, Name: "Test Project", CreatedAt: now, UpdatedAt: now})
+	repo.CreateQuestion(nil, &domain.Question{
+		ID: uuid.New(), ProjectID: projectID, Text: "Open question", Type: domain.QuestionTypeFreeform,
+		Status: domain.QuestionStatusUnanswered, CreatedAt: now,
+	})
+
+	req := httptest.NewRequest("POST", "/projects/"+projectID.String()+"/suggestions", nil)
+	req.SetPathValue("projectId", projectID.String())
+	w := httptest.NewRecorder()
+
+	handler.GenerateSuggestions(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GenerateSuggestions() without compiler status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
 func TestExportWithoutSnapshot(t *testing.T) {
 	handler, repo := setupHandler()
 
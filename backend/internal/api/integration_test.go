@@ -4,13 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/dshills/specbuilder/backend/internal/audit"
 	"github.com/dshills/specbuilder/backend/internal/compiler"
 	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/jobs"
 	"github.com/dshills/specbuilder/backend/internal/llm"
 	"github.com/dshills/specbuilder/backend/internal/repository/mock"
 	"github.com/dshills/specbuilder/backend/internal/validator"
@@ -27,7 +34,9 @@ func setupIntegrationTest(t *testing.T, llmResponse string) (*Handler, *mock.Rep
 		t.Fatalf("Failed to create validator: %v", err)
 	}
 	compilerSvc := compiler.NewService(mockFactory, val, `{"type": "object"}`)
-	handler := NewHandler(repo, compilerSvc)
+	runner := jobs.NewRunner(repo, jobs.Options{})
+	t.Cleanup(runner.Close)
+	handler := NewHandler(repo, compilerSvc, runner)
 	return handler, repo, mockFactory
 }
 
@@ -325,12 +334,13 @@ func TestIntegration_SnapshotDiffing(t *testing.T) {
 	}
 
 	snapshot2 := &domain.SpecSnapshot{
-		ID:          uuid.New(),
-		ProjectID:   projectID,
-		Spec:        json.RawMessage(`{"product": {"name": "App v2", "version": "2.0"}}`),
-		CreatedAt:   now.Add(time.Hour),
-		DerivedFrom: map[uuid.UUID]int{},
-		Compiler:    domain.CompilerConfig{Model: "mock-model"},
+		ID:               uuid.New(),
+		ProjectID:        projectID,
+		ParentSnapshotID: &snapshot1.ID,
+		Spec:             json.RawMessage(`{"product": {"name": "App v2", "version": "2.0"}}`),
+		CreatedAt:        now.Add(time.Hour),
+		DerivedFrom:      map[uuid.UUID]int{},
+		Compiler:         domain.CompilerConfig{Model: "mock-model"},
 	}
 	if err := repo.CreateSnapshot(context.Background(), snapshot2); err != nil {
 		t.Fatalf("Failed to create snapshot2: %v", err)
@@ -450,3 +460,1008 @@ func TestIntegration_ProjectNotFound(t *testing.T) {
 		t.Errorf("ListQuestions for non-existent project = %d, want %d", rec.Code, http.StatusNotFound)
 	}
 }
+
+// TestIntegration_CompileSpecificAnswerVersions tests compiling from pinned answer versions.
+func TestIntegration_CompileSpecificAnswerVersions(t *testing.T) {
+	handler, repo, mockFactory := setupIntegrationTest(t, `{"spec": {}, "trace": {}}`)
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{
+		ID:        projectID,
+		Name:      "Pinned Versions Test",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	// Two questions: q1 has two answer versions, q2 has one
+	q1 := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Database?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	q2 := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Language?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	for _, q := range []*domain.Question{q1, q2} {
+		if err := repo.CreateQuestion(context.Background(), q); err != nil {
+			t.Fatalf("Failed to create question: %v", err)
+		}
+	}
+	q1v1 := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: q1.ID, Value: json.RawMessage(`"PostgreSQL"`), Version: 1, CreatedAt: now}
+	q1v2 := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: q1.ID, Value: json.RawMessage(`"SQLite"`), Version: 2, Supersedes: &q1v1.ID, CreatedAt: now}
+	q2v1 := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: q2.ID, Value: json.RawMessage(`"Go"`), Version: 1, CreatedAt: now}
+	for _, a := range []*domain.Answer{q1v1, q1v2, q2v1} {
+		if err := repo.CreateAnswer(context.Background(), a); err != nil {
+			t.Fatalf("Failed to create answer: %v", err)
+		}
+	}
+
+	compile := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(body)))
+		req.SetPathValue("projectId", projectID.String())
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.Compile(rec, req)
+		return rec
+	}
+
+	t.Run("pinned version is used", func(t *testing.T) {
+		rec := compile(`{"mode": "specific_answer_versions", "answer_versions": {"` + q1.ID.String() + `": 1}}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Compile status = %d, want %d, body: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var resp compileResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode compile response: %v", err)
+		}
+		snap, err := repo.GetSnapshot(context.Background(), resp.SnapshotID)
+		if err != nil {
+			t.Fatalf("Failed to get snapshot: %v", err)
+		}
+		if snap.DerivedFrom[q1.ID] != 1 {
+			t.Errorf("DerivedFrom[q1] = %d, want 1", snap.DerivedFrom[q1.ID])
+		}
+		if snap.DerivedFrom[q2.ID] != 1 {
+			t.Errorf("DerivedFrom[q2] = %d, want 1 (latest)", snap.DerivedFrom[q2.ID])
+		}
+
+		// The pinned (older) answer value must be what the compiler saw
+		prompt := mockFactory.Client.LastRequest.Messages[1].Content
+		if !strings.Contains(prompt, q1v1.ID.String()) || strings.Contains(prompt, q1v2.ID.String()) {
+			t.Error("Compile prompt should contain the pinned answer and not the latest one")
+		}
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		rec := compile(`{"mode": "specific_answer_versions", "answer_versions": {"` + q1.ID.String() + `": 7}}`)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Compile status = %d, want %d, body: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+		}
+		var resp errorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+		if resp.Error != "version_mismatch" {
+			t.Errorf("error = %s, want version_mismatch", resp.Error)
+		}
+	})
+
+	t.Run("missing answer_versions", func(t *testing.T) {
+		rec := compile(`{"mode": "specific_answer_versions"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Compile status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		rec := compile(`{"mode": "bogus"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Compile status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+// TestIntegration_SnapshotTrace tests that the compiler trace is persisted and queryable.
+func TestIntegration_SnapshotTrace(t *testing.T) {
+	answerID := uuid.New()
+	questionID := uuid.New()
+	llmResponse := `{"spec": {"product": {"name": "Traced"}}, "trace": {"spec_path_to_sources": {
+		"/product/name": [{"question_id": "` + questionID.String() + `", "answer_id": "` + answerID.String() + `", "answer_version": 1}],
+		"/requirements/functional/3": [{"question_id": "` + questionID.String() + `", "answer_id": "` + answerID.String() + `", "answer_version": 1}]
+	}}}`
+	handler, repo, _ := setupIntegrationTest(t, llmResponse)
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Trace Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: questionID, ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: answerID, ProjectID: projectID, QuestionID: questionID, Value: json.RawMessage(`"Traced"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(`{"mode": "latest_answers"}`)))
+	req.SetPathValue("projectId", projectID.String())
+	rec := httptest.NewRecorder()
+	handler.Compile(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Compile status = %d, want %d, body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var compileResp compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&compileResp); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+	snapshotID := compileResp.SnapshotID.String()
+
+	get := func(path string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.SetPathValue("projectId", projectID.String())
+		req.SetPathValue("snapshotId", snapshotID)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+	base := "/projects/" + projectID.String() + "/snapshots/" + snapshotID + "/trace"
+
+	t.Run("get trace", func(t *testing.T) {
+		rec := get(base, handler.GetSnapshotTrace)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GetSnapshotTrace status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+		var resp snapshotTraceResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode trace response: %v", err)
+		}
+		if len(resp.Trace.SpecPathToSources) != 2 {
+			t.Errorf("trace has %d paths, want 2", len(resp.Trace.SpecPathToSources))
+		}
+	})
+
+	t.Run("lookup by path", func(t *testing.T) {
+		rec := get(base+"/lookup?path=/requirements/functional/3", handler.LookupTrace)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("LookupTrace status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+		var resp traceLookupResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode lookup response: %v", err)
+		}
+		if len(resp.Entries) != 1 || resp.Entries[0].AnswerID != answerID.String() {
+			t.Errorf("lookup entries = %+v, want one entry from answer %s", resp.Entries, answerID)
+		}
+	})
+
+	t.Run("lookup by answer", func(t *testing.T) {
+		rec := get(base+"/lookup?answer_id="+answerID.String(), handler.LookupTrace)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("LookupTrace status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+		var resp traceLookupResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode lookup response: %v", err)
+		}
+		if len(resp.Entries) != 2 {
+			t.Errorf("lookup returned %d entries, want 2", len(resp.Entries))
+		}
+	})
+
+	t.Run("lookup without params", func(t *testing.T) {
+		rec := get(base+"/lookup", handler.LookupTrace)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("LookupTrace status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+// TestIntegration_CompileStreamJob tests that a streamed compile runs as a job
+// whose events can be fetched and replayed after the stream ends.
+func TestIntegration_CompileStreamJob(t *testing.T) {
+	handler, repo, _ := setupIntegrationTest(t, `{"spec": {"product": {"name": "Streamed"}}}`)
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Stream Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"Streamed"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	stream := func(path, lastEventID string, h http.HandlerFunc, pathValues map[string]string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range pathValues {
+			req.SetPathValue(k, v)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Body.String()
+	}
+
+	body := stream("/projects/"+projectID.String()+"/compile/stream", "", handler.CompileStream, map[string]string{"projectId": projectID.String()})
+	if !strings.Contains(body, "event: complete") {
+		t.Fatalf("stream did not complete, body: %s", body)
+	}
+	// The mock client streams its output, so token progress is forwarded
+	if !strings.Contains(body, `"tokens":`) || !strings.Contains(body, `"section":"product"`) {
+		t.Errorf("stream lacks token progress events, body: %s", body)
+	}
+
+	jobList, err := repo.ListJobs(context.Background(), projectID, 10)
+	if err != nil || len(jobList) != 1 {
+		t.Fatalf("ListJobs = %d jobs, err %v; want 1", len(jobList), err)
+	}
+	jobID := jobList[0].ID.String()
+	if !strings.Contains(body, "id: "+jobID+":1\n") {
+		t.Errorf("stream events lack job IDs, body: %s", body)
+	}
+
+	t.Run("get job", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/projects/"+projectID.String()+"/jobs/"+jobID, nil)
+		req.SetPathValue("projectId", projectID.String())
+		req.SetPathValue("jobId", jobID)
+		rec := httptest.NewRecorder()
+		handler.GetJob(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GetJob status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+		var resp getJobResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode job response: %v", err)
+		}
+		if resp.Job.Status != domain.JobStatusSucceeded {
+			t.Errorf("job status = %s, want succeeded", resp.Job.Status)
+		}
+		if len(resp.Events) < 2 || resp.Events[len(resp.Events)-1].Type != jobs.EventComplete {
+			t.Errorf("job events = %+v, want stage history ending in complete", resp.Events)
+		}
+	})
+
+	t.Run("reconnect resumes the job", func(t *testing.T) {
+		body := stream("/projects/"+projectID.String()+"/compile/stream", jobID+":1", handler.CompileStream, map[string]string{"projectId": projectID.String()})
+		if strings.Contains(body, "id: "+jobID+":1\n") || !strings.Contains(body, "event: complete") {
+			t.Errorf("resumed stream should replay events after seq 1, body: %s", body)
+		}
+		if jobList, _ := repo.ListJobs(context.Background(), projectID, 10); len(jobList) != 1 {
+			t.Errorf("reconnect started a new job: %d jobs", len(jobList))
+		}
+	})
+
+	t.Run("job events stream", func(t *testing.T) {
+		body := stream("/projects/"+projectID.String()+"/jobs/"+jobID+"/events", "", handler.JobEvents,
+			map[string]string{"projectId": projectID.String(), "jobId": jobID})
+		if !strings.Contains(body, "id: "+jobID+":1\n") || !strings.Contains(body, "event: complete") {
+			t.Errorf("job events stream should replay all events, body: %s", body)
+		}
+	})
+}
+
+// TestIntegration_CompileParentConflict tests that compiles chain snapshots and
+// reject a stale parent_snapshot_id with a retryable 409.
+func TestIntegration_CompileParentConflict(t *testing.T) {
+	handler, repo, _ := setupIntegrationTest(t, `{"spec": {"product": {"name": "Chained"}}}`)
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Conflict Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"Chained"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	compile := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(body)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.Compile(rec, req)
+		return rec
+	}
+
+	rec := compile(`{"mode": "latest_answers"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first Compile status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var first compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&first); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+	if first.AnswersNotIncluded == nil || len(first.AnswersNotIncluded) != 0 {
+		t.Errorf("answers_not_included = %v, want empty", first.AnswersNotIncluded)
+	}
+
+	rec = compile(`{"mode": "latest_answers", "parent_snapshot_id": "` + first.SnapshotID.String() + `"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second Compile status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var second compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&second); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+	snap, err := repo.GetSnapshot(context.Background(), second.SnapshotID)
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+	if snap.ParentSnapshotID == nil || *snap.ParentSnapshotID != first.SnapshotID {
+		t.Errorf("parent_snapshot_id = %v, want %s", snap.ParentSnapshotID, first.SnapshotID)
+	}
+
+	// The first snapshot is no longer the latest
+	rec = compile(`{"mode": "latest_answers", "parent_snapshot_id": "` + first.SnapshotID.String() + `"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("stale Compile status = %d, want %d, body: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	var conflict struct {
+		Error   string                  `json:"error"`
+		Details snapshotConflictDetails `json:"details"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&conflict); err != nil {
+		t.Fatalf("Failed to decode conflict response: %v", err)
+	}
+	if conflict.Error != "snapshot_conflict" || conflict.Details.LatestSnapshotID == nil || *conflict.Details.LatestSnapshotID != second.SnapshotID {
+		t.Errorf("conflict = %+v, want snapshot_conflict naming %s", conflict, second.SnapshotID)
+	}
+}
+
+func TestIntegration_CompileCanceledWhileWaiting(t *testing.T) {
+	handler, repo, _ := setupIntegrationTest(t, `{"spec": {"product": {"name": "Waiting"}}}`)
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Wait Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	unlock, err := handler.compileLocks.Lock(context.Background(), projectID)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(`{}`))).WithContext(ctx)
+	req.SetPathValue("projectId", projectID.String())
+	rec := httptest.NewRecorder()
+	handler.Compile(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "request_canceled") {
+		t.Errorf("Compile status = %d, body: %s; want 503 request_canceled", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIntegration_CompileEnsemble(t *testing.T) {
+	handler, repo, factory := setupIntegrationTest(t, `{"spec": {"product": {"name": "Default"}}}`)
+	factory.Clients = map[string]*llm.MockClient{
+		"model-a": {ModelName: "model-a", Response: `{"spec": {"product": {"name": "Alpha"}}}`},
+		"model-b": {ModelName: "model-b", Response: `{"spec": {"product": {"name": "Beta"}}}`},
+		"model-c": {ModelName: "model-c", Response: `{"spec": {"product": {"name": "Beta"}}}`},
+	}
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Ensemble Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, SpecPaths: []string{"product.name"}, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"Beta"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	compile := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(body)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.Compile(rec, req)
+		return rec
+	}
+
+	rec := compile(`{"mode": "latest_answers", "ensemble": [{"provider": "mock", "model": "model-a"}]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("single-model ensemble status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = compile(`{"mode": "latest_answers", "ensemble": [
+		{"provider": "mock", "model": "model-a"},
+		{"provider": "mock", "model": "model-b"},
+		{"provider": "mock", "model": "model-c"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Compile status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var resp compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+
+	snap, err := repo.GetSnapshot(context.Background(), resp.SnapshotID)
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+	if string(snap.Spec) != `{"product":{"name":"Beta"}}` {
+		t.Errorf("spec = %s, want majority name Beta", snap.Spec)
+	}
+	if len(snap.Compiler.Models) != 3 || snap.Compiler.Models[0].Model != "model-a" {
+		t.Errorf("compiler models = %+v, want model-a, model-b, model-c", snap.Compiler.Models)
+	}
+
+	issues, err := repo.ListIssuesForSnapshot(context.Background(), resp.SnapshotID)
+	if err != nil {
+		t.Fatalf("Failed to list issues: %v", err)
+	}
+	var found bool
+	for _, issue := range issues {
+		if issue.Type == domain.IssueTypeConflict && strings.HasPrefix(issue.Message, "Ensemble models disagree on /product/name") {
+			found = true
+			if len(issue.RelatedQuestionIDs) != 1 || issue.RelatedQuestionIDs[0] != question.ID {
+				t.Errorf("related questions = %v, want %s", issue.RelatedQuestionIDs, question.ID)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("issues = %+v, want ensemble conflict on /product/name", issues)
+	}
+}
+
+func TestIntegration_Usage(t *testing.T) {
+	handler, repo, factory := setupIntegrationTest(t, `{"spec": {"product": {"name": "Metered"}}}`)
+	factory.Client.Usage = llm.Usage{InputTokens: 1000, OutputTokens: 500, StopReason: "end_turn"}
+	factory.Pricing = llm.PriceTable{"mock-model": {Input: 2, Output: 10}}
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Usage Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"Metered"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(`{"mode": "latest_answers"}`)))
+	req.SetPathValue("projectId", projectID.String())
+	rec := httptest.NewRecorder()
+	handler.Compile(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Compile status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var compiled compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&compiled); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+
+	// Every call of the compile (generation, schema repairs and validation) at $0.007 each
+	calls := factory.Client.CallCount
+	req = httptest.NewRequest(http.MethodGet, "/projects/"+projectID.String()+"/usage", nil)
+	req.SetPathValue("projectId", projectID.String())
+	rec = httptest.NewRecorder()
+	handler.GetProjectUsage(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GetProjectUsage status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var usage domain.ProjectUsage
+	if err := json.NewDecoder(rec.Body).Decode(&usage); err != nil {
+		t.Fatalf("Failed to decode usage: %v", err)
+	}
+	if usage.Total.Calls != calls || usage.Total.InputTokens != 1000*calls || usage.Total.OutputTokens != 500*calls {
+		t.Errorf("total = %+v, want %d calls", usage.Total, calls)
+	}
+	if want := 0.007 * float64(calls); math.Abs(usage.Total.CostUSD-want) > 1e-9 || usage.Total.UnpricedCalls != 0 {
+		t.Errorf("cost = %v, want %v", usage.Total.CostUSD, want)
+	}
+	if len(usage.ByRole) != 2 || usage.ByRole[0].Role != domain.LLMRoleCompiler || usage.ByRole[1].Role != domain.LLMRoleValidator {
+		t.Errorf("by_role = %+v, want compiler and validator", usage.ByRole)
+	}
+	if len(usage.ByModel) != 1 || usage.ByModel[0].Model != "mock-model" || usage.ByModel[0].Calls != calls {
+		t.Errorf("by_model = %+v, want mock-model", usage.ByModel)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/projects/"+projectID.String()+"/snapshots/"+compiled.SnapshotID.String(), nil)
+	req.SetPathValue("projectId", projectID.String())
+	req.SetPathValue("snapshotId", compiled.SnapshotID.String())
+	rec = httptest.NewRecorder()
+	handler.GetSnapshot(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GetSnapshot status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var snapshot getSnapshotResponse
+	if err := json.NewDecoder(rec.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	if snapshot.Snapshot.Usage == nil || snapshot.Snapshot.Usage.Calls != calls {
+		t.Errorf("snapshot usage = %+v, want the %d calls of its compile", snapshot.Snapshot.Usage, calls)
+	}
+}
+
+func TestIntegration_LLMAudit(t *testing.T) {
+	handler, repo, factory := setupIntegrationTest(t, `{"spec": {"product": {"name": "Audited"}}}`)
+	redactor, err := audit.NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+	handler.SetAudit(&AuditConfig{Redactor: redactor, Retention: time.Hour})
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Audit Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Who is the contact?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"ops@example.com, key sk-ant-REDACTED"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	listCalls := func(query string) []*domain.LLMAuditEntry {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/projects/"+projectID.String()+"/llm-calls?"+query, nil)
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.ListLLMCalls(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ListLLMCalls status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+		var resp listLLMCallsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode LLM calls: %v", err)
+		}
+		if !resp.Enabled {
+			t.Error("enabled = false, want true")
+		}
+		return resp.Calls
+	}
+	compile := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(`{"mode": "latest_answers"}`)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.Compile(rec, req)
+		return rec
+	}
+
+	rec := compile()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Compile status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var compiled compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&compiled); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+
+	calls := listCalls("snapshot_id=" + compiled.SnapshotID.String())
+	if len(calls) != factory.Client.CallCount {
+		t.Fatalf("listed %d calls for the snapshot, want %d", len(calls), factory.Client.CallCount)
+	}
+	compilerCall := calls[len(calls)-1]
+	if compilerCall.Role != domain.LLMRoleCompiler || compilerCall.Stage != "compiling" || compilerCall.Outcome != domain.LLMCallOK ||
+		compilerCall.PromptVersion != "v1" || compilerCall.Response != factory.Client.Response {
+		t.Errorf("first call = %+v, want the compiler's", compilerCall)
+	}
+	prompt := compilerCall.Messages[len(compilerCall.Messages)-1].Content
+	if strings.Contains(prompt, "ops@example.com") || strings.Contains(prompt, "sk-ant-") ||
+		!strings.Contains(prompt, "[REDACTED:email]") || !strings.Contains(prompt, "[REDACTED:api_key]") {
+		t.Errorf("prompt isn't redacted:\n%s", prompt)
+	}
+
+	// Questions link the planner and asker calls that produced them
+	factory.Client.Response = `{"suggestions": [], "questions": [{"text": "Who pays?", "type": "freeform", "priority": 1}]}`
+	req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/next-questions", bytes.NewReader([]byte(`{"count": 1}`)))
+	req.SetPathValue("projectId", projectID.String())
+	rec = httptest.NewRecorder()
+	handler.GenerateNextQuestions(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GenerateNextQuestions status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var generated nextQuestionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&generated); err != nil {
+		t.Fatalf("Failed to decode questions: %v", err)
+	}
+	calls = listCalls("question_id=" + generated.Questions[0].ID.String())
+	if len(calls) != 2 || calls[0].Role != domain.LLMRoleAsker || calls[1].Role != domain.LLMRolePlanner {
+		t.Errorf("calls for the question = %+v, want the asker and planner calls", calls)
+	}
+
+	// Failed calls are audited, though they have no usage
+	usage, _ := repo.GetProjectUsage(context.Background(), projectID)
+	factory.Client.Error = errors.New("upstream unavailable")
+	if rec := compile(); rec.Code == http.StatusOK {
+		t.Fatal("Compile succeeded, want a failure")
+	}
+	calls = listCalls("outcome=failed&limit=1")
+	if len(calls) != 1 || calls[0].Error != "upstream unavailable" || calls[0].SnapshotID != nil {
+		t.Errorf("failed calls = %+v, want the failed compile", calls)
+	}
+	if after, _ := repo.GetProjectUsage(context.Background(), projectID); after.Total.Calls != usage.Total.Calls {
+		t.Errorf("usage calls = %d, want %d", after.Total.Calls, usage.Total.Calls)
+	}
+}
+
+func TestIntegration_Budget(t *testing.T) {
+	handler, repo, factory := setupIntegrationTest(t, `{"spec": {"product": {"name": "Budgeted"}}}`)
+	factory.Client.Usage = llm.Usage{InputTokens: 100, OutputTokens: 50}
+	factory.Pricing = llm.PriceTable{"mock-model": {Input: 2, Output: 10}}
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Budget Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"Budgeted"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	// spend records an earlier call of the given size against the project
+	spend := func(tokens int) {
+		call := &domain.LLMCall{ID: uuid.New(), ProjectID: projectID, Role: domain.LLMRoleCompiler, Provider: "mock", Model: "mock-model", InputTokens: tokens, CreatedAt: time.Now().UTC()}
+		if err := repo.CreateLLMCall(context.Background(), call); err != nil {
+			t.Fatalf("Failed to create LLM call: %v", err)
+		}
+	}
+	setBudget := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/projects/"+projectID.String()+"/budget", bytes.NewReader([]byte(body)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.SetBudget(rec, req)
+		return rec
+	}
+	compile := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(`{"mode": "latest_answers"}`)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.Compile(rec, req)
+		return rec
+	}
+
+	if rec := setBudget(`{"budget": {"period": "weekly", "max_tokens": 10}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid budget status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec := setBudget(`{"budget": {"period": "monthly", "max_tokens": 100000, "warn_at": 0.5}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SetBudget status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	// Past the warning threshold, compiles still run but report a budget issue
+	spend(60000)
+	rec = compile()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Compile status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var compiled compileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&compiled); err != nil {
+		t.Fatalf("Failed to decode compile response: %v", err)
+	}
+	var warning *domain.Issue
+	for _, issue := range compiled.Issues {
+		if issue.Type == domain.IssueTypeBudget {
+			warning = issue
+		}
+	}
+	if warning == nil || warning.Severity != domain.IssueSeverityWarn || !strings.HasPrefix(warning.Message, "Project LLM budget") {
+		t.Errorf("budget issue = %+v, want a project budget warning", warning)
+	}
+
+	type refusal struct {
+		Error   string       `json:"error"`
+		Details budgetStatus `json:"details"`
+	}
+
+	// A call that could cross the limit is refused while usage is still below it
+	spend(10000)
+	calls := factory.Client.CallCount
+	rec = compile()
+	if rec.Code != http.StatusPaymentRequired {
+		t.Fatalf("Compile near budget status = %d, want %d, body: %s", rec.Code, http.StatusPaymentRequired, rec.Body.String())
+	}
+	var refused refusal
+	if err := json.NewDecoder(rec.Body).Decode(&refused); err != nil {
+		t.Fatalf("Failed to decode error: %v", err)
+	}
+	if used := refused.Details.Usage.InputTokens + refused.Details.Usage.OutputTokens; refused.Error != "budget_exceeded" || used >= 100000 {
+		t.Errorf("refusal = %+v, want budget_exceeded with usage below the limit", refused)
+	}
+	if e := refused.Details.Estimate; e == nil || e.OutputTokens != 32000 || e.InputTokens == 0 {
+		t.Errorf("refusal estimate = %+v, want the prompt's tokens and 32000 output tokens", e)
+	}
+	if factory.Client.CallCount != calls {
+		t.Errorf("LLM called %d times for a call that could cross the budget", factory.Client.CallCount-calls)
+	}
+
+	// Once the budget is used up, LLM work is refused before any call is made
+	spend(30000)
+	rec = compile()
+	if rec.Code != http.StatusPaymentRequired {
+		t.Fatalf("Compile over budget status = %d, want %d, body: %s", rec.Code, http.StatusPaymentRequired, rec.Body.String())
+	}
+	refused = refusal{}
+	if err := json.NewDecoder(rec.Body).Decode(&refused); err != nil {
+		t.Fatalf("Failed to decode error: %v", err)
+	}
+	if refused.Error != "budget_exceeded" || refused.Details.Scope != budgetScopeProject || refused.Details.Usage.InputTokens < 100000 || refused.Details.Estimate != nil {
+		t.Errorf("refusal = %+v, want budget_exceeded for the project", refused)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/next-questions", bytes.NewReader([]byte(`{"count": 3}`)))
+	req.SetPathValue("projectId", projectID.String())
+	rec = httptest.NewRecorder()
+	handler.GenerateNextQuestions(rec, req)
+	if rec.Code != http.StatusPaymentRequired {
+		t.Errorf("GenerateNextQuestions over budget status = %d, want %d", rec.Code, http.StatusPaymentRequired)
+	}
+	if factory.Client.CallCount != calls {
+		t.Errorf("LLM called %d times over budget", factory.Client.CallCount-calls)
+	}
+
+	// The server budget applies even without a project budget
+	if rec := setBudget(`{"budget": null}`); rec.Code != http.StatusOK {
+		t.Fatalf("clearing the budget status = %d", rec.Code)
+	}
+	handler.SetServerBudget(&domain.Budget{Period: domain.BudgetPeriodLifetime, MaxCostUSD: 0.001})
+	rec = compile()
+	if rec.Code != http.StatusPaymentRequired || !strings.Contains(rec.Body.String(), "Server LLM budget exhausted") {
+		t.Errorf("Compile over server budget status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/projects/"+projectID.String()+"/budget", nil)
+	req.SetPathValue("projectId", projectID.String())
+	rec = httptest.NewRecorder()
+	handler.GetBudget(rec, req)
+	var budgets budgetResponse
+	if err := json.NewDecoder(rec.Body).Decode(&budgets); err != nil {
+		t.Fatalf("Failed to decode budgets: %v", err)
+	}
+	if len(budgets.Budgets) != 1 || budgets.Budgets[0].Scope != budgetScopeServer || budgets.Budgets[0].Since != nil {
+		t.Errorf("budgets = %+v, want only the lifetime server budget", budgets.Budgets)
+	}
+}
+
+func TestIntegration_PromptVersions(t *testing.T) {
+	handler, repo, factory := setupIntegrationTest(t, `{"spec": {"product": {"name": "Prompted"}}}`)
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "v2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "v2", "compiler.txt"), []byte("v2 compiler prompt {{QA_BUNDLE_JSON}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts := llm.NewPromptRegistry()
+	if err := prompts.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	if err := handler.compiler.SetPrompts(prompts, llm.PromptVersionV1); err != nil {
+		t.Fatalf("SetPrompts() error = %v", err)
+	}
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	project := &domain.Project{ID: projectID, Name: "Prompt Test", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	question := &domain.Question{ID: uuid.New(), ProjectID: projectID, Text: "Product name?", Type: domain.QuestionTypeFreeform, Status: domain.QuestionStatusAnswered, CreatedAt: now}
+	if err := repo.CreateQuestion(context.Background(), question); err != nil {
+		t.Fatalf("Failed to create question: %v", err)
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: projectID, QuestionID: question.ID, Value: json.RawMessage(`"Prompted"`), Version: 1, CreatedAt: now}
+	if err := repo.CreateAnswer(context.Background(), answer); err != nil {
+		t.Fatalf("Failed to create answer: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ListPrompts(rec, httptest.NewRequest(http.MethodGet, "/prompts", nil))
+	var listed listPromptsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode prompts: %v", err)
+	}
+	if listed.DefaultVersion != llm.PromptVersionV1 || len(listed.Versions) != 2 || listed.Versions[1].Version != "v2" {
+		t.Errorf("prompts = %+v, want v1 (default) and v2", listed)
+	}
+
+	setVersion := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/projects/"+projectID.String()+"/prompt-version", bytes.NewReader([]byte(body)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.SetPromptVersion(rec, req)
+		return rec
+	}
+	// compile compiles the project and returns the prompt version its snapshot records
+	compile := func(body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.String()+"/compile", bytes.NewReader([]byte(body)))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.Compile(rec, req)
+		if rec.Code != http.StatusOK {
+			return rec.Code, ""
+		}
+		var compiled compileResponse
+		if err := json.NewDecoder(rec.Body).Decode(&compiled); err != nil {
+			t.Fatalf("Failed to decode compile response: %v", err)
+		}
+		snapshot, err := repo.GetSnapshot(context.Background(), compiled.SnapshotID)
+		if err != nil {
+			t.Fatalf("Failed to get snapshot: %v", err)
+		}
+		return rec.Code, snapshot.Compiler.PromptVersion
+	}
+
+	if rec := setVersion(`{"prompt_version": "v9"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown prompt version status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := setVersion(`{"prompt_version": "v2"}`); rec.Code != http.StatusOK {
+		t.Fatalf("SetPromptVersion status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	if code, version := compile(`{"mode": "latest_answers"}`); code != http.StatusOK || version != "v2" {
+		t.Errorf("pinned compile = %d with prompt version %q, want v2", code, version)
+	}
+	// Validation runs with the version the spec was compiled with
+	if got := factory.Client.LastRequest.PromptVersion; got != "v2" {
+		t.Errorf("validator request prompt version = %q, want v2", got)
+	}
+	if code, version := compile(`{"mode": "latest_answers", "prompt_version": "v1"}`); code != http.StatusOK || version != "v1" {
+		t.Errorf("overridden compile = %d with prompt version %q, want v1", code, version)
+	}
+	if code, _ := compile(`{"mode": "latest_answers", "prompt_version": "v9"}`); code != http.StatusBadRequest {
+		t.Errorf("compile with unknown prompt version status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	if rec := setVersion(`{"prompt_version": ""}`); rec.Code != http.StatusOK {
+		t.Fatalf("unpinning status = %d", rec.Code)
+	}
+	if code, version := compile(`{"mode": "latest_answers"}`); code != http.StatusOK || version != "v1" {
+		t.Errorf("unpinned compile = %d with prompt version %q, want the default v1", code, version)
+	}
+}
+
+// TestIntegration_PullOllamaModel tests streaming the progress of an Ollama model pull.
+func TestIntegration_PullOllamaModel(t *testing.T) {
+	handler, _, mockFactory := setupIntegrationTest(t, `{}`)
+
+	pull := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/ollama/pull", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.PullOllamaModel(rec, req)
+		return rec
+	}
+
+	if rec := pull(`{"model": "llama3.2"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("pull without Ollama = %d, want 503", rec.Code)
+	}
+
+	mockFactory.Providers = []llm.ProviderInfo{{ID: llm.ProviderOllama, Available: true, Models: []llm.ModelInfo{}}}
+	if rec := pull(`{"model": " "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("pull without a model = %d, want 400", rec.Code)
+	}
+
+	mockFactory.PullProgress = []llm.OllamaPullProgress{
+		{Status: "pulling manifest"},
+		{Status: "pulling abc", Digest: "sha256:abc", Total: 200, Completed: 50},
+		{Status: "success"},
+	}
+	rec := pull(`{"model": "llama3.2"}`)
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" || strings.Count(body, "event: progress") != 3 || !strings.Contains(body, "event: complete") {
+		t.Fatalf("pull stream = %s, want 3 progress events and completion", body)
+	}
+	if !strings.Contains(body, `"completed":50,"percent":25`) || !strings.Contains(body, `"model":"llama3.2"`) {
+		t.Errorf("pull stream = %s, want the layer's progress and the model", body)
+	}
+
+	mockFactory.PullError = errors.New("pull model manifest: file does not exist")
+	if body := pull(`{"model": "nope"}`).Body.String(); !strings.Contains(body, "event: fail") || !strings.Contains(body, "file does not exist") {
+		t.Errorf("failed pull stream = %s, want a fail event", body)
+	}
+}
+
+func TestIntegration_ModelRouting(t *testing.T) {
+	handler, repo, factory := setupIntegrationTest(t, `{}`)
+
+	projectID := uuid.New()
+	now := time.Now().UTC()
+	if err := repo.CreateProject(context.Background(), &domain.Project{ID: projectID, Name: "Routing Test", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	setRouting := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/projects/"+projectID.String()+"/model-routing", strings.NewReader(body))
+		req.SetPathValue("projectId", projectID.String())
+		rec := httptest.NewRecorder()
+		handler.SetModelRouting(rec, req)
+		return rec
+	}
+	listModels := func(query string) listModelsResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ListModels(rec, httptest.NewRequest(http.MethodGet, "/models"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ListModels() status = %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp listModelsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode models: %v", err)
+		}
+		return resp
+	}
+
+	if rec := setRouting(`{"model_routing": {"plannr": {"provider": "mock", "model": "mock-model"}}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown role = %d, want 400", rec.Code)
+	}
+	if rec := setRouting(`{"model_routing": {"asker": {"provider": "anthropic", "model": "claude"}}}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not available") {
+		t.Errorf("unavailable provider = %d %s, want 400", rec.Code, rec.Body.String())
+	}
+
+	if err := handler.compiler.SetRouting(domain.ModelRouting{domain.LLMRoleValidator: {Provider: "mock", Model: "validator-model"}}); err != nil {
+		t.Fatalf("SetRouting() error = %v", err)
+	}
+	rec := setRouting(`{"model_routing": {"asker": {"provider": "mock", "model": "asker-model"}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SetModelRouting() status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if stored, _ := repo.GetProject(context.Background(), projectID); stored.ModelRouting[domain.LLMRoleAsker].Model != "asker-model" {
+		t.Errorf("stored routing = %+v, want the asker route", stored.ModelRouting)
+	}
+
+	routing := listModels("?project_id=" + projectID.String()).Routing
+	if r := routing[domain.LLMRoleAsker]; r.Model != "asker-model" || r.Source != compiler.RouteSourceProject {
+		t.Errorf("asker route = %+v, want the project's model", r)
+	}
+	if r := routing[domain.LLMRoleValidator]; r.Model != "validator-model" || r.Source != compiler.RouteSourceServer {
+		t.Errorf("validator route = %+v, want the server's model", r)
+	}
+	if r := routing[domain.LLMRoleCompiler]; r.Model != factory.DefaultModel() || r.Source != compiler.RouteSourceDefault {
+		t.Errorf("compiler route = %+v, want the default model", r)
+	}
+	if r := listModels("").Routing[domain.LLMRoleAsker]; r.Source != compiler.RouteSourceDefault {
+		t.Errorf("asker route without a project = %+v, want the default model", r)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ListModels(rec, httptest.NewRequest(http.MethodGet, "/models?project_id="+uuid.New().String(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("ListModels() for an unknown project = %d, want 404", rec.Code)
+	}
+
+	if rec := setRouting(`{"model_routing": null}`); rec.Code != http.StatusOK {
+		t.Fatalf("clearing routing status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if r := listModels("?project_id=" + projectID.String()).Routing[domain.LLMRoleAsker]; r.Source != compiler.RouteSourceDefault {
+		t.Errorf("asker route after clearing = %+v, want the default model", r)
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/jobs"
+	"github.com/google/uuid"
+)
+
+// sseKeepAlive is how often an idle job stream sends a comment so proxies
+// don't close the connection.
+var sseKeepAlive = 15 * time.Second
+
+// sseWriter writes Server-Sent Events to a response.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newSSEWriter sets SSE headers and lifts the server write timeout, since a job
+// stream lasts as long as the job. It returns false if streaming is unsupported.
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return nil, false
+	}
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+// send writes an event without an ID (used before a job exists).
+func (s *sseWriter) send(eventType string, data any) {
+	jsonData, _ := json.Marshal(data)
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", eventType, jsonData)
+	s.flusher.Flush()
+}
+
+// sendJobEvent writes a persisted job event. The ID is "<job_id>:<seq>" so a
+// reconnecting EventSource can resume the same job via Last-Event-ID.
+func (s *sseWriter) sendJobEvent(e *domain.JobEvent) {
+	fmt.Fprintf(s.w, "id: %s:%d\nevent: %s\ndata: %s\n\n", e.JobID, e.Seq, e.Type, e.Data)
+	s.flusher.Flush()
+}
+
+func (s *sseWriter) comment(text string) {
+	fmt.Fprintf(s.w, ": %s\n\n", text)
+	s.flusher.Flush()
+}
+
+// parseLastEventID reads the SSE resume position from the Last-Event-ID header
+// (sent by EventSource on reconnect) or the last_event_id query parameter.
+// The job ID part is optional; jobID is uuid.Nil when absent.
+func parseLastEventID(r *http.Request) (jobID uuid.UUID, seq int, ok bool) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return uuid.Nil, 0, false
+	}
+
+	seqStr := v
+	if i := strings.LastIndex(v, ":"); i >= 0 {
+		id, err := uuid.Parse(v[:i])
+		if err != nil {
+			return uuid.Nil, 0, false
+		}
+		jobID, seqStr = id, v[i+1:]
+	}
+	seq, err := strconv.Atoi(seqStr)
+	if err != nil || seq < 0 {
+		return uuid.Nil, 0, false
+	}
+	return jobID, seq, true
+}
+
+// resumeJob streams the job named by Last-Event-ID, if any. A reconnecting
+// EventSource re-requests the URL that started the job, so this keeps a
+// reconnect from starting a second job. It returns true if it handled the request.
+func (h *Handler) resumeJob(sse *sseWriter, r *http.Request, projectID uuid.UUID, kind domain.JobKind) bool {
+	jobID, seq, ok := parseLastEventID(r)
+	if !ok || jobID == uuid.Nil {
+		return false
+	}
+
+	job, err := h.repo.GetJob(r.Context(), jobID)
+	if err != nil || job.ProjectID != projectID || job.Kind != kind {
+		sse.send(jobs.EventFail, map[string]string{"error": "not_found", "message": "Job not found"})
+		return true
+	}
+	h.streamJob(sse, r, job.ID, seq)
+	return true
+}
+
+// startJob submits a job and streams its events. queued is sent as a stage
+// event if the job has to wait for another job on the same project.
+func (h *Handler) startJob(sse *sseWriter, r *http.Request, projectID uuid.UUID, kind domain.JobKind, params, queued any, run jobs.Func) {
+	paramsJSON, _ := json.Marshal(params)
+	job := &domain.Job{
+		ID:        uuid.New(),
+		ProjectID: projectID,
+		Kind:      kind,
+		Params:    paramsJSON,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := h.jobs.Submit(r.Context(), jobs.Task{Job: job, Run: run, Queued: queued}); err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) {
+			sse.send(jobs.EventFail, map[string]string{"error": "busy", "message": "Too many jobs queued, try again later"})
+			return
+		}
+		sse.send(jobs.EventFail, map[string]string{"error": "internal_error", "message": "Failed to start job"})
+		return
+	}
+	h.streamJob(sse, r, job.ID, 0)
+}
+
+// streamJob replays a job's events after afterSeq, then follows new events
+// until the job finishes or the client disconnects. Disconnecting does not
+// affect the job.
+func (h *Handler) streamJob(sse *sseWriter, r *http.Request, jobID uuid.UUID, afterSeq int) {
+	notify, unsubscribe := h.jobs.Subscribe(jobID)
+	defer unsubscribe()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		events, err := h.repo.ListJobEvents(r.Context(), jobID, afterSeq)
+		if err != nil {
+			if r.Context().Err() == nil {
+				sse.send(jobs.EventFail, map[string]string{"error": "internal_error", "message": "Failed to load job events"})
+			}
+			return
+		}
+		for _, e := range events {
+			sse.sendJobEvent(e)
+			afterSeq = e.Seq
+			if jobs.IsTerminal(e.Type) {
+				return
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-notify:
+		case <-keepAlive.C:
+			// Guard against a finished job whose terminal event was never stored
+			if job, err := h.repo.GetJob(r.Context(), jobID); err == nil && job.Status.IsFinished() {
+				if more, _ := h.repo.ListJobEvents(r.Context(), jobID, afterSeq); len(more) == 0 {
+					eventType := jobs.EventComplete
+					if job.Status == domain.JobStatusFailed {
+						eventType = jobs.EventFail
+					}
+					sse.sendJobEvent(&domain.JobEvent{JobID: jobID, Seq: afterSeq + 1, Type: eventType, Data: job.Result})
+					return
+				}
+				continue
+			}
+			sse.comment("keep-alive")
+		}
+	}
+}
+
+// Job endpoints
+
+type listJobsResponse struct {
+	Jobs []*domain.Job `json:"jobs"`
+}
+
+type getJobResponse struct {
+	Job    *domain.Job        `json:"job"`
+	Events []*domain.JobEvent `json:"events"` // Stage history, including the terminal event
+}
+
+// loadProjectJob resolves the projectId/jobId path values, writing an error
+// response and returning nil if the job doesn't exist in the project.
+func (h *Handler) loadProjectJob(w http.ResponseWriter, r *http.Request) *domain.Job {
+	projectID, err := parseUUID(r.PathValue("projectId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid project ID format")
+		return nil
+	}
+
+	jobID, err := parseUUID(r.PathValue("jobId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid job ID format")
+		return nil
+	}
+
+	job, err := h.repo.GetJob(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "Job not found")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get job")
+		return nil
+	}
+
+	if job.ProjectID != projectID {
+		writeError(w, http.StatusNotFound, "not_found", "Job not found in this project")
+		return nil
+	}
+	return job
+}
+
+func (h *Handler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseUUID(r.PathValue("projectId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid project ID format")
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	list, err := h.repo.ListJobs(r.Context(), projectID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list jobs")
+		return
+	}
+	if list == nil {
+		list = []*domain.Job{}
+	}
+
+	writeJSON(w, http.StatusOK, listJobsResponse{Jobs: list})
+}
+
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job := h.loadProjectJob(w, r)
+	if job == nil {
+		return
+	}
+
+	events, err := h.repo.ListJobEvents(r.Context(), job.ID, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get job events")
+		return
+	}
+	if events == nil {
+		events = []*domain.JobEvent{}
+	}
+
+	writeJSON(w, http.StatusOK, getJobResponse{Job: job, Events: events})
+}
+
+// JobEvents streams a job's events over SSE, starting after Last-Event-ID
+// (either "<job_id>:<seq>" or a bare sequence number) if given.
+func (h *Handler) JobEvents(w http.ResponseWriter, r *http.Request) {
+	job := h.loadProjectJob(w, r)
+	if job == nil {
+		return
+	}
+
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		return
+	}
+
+	_, seq, _ := parseLastEventID(r)
+	h.streamJob(sse, r, job.ID, seq)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// projectLocks serializes compiles per project, so each compile reads the
+// snapshot written by the previous one. The zero value is ready to use.
+type projectLocks struct {
+	mu    sync.Mutex
+	locks map[uuid.UUID]*projectLock
+}
+
+// projectLock is the lock of one project. It is dropped from projectLocks
+// once nobody holds or waits for it.
+type projectLock struct {
+	ch   chan struct{}
+	refs int // Holders and waiters
+}
+
+func (l *projectLocks) acquire(projectID uuid.UUID) *projectLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[uuid.UUID]*projectLock)
+	}
+	lock, ok := l.locks[projectID]
+	if !ok {
+		lock = &projectLock{ch: make(chan struct{}, 1)}
+		l.locks[projectID] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (l *projectLocks) release(projectID uuid.UUID, lock *projectLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, projectID)
+	}
+}
+
+// Lock waits for the project's lock. It returns the unlock func, or the
+// context's error if ctx is done first.
+func (l *projectLocks) Lock(ctx context.Context, projectID uuid.UUID) (func(), error) {
+	lock := l.acquire(projectID)
+	select {
+	case lock.ch <- struct{}{}:
+		return func() {
+			<-lock.ch
+			l.release(projectID, lock)
+		}, nil
+	case <-ctx.Done():
+		l.release(projectID, lock)
+		return nil, ctx.Err()
+	}
+}
+
+// Held reports whether a compile currently holds the project's lock.
+func (l *projectLocks) Held(projectID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[projectID]
+	return ok && len(lock.ch) > 0
+}
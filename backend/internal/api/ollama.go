@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+type pullModelRequest struct {
+	Model string `json:"model"` // e.g. "llama3.2" or "qwen2.5:7b"
+}
+
+// pullProgressEvent is a "progress" event of a model pull.
+type pullProgressEvent struct {
+	llm.OllamaPullProgress
+	Percent   int   `json:"percent,omitempty"` // Share of the current layer downloaded
+	ElapsedMs int64 `json:"elapsed_ms"`
+}
+
+type pullCompleteEvent struct {
+	Model     string `json:"model"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+// PullOllamaModel downloads a model to the Ollama server, streaming its
+// progress as SSE. The pull stops if the client disconnects.
+// SSE event types: "progress" while Ollama downloads and verifies the model,
+// "complete" once it is ready, "fail" for failure
+func (h *Handler) PullOllamaModel(w http.ResponseWriter, r *http.Request) {
+	if h.compiler == nil || !ollamaAvailable(h.compiler.Factory()) {
+		writeError(w, http.StatusServiceUnavailable, "service_unavailable", "Ollama server not available (check OLLAMA_HOST or start Ollama)")
+		return
+	}
+
+	var req pullModelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	req.Model = strings.TrimSpace(req.Model)
+	if req.Model == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "model is required")
+		return
+	}
+
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		return
+	}
+	start := time.Now()
+	err := h.compiler.Factory().PullOllamaModel(r.Context(), req.Model, func(p llm.OllamaPullProgress) {
+		event := pullProgressEvent{OllamaPullProgress: p, ElapsedMs: time.Since(start).Milliseconds()}
+		if p.Total > 0 {
+			event.Percent = int(p.Completed * 100 / p.Total)
+		}
+		sse.send("progress", event)
+	})
+	if err != nil {
+		log.Printf("PullOllamaModel: pull of %s failed: %v", req.Model, err)
+		sse.send("fail", map[string]string{"error": "pull_failed", "message": err.Error()})
+		return
+	}
+	sse.send("complete", pullCompleteEvent{Model: req.Model, ElapsedMs: time.Since(start).Milliseconds()})
+}
+
+// ollamaAvailable reports whether factory can reach an Ollama server.
+func ollamaAvailable(factory llm.ClientFactory) bool {
+	for _, p := range factory.ListProviders() {
+		if p.ID == llm.ProviderOllama {
+			return p.Available
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+type listPromptsResponse struct {
+	DefaultVersion llm.PromptVersion       `json:"default_version"`
+	Versions       []llm.PromptVersionInfo `json:"versions"`
+}
+
+// ListPrompts lists the available prompt versions and the roles each one has
+// its own prompt for.
+func (h *Handler) ListPrompts(w http.ResponseWriter, r *http.Request) {
+	if h.compiler == nil {
+		writeJSON(w, http.StatusOK, listPromptsResponse{Versions: []llm.PromptVersionInfo{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, listPromptsResponse{
+		DefaultVersion: h.compiler.DefaultPromptVersion(),
+		Versions:       h.compiler.Prompts().Versions(),
+	})
+}
+
+type setPromptVersionRequest struct {
+	PromptVersion llm.PromptVersion `json:"prompt_version"` // Empty to use the server default
+}
+
+// SetPromptVersion pins the prompt version a project's LLM calls use, or
+// unpins it.
+func (h *Handler) SetPromptVersion(w http.ResponseWriter, r *http.Request) {
+	project := h.loadProject(w, r)
+	if project == nil {
+		return
+	}
+
+	var req setPromptVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if err := h.checkPromptVersion(req.PromptVersion); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	project.PromptVersion = string(req.PromptVersion)
+	project.UpdatedAt = time.Now().UTC()
+	if err := h.repo.UpdateProject(r.Context(), project); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to update project")
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
+
+// checkPromptVersion returns an error if version is set but not available.
+func (h *Handler) checkPromptVersion(version llm.PromptVersion) error {
+	if version == "" || h.compiler == nil || h.compiler.Prompts().Has(version) {
+		return nil
+	}
+	return fmt.Errorf("unknown prompt version %q; GET /prompts lists the available versions", version)
+}
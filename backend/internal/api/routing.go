@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+type setModelRoutingRequest struct {
+	ModelRouting domain.ModelRouting `json:"model_routing"` // null or {} to use the server's routing
+}
+
+// SetModelRouting sets the models a project's LLM roles are routed to, or
+// removes the project's routing.
+func (h *Handler) SetModelRouting(w http.ResponseWriter, r *http.Request) {
+	project := h.loadProject(w, r)
+	if project == nil {
+		return
+	}
+
+	var req setModelRoutingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if err := h.checkModelRouting(req.ModelRouting); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", "Invalid model routing: "+err.Error())
+		return
+	}
+
+	project.ModelRouting = req.ModelRouting
+	if len(project.ModelRouting) == 0 {
+		project.ModelRouting = nil
+	}
+	project.UpdatedAt = time.Now().UTC()
+	if err := h.repo.UpdateProject(r.Context(), project); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to update project")
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
+
+// checkModelRouting returns an error if routing is invalid or routes a role
+// to a provider that isn't available.
+func (h *Handler) checkModelRouting(routing domain.ModelRouting) error {
+	if err := routing.Validate(); err != nil {
+		return err
+	}
+	if h.compiler == nil {
+		return nil
+	}
+	available := make(map[llm.Provider]bool)
+	for _, p := range h.compiler.Factory().ListProviders() {
+		available[p.ID] = p.Available
+	}
+	for _, role := range slices.Sorted(maps.Keys(routing)) {
+		if provider := llm.Provider(routing[role].Provider); !available[provider] {
+			return fmt.Errorf("%s: provider %q is not available; GET /models lists the available providers", role, provider)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/compiler"
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// usageTracker collects the LLM calls made while handling a request, so they
+// can be saved against the project and the snapshot they produced, along
+// with their audit entries when the audit log is on. It also refuses calls
+// that could take usage past one of the request's budgets.
+type usageTracker struct {
+	projectID uuid.UUID
+	factory   llm.ClientFactory
+	prices    llm.PriceTable
+	audit     *AuditConfig
+	budgets   []budgetStatus // Usage as of the start of the request
+
+	mu          sync.Mutex
+	calls       []*domain.LLMCall
+	entries     []*domain.LLMAuditEntry
+	questionIDs []uuid.UUID
+	spent       domain.UsageTotals // Usage of the calls recorded, saved or not
+	reserved    domain.UsageTotals // Estimated usage of the calls in flight
+}
+
+// trackUsage returns a context that records the compiler's LLM calls in a
+// new usageTracker and checks each against budgets before it is made.
+func (h *Handler) trackUsage(ctx context.Context, projectID uuid.UUID, budgets []budgetStatus) (context.Context, *usageTracker) {
+	factory := h.compiler.Factory()
+	t := &usageTracker{projectID: projectID, factory: factory, prices: factory.Prices(), audit: h.audit, budgets: budgets}
+	ctx = compiler.WithCallGuard(ctx, t.guard)
+	return compiler.WithCallRecorder(ctx, t.record), t
+}
+
+// guard refuses a call if the usage of the budget period so far, plus the
+// estimated usage of the calls in flight and of this one, would be over a
+// budget. A call is estimated at its prompt's tokens plus a full max tokens
+// of output, so an ensemble's parallel compiles reserve max tokens once per
+// model.
+func (t *usageTracker) guard(call compiler.LLMCall) (func(), error) {
+	if len(t.budgets) == 0 {
+		return func() {}, nil
+	}
+	usage := llm.Usage{
+		InputTokens:  t.factory.TokenEstimator(call.Provider, call.Model).EstimateMessages(call.Request.Messages),
+		OutputTokens: call.Request.MaxTokens,
+	}
+	estimate := domain.UsageTotals{Calls: 1, InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens}
+	if cost, ok := t.prices.Cost(call.Provider, call.Model, usage); ok {
+		estimate.CostUSD = cost
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.reserved
+	pending.Merge(estimate)
+	for _, b := range t.budgets {
+		b.Usage.Merge(t.spent)
+		total := b.Usage
+		total.Merge(pending)
+		if b.Budget.Used(total) > 1 {
+			b.Estimate = &pending
+			return nil, &budgetExceededError{status: &b}
+		}
+	}
+	t.reserved = pending
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.reserved.Calls--
+		t.reserved.InputTokens -= estimate.InputTokens
+		t.reserved.OutputTokens -= estimate.OutputTokens
+		t.reserved.CostUSD -= estimate.CostUSD
+	}, nil
+}
+
+// record keeps the usage of a successful call, since failed calls report no
+// usage, and the audit entry of any call.
+func (t *usageTracker) record(call compiler.LLMCall) {
+	var entry *domain.LLMAuditEntry
+	if t.audit != nil {
+		entry = t.audit.entry(t.projectID, call)
+	}
+	if call.Err != nil {
+		if entry != nil {
+			t.mu.Lock()
+			t.entries = append(t.entries, entry)
+			t.mu.Unlock()
+		}
+		return
+	}
+
+	c := &domain.LLMCall{
+		ID:           uuid.New(),
+		ProjectID:    t.projectID,
+		Role:         call.Role,
+		Provider:     string(call.Provider),
+		Model:        call.Model,
+		InputTokens:  call.Usage.InputTokens,
+		OutputTokens: call.Usage.OutputTokens,
+		CachedTokens: call.Usage.CachedTokens,
+		LatencyMs:    call.Usage.Latency.Milliseconds(),
+		StopReason:   call.Usage.StopReason,
+		CacheHit:     call.CacheHit,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if cost, ok := t.prices.Cost(call.Provider, call.Model, call.Usage); ok {
+		c.CostUSD = &cost
+	}
+
+	if entry != nil {
+		// The audit entry of a call shares the ID of its usage record
+		entry.ID = c.ID
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, c)
+	t.spent.Add(c)
+	if entry != nil {
+		t.entries = append(t.entries, entry)
+	}
+}
+
+// linkQuestions links the calls saved next to the questions they produced.
+func (t *usageTracker) linkQuestions(questions []*domain.Question) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, q := range questions {
+		t.questionIDs = append(t.questionIDs, q.ID)
+	}
+}
+
+// save persists the calls recorded since the last save, and their audit
+// entries, linked to snapshotID if it is set. Calls are saved even when the
+// request fails, since they were billed all the same.
+func (t *usageTracker) save(ctx context.Context, repo repository.Repository, snapshotID *uuid.UUID) {
+	t.mu.Lock()
+	calls, entries, questionIDs := t.calls, t.entries, t.questionIDs
+	t.calls, t.entries, t.questionIDs = nil, nil, nil
+	t.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	for _, c := range calls {
+		c.SnapshotID = snapshotID
+		if err := repo.CreateLLMCall(ctx, c); err != nil {
+			log.Printf("Warning: failed to save LLM call %s for project %s: %v", c.ID, t.projectID, err)
+		}
+	}
+	if len(entries) > 0 {
+		t.audit.prune(ctx, repo)
+	}
+	for _, e := range entries {
+		e.SnapshotID = snapshotID
+		e.QuestionIDs = questionIDs
+		if err := repo.CreateLLMAuditEntry(ctx, e); err != nil {
+			log.Printf("Warning: failed to save LLM audit entry %s for project %s: %v", e.ID, t.projectID, err)
+		}
+	}
+}
+
+// withUsage returns copies of snapshots with their LLM usage set.
+func (h *Handler) withUsage(ctx context.Context, snapshots []*domain.SpecSnapshot) []*domain.SpecSnapshot {
+	ids := make([]uuid.UUID, len(snapshots))
+	for i, s := range snapshots {
+		ids[i] = s.ID
+	}
+	usage, err := h.repo.GetSnapshotUsage(ctx, ids)
+	if err != nil {
+		log.Printf("Warning: failed to get snapshot usage: %v", err)
+		return snapshots
+	}
+
+	result := make([]*domain.SpecSnapshot, len(snapshots))
+	for i, s := range snapshots {
+		cp := *s
+		if totals, ok := usage[s.ID]; ok {
+			cp.Usage = &totals
+		}
+		result[i] = &cp
+	}
+	return result
+}
+
+// GetProjectUsage returns the token usage and estimated cost of a project's
+// LLM calls, overall, by role and by model.
+func (h *Handler) GetProjectUsage(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseUUID(r.PathValue("projectId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_uuid", "Invalid project ID format")
+		return
+	}
+
+	if _, err := h.repo.GetProject(r.Context(), projectID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "Project not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get project")
+		return
+	}
+
+	usage, err := h.repo.GetProjectUsage(r.Context(), projectID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
@@ -0,0 +1,95 @@
+// Package audit masks secrets and personal data in the LLM prompts and
+// responses kept in the audit log. Redaction is pattern based, so it catches
+// common formats rather than guaranteeing that nothing sensitive is stored.
+package audit
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// rule replaces the matches of a pattern with a [REDACTED:kind] marker.
+type rule struct {
+	kind string
+	re   *regexp.Regexp
+	// keep marks patterns whose first group is a prefix to keep, such as the
+	// key of a key=value pair
+	keep bool
+	// valid, if set, filters matches, for patterns that overmatch
+	valid func(match string) bool
+}
+
+// builtinRules are applied in order, before any extra patterns. More specific
+// patterns come first so that, say, a JWT in a bearer header is reported as a
+// JWT.
+var builtinRules = []rule{
+	{kind: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{kind: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: "api_key", re: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`)},
+	{kind: "api_key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{kind: "api_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "api_key", re: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`)},
+	{kind: "api_key", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{kind: "token", re: regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{16,}`), keep: true},
+	{kind: "secret", re: regexp.MustCompile(`(?i)(\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret)["'\\]*\s*[:=]\s*["'\\]*)[^\s"'\\,;]+`), keep: true},
+	{kind: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{kind: "phone", re: regexp.MustCompile(`(?:\+1[\s.-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.-])\d{3}[\s.-]\d{4}\b`)},
+	{kind: "phone", re: regexp.MustCompile(`\+[1-9]\d{7,14}\b`)},
+	{kind: "card", re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+}
+
+// Redactor masks secrets and personal data in text. It is safe for
+// concurrent use.
+type Redactor struct {
+	rules []rule
+}
+
+// NewRedactor returns a Redactor that applies the built-in patterns and then
+// the extra regular expressions, whose matches are reported as "custom".
+func NewRedactor(extra []string) (*Redactor, error) {
+	rules := append([]rule(nil), builtinRules...)
+	for _, pattern := range extra {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, rule{kind: "custom", re: re})
+	}
+	return &Redactor{rules: rules}, nil
+}
+
+// Redact returns s with every match replaced by a [REDACTED:kind] marker.
+func (r *Redactor) Redact(s string) string {
+	for _, rl := range r.rules {
+		marker := "[REDACTED:" + rl.kind + "]"
+		s = rl.re.ReplaceAllStringFunc(s, func(match string) string {
+			if rl.valid != nil && !rl.valid(match) {
+				return match
+			}
+			if rl.keep {
+				return rl.re.FindStringSubmatch(match)[1] + marker
+			}
+			return marker
+		})
+	}
+	return s
+}
+
+// luhn reports whether the digits of s pass the Luhn check that payment card
+// numbers carry.
+func luhn(s string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
@@ -1,32 +1,107 @@
 package compiler
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/dshills/specbuilder/backend/internal/domain"
 	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/trace"
 	"github.com/dshills/specbuilder/backend/internal/validator"
 	"github.com/google/uuid"
 )
 
+// DefaultMaxRepairAttempts is the default number of schema-repair calls made
+// when a compiled spec fails JSON schema validation.
+const DefaultMaxRepairAttempts = 2
+
 // Service handles spec compilation.
 type Service struct {
-	factory       llm.ClientFactory
-	validator     *validator.Validator
-	promptVersion llm.PromptVersion
-	specSchema    string // JSON schema for ProjectImplementationSpec
+	factory           llm.ClientFactory
+	validator         *validator.Validator
+	prompts           *llm.PromptRegistry
+	promptVersion     llm.PromptVersion   // Default; projects and compile requests may select another
+	routing           domain.ModelRouting // Server-wide; projects and requests may select other models
+	specSchema        string              // JSON schema for ProjectImplementationSpec
+	maxRepairAttempts int                 // Schema-repair calls after a failed validation (0 disables)
+	rejectInvalid     bool                // Fail with ErrValidationFailed if still invalid after repair
 }
 
 // NewService creates a new compiler service.
 func NewService(factory llm.ClientFactory, val *validator.Validator, specSchema string) *Service {
 	return &Service{
-		factory:       factory,
-		validator:     val,
-		promptVersion: llm.PromptVersionV1,
-		specSchema:    specSchema,
+		factory:           factory,
+		validator:         val,
+		prompts:           llm.NewPromptRegistry(),
+		promptVersion:     llm.DefaultPromptVersion,
+		specSchema:        specSchema,
+		maxRepairAttempts: DefaultMaxRepairAttempts,
+	}
+}
+
+// SetRepairPolicy configures the schema-repair loop that runs after each compile.
+// maxAttempts is the number of repair calls made when the spec fails schema
+// validation (0 disables repair). If rejectInvalid is true, a spec that is still
+// invalid after the last attempt fails with domain.ErrValidationFailed; otherwise
+// it is returned with its validation errors so the caller can flag it.
+func (s *Service) SetRepairPolicy(maxAttempts int, rejectInvalid bool) {
+	if maxAttempts < 0 {
+		maxAttempts = 0
+	}
+	s.maxRepairAttempts = maxAttempts
+	s.rejectInvalid = rejectInvalid
+}
+
+// SetPrompts replaces the prompt registry and the default prompt version,
+// which must be in it.
+func (s *Service) SetPrompts(prompts *llm.PromptRegistry, version llm.PromptVersion) error {
+	if !prompts.Has(version) {
+		return fmt.Errorf("default prompt version %q: %w", version, llm.ErrUnknownPromptVersion)
+	}
+	s.prompts, s.promptVersion = prompts, version
+	return nil
+}
+
+// Prompts returns the prompt registry.
+func (s *Service) Prompts() *llm.PromptRegistry {
+	return s.prompts
+}
+
+// DefaultPromptVersion returns the prompt version used unless a project or
+// request selects another.
+func (s *Service) DefaultPromptVersion() llm.PromptVersion {
+	return s.promptVersion
+}
+
+// resolvePromptVersion returns the prompt version to use: override if set,
+// else the version the project pins, else the default.
+func (s *Service) resolvePromptVersion(project *domain.Project, override llm.PromptVersion) (llm.PromptVersion, error) {
+	version := override
+	if version == "" && project != nil {
+		version = llm.PromptVersion(project.PromptVersion)
+	}
+	if version == "" {
+		return s.promptVersion, nil
+	}
+	if !s.prompts.Has(version) {
+		return "", fmt.Errorf("%w: prompt version %q: %w", domain.ErrInvalidInput, version, llm.ErrUnknownPromptVersion)
+	}
+	return version, nil
+}
+
+// ProgressFunc receives progress updates (stage name and human-readable message)
+// from long-running service calls. It may be nil.
+type ProgressFunc func(stage, message string)
+
+func (f ProgressFunc) report(stage, message string) {
+	if f != nil {
+		f(stage, message)
 	}
 }
 
@@ -54,40 +129,52 @@ type CompileInput struct {
 	CurrentSpec json.RawMessage // Previous spec if exists
 	Provider    llm.Provider    // Optional: override default provider
 	Model       string          // Optional: override default model
+	Progress    ProgressFunc    // Optional: receives "compiling"/"repairing"/"merging" progress updates
+	Stream      StreamFunc      // Optional: receives token counts and retries while the model runs
+
+	// Optional: the prompt version to compile with, instead of the project's
+	PromptVersion llm.PromptVersion
+
+	// Incremental compiles regenerate only the top-level sections whose questions
+	// changed since PreviousDerivedFrom (the previous snapshot's DerivedFrom).
+	// The trace entries of the other sections are kept from PreviousTrace (the
+	// previous snapshot's trace), or from the trace embedded in CurrentSpec.
+	Incremental         bool
+	PreviousDerivedFrom map[uuid.UUID]int
+	PreviousTrace       json.RawMessage
 }
 
 // CompileOutput holds compilation result.
 type CompileOutput struct {
-	Spec        json.RawMessage   `json:"spec"`
-	Trace       json.RawMessage   `json:"trace"`
-	DerivedFrom map[uuid.UUID]int // question_id -> answer_version
-	Compiler    domain.CompilerConfig
+	Spec           json.RawMessage   `json:"spec"`
+	Trace          json.RawMessage   `json:"trace"`
+	DerivedFrom    map[uuid.UUID]int // question_id -> answer_version
+	Compiler       domain.CompilerConfig
+	Validation     validator.ValidationResult // Final schema validation result
+	RepairAttempts int                        // Number of schema-repair calls made
+	Disagreements  []domain.IssueDraft        // Ensemble compiles only: conflicts between candidate specs
 }
 
 // compilerResponse represents the LLM output structure.
 type compilerResponse struct {
 	Spec  json.RawMessage `json:"spec"`
 	Trace json.RawMessage `json:"trace"`
+
+	model string // Model that served the call, which may be a fallback
 }
 
 // Compile compiles Q&A bundles into a spec.
 func (s *Service) Compile(ctx context.Context, input CompileInput) (*CompileOutput, error) {
-	// Create LLM client (use specified or default)
-	var llmClient llm.Client
 	var err error
-	if input.Provider != "" && input.Model != "" {
-		llmClient, err = s.factory.CreateClient(input.Provider, input.Model)
-	} else {
-		llmClient, err = s.factory.CreateDefaultClient()
-	}
+	input.PromptVersion, err = s.resolvePromptVersion(input.Project, input.PromptVersion)
 	if err != nil {
-		return nil, fmt.Errorf("create llm client: %w", err)
+		return nil, err
 	}
 
-	// Load compiler prompt
-	prompt, err := llm.LoadPrompt("compiler", s.promptVersion)
+	// Create LLM client (use specified or routed)
+	llmClient, err := s.client(domain.LLMRoleCompiler, input.Project, input.Provider, input.Model)
 	if err != nil {
-		return nil, fmt.Errorf("load prompt: %w", err)
+		return nil, err
 	}
 
 	// Prepare Q&A bundle JSON
@@ -96,35 +183,105 @@ func (s *Service) Compile(ctx context.Context, input CompileInput) (*CompileOutp
 		return nil, fmt.Errorf("marshal qa bundles: %w", err)
 	}
 
-	// Prepare current spec (or empty object)
-	currentSpec := input.CurrentSpec
-	if len(currentSpec) == 0 {
-		currentSpec = []byte("{}")
-	}
-
 	// Prepare project JSON
 	projectJSON, err := json.Marshal(input.Project)
 	if err != nil {
 		return nil, fmt.Errorf("marshal project: %w", err)
 	}
 
+	// Incremental mode regenerates only the sections affected by changed answers;
+	// it falls back to a full compile when the affected sections can't be determined.
+	var sections []string
+	if input.Incremental {
+		sections = IncrementalSections(input.QABundles, input.PreviousDerivedFrom, input.CurrentSpec)
+	}
+
+	var compilerResp *compilerResponse
+	if len(sections) > 0 {
+		input.Progress.report("compiling", fmt.Sprintf("Regenerating sections: %s...", strings.Join(sections, ", ")))
+		compilerResp, err = s.compileSections(ctx, llmClient, input, projectJSON, sections)
+	} else {
+		compilerResp, err = s.compileFull(ctx, llmClient, input, projectJSON, qaBundleJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate spec against schema, sending errors back to the model for repair
+	var result validator.ValidationResult
+	var repairAttempts int
+	compilerResp.Spec, result, repairAttempts, err = s.repairSpec(ctx, llmClient, input, projectJSON, qaBundleJSON, compilerResp.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		log.Printf("Compile: spec still has %d schema errors after %d repair attempts", len(result.Errors), repairAttempts)
+		if s.rejectInvalid {
+			return nil, fmt.Errorf("%w: %d errors remain after %d repair attempts", domain.ErrValidationFailed, len(result.Errors), repairAttempts)
+		}
+	}
+
+	// The trace is normally returned alongside the spec; fall back to the copy embedded in it
+	traceJSON := compilerResp.Trace
+	if len(traceJSON) == 0 || string(traceJSON) == "null" {
+		traceJSON = trace.FromSpec(compilerResp.Spec)
+	}
+
+	// Build derived_from map
+	derivedFrom := make(map[uuid.UUID]int)
+	for _, qa := range input.QABundles {
+		derivedFrom[qa.QuestionID] = qa.AnswerVersion
+	}
+
+	return &CompileOutput{
+		Spec:        compilerResp.Spec,
+		Trace:       traceJSON,
+		DerivedFrom: derivedFrom,
+		Compiler: domain.CompilerConfig{
+			Model:         cmp.Or(compilerResp.model, llmClient.Model()),
+			PromptVersion: string(input.PromptVersion),
+			Temperature:   0,
+			Sections:      sections,
+		},
+		Validation:     result,
+		RepairAttempts: repairAttempts,
+	}, nil
+}
+
+// compileFull asks the model to (re)generate the whole spec.
+func (s *Service) compileFull(ctx context.Context, llmClient llm.Client, input CompileInput, projectJSON, qaBundleJSON []byte) (*compilerResponse, error) {
+	// Load compiler prompt
+	prompt, err := s.prompts.Load("compiler", input.PromptVersion)
+	if err != nil {
+		return nil, fmt.Errorf("load prompt: %w", err)
+	}
+
+	// Prepare current spec (or empty object)
+	currentSpec := input.CurrentSpec
+	if len(currentSpec) == 0 {
+		currentSpec = []byte("{}")
+	}
+
 	// Render prompt (schema is now embedded in prompt template for efficiency)
-	renderedPrompt := prompt.Render(map[string]string{
+	messages, err := prompt.Messages(map[string]string{
 		"PROJECT":           string(projectJSON),
 		"QA_BUNDLE_JSON":    string(qaBundleJSON),
 		"CURRENT_SPEC_JSON": string(currentSpec),
 	})
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
 
 	// Call LLM
 	req := llm.Request{
-		Messages: []llm.Message{
-			{Role: "user", Content: renderedPrompt},
-		},
-		Temperature: 0,
-		MaxTokens:   32000, // Large output for full spec (increased from 16000 to prevent truncation)
+		Messages:      messages,
+		Temperature:   0,
+		MaxTokens:     32000, // Large output for full spec (increased from 16000 to prevent truncation)
+		Schema:        s.compilerSchema(),
+		PromptVersion: input.PromptVersion,
 	}
 
-	resp, err := llmClient.Complete(ctx, req)
+	resp, err := complete(ctx, llmClient, req, "compiling", input.Stream)
 	if err != nil {
 		return nil, fmt.Errorf("llm call: %w", err)
 	}
@@ -134,30 +291,131 @@ func (s *Service) Compile(ctx context.Context, input CompileInput) (*CompileOutp
 	if err := json.Unmarshal([]byte(resp.Content), &compilerResp); err != nil {
 		return nil, fmt.Errorf("parse llm response: %w (response: %s)", err, resp.Content[:min(500, len(resp.Content))])
 	}
+	compilerResp.model = resp.Model
+	return &compilerResp, nil
+}
 
-	// Validate spec against schema
-	result := s.validator.ValidateSpec(compilerResp.Spec)
-	if !result.Valid {
-		// Log validation errors but don't fail - let validator LLM handle it
-		// In production, we might want to retry or return a partial result
+// repairSpec validates spec against the schema and sends the errors back to
+// the model for repair, up to maxRepairAttempts times. It returns the last
+// spec, its validation result, and the number of repair calls made.
+func (s *Service) repairSpec(ctx context.Context, llmClient llm.Client, input CompileInput, projectJSON, qaBundleJSON []byte, spec json.RawMessage) (json.RawMessage, validator.ValidationResult, int, error) {
+	result := s.validator.ValidateSpec(spec)
+	attempts := 0
+	for !result.Valid && attempts < s.maxRepairAttempts {
+		attempts++
+		input.Progress.report("repairing", fmt.Sprintf("Repairing %d schema errors (attempt %d of %d)...",
+			len(result.Errors), attempts, s.maxRepairAttempts))
+
+		repaired, err := s.repair(ctx, llmClient, input.PromptVersion, projectJSON, qaBundleJSON, spec, result.Errors, input.Stream)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, result, attempts, fmt.Errorf("repair spec: %w", ctx.Err())
+			}
+			log.Printf("Compile: repair attempt %d failed: %v", attempts, err)
+			if errors.Is(err, ErrCallRefused) {
+				break // Further attempts would be refused too
+			}
+			continue
+		}
+		spec = repaired
+		result = s.validator.ValidateSpec(spec)
 	}
+	return spec, result, attempts, nil
+}
 
-	// Build derived_from map
-	derivedFrom := make(map[uuid.UUID]int)
-	for _, qa := range input.QABundles {
-		derivedFrom[qa.QuestionID] = qa.AnswerVersion
+// repairResponse represents the repairer LLM output structure.
+type repairResponse struct {
+	Spec json.RawMessage `json:"spec"`
+}
+
+// repair asks the model to fix the given schema validation errors in spec.
+func (s *Service) repair(ctx context.Context, llmClient llm.Client, version llm.PromptVersion, projectJSON, qaBundleJSON, spec json.RawMessage, errs []validator.ValidationError, onStream StreamFunc) (json.RawMessage, error) {
+	prompt, err := s.prompts.Load("repairer", version)
+	if err != nil {
+		return nil, fmt.Errorf("load prompt: %w", err)
 	}
 
-	return &CompileOutput{
-		Spec:        compilerResp.Spec,
-		Trace:       compilerResp.Trace,
-		DerivedFrom: derivedFrom,
-		Compiler: domain.CompilerConfig{
-			Model:         llmClient.Model(),
-			PromptVersion: string(s.promptVersion),
-			Temperature:   0,
-		},
-	}, nil
+	errorsJSON, err := json.Marshal(errs)
+	if err != nil {
+		return nil, fmt.Errorf("marshal validation errors: %w", err)
+	}
+
+	messages, err := prompt.Messages(map[string]string{
+		"PROJECT":                string(projectJSON),
+		"SPEC_JSON":              string(spec),
+		"VALIDATION_ERRORS_JSON": string(errorsJSON),
+		"QA_BUNDLE_JSON":         string(qaBundleJSON),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
+
+	req := llm.Request{
+		Messages:      messages,
+		Temperature:   0,
+		MaxTokens:     32000,
+		Schema:        s.repairSchema(),
+		PromptVersion: version,
+	}
+
+	resp, err := complete(ctx, llmClient, req, "repairing", onStream)
+	if err != nil {
+		return nil, fmt.Errorf("llm call: %w", err)
+	}
+
+	var repairResp repairResponse
+	if err := json.Unmarshal([]byte(resp.Content), &repairResp); err != nil {
+		return nil, fmt.Errorf("parse repair response: %w", err)
+	}
+	if len(repairResp.Spec) == 0 {
+		return nil, fmt.Errorf("%w: repair response has no spec", llm.ErrInvalidResponse)
+	}
+	return repairResp.Spec, nil
+}
+
+// SchemaIssueDrafts converts schema validation errors that survived the repair
+// loop into error-severity issue drafts, so an invalid spec is visibly flagged.
+func SchemaIssueDrafts(errs []validator.ValidationError) []domain.IssueDraft {
+	drafts := make([]domain.IssueDraft, 0, len(errs))
+	for _, e := range errs {
+		issueType := domain.IssueTypeConflict
+		if strings.Contains(e.Message, "missing propert") {
+			issueType = domain.IssueTypeMissing
+		}
+		drafts = append(drafts, domain.IssueDraft{
+			Type:               issueType,
+			Severity:           domain.IssueSeverityError,
+			Message:            "Schema validation failed: " + e.Message,
+			RelatedSpecPaths:   []string{e.Path},
+			RelatedQuestionIDs: []string{},
+		})
+	}
+	return drafts
+}
+
+// TraceIssueDrafts runs the deterministic trace coverage check on a compiled
+// spec against the answer versions it was compiled from.
+func TraceIssueDrafts(spec, traceJSON json.RawMessage, qaBundles []QABundle) []domain.IssueDraft {
+	t, err := trace.Parse(traceJSON)
+	if err != nil {
+		return []domain.IssueDraft{{
+			Type:               domain.IssueTypeConflict,
+			Severity:           domain.IssueSeverityError,
+			Message:            "Trace could not be parsed: " + err.Error(),
+			RelatedSpecPaths:   []string{"/trace"},
+			RelatedQuestionIDs: []string{},
+		}}
+	}
+
+	known := make([]domain.TraceSource, 0, len(qaBundles))
+	for _, qa := range qaBundles {
+		known = append(known, domain.TraceSource{
+			QuestionID:    qa.QuestionID.String(),
+			AnswerID:      qa.AnswerID.String(),
+			AnswerVersion: qa.AnswerVersion,
+		})
+	}
+	return trace.CheckCoverage(spec, t, known)
 }
 
 // ValidatorOutput represents the LLM validator output.
@@ -165,14 +423,33 @@ type ValidatorOutput struct {
 	Issues []domain.IssueDraft `json:"issues"`
 }
 
+// ValidateInput holds input for LLM-based validation.
+type ValidateInput struct {
+	Project   *domain.Project
+	Spec      json.RawMessage
+	Trace     json.RawMessage
+	QABundles []QABundle
+	Provider  llm.Provider // Optional: override the routed provider, normally with the compile's
+	Model     string       // Optional: override the routed model, normally with the compile's
+	// Optional: the prompt version, normally the one the spec was compiled
+	// with; if empty, the project's is used
+	PromptVersion llm.PromptVersion
+}
+
 // Validate runs LLM-based validation on a compiled spec.
-func (s *Service) Validate(ctx context.Context, project *domain.Project, spec, trace json.RawMessage, qaBundles []QABundle) ([]domain.IssueDraft, error) {
-	llmClient, err := s.factory.CreateDefaultClient()
+func (s *Service) Validate(ctx context.Context, input ValidateInput) ([]domain.IssueDraft, error) {
+	project, spec, trace := input.Project, input.Spec, input.Trace
+	version, err := s.resolvePromptVersion(project, input.PromptVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	llmClient, err := s.client(domain.LLMRoleValidator, project, input.Provider, input.Model)
 	if err != nil {
-		return nil, fmt.Errorf("create llm client: %w", err)
+		return nil, err
 	}
 
-	prompt, err := llm.LoadPrompt("validator_llm_optional", s.promptVersion)
+	prompt, err := s.prompts.Load("validator_llm_optional", version)
 	if err != nil {
 		return nil, fmt.Errorf("load prompt: %w", err)
 	}
@@ -184,25 +461,32 @@ func (s *Service) Validate(ctx context.Context, project *domain.Project, spec, t
 		"errors":   schemaResult.Errors,
 	})
 
-	qaBundleJSON, _ := json.Marshal(qaBundles)
+	if len(trace) == 0 {
+		trace = []byte("{}")
+	}
+	projectJSON, _ := json.Marshal(project)
+	qaBundleJSON, _ := json.Marshal(input.QABundles)
 
-	renderedPrompt := prompt.Render(map[string]string{
-		"PROJECT":                project.Name,
+	messages, err := prompt.Messages(map[string]string{
+		"PROJECT":                string(projectJSON),
 		"COMPILED_SPEC_JSON":     string(spec),
 		"TRACE_JSON":             string(trace),
 		"SCHEMA_VALIDATION_JSON": string(schemaValidationJSON),
 		"QA_BUNDLE_JSON":         string(qaBundleJSON),
 	})
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
 
 	req := llm.Request{
-		Messages: []llm.Message{
-			{Role: "user", Content: renderedPrompt},
-		},
-		Temperature: 0,
-		MaxTokens:   4000,
+		Messages:      messages,
+		Temperature:   0,
+		MaxTokens:     4000,
+		Schema:        validatorSchema,
+		PromptVersion: version,
 	}
 
-	resp, err := llmClient.Complete(ctx, req)
+	resp, err := complete(ctx, llmClient, req, "validating", nil)
 	if err != nil {
 		return nil, fmt.Errorf("llm call: %w", err)
 	}
@@ -3,6 +3,7 @@ package compiler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -154,6 +155,33 @@ func TestCompileLLMError(t *testing.T) {
 	}
 }
 
+func TestCompileRecordsFallbackModel(t *testing.T) {
+	primary := llm.NewMockClient("")
+	primary.Error = &llm.APIError{Provider: "mock", StatusCode: 529, Type: "overloaded_error"}
+	backup := llm.NewMockClient(`{"spec": {"product": {"name": "Backup"}}, "trace": {}}`)
+	backup.ModelName = "backup-model"
+
+	mockFactory := llm.NewMockFactoryWithClient(primary)
+	mockFactory.Default = llm.NewFallbackClient(primary, backup)
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	service := NewService(mockFactory, val, `{}`)
+
+	input := CompileInput{
+		Project:   &domain.Project{ID: uuid.New(), Name: "Test Project"},
+		QABundles: []QABundle{},
+	}
+	output, err := service.Compile(testContext(t), input)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if output.Compiler.Model != "backup-model" {
+		t.Errorf("Compile() model = %s, want the fallback that served the call", output.Compiler.Model)
+	}
+}
+
 func TestCompileInvalidJSON(t *testing.T) {
 	mockResponse := `not valid json`
 	service := setupCompilerService(t, mockResponse)
@@ -201,7 +229,7 @@ func TestValidate(t *testing.T) {
 	spec := json.RawMessage(`{"product": {"name": "Test"}}`)
 	trace := json.RawMessage(`{}`)
 
-	issues, err := service.Validate(ctx, project, spec, trace, nil)
+	issues, err := service.Validate(ctx, ValidateInput{Project: project, Spec: spec, Trace: trace})
 	if err != nil {
 		t.Fatalf("Validate() error = %v", err)
 	}
@@ -262,3 +290,230 @@ func TestHydrateIssues(t *testing.T) {
 		t.Errorf("HydrateIssues() type = %s, want assumption", issues[1].Type)
 	}
 }
+
+// validSpecJSON is a minimal ProjectImplementationSpec that passes schema validation.
+const validSpecJSON = `{
+	"product": {
+		"name": "Test Product",
+		"purpose": "A test product",
+		"success_criteria": ["Works correctly"]
+	},
+	"scope": {
+		"in_scope": ["Feature A"],
+		"out_of_scope": [],
+		"assumptions": []
+	},
+	"personas": [{
+		"name": "User",
+		"description": "A test user",
+		"goals": ["Use the product"]
+	}],
+	"requirements": {
+		"functional": [{
+			"id": "FR-001",
+			"title": "Test Feature",
+			"description": "A test feature",
+			"priority": "must",
+			"acceptance_criteria": ["Feature works"]
+		}],
+		"non_functional": [{
+			"id": "NFR-001",
+			"title": "Performance",
+			"description": "Fast response",
+			"metric_or_constraint": "<100ms"
+		}]
+	},
+	"workflows": [{
+		"id": "WF-001",
+		"name": "Main Flow",
+		"actors": ["User"],
+		"preconditions": [],
+		"steps": [{
+			"n": 1,
+			"action": "User clicks button",
+			"system_response": "System shows result"
+		}],
+		"postconditions": ["Result is shown"]
+	}],
+	"data_model": {
+		"entities": [{
+			"name": "Item",
+			"description": "An item",
+			"fields": [{
+				"name": "id",
+				"type": "uuid",
+				"required": true
+			}]
+		}]
+	},
+	"api": {
+		"style": "rest",
+		"auth": {
+			"scheme": "none",
+			"authorization": "No auth required"
+		},
+		"endpoints": [{
+			"id": "EP-001",
+			"method": "GET",
+			"path": "/items",
+			"summary": "List items",
+			"request": {},
+			"responses": [{"status": 200, "body": {}}]
+		}],
+		"errors": [{
+			"code": "NOT_FOUND",
+			"message": "Resource not found",
+			"http_status": 404
+		}]
+	},
+	"ui": {
+		"screens": [{
+			"id": "SCR-001",
+			"name": "Home",
+			"purpose": "Main screen",
+			"states": ["loading", "loaded"],
+			"validations": []
+		}]
+	},
+	"non_functionals": {
+		"performance": "Fast",
+		"reliability": "99.9%",
+		"security": "Basic",
+		"privacy": "No PII",
+		"cost": "Low"
+	},
+	"acceptance": {
+		"definition_of_done": ["Feature complete"],
+		"test_cases": [{
+			"id": "TC-001",
+			"name": "Basic test",
+			"steps": ["Open app"],
+			"expected": ["App opens"]
+		}]
+	},
+	"plan": {
+		"milestones": [{
+			"id": "M1",
+			"name": "MVP",
+			"goals": ["Basic functionality"]
+		}],
+		"tasks": [{
+			"id": "T-001",
+			"milestone_id": "M1",
+			"title": "Implement feature",
+			"description": "Build the thing",
+			"depends_on": []
+		}]
+	},
+	"trace": {
+		"spec_path_to_sources": {
+			"/product": [{
+				"question_id": "q1",
+				"answer_id": "a1",
+				"answer_version": 1
+			}]
+		}
+	}
+}`
+
+func TestCompileRepairsInvalidSpec(t *testing.T) {
+	mockClient := llm.NewMockClient("")
+	mockClient.Responses = []string{
+		`{"spec": {"product": {"name": "Broken"}}, "trace": {}}`,
+		`{"spec": ` + validSpecJSON + `}`,
+	}
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	service := NewService(llm.NewMockFactoryWithClient(mockClient), val, `{}`)
+	ctx := testContext(t)
+
+	var stages []string
+	output, err := service.Compile(ctx, CompileInput{
+		Project:   &domain.Project{ID: uuid.New(), Name: "Test Project"},
+		QABundles: []QABundle{},
+		Progress: func(stage, message string) {
+			stages = append(stages, stage)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if mockClient.CallCount != 2 {
+		t.Errorf("Compile() LLM calls = %d, want 2 (compile + 1 repair)", mockClient.CallCount)
+	}
+	if output.RepairAttempts != 1 {
+		t.Errorf("Compile() RepairAttempts = %d, want 1", output.RepairAttempts)
+	}
+	if !output.Validation.Valid {
+		t.Errorf("Compile() repaired spec should be valid, got errors: %v", output.Validation.Errors)
+	}
+	if len(stages) != 1 || stages[0] != "repairing" {
+		t.Errorf("Compile() progress stages = %v, want [repairing]", stages)
+	}
+}
+
+func TestCompileInvalidSpecAfterRepair(t *testing.T) {
+	invalidResponse := `{"spec": {"product": {"name": "Broken"}}, "trace": {}}`
+
+	t.Run("flagged", func(t *testing.T) {
+		mockClient := llm.NewMockClient(invalidResponse)
+		val, _ := validator.New()
+		service := NewService(llm.NewMockFactoryWithClient(mockClient), val, `{}`)
+		service.SetRepairPolicy(2, false)
+
+		output, err := service.Compile(testContext(t), CompileInput{
+			Project: &domain.Project{ID: uuid.New(), Name: "Test Project"},
+		})
+		if err != nil {
+			t.Fatalf("Compile() error = %v", err)
+		}
+		if mockClient.CallCount != 3 {
+			t.Errorf("Compile() LLM calls = %d, want 3", mockClient.CallCount)
+		}
+		if output.Validation.Valid || len(output.Validation.Errors) == 0 {
+			t.Error("Compile() should return the remaining validation errors")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		mockClient := llm.NewMockClient(invalidResponse)
+		val, _ := validator.New()
+		service := NewService(llm.NewMockFactoryWithClient(mockClient), val, `{}`)
+		service.SetRepairPolicy(1, true)
+
+		_, err := service.Compile(testContext(t), CompileInput{
+			Project: &domain.Project{ID: uuid.New(), Name: "Test Project"},
+		})
+		if !errors.Is(err, domain.ErrValidationFailed) {
+			t.Errorf("Compile() error = %v, want ErrValidationFailed", err)
+		}
+		if mockClient.CallCount != 2 {
+			t.Errorf("Compile() LLM calls = %d, want 2", mockClient.CallCount)
+		}
+	})
+}
+
+func TestSchemaIssueDrafts(t *testing.T) {
+	drafts := SchemaIssueDrafts([]validator.ValidationError{
+		{Path: "/", Message: "missing property 'scope'"},
+		{Path: "/api/style", Message: "value must be one of 'rest', 'rpc'"},
+	})
+
+	if len(drafts) != 2 {
+		t.Fatalf("SchemaIssueDrafts() count = %d, want 2", len(drafts))
+	}
+	if drafts[0].Type != domain.IssueTypeMissing {
+		t.Errorf("SchemaIssueDrafts() type = %s, want missing", drafts[0].Type)
+	}
+	if drafts[1].Type != domain.IssueTypeConflict {
+		t.Errorf("SchemaIssueDrafts() type = %s, want conflict", drafts[1].Type)
+	}
+	for _, d := range drafts {
+		if d.Severity != domain.IssueSeverityError {
+			t.Errorf("SchemaIssueDrafts() severity = %s, want error", d.Severity)
+		}
+	}
+}
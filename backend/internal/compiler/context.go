@@ -0,0 +1,367 @@
+package compiler
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"maps"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+// contextMargin is the share of a model's context window left unused, since
+// prompt sizes are estimates.
+const contextMargin = 0.1
+
+// shortAnswerLen is the length, in bytes, that summarized answers and issue
+// messages are cut to.
+const shortAnswerLen = 200
+
+// omittedSection replaces the spec sections left out of a prompt.
+const omittedSection = "[omitted to fit the context window]"
+
+// ContextTrim reports how the inputs of an LLM call were cut down to fit the
+// model's context window.
+type ContextTrim struct {
+	ContextWindow   int            `json:"context_window"`   // The model's context window, in tokens
+	EstimatedTokens int            `json:"estimated_tokens"` // Estimated prompt tokens of the full inputs
+	TrimmedTokens   int            `json:"trimmed_tokens"`   // Estimated prompt tokens after trimming
+	Inputs          []TrimmedInput `json:"inputs"`           // The inputs that were cut
+}
+
+// TrimmedInput reports how one input of a prompt was cut.
+type TrimmedInput struct {
+	Name       string   `json:"name"`               // "spec", "issues", "questions", "answers" or "unanswered_questions"
+	Total      int      `json:"total"`              // Items in the input; for the spec, its top-level sections
+	Summarized int      `json:"summarized"`         // Items sent in short form; for the spec, sections left out
+	Dropped    int      `json:"dropped"`            // Items left out
+	Sections   []string `json:"sections,omitempty"` // Spec only: the sections left out
+}
+
+// promptInputs are the inputs of a planning, asking or suggesting prompt that
+// can be cut to fit the model's context window.
+type promptInputs struct {
+	Spec      json.RawMessage
+	Issues    []*domain.Issue
+	Questions []*domain.Question // Existing questions
+	Answers   []*domain.Answer
+	Targets   []*domain.Question // The questions the call is about, cut last
+}
+
+// itemState is how much of a contextItem is sent.
+type itemState int
+
+const (
+	itemFull itemState = iota
+	itemShort
+	itemDropped
+)
+
+// contextItem is one piece of a promptInputs: a spec section, issue,
+// question or answer.
+type contextItem struct {
+	input     string // TrimmedInput name
+	index     int    // Position in its input
+	key       string // Spec sections only: the section name
+	tier      int    // Items in lower tiers are cut first...
+	order     int64  // ...and within a tier, lower orders
+	full      int    // Estimated tokens of the full form
+	short     int    // Estimated tokens of the short form; 0 if there is none
+	droppable bool
+	state     itemState
+}
+
+// fitContext cuts in down until the prompt that render builds from it fits
+// the context window of llmClient's model, leaving maxTokens for the
+// response. Items are summarized, or dropped if they have no short form,
+// from the least important up: spec sections unrelated to relevantPaths,
+// answered questions, older answers and minor issues go first; the spec
+// sections relevant to relevantPaths, unanswered questions by priority and
+// the targets go last. If the prompt still doesn't fit, summarized items are
+// dropped in the same order. fitContext returns the inputs to render and, if
+// it cut anything, a report.
+func (s *Service) fitContext(llmClient llm.Client, in promptInputs, relevantPaths []string, maxTokens int, render func(promptInputs) ([]llm.Message, error)) (promptInputs, *ContextTrim) {
+	est := s.factory.TokenEstimator(llmClient.Provider(), llmClient.Model())
+	budget := int(float64(est.ContextWindow)*(1-contextMargin)) - maxTokens
+
+	messages, err := render(in)
+	if err != nil {
+		return in, nil // The caller's render reports the error
+	}
+	total := est.EstimateMessages(messages)
+	if total <= budget {
+		return in, nil
+	}
+	base, err := render(promptInputs{})
+	if err != nil {
+		return in, nil
+	}
+
+	items, spec := contextItems(est, in, relevantPaths)
+	// Scale the item estimates so that they add up to the rendered prompt,
+	// whose formatting they don't see
+	sum := 0
+	for _, it := range items {
+		sum += it.full
+	}
+	if sum > 0 {
+		scale := float64(total-est.EstimateMessages(base)) / float64(sum)
+		for _, it := range items {
+			it.full = int(float64(it.full) * scale)
+			it.short = int(float64(it.short) * scale)
+		}
+	}
+
+	slices.SortStableFunc(items, func(a, b *contextItem) int {
+		return cmp.Or(cmp.Compare(a.tier, b.tier), cmp.Compare(a.order, b.order))
+	})
+	used := total
+	for _, it := range items {
+		if used <= budget {
+			break
+		}
+		switch {
+		case it.short > 0:
+			used -= it.full - it.short
+			it.state = itemShort
+		case it.droppable:
+			used -= it.full
+			it.state = itemDropped
+		}
+	}
+	for _, it := range items {
+		if used <= budget {
+			break
+		}
+		if it.state == itemShort && it.droppable {
+			used -= it.short
+			it.state = itemDropped
+		}
+	}
+
+	out := trimInputs(in, items, spec)
+	trim := &ContextTrim{ContextWindow: est.ContextWindow, EstimatedTokens: total, Inputs: trimReport(in, items)}
+	if messages, err := render(out); err == nil {
+		trim.TrimmedTokens = est.EstimateMessages(messages)
+	}
+	if trim.TrimmedTokens > budget {
+		log.Printf("Warning: prompt of about %d tokens is still too large for %s's %d-token context window after trimming",
+			trim.TrimmedTokens, llmClient.Model(), est.ContextWindow)
+	}
+	return out, trim
+}
+
+// contextItems splits in into items, and returns them with the parsed spec.
+func contextItems(est llm.TokenEstimator, in promptInputs, relevantPaths []string) ([]*contextItem, map[string]json.RawMessage) {
+	tokens := func(v any) int {
+		data, _ := json.Marshal(v)
+		return est.Estimate(string(data)) + 1 // And its separator
+	}
+	var items []*contextItem
+
+	relevant := make(map[string]bool)
+	for _, p := range relevantPaths {
+		relevant[SectionForPath(p)] = true
+	}
+	var spec map[string]json.RawMessage
+	if json.Unmarshal(in.Spec, &spec) == nil {
+		for i, name := range slices.Sorted(maps.Keys(spec)) {
+			it := &contextItem{input: "spec", key: name, tier: 1, order: int64(i), full: est.Estimate(string(spec[name])), short: tokens(omittedSection)}
+			if relevant[name] {
+				it.tier = 7
+			}
+			if it.short < it.full {
+				items = append(items, it)
+			}
+		}
+	}
+
+	for i, issue := range in.Issues {
+		tier := 2
+		switch issue.Severity {
+		case domain.IssueSeverityError:
+			tier = 5
+		case domain.IssueSeverityWarn:
+			tier = 4
+		}
+		items = append(items, &contextItem{input: "issues", index: i, tier: tier, order: int64(-i),
+			full: tokens(issue), short: tokens(shortIssue(issue)), droppable: true})
+	}
+	for i, q := range in.Questions {
+		it := &contextItem{input: "questions", index: i, tier: 2, order: q.CreatedAt.UnixNano(),
+			full: tokens(q), short: tokens(shortQuestion(q)), droppable: true}
+		if q.Status != domain.QuestionStatusAnswered {
+			it.tier, it.order = 6, int64(q.Priority)
+		}
+		items = append(items, it)
+	}
+	for i, a := range in.Answers {
+		items = append(items, &contextItem{input: "answers", index: i, tier: 3, order: a.CreatedAt.UnixNano(),
+			full: tokens(a), short: tokens(shortAnswer(a)), droppable: true})
+	}
+	for i, q := range in.Targets {
+		items = append(items, &contextItem{input: "unanswered_questions", index: i, tier: 9, order: int64(q.Priority),
+			full: tokens(q), droppable: true})
+	}
+
+	for _, it := range items {
+		if it.short >= it.full {
+			it.short = 0 // Summarizing wouldn't save anything
+		}
+	}
+	return items, spec
+}
+
+// trimInputs returns in with the items cut as marked.
+func trimInputs(in promptInputs, items []*contextItem, spec map[string]json.RawMessage) promptInputs {
+	state := make(map[string]map[int]itemState)
+	omitted := make(map[string]bool)
+	for _, it := range items {
+		if it.input == "spec" {
+			omitted[it.key] = it.state != itemFull
+			continue
+		}
+		if state[it.input] == nil {
+			state[it.input] = make(map[int]itemState)
+		}
+		state[it.input][it.index] = it.state
+	}
+
+	out := promptInputs{Spec: in.Spec}
+	if len(omitted) > 0 {
+		trimmed := make(map[string]json.RawMessage, len(spec))
+		for name, section := range spec {
+			trimmed[name] = section
+			if omitted[name] {
+				trimmed[name], _ = json.Marshal(omittedSection)
+			}
+		}
+		out.Spec, _ = json.Marshal(trimmed)
+	}
+	out.Issues = trimList(in.Issues, state["issues"], shortIssue)
+	out.Questions = trimList(in.Questions, state["questions"], shortQuestion)
+	out.Answers = trimList(in.Answers, state["answers"], shortAnswer)
+	out.Targets = trimList(in.Targets, state["unanswered_questions"], nil)
+	return out
+}
+
+// trimList returns list without its dropped items, and with its summarized
+// items in short form.
+func trimList[T any](list []T, state map[int]itemState, short func(T) T) []T {
+	if list == nil {
+		return nil
+	}
+	out := make([]T, 0, len(list))
+	for i, v := range list {
+		switch state[i] {
+		case itemShort:
+			out = append(out, short(v))
+		case itemFull:
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// trimReport summarizes the cut items of each input.
+func trimReport(in promptInputs, items []*contextItem) []TrimmedInput {
+	totals := map[string]int{
+		"issues":               len(in.Issues),
+		"questions":            len(in.Questions),
+		"answers":              len(in.Answers),
+		"unanswered_questions": len(in.Targets),
+	}
+	var spec map[string]json.RawMessage
+	if json.Unmarshal(in.Spec, &spec) == nil {
+		totals["spec"] = len(spec)
+	}
+
+	byName := make(map[string]*TrimmedInput)
+	for _, it := range items {
+		if it.state == itemFull {
+			continue
+		}
+		r := byName[it.input]
+		if r == nil {
+			r = &TrimmedInput{Name: it.input, Total: totals[it.input]}
+			byName[it.input] = r
+		}
+		switch {
+		case it.input == "spec":
+			r.Summarized++
+			r.Sections = append(r.Sections, it.key)
+		case it.state == itemShort:
+			r.Summarized++
+		default:
+			r.Dropped++
+		}
+	}
+
+	var report []TrimmedInput
+	for _, name := range []string{"spec", "issues", "questions", "answers", "unanswered_questions"} {
+		if r := byName[name]; r != nil {
+			slices.Sort(r.Sections)
+			report = append(report, *r)
+		}
+	}
+	return report
+}
+
+// shortQuestion returns q without its options and tags.
+func shortQuestion(q *domain.Question) *domain.Question {
+	short := *q
+	short.Options, short.Tags = nil, nil
+	return &short
+}
+
+// shortAnswer returns a with a long value cut to a string of its start.
+func shortAnswer(a *domain.Answer) *domain.Answer {
+	if len(a.Value) <= shortAnswerLen {
+		return a
+	}
+	short := *a
+	var text string
+	if json.Unmarshal(a.Value, &text) != nil {
+		text = string(a.Value)
+	}
+	short.Value, _ = json.Marshal(truncate(text, shortAnswerLen) + "…")
+	return &short
+}
+
+// shortIssue returns issue with its message cut short and without its
+// related questions.
+func shortIssue(issue *domain.Issue) *domain.Issue {
+	short := *issue
+	if len(short.Message) > shortAnswerLen {
+		short.Message = truncate(short.Message, shortAnswerLen) + "…"
+	}
+	short.RelatedQuestionIDs = nil
+	return &short
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// reportTrim logs how a stage's inputs were trimmed, if they were, and
+// reports it to onStream.
+func reportTrim(stage string, trim *ContextTrim, onStream StreamFunc) {
+	if trim == nil {
+		return
+	}
+	log.Printf("%s: trimmed inputs from about %d to %d tokens to fit a %d-token context window: %+v",
+		stage, trim.EstimatedTokens, trim.TrimmedTokens, trim.ContextWindow, trim.Inputs)
+	if onStream != nil {
+		onStream(StreamProgress{Stage: stage, Trimmed: trim})
+	}
+}
@@ -0,0 +1,121 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+func TestPlanFitsContextWindow(t *testing.T) {
+	mockFactory := llm.NewMockFactory(`{"rationale": "ok", "targets": [], "suggestions": []}`)
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	service := NewService(mockFactory, val, `{}`)
+	ctx := testContext(t)
+
+	start := time.Now().UTC().Add(-time.Hour)
+	input := PlanInput{
+		Project:     &domain.Project{ID: uuid.New(), Name: "Test Project", CreatedAt: start},
+		CurrentSpec: json.RawMessage(fmt.Sprintf(`{"product": {"name": "Test"}, "operations": {"notes": "OPS-MARKER %s"}}`, strings.Repeat("x", 4000))),
+	}
+	for i := range 40 {
+		q := &domain.Question{
+			ID: uuid.New(), Text: fmt.Sprintf("Question %d?", i), Type: domain.QuestionTypeSingle,
+			Options: []string{"First option", "Second option", "Third option"}, Priority: 50,
+			SpecPaths: []string{"/product"}, Status: domain.QuestionStatusAnswered, CreatedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		value := strings.Repeat("y", 500)
+		if i == 39 {
+			value += " NEWEST-MARKER"
+		}
+		raw, _ := json.Marshal(value)
+		input.ExistingQuestions = append(input.ExistingQuestions, q)
+		input.LatestAnswers = append(input.LatestAnswers, &domain.Answer{
+			ID: uuid.New(), QuestionID: q.ID, Value: raw, Version: 1, CreatedAt: q.CreatedAt.Add(time.Minute),
+		})
+	}
+	input.ExistingQuestions = append(input.ExistingQuestions, &domain.Question{
+		ID: uuid.New(), Text: "UNANSWERED-MARKER?", Type: domain.QuestionTypeFreeform, Priority: 10,
+		SpecPaths: []string{"/product/name"}, Status: domain.QuestionStatusUnanswered, CreatedAt: start,
+	})
+
+	var trims []*ContextTrim
+	input.Stream = func(p StreamProgress) {
+		if p.Trimmed != nil {
+			trims = append(trims, p.Trimmed)
+		}
+	}
+
+	// With room for everything, nothing is cut
+	if _, err := service.Plan(ctx, input); err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(trims) != 0 {
+		t.Fatalf("trimmed %+v, want no trim", trims[0])
+	}
+	est := mockFactory.TokenEstimator("mock", "mock-model")
+	full := est.EstimateMessages(mockFactory.Client.LastRequest.Messages)
+
+	// Leave room for three quarters of the prompt
+	mockFactory.Window = int(float64(stageMaxTokens+full*3/4) / (1 - contextMargin))
+	if _, err := service.Plan(ctx, input); err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(trims) != 1 {
+		t.Fatalf("reported %d trims, want 1", len(trims))
+	}
+	trim := trims[0]
+	if trim.ContextWindow != mockFactory.Window || trim.EstimatedTokens != full || trim.TrimmedTokens > full*3/4 {
+		t.Errorf("trim = %+v, want %d tokens cut to at most %d", trim, full, full*3/4)
+	}
+	inputs := make(map[string]TrimmedInput)
+	for _, in := range trim.Inputs {
+		inputs[in.Name] = in
+	}
+	if spec := inputs["spec"]; len(spec.Sections) != 1 || spec.Sections[0] != "operations" {
+		t.Errorf("spec trim = %+v, want only the unrelated operations section left out", spec)
+	}
+	if answers := inputs["answers"]; answers.Total != 40 || answers.Summarized == 0 || answers.Dropped != 0 {
+		t.Errorf("answers trim = %+v, want some of 40 summarized", answers)
+	}
+
+	prompt := mockFactory.Client.LastRequest.Messages[1].Content
+	if strings.Contains(prompt, "OPS-MARKER") || !strings.Contains(prompt, omittedSection) {
+		t.Error("prompt still contains the operations section")
+	}
+	if !strings.Contains(prompt, "UNANSWERED-MARKER") {
+		t.Error("prompt lost the unanswered question")
+	}
+	if !strings.Contains(prompt, "NEWEST-MARKER") {
+		t.Error("prompt summarized the newest answer")
+	}
+	if strings.Count(prompt, "First option") >= 40 {
+		t.Error("prompt kept the options of every answered question")
+	}
+}
+
+func TestShortAnswer(t *testing.T) {
+	long, _ := json.Marshal(strings.Repeat("é", 150)) // 300 bytes
+	short := shortAnswer(&domain.Answer{Value: long})
+	var text string
+	if err := json.Unmarshal(short.Value, &text); err != nil {
+		t.Fatalf("short value %s is not a string: %v", short.Value, err)
+	}
+	if !strings.HasSuffix(text, "…") || len(text) > shortAnswerLen+len("…") || !json.Valid(short.Value) {
+		t.Errorf("shortAnswer() = %q, want at most %d bytes and an ellipsis", text, shortAnswerLen)
+	}
+
+	small := &domain.Answer{Value: json.RawMessage(`["a", "b"]`)}
+	if got := shortAnswer(small); got != small {
+		t.Errorf("shortAnswer() = %s, want a short answer unchanged", got.Value)
+	}
+}
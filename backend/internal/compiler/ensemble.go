@@ -0,0 +1,642 @@
+package compiler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dshills/specbuilder/backend/internal/diff"
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/trace"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+)
+
+// MaxEnsembleMembers bounds the number of models compiled in parallel by one
+// ensemble compile.
+const MaxEnsembleMembers = 5
+
+// maxDisagreementIssues caps the disagreement issues one ensemble reports;
+// the rest are summarized in a final issue.
+const maxDisagreementIssues = 50
+
+// EnsembleMember is a provider/model pair that compiles one candidate spec.
+type EnsembleMember struct {
+	Provider llm.Provider `json:"provider"`
+	Model    string       `json:"model"`
+}
+
+func (m EnsembleMember) label() string {
+	return string(m.Provider) + "/" + m.Model
+}
+
+// ensembleCandidate is a member's successful compile.
+type ensembleCandidate struct {
+	member EnsembleMember
+	output *CompileOutput
+}
+
+// CompileEnsemble compiles the input with every member in parallel and merges
+// the candidate specs by consensus. The first member that succeeds is the
+// primary: its spec is the base of the merge, and each value where the
+// candidates disagree is set by majority vote, with ties going to the earlier
+// member. The trace of the merged spec is assembled from the members' traces.
+// If the primary's spec is schema-valid but the merged spec is not, the merged
+// spec is repaired with the primary's model, and replaced by the primary's
+// spec if it is still invalid.
+// Every disagreement is returned as a conflict issue draft in
+// CompileOutput.Disagreements. input.Provider and input.Model are ignored.
+func (s *Service) CompileEnsemble(ctx context.Context, input CompileInput, members []EnsembleMember) (*CompileOutput, error) {
+	if len(members) < 2 || len(members) > MaxEnsembleMembers {
+		return nil, fmt.Errorf("%w: ensemble needs 2 to %d models, got %d", domain.ErrInvalidInput, MaxEnsembleMembers, len(members))
+	}
+	for _, m := range members {
+		if m.Provider == "" || m.Model == "" {
+			return nil, fmt.Errorf("%w: ensemble models need a provider and model", domain.ErrInvalidInput)
+		}
+	}
+
+	// Members report progress from their own goroutines
+	var mu sync.Mutex
+	progress := func(stage, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		input.Progress.report(stage, message)
+	}
+	stream := func(p StreamProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		input.Stream(p)
+	}
+	progress("compiling", fmt.Sprintf("Compiling with %d models in parallel...", len(members)))
+
+	outputs := make([]*CompileOutput, len(members))
+	errs := make([]error, len(members))
+	finished := 0
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			memberInput := input
+			memberInput.Provider = m.Provider
+			memberInput.Model = m.Model
+			memberInput.Progress = func(stage, message string) {
+				progress(stage, m.label()+": "+message)
+			}
+			if input.Stream != nil {
+				memberInput.Stream = func(p StreamProgress) {
+					p.Model = m.label()
+					stream(p)
+				}
+			}
+			outputs[i], errs[i] = s.Compile(ctx, memberInput)
+
+			mu.Lock()
+			finished++
+			n := finished
+			mu.Unlock()
+			progress("compiling", fmt.Sprintf("%s finished (%d of %d)", m.label(), n, len(members)))
+		}()
+	}
+	wg.Wait()
+
+	var candidates []ensembleCandidate
+	for i, m := range members {
+		if errs[i] != nil {
+			log.Printf("Compile: ensemble model %s failed: %v", m.label(), errs[i])
+			errs[i] = fmt.Errorf("%s: %w", m.label(), errs[i])
+			continue
+		}
+		candidates = append(candidates, ensembleCandidate{member: m, output: outputs[i]})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("all %d ensemble models failed: %w", len(members), errors.Join(errs...))
+	}
+
+	progress("merging", fmt.Sprintf("Merging %d candidate specs...", len(candidates)))
+
+	merged, mergedTrace, disagreements, err := mergeCandidates(candidates, input.QABundles)
+	if err != nil {
+		return nil, fmt.Errorf("merge ensemble: %w", err)
+	}
+
+	// Votes on separate paths can combine valid candidates into an invalid spec
+	primary := candidates[0]
+	validation, repairAttempts := s.validator.ValidateSpec(merged), 0
+	if !validation.Valid && primary.output.Validation.Valid {
+		merged, validation, repairAttempts, err = s.repairMerged(ctx, input, primary, merged)
+		if err != nil {
+			return nil, err
+		}
+		if !validation.Valid {
+			log.Printf("Compile: merged ensemble spec still has %d schema errors after %d repair attempts; using the spec of %s",
+				len(validation.Errors), repairAttempts, primary.member.label())
+			merged, mergedTrace, validation = primary.output.Spec, primary.output.Trace, primary.output.Validation
+		}
+	}
+
+	out := *primary.output
+	out.Spec = merged
+	out.Trace = mergedTrace
+	out.Validation = validation
+	out.Disagreements = disagreements
+	out.RepairAttempts = repairAttempts
+	out.Compiler.Models = make([]domain.ModelRef, 0, len(candidates))
+	for _, c := range candidates {
+		out.RepairAttempts += c.output.RepairAttempts
+		out.Compiler.Models = append(out.Compiler.Models, domain.ModelRef{
+			Provider: string(c.member.Provider),
+			Model:    c.output.Compiler.Model,
+		})
+	}
+	return &out, nil
+}
+
+// repairMerged runs the schema repair loop on a merged spec with the primary
+// candidate's model.
+func (s *Service) repairMerged(ctx context.Context, input CompileInput, primary ensembleCandidate, spec json.RawMessage) (json.RawMessage, validator.ValidationResult, int, error) {
+	llmClient, err := s.client(domain.LLMRoleCompiler, input.Project, primary.member.Provider, primary.member.Model)
+	if err != nil {
+		return nil, validator.ValidationResult{}, 0, err
+	}
+	qaBundleJSON, err := json.Marshal(input.QABundles)
+	if err != nil {
+		return nil, validator.ValidationResult{}, 0, fmt.Errorf("marshal qa bundles: %w", err)
+	}
+	projectJSON, err := json.Marshal(input.Project)
+	if err != nil {
+		return nil, validator.ValidationResult{}, 0, fmt.Errorf("marshal project: %w", err)
+	}
+	input.PromptVersion = llm.PromptVersion(primary.output.Compiler.PromptVersion)
+	return s.repairSpec(ctx, llmClient, input, projectJSON, qaBundleJSON, spec)
+}
+
+// mergeCandidates merges candidate specs by majority vote at every path where
+// diff.Specs finds a candidate that differs from the primary (the first
+// candidate), and returns the merged spec, its trace (see mergeTraces), and an
+// issue draft per disagreeing spec item. The spec's trace section is not voted
+// on; it is replaced by the merged trace.
+func mergeCandidates(candidates []ensembleCandidate, qaBundles []QABundle) (json.RawMessage, json.RawMessage, []domain.IssueDraft, error) {
+	primary := candidates[0]
+
+	roots := make([]any, len(candidates))
+	traces := make([]*domain.Trace, len(candidates))
+	for i, c := range candidates {
+		if err := json.Unmarshal(c.output.Spec, &roots[i]); err != nil {
+			return nil, nil, nil, fmt.Errorf("parse %s spec: %w", c.member.label(), err)
+		}
+		t, err := trace.Parse(c.output.Trace)
+		if err != nil {
+			log.Printf("Compile: ignoring unparseable trace of ensemble model %s: %v", c.member.label(), err)
+			t = &domain.Trace{SpecPathToSources: map[string][]domain.TraceSource{}}
+		}
+		traces[i] = t
+	}
+
+	seen := make(map[string]bool)
+	var paths [][]pathSegment
+	for _, c := range candidates[1:] {
+		result, err := diff.Specs(primary.output.Spec, c.output.Spec, primary.member.label(), c.member.label())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, change := range result.Changes {
+			// Trace keys are spec paths, which parseDiffPath can't split
+			if change.Path == "/trace" || strings.HasPrefix(change.Path, "/trace/") {
+				continue
+			}
+			if seen[change.Path] {
+				continue
+			}
+			seen[change.Path] = true
+			if segs, ok := parseDiffPath(change.Path); ok {
+				paths = append(paths, segs)
+			}
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return compareSegments(paths[i], paths[j]) < 0 })
+
+	var merged any
+	if err := json.Unmarshal(primary.output.Spec, &merged); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Parents are visited before children. Array elements can only be removed
+	// from the end, so removals are applied afterwards, last index first.
+	var removals [][]pathSegment
+	for _, segs := range paths {
+		value, present := vote(roots, segs)
+		primaryValue, primaryPresent := lookupPath(roots[0], segs)
+		if variantKey(value, present) == variantKey(primaryValue, primaryPresent) {
+			continue
+		}
+		if !present {
+			removals = append(removals, segs)
+			continue
+		}
+		if updated, ok := setPath(merged, segs, cloneJSON(value), false); ok {
+			merged = updated
+		}
+	}
+	for i := len(removals) - 1; i >= 0; i-- {
+		if updated, ok := setPath(merged, removals[i], nil, true); ok {
+			merged = updated
+		}
+	}
+
+	mergedTrace, err := json.Marshal(mergeTraces(traces, roots, merged))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if m, ok := merged.(map[string]any); ok {
+		if _, ok := m["trace"]; ok {
+			m["trace"] = json.RawMessage(mergedTrace)
+		}
+	}
+	mergedJSON, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return mergedJSON, mergedTrace, disagreementIssues(candidates, roots, traces, paths, qaBundles), nil
+}
+
+// mergeTraces builds the trace of the merged spec. A member's sources for a
+// path are kept where the member's value at the path is the merged value, or
+// where both are objects or arrays, which the vote may have assembled from
+// several members. Paths missing from the merged spec are dropped.
+func mergeTraces(traces []*domain.Trace, roots []any, merged any) *domain.Trace {
+	out := &domain.Trace{SpecPathToSources: make(map[string][]domain.TraceSource)}
+	for i, t := range traces {
+		for path, sources := range t.SpecPathToSources {
+			ptr := trace.NormalizePath(path)
+			want, ok := lookupPointer(merged, ptr)
+			if !ok {
+				continue
+			}
+			got, ok := lookupPointer(roots[i], ptr)
+			if !ok || (variantKey(got, true) != variantKey(want, true) && !(isContainer(got) && isContainer(want))) {
+				continue
+			}
+			for _, src := range sources {
+				if !slices.Contains(out.SpecPathToSources[path], src) {
+					out.SpecPathToSources[path] = append(out.SpecPathToSources[path], src)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// vote returns the most common value at a path across candidate specs. Ties
+// go to the value of the earliest candidate.
+func vote(roots []any, segs []pathSegment) (any, bool) {
+	type tally struct {
+		value   any
+		present bool
+		count   int
+		first   int
+	}
+	tallies := make(map[string]*tally)
+	for i, root := range roots {
+		v, ok := lookupPath(root, segs)
+		key := variantKey(v, ok)
+		if tallies[key] == nil {
+			tallies[key] = &tally{value: v, present: ok, first: i}
+		}
+		tallies[key].count++
+	}
+
+	var best *tally
+	for _, t := range tallies {
+		if best == nil || t.count > best.count || (t.count == best.count && t.first < best.first) {
+			best = t
+		}
+	}
+	return best.value, best.present
+}
+
+// disagreementIssues returns one conflict issue per spec item (see itemPath)
+// on which the candidates disagree, naming which models produced each variant
+// and the questions any candidate traced the item to.
+func disagreementIssues(candidates []ensembleCandidate, roots []any, traces []*domain.Trace, paths [][]pathSegment, qaBundles []QABundle) []domain.IssueDraft {
+	seen := make(map[string]bool)
+	drafts := make([]domain.IssueDraft, 0)
+	extra := 0
+	for _, segs := range paths {
+		item := itemPath(segs)
+		ptr := pointer(item)
+		if seen[ptr] {
+			continue
+		}
+		seen[ptr] = true
+
+		var order []string
+		variants := make(map[string][]string)
+		for i, root := range roots {
+			v, ok := lookupPath(root, item)
+			key := variantKey(v, ok)
+			label := candidates[i].member.label()
+			if !ok {
+				label += " (omitted)"
+			}
+			if _, exists := variants[key]; !exists {
+				order = append(order, key)
+			}
+			variants[key] = append(variants[key], label)
+		}
+		if len(order) < 2 {
+			continue
+		}
+		if len(drafts) >= maxDisagreementIssues {
+			extra++
+			continue
+		}
+
+		parts := make([]string, len(order))
+		for i, key := range order {
+			parts[i] = strings.Join(variants[key], ", ")
+		}
+		drafts = append(drafts, domain.IssueDraft{
+			Type:               domain.IssueTypeConflict,
+			Severity:           domain.IssueSeverityWarn,
+			Message:            fmt.Sprintf("Ensemble models disagree on %s: %s", ptr, strings.Join(parts, " vs ")),
+			RelatedSpecPaths:   []string{ptr},
+			RelatedQuestionIDs: relatedQuestions(traces, qaBundles, ptr),
+		})
+	}
+
+	if extra > 0 {
+		drafts = append(drafts, domain.IssueDraft{
+			Type:               domain.IssueTypeConflict,
+			Severity:           domain.IssueSeverityWarn,
+			Message:            fmt.Sprintf("Ensemble models disagree on %d more spec items", extra),
+			RelatedSpecPaths:   []string{},
+			RelatedQuestionIDs: []string{},
+		})
+	}
+	return drafts
+}
+
+// relatedQuestions returns the questions behind a spec path: the sources for
+// the path in any of the traces, or failing that, the questions whose spec
+// paths overlap it.
+func relatedQuestions(traces []*domain.Trace, qaBundles []QABundle, ptr string) []string {
+	ids := make(map[string]bool)
+	for _, t := range traces {
+		for _, e := range trace.SourcesForPath(t, ptr) {
+			ids[strings.ToLower(e.QuestionID)] = true
+		}
+	}
+	if len(ids) == 0 {
+		for _, qa := range qaBundles {
+			for _, p := range qa.QuestionPaths {
+				np := trace.NormalizePath(p)
+				if np == ptr || strings.HasPrefix(ptr, np+"/") || strings.HasPrefix(np, ptr+"/") {
+					ids[qa.QuestionID.String()] = true
+				}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// pathSegment is one step of a diff path: an object key or an array index.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseDiffPath parses a diff.Change path ("/requirements/functional[3]/id").
+func parseDiffPath(path string) ([]pathSegment, bool) {
+	var segs []pathSegment
+	for _, part := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		key := part
+		var indexes []int
+		for strings.HasSuffix(key, "]") {
+			open := strings.LastIndex(key, "[")
+			if open < 0 {
+				return nil, false
+			}
+			idx, err := strconv.Atoi(key[open+1 : len(key)-1])
+			if err != nil {
+				return nil, false
+			}
+			indexes = append([]int{idx}, indexes...)
+			key = key[:open]
+		}
+		if key != "" {
+			segs = append(segs, pathSegment{key: key})
+		}
+		for _, idx := range indexes {
+			segs = append(segs, pathSegment{index: idx, isIndex: true})
+		}
+	}
+	return segs, len(segs) > 0
+}
+
+// compareSegments orders paths so that parents precede children and array
+// indexes sort numerically.
+func compareSegments(a, b []pathSegment) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i].isIndex && b[i].isIndex:
+			if a[i].index != b[i].index {
+				return a[i].index - b[i].index
+			}
+		case a[i].isIndex != b[i].isIndex:
+			if a[i].isIndex {
+				return -1
+			}
+			return 1
+		default:
+			if c := strings.Compare(a[i].key, b[i].key); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(a) - len(b)
+}
+
+// itemPath truncates a path to the spec item it belongs to: the first array
+// element on the path ("/requirements/functional/3"), or else the first two
+// keys ("/product/name").
+func itemPath(segs []pathSegment) []pathSegment {
+	keys := 0
+	for i, seg := range segs {
+		if seg.isIndex {
+			return segs[:i+1]
+		}
+		keys++
+		if keys == 2 && (i+1 == len(segs) || !segs[i+1].isIndex) {
+			return segs[:i+1]
+		}
+	}
+	return segs
+}
+
+// pointer formats a path as a JSON pointer.
+func pointer(segs []pathSegment) string {
+	var b strings.Builder
+	for _, seg := range segs {
+		b.WriteByte('/')
+		if seg.isIndex {
+			b.WriteString(strconv.Itoa(seg.index))
+		} else {
+			b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(seg.key))
+		}
+	}
+	return b.String()
+}
+
+func lookupPath(node any, segs []pathSegment) (any, bool) {
+	for _, seg := range segs {
+		if seg.isIndex {
+			arr, ok := node.([]any)
+			if !ok || seg.index >= len(arr) {
+				return nil, false
+			}
+			node = arr[seg.index]
+			continue
+		}
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[seg.key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// lookupPointer returns the value at a JSON pointer ("/requirements/functional/3").
+func lookupPointer(node any, ptr string) (any, bool) {
+	if ptr == "" {
+		return node, true
+	}
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, token := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		switch n := node.(type) {
+		case map[string]any:
+			v, ok := n[unescape.Replace(token)]
+			if !ok {
+				return nil, false
+			}
+			node = v
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// setPath sets (or, if remove is set, deletes) the value at a path and returns
+// the updated node. The parent must exist; an array element can only be
+// appended at the end or removed from the end.
+func setPath(node any, segs []pathSegment, value any, remove bool) (any, bool) {
+	if len(segs) == 0 {
+		return value, !remove
+	}
+	seg, last := segs[0], len(segs) == 1
+
+	if seg.isIndex {
+		arr, ok := node.([]any)
+		if !ok {
+			return node, false
+		}
+		switch {
+		case last && remove:
+			if seg.index != len(arr)-1 {
+				return node, false
+			}
+			return arr[:seg.index], true
+		case seg.index < len(arr):
+			child, ok := setPath(arr[seg.index], segs[1:], value, remove)
+			if !ok {
+				return node, false
+			}
+			arr[seg.index] = child
+			return arr, true
+		case last && seg.index == len(arr):
+			return append(arr, value), true
+		default:
+			return node, false
+		}
+	}
+
+	m, ok := node.(map[string]any)
+	if !ok {
+		return node, false
+	}
+	if last {
+		if remove {
+			delete(m, seg.key)
+		} else {
+			m[seg.key] = value
+		}
+		return m, true
+	}
+	child, exists := m[seg.key]
+	if !exists {
+		return node, false
+	}
+	child, ok = setPath(child, segs[1:], value, remove)
+	if !ok {
+		return node, false
+	}
+	m[seg.key] = child
+	return m, true
+}
+
+// variantKey identifies a value for voting; absent values get their own key.
+func variantKey(v any, present bool) string {
+	if !present {
+		return "\x00absent"
+	}
+	b, _ := json.Marshal(v) // Map keys are sorted, so equal values match
+	return string(b)
+}
+
+// isContainer reports whether a decoded JSON value is an object or an array.
+func isContainer(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
+
+// cloneJSON deep-copies a decoded JSON value so the merged spec shares no
+// containers with the candidates.
+func cloneJSON(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
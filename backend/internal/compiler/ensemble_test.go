@@ -0,0 +1,284 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+func setupEnsembleService(t *testing.T, clients map[string]*llm.MockClient) *Service {
+	t.Helper()
+	for model, c := range clients {
+		c.ModelName = model
+	}
+	factory := &llm.MockFactory{Client: llm.NewMockClient(`{}`), Clients: clients}
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	return NewService(factory, val, `{"type": "object"}`)
+}
+
+func TestCompileEnsemble(t *testing.T) {
+	nameQ := uuid.New()
+	scopeQ := uuid.New()
+	trace := `{"product.name": {"question_id": "` + nameQ.String() + `", "answer_id": "a1"}}`
+	response := func(name, scope string) string {
+		return `{"spec": {"product": {"name": "` + name + `", "purpose": "Testing"},
+			"scope": {"in_scope": [` + scope + `]}}, "trace": ` + trace + `}`
+	}
+
+	service := setupEnsembleService(t, map[string]*llm.MockClient{
+		"model-a": llm.NewMockClient(response("Alpha", `"API"`)),
+		"model-b": llm.NewMockClient(response("Beta", `"API", "CLI"`)),
+		"model-c": llm.NewMockClient(response("Beta", `"API"`)),
+	})
+
+	input := CompileInput{
+		Project: &domain.Project{ID: uuid.New(), Name: "Test", CreatedAt: time.Now().UTC()},
+		QABundles: []QABundle{
+			{QuestionID: nameQ, QuestionPaths: []string{"product.name"}, AnswerID: uuid.New(), AnswerValue: json.RawMessage(`"Beta"`), AnswerVersion: 1},
+			{QuestionID: scopeQ, QuestionPaths: []string{"scope.in_scope"}, AnswerID: uuid.New(), AnswerValue: json.RawMessage(`["API"]`), AnswerVersion: 1},
+		},
+	}
+	members := []EnsembleMember{
+		{Provider: "mock", Model: "model-a"},
+		{Provider: "mock", Model: "model-b"},
+		{Provider: "mock", Model: "model-c"},
+	}
+
+	output, err := service.CompileEnsemble(testContext(t), input, members)
+	if err != nil {
+		t.Fatalf("CompileEnsemble() error = %v", err)
+	}
+
+	var spec struct {
+		Product struct {
+			Name string `json:"name"`
+		} `json:"product"`
+		Scope struct {
+			InScope []string `json:"in_scope"`
+		} `json:"scope"`
+	}
+	if err := json.Unmarshal(output.Spec, &spec); err != nil {
+		t.Fatalf("parse merged spec: %v", err)
+	}
+	if spec.Product.Name != "Beta" {
+		t.Errorf("merged product.name = %q, want majority value Beta", spec.Product.Name)
+	}
+	if len(spec.Scope.InScope) != 1 || spec.Scope.InScope[0] != "API" {
+		t.Errorf("merged scope.in_scope = %v, want [API]", spec.Scope.InScope)
+	}
+
+	byPath := make(map[string]domain.IssueDraft)
+	for _, d := range output.Disagreements {
+		if d.Type != domain.IssueTypeConflict {
+			t.Errorf("disagreement type = %s, want conflict", d.Type)
+		}
+		byPath[d.RelatedSpecPaths[0]] = d
+	}
+	if len(byPath) != 2 {
+		t.Fatalf("disagreements = %+v, want product/name and scope/in_scope/1", output.Disagreements)
+	}
+
+	name, ok := byPath["/product/name"]
+	if !ok {
+		t.Fatalf("no disagreement for /product/name in %+v", output.Disagreements)
+	}
+	if !strings.Contains(name.Message, "mock/model-a vs mock/model-b, mock/model-c") {
+		t.Errorf("message = %q, want models grouped by value", name.Message)
+	}
+	if len(name.RelatedQuestionIDs) != 1 || name.RelatedQuestionIDs[0] != nameQ.String() {
+		t.Errorf("related questions = %v, want traced question %s", name.RelatedQuestionIDs, nameQ)
+	}
+
+	// Untraced paths fall back to the questions that target them
+	scope, ok := byPath["/scope/in_scope/1"]
+	if !ok {
+		t.Fatalf("no disagreement for /scope/in_scope/1 in %+v", output.Disagreements)
+	}
+	if len(scope.RelatedQuestionIDs) != 1 || scope.RelatedQuestionIDs[0] != scopeQ.String() {
+		t.Errorf("related questions = %v, want %s", scope.RelatedQuestionIDs, scopeQ)
+	}
+
+	if output.Compiler.Model != "model-a" {
+		t.Errorf("Compiler.Model = %s, want primary model-a", output.Compiler.Model)
+	}
+	if len(output.Compiler.Models) != 3 {
+		t.Fatalf("Compiler.Models = %+v, want 3 models", output.Compiler.Models)
+	}
+	for i, want := range []string{"model-a", "model-b", "model-c"} {
+		if got := output.Compiler.Models[i]; got.Provider != "mock" || got.Model != want {
+			t.Errorf("Compiler.Models[%d] = %+v, want mock/%s", i, got, want)
+		}
+	}
+}
+
+func TestCompileEnsembleTrace(t *testing.T) {
+	nameQ := uuid.New()
+	purposeQ := uuid.New()
+	response := func(name, nameAnswer string) string {
+		trace := `{"spec_path_to_sources": {
+			"/product/name": [{"question_id": "` + nameQ.String() + `", "answer_id": "` + nameAnswer + `", "answer_version": 1}],
+			"/product/purpose": [{"question_id": "` + purposeQ.String() + `", "answer_id": "p1", "answer_version": 1}]}}`
+		return `{"spec": {"product": {"name": "` + name + `", "purpose": "Testing"}, "trace": ` + trace + `}, "trace": ` + trace + `}`
+	}
+
+	service := setupEnsembleService(t, map[string]*llm.MockClient{
+		"model-a": llm.NewMockClient(response("Alpha", "a-alpha")),
+		"model-b": llm.NewMockClient(response("Beta", "a-beta")),
+		"model-c": llm.NewMockClient(response("Beta", "a-beta")),
+	})
+	input := CompileInput{
+		Project: &domain.Project{ID: uuid.New(), Name: "Test"},
+		QABundles: []QABundle{
+			{QuestionID: nameQ, AnswerValue: json.RawMessage(`"Beta"`), AnswerVersion: 1},
+			{QuestionID: purposeQ, AnswerValue: json.RawMessage(`"Testing"`), AnswerVersion: 1},
+		},
+	}
+	members := []EnsembleMember{
+		{Provider: "mock", Model: "model-a"},
+		{Provider: "mock", Model: "model-b"},
+		{Provider: "mock", Model: "model-c"},
+	}
+
+	output, err := service.CompileEnsemble(testContext(t), input, members)
+	if err != nil {
+		t.Fatalf("CompileEnsemble() error = %v", err)
+	}
+
+	// The traces differ too, but only the product name is a disagreement
+	if len(output.Disagreements) != 1 || output.Disagreements[0].RelatedSpecPaths[0] != "/product/name" {
+		t.Fatalf("disagreements = %+v, want only /product/name", output.Disagreements)
+	}
+	if related := output.Disagreements[0].RelatedQuestionIDs; len(related) != 1 || related[0] != nameQ.String() {
+		t.Errorf("related questions = %v, want traced question %s", related, nameQ)
+	}
+
+	var got domain.Trace
+	if err := json.Unmarshal(output.Trace, &got); err != nil {
+		t.Fatalf("parse merged trace: %v", err)
+	}
+	name := got.SpecPathToSources["/product/name"]
+	if len(name) != 1 || name[0].AnswerID != "a-beta" {
+		t.Errorf("trace of /product/name = %+v, want the sources of the winning value", name)
+	}
+	if purpose := got.SpecPathToSources["/product/purpose"]; len(purpose) != 1 {
+		t.Errorf("trace of /product/purpose = %+v, want one source", purpose)
+	}
+
+	var spec struct {
+		Trace domain.Trace `json:"trace"`
+	}
+	if err := json.Unmarshal(output.Spec, &spec); err != nil {
+		t.Fatalf("parse merged spec: %v", err)
+	}
+	if embedded := spec.Trace.SpecPathToSources["/product/name"]; len(embedded) != 1 || embedded[0].AnswerID != "a-beta" {
+		t.Errorf("embedded trace of /product/name = %+v, want the merged trace", embedded)
+	}
+}
+
+func TestCompileEnsembleRepair(t *testing.T) {
+	// Two members drop product.purpose, so the merged spec loses it
+	valid := `{"spec": ` + validSpecJSON + `}`
+	noPurpose := `{"spec": ` + strings.Replace(validSpecJSON, `"purpose": "A test product",`, "", 1) + `}`
+	members := []EnsembleMember{
+		{Provider: "mock", Model: "model-a"},
+		{Provider: "mock", Model: "model-b"},
+		{Provider: "mock", Model: "model-c"},
+	}
+	input := CompileInput{Project: &domain.Project{ID: uuid.New(), Name: "Test"}}
+	setup := func(repaired string) (*Service, *llm.MockClient) {
+		primary := llm.NewMockClient("")
+		primary.Responses = []string{valid, repaired}
+		service := setupEnsembleService(t, map[string]*llm.MockClient{
+			"model-a": primary,
+			"model-b": llm.NewMockClient(noPurpose),
+			"model-c": llm.NewMockClient(noPurpose),
+		})
+		service.SetRepairPolicy(1, false)
+		return service, primary
+	}
+	purpose := func(spec json.RawMessage) string {
+		var s struct {
+			Product struct {
+				Purpose string `json:"purpose"`
+			} `json:"product"`
+		}
+		if err := json.Unmarshal(spec, &s); err != nil {
+			t.Fatalf("parse spec: %v", err)
+		}
+		return s.Product.Purpose
+	}
+
+	t.Run("repaired", func(t *testing.T) {
+		service, primary := setup(`{"spec": ` + strings.Replace(validSpecJSON, "A test product", "Repaired", 1) + `}`)
+		output, err := service.CompileEnsemble(testContext(t), input, members)
+		if err != nil {
+			t.Fatalf("CompileEnsemble() error = %v", err)
+		}
+		if primary.CallCount != 2 {
+			t.Errorf("primary model calls = %d, want compile + 1 repair of the merged spec", primary.CallCount)
+		}
+		if !output.Validation.Valid || purpose(output.Spec) != "Repaired" {
+			t.Errorf("merged spec valid = %v, purpose = %q; want the repaired spec", output.Validation.Valid, purpose(output.Spec))
+		}
+		if output.RepairAttempts != 3 {
+			t.Errorf("RepairAttempts = %d, want 1 per failing member and 1 for the merged spec", output.RepairAttempts)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		service, _ := setup(`{"spec": {"product": {"name": "Broken"}}}`)
+		output, err := service.CompileEnsemble(testContext(t), input, members)
+		if err != nil {
+			t.Fatalf("CompileEnsemble() error = %v", err)
+		}
+		if !output.Validation.Valid || purpose(output.Spec) != "A test product" {
+			t.Errorf("spec valid = %v, purpose = %q; want the primary's spec", output.Validation.Valid, purpose(output.Spec))
+		}
+		if len(output.Disagreements) == 0 {
+			t.Error("disagreements dropped with the merged spec")
+		}
+	})
+}
+
+func TestCompileEnsembleMemberFailure(t *testing.T) {
+	response := `{"spec": {"product": {"name": "Solo"}}, "trace": {}}`
+	failing := llm.NewMockClient("")
+	failing.Error = errors.New("provider down")
+
+	service := setupEnsembleService(t, map[string]*llm.MockClient{
+		"model-a": failing,
+		"model-b": llm.NewMockClient(response),
+	})
+	input := CompileInput{Project: &domain.Project{ID: uuid.New(), Name: "Test"}}
+	members := []EnsembleMember{{Provider: "mock", Model: "model-a"}, {Provider: "mock", Model: "model-b"}}
+
+	output, err := service.CompileEnsemble(testContext(t), input, members)
+	if err != nil {
+		t.Fatalf("CompileEnsemble() error = %v", err)
+	}
+	if output.Compiler.Model != "model-b" || len(output.Compiler.Models) != 1 {
+		t.Errorf("Compiler = %+v, want only model-b", output.Compiler)
+	}
+	if len(output.Disagreements) != 0 {
+		t.Errorf("disagreements = %+v, want none", output.Disagreements)
+	}
+
+	service = setupEnsembleService(t, map[string]*llm.MockClient{"model-a": failing, "model-b": failing})
+	if _, err := service.CompileEnsemble(testContext(t), input, members); err == nil {
+		t.Error("CompileEnsemble() with every model failing: want error")
+	}
+
+	if _, err := service.CompileEnsemble(testContext(t), input, members[:1]); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("CompileEnsemble() with one model err = %v, want ErrInvalidInput", err)
+	}
+}
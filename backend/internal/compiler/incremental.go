@@ -0,0 +1,227 @@
+package compiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/google/uuid"
+)
+
+// SpecSections lists the top-level ProjectImplementationSpec sections that can be
+// regenerated independently. The trace section is maintained by the backend.
+var SpecSections = []string{
+	"product",
+	"scope",
+	"personas",
+	"requirements",
+	"workflows",
+	"data_model",
+	"api",
+	"ui",
+	"integrations",
+	"non_functionals",
+	"observability",
+	"security_privacy",
+	"acceptance",
+	"plan",
+}
+
+// SectionForPath returns the top-level section a spec path belongs to, or ""
+// if the path does not name a known section. Both JSON-pointer ("/data_model/entities")
+// and dotted ("data_model.entities") forms are accepted.
+func SectionForPath(path string) string {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "/")
+	if i := strings.IndexAny(p, "/.["); i >= 0 {
+		p = p[:i]
+	}
+	for _, s := range SpecSections {
+		if s == p {
+			return s
+		}
+	}
+	return ""
+}
+
+// ChangedQABundles returns the bundles whose answer is new or has a different
+// version than the one recorded in previous (a snapshot's DerivedFrom).
+func ChangedQABundles(bundles []QABundle, previous map[uuid.UUID]int) []QABundle {
+	changed := make([]QABundle, 0)
+	for _, qa := range bundles {
+		if v, ok := previous[qa.QuestionID]; !ok || v != qa.AnswerVersion {
+			changed = append(changed, qa)
+		}
+	}
+	return changed
+}
+
+// IncrementalSections returns the sorted top-level sections affected by answers
+// that changed since the previous snapshot. It returns nil when an incremental
+// compile is not possible: there is no previous spec, nothing changed, or a
+// changed question has no spec path that maps to a known section.
+func IncrementalSections(bundles []QABundle, previous map[uuid.UUID]int, currentSpec json.RawMessage) []string {
+	if len(currentSpec) == 0 || string(currentSpec) == "{}" || previous == nil {
+		return nil
+	}
+
+	changed := ChangedQABundles(bundles, previous)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	affected := make(map[string]bool)
+	for _, qa := range changed {
+		found := false
+		for _, path := range qa.QuestionPaths {
+			if section := SectionForPath(path); section != "" {
+				affected[section] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	sections := make([]string, 0, len(affected))
+	for s := range affected {
+		sections = append(sections, s)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// sectionResponse represents the section-compiler LLM output structure.
+type sectionResponse struct {
+	Sections map[string]json.RawMessage `json:"sections"`
+	Trace    json.RawMessage            `json:"trace"`
+}
+
+// compileSections regenerates only the given sections and merges them into the previous spec.
+func (s *Service) compileSections(ctx context.Context, llmClient llm.Client, input CompileInput, projectJSON []byte, sections []string) (*compilerResponse, error) {
+	prompt, err := s.prompts.Load("compiler_section", input.PromptVersion)
+	if err != nil {
+		return nil, fmt.Errorf("load prompt: %w", err)
+	}
+
+	// Only send answers that feed the regenerated sections
+	wanted := make(map[string]bool, len(sections))
+	for _, sec := range sections {
+		wanted[sec] = true
+	}
+	relevant := make([]QABundle, 0)
+	for _, qa := range input.QABundles {
+		for _, path := range qa.QuestionPaths {
+			if wanted[SectionForPath(path)] {
+				relevant = append(relevant, qa)
+				break
+			}
+		}
+	}
+
+	sectionsJSON, _ := json.Marshal(sections)
+	qaBundleJSON, err := json.Marshal(relevant)
+	if err != nil {
+		return nil, fmt.Errorf("marshal qa bundles: %w", err)
+	}
+
+	messages, err := prompt.Messages(map[string]string{
+		"PROJECT":           string(projectJSON),
+		"SECTIONS_JSON":     string(sectionsJSON),
+		"QA_BUNDLE_JSON":    string(qaBundleJSON),
+		"CURRENT_SPEC_JSON": string(input.CurrentSpec),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
+
+	req := llm.Request{
+		Messages:      messages,
+		Temperature:   0,
+		MaxTokens:     16000, // Sections are a fraction of the full spec
+		Schema:        s.sectionSchema(sections),
+		PromptVersion: input.PromptVersion,
+	}
+
+	resp, err := complete(ctx, llmClient, req, "compiling", input.Stream)
+	if err != nil {
+		return nil, fmt.Errorf("llm call: %w", err)
+	}
+
+	var sectionResp sectionResponse
+	if err := json.Unmarshal([]byte(resp.Content), &sectionResp); err != nil {
+		return nil, fmt.Errorf("parse section response: %w (response: %s)", err, resp.Content[:min(500, len(resp.Content))])
+	}
+	for _, sec := range sections {
+		if _, ok := sectionResp.Sections[sec]; !ok {
+			return nil, fmt.Errorf("%w: section %q missing from response", llm.ErrInvalidResponse, sec)
+		}
+	}
+
+	merged, err := mergeSections(input.CurrentSpec, input.PreviousTrace, sections, sectionResp)
+	if err != nil {
+		return nil, err
+	}
+	merged.model = resp.Model
+	return merged, nil
+}
+
+// mergeSections replaces the regenerated sections in the previous spec and
+// rebuilds the trace: entries pointing into regenerated sections are replaced
+// by the new ones, all other entries are kept from previousTrace, or if that
+// is empty, from the trace embedded in the previous spec.
+func mergeSections(previous, previousTrace json.RawMessage, sections []string, resp sectionResponse) (*compilerResponse, error) {
+	var spec map[string]json.RawMessage
+	if err := json.Unmarshal(previous, &spec); err != nil {
+		return nil, fmt.Errorf("parse previous spec: %w", err)
+	}
+
+	regenerated := make(map[string]bool, len(sections))
+	for _, sec := range sections {
+		spec[sec] = resp.Sections[sec]
+		regenerated[sec] = true
+	}
+
+	type traceDoc struct {
+		SpecPathToSources map[string]json.RawMessage `json:"spec_path_to_sources"`
+	}
+	var oldTrace, newTrace traceDoc
+	if len(previousTrace) == 0 || string(previousTrace) == "null" {
+		previousTrace = spec["trace"]
+	}
+	if len(previousTrace) > 0 {
+		_ = json.Unmarshal(previousTrace, &oldTrace)
+	}
+	if len(resp.Trace) > 0 {
+		if err := json.Unmarshal(resp.Trace, &newTrace); err != nil {
+			return nil, fmt.Errorf("parse section trace: %w", err)
+		}
+	}
+
+	merged := traceDoc{SpecPathToSources: make(map[string]json.RawMessage)}
+	for path, sources := range oldTrace.SpecPathToSources {
+		if !regenerated[SectionForPath(path)] {
+			merged.SpecPathToSources[path] = sources
+		}
+	}
+	for path, sources := range newTrace.SpecPathToSources {
+		if regenerated[SectionForPath(path)] {
+			merged.SpecPathToSources[path] = sources
+		}
+	}
+
+	traceJSON, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("marshal trace: %w", err)
+	}
+	spec["trace"] = traceJSON
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshal spec: %w", err)
+	}
+	return &compilerResponse{Spec: specJSON, Trace: traceJSON}, nil
+}
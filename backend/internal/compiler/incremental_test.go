@@ -0,0 +1,236 @@
+package compiler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+func TestSectionForPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/data_model/entities/0/name", "data_model"},
+		{"data_model.entities", "data_model"},
+		{"requirements[0]", "requirements"},
+		{"product", "product"},
+		{"/trace/spec_path_to_sources", ""},
+		{"unknown.field", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := SectionForPath(tt.path); got != tt.want {
+				t.Errorf("SectionForPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncrementalSections(t *testing.T) {
+	q1, q2, q3 := uuid.New(), uuid.New(), uuid.New()
+	bundles := []QABundle{
+		{QuestionID: q1, QuestionPaths: []string{"product.name"}, AnswerVersion: 2},
+		{QuestionID: q2, QuestionPaths: []string{"/api/endpoints", "data_model.entities"}, AnswerVersion: 1},
+		{QuestionID: q3, QuestionPaths: []string{"plan.milestones"}, AnswerVersion: 1},
+	}
+	spec := json.RawMessage(`{"product": {}}`)
+
+	tests := []struct {
+		name     string
+		bundles  []QABundle
+		previous map[uuid.UUID]int
+		spec     json.RawMessage
+		want     []string
+	}{
+		{
+			name:     "changed and new answers",
+			bundles:  bundles,
+			previous: map[uuid.UUID]int{q1: 1, q3: 1},
+			spec:     spec,
+			want:     []string{"api", "data_model", "product"},
+		},
+		{
+			name:     "nothing changed",
+			bundles:  bundles,
+			previous: map[uuid.UUID]int{q1: 2, q2: 1, q3: 1},
+			spec:     spec,
+			want:     nil,
+		},
+		{
+			name:     "no previous spec",
+			bundles:  bundles,
+			previous: map[uuid.UUID]int{q1: 1},
+			spec:     nil,
+			want:     nil,
+		},
+		{
+			name: "unmappable question",
+			bundles: []QABundle{
+				{QuestionID: q1, QuestionPaths: []string{"misc.notes"}, AnswerVersion: 2},
+			},
+			previous: map[uuid.UUID]int{q1: 1},
+			spec:     spec,
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := IncrementalSections(tt.bundles, tt.previous, tt.spec)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IncrementalSections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSections(t *testing.T) {
+	previous := json.RawMessage(`{
+		"product": {"name": "Old"},
+		"scope": {"in_scope": ["A"]},
+		"trace": {"spec_path_to_sources": {
+			"/product/name": [{"question_id": "q1", "answer_id": "a1", "answer_version": 1}],
+			"/scope/in_scope": [{"question_id": "q2", "answer_id": "a2", "answer_version": 1}]
+		}}
+	}`)
+	resp := sectionResponse{
+		Sections: map[string]json.RawMessage{"product": json.RawMessage(`{"name": "New"}`)},
+		Trace: json.RawMessage(`{"spec_path_to_sources": {
+			"/product/name": [{"question_id": "q1", "answer_id": "a3", "answer_version": 2}],
+			"/scope/in_scope": [{"question_id": "q9", "answer_id": "a9", "answer_version": 1}]
+		}}`),
+	}
+
+	merged, err := mergeSections(previous, nil, []string{"product"}, resp)
+	if err != nil {
+		t.Fatalf("mergeSections() error = %v", err)
+	}
+
+	var spec struct {
+		Product struct {
+			Name string `json:"name"`
+		} `json:"product"`
+		Scope struct {
+			InScope []string `json:"in_scope"`
+		} `json:"scope"`
+		Trace struct {
+			SpecPathToSources map[string][]struct {
+				AnswerID string `json:"answer_id"`
+			} `json:"spec_path_to_sources"`
+		} `json:"trace"`
+	}
+	if err := json.Unmarshal(merged.Spec, &spec); err != nil {
+		t.Fatalf("Failed to parse merged spec: %v", err)
+	}
+
+	if spec.Product.Name != "New" {
+		t.Errorf("product.name = %q, want New", spec.Product.Name)
+	}
+	if len(spec.Scope.InScope) != 1 || spec.Scope.InScope[0] != "A" {
+		t.Errorf("scope should be untouched, got %v", spec.Scope.InScope)
+	}
+	if got := spec.Trace.SpecPathToSources["/product/name"]; len(got) != 1 || got[0].AnswerID != "a3" {
+		t.Errorf("trace for regenerated section = %v, want answer a3", got)
+	}
+	if got := spec.Trace.SpecPathToSources["/scope/in_scope"]; len(got) != 1 || got[0].AnswerID != "a2" {
+		t.Errorf("trace for untouched section = %v, want answer a2", got)
+	}
+}
+
+func TestMergeSectionsSnapshotTrace(t *testing.T) {
+	// The snapshot's trace is stored apart from the spec, which has none embedded
+	previous := json.RawMessage(`{"product": {"name": "Old"}, "scope": {"in_scope": ["A"]}}`)
+	previousTrace := json.RawMessage(`{"spec_path_to_sources": {
+		"/product/name": [{"question_id": "q1", "answer_id": "a1", "answer_version": 1}],
+		"/scope/in_scope": [{"question_id": "q2", "answer_id": "a2", "answer_version": 1}]
+	}}`)
+	resp := sectionResponse{
+		Sections: map[string]json.RawMessage{"product": json.RawMessage(`{"name": "New"}`)},
+		Trace: json.RawMessage(`{"spec_path_to_sources": {
+			"/product/name": [{"question_id": "q1", "answer_id": "a3", "answer_version": 2}]
+		}}`),
+	}
+
+	merged, err := mergeSections(previous, previousTrace, []string{"product"}, resp)
+	if err != nil {
+		t.Fatalf("mergeSections() error = %v", err)
+	}
+
+	var got domain.Trace
+	if err := json.Unmarshal(merged.Trace, &got); err != nil {
+		t.Fatalf("Failed to parse merged trace: %v", err)
+	}
+	if s := got.SpecPathToSources["/product/name"]; len(s) != 1 || s[0].AnswerID != "a3" {
+		t.Errorf("trace for regenerated section = %v, want answer a3", s)
+	}
+	if s := got.SpecPathToSources["/scope/in_scope"]; len(s) != 1 || s[0].AnswerID != "a2" {
+		t.Errorf("trace for untouched section = %v, want answer a2 from the snapshot trace", s)
+	}
+}
+
+func TestCompileIncremental(t *testing.T) {
+	questionID := uuid.New()
+	mockClient := llm.NewMockClient(`{
+		"sections": {"product": {"name": "Renamed Product", "purpose": "A test product", "success_criteria": ["Works correctly"]}},
+		"trace": {"spec_path_to_sources": {"/product/name": [{"question_id": "q1", "answer_id": "a2", "answer_version": 2}]}}
+	}`)
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	service := NewService(llm.NewMockFactoryWithClient(mockClient), val, `{}`)
+	ctx := testContext(t)
+
+	output, err := service.Compile(ctx, CompileInput{
+		Project: &domain.Project{ID: uuid.New(), Name: "Test Project"},
+		QABundles: []QABundle{
+			{QuestionID: questionID, QuestionText: "What is the product name?", QuestionPaths: []string{"product.name"}, AnswerID: uuid.New(), AnswerVersion: 2, AnswerValue: json.RawMessage(`"Renamed Product"`)},
+		},
+		CurrentSpec:         json.RawMessage(validSpecJSON),
+		Incremental:         true,
+		PreviousDerivedFrom: map[uuid.UUID]int{questionID: 1},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(output.Compiler.Sections, []string{"product"}) {
+		t.Errorf("Compile() Compiler.Sections = %v, want [product]", output.Compiler.Sections)
+	}
+	if !strings.Contains(mockClient.LastRequest.Messages[1].Content, "Sections to regenerate") {
+		t.Error("Compile() should use the section compiler prompt")
+	}
+	if !output.Validation.Valid {
+		t.Errorf("Compile() merged spec should be valid, got errors: %v", output.Validation.Errors)
+	}
+	if !strings.Contains(string(output.Spec), "Renamed Product") || !strings.Contains(string(output.Spec), "FR-001") {
+		t.Error("Compile() merged spec should contain the new product and the untouched requirements")
+	}
+}
+
+func TestCompileIncrementalFallsBackToFull(t *testing.T) {
+	mockResponse := `{"spec": ` + validSpecJSON + `, "trace": {}}`
+	service := setupCompilerService(t, mockResponse)
+	ctx := testContext(t)
+
+	output, err := service.Compile(ctx, CompileInput{
+		Project:     &domain.Project{ID: uuid.New(), Name: "Test Project"},
+		QABundles:   []QABundle{},
+		Incremental: true,
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if output.Compiler.Sections != nil {
+		t.Errorf("Compile() Compiler.Sections = %v, want nil for a full compile", output.Compiler.Sections)
+	}
+}
@@ -36,6 +36,10 @@ type PlannerSuggestion struct {
 	Tags               []string `json:"tags"`
 }
 
+// stageMaxTokens is the response limit of the planning, asking and
+// suggesting calls.
+const stageMaxTokens = 4000
+
 // QuestionMode represents the question complexity level.
 type QuestionMode string
 
@@ -56,19 +60,18 @@ type PlanInput struct {
 	Mode              QuestionMode // basic or advanced
 	Provider          llm.Provider // optional: override default provider
 	Model             string       // optional: override default model
+	Stream            StreamFunc   // optional: receives token counts and retries while the model runs
 }
 
 // Plan runs the planner to determine next questions.
 func (s *Service) Plan(ctx context.Context, input PlanInput) (*PlannerOutput, error) {
-	var llmClient llm.Client
-	var err error
-	if input.Provider != "" && input.Model != "" {
-		llmClient, err = s.factory.CreateClient(input.Provider, input.Model)
-	} else {
-		llmClient, err = s.factory.CreateDefaultClient()
+	llmClient, err := s.client(domain.LLMRolePlanner, input.Project, input.Provider, input.Model)
+	if err != nil {
+		return nil, err
 	}
+	version, err := s.resolvePromptVersion(input.Project, "")
 	if err != nil {
-		return nil, fmt.Errorf("create llm client: %w", err)
+		return nil, err
 	}
 
 	// Select prompt based on mode
@@ -78,37 +81,61 @@ func (s *Service) Plan(ctx context.Context, input PlanInput) (*PlannerOutput, er
 	}
 	log.Printf("Plan: using prompt %s (mode=%s)", promptName, input.Mode)
 
-	prompt, err := llm.LoadPrompt(promptName, s.promptVersion)
+	prompt, err := s.prompts.Load(promptName, version)
 	if err != nil {
 		return nil, fmt.Errorf("load prompt: %w", err)
 	}
 
 	projectJSON, _ := json.Marshal(input.Project)
-	currentSpec := input.CurrentSpec
-	if len(currentSpec) == 0 {
-		currentSpec = []byte("{}")
-	}
-	issuesJSON, _ := json.Marshal(input.CurrentIssues)
-	questionsJSON, _ := json.Marshal(input.ExistingQuestions)
-	answersJSON, _ := json.Marshal(input.LatestAnswers)
-
-	renderedPrompt := prompt.Render(map[string]string{
-		"PROJECT":                 string(projectJSON),
-		"CURRENT_SPEC_JSON":       string(currentSpec),
-		"CURRENT_ISSUES_JSON":     string(issuesJSON),
-		"EXISTING_QUESTIONS_JSON": string(questionsJSON),
-		"LATEST_ANSWERS_JSON":     string(answersJSON),
-	})
+	render := func(in promptInputs) ([]llm.Message, error) {
+		currentSpec := in.Spec
+		if len(currentSpec) == 0 {
+			currentSpec = []byte("{}")
+		}
+		issuesJSON, _ := json.Marshal(in.Issues)
+		questionsJSON, _ := json.Marshal(in.Questions)
+		answersJSON, _ := json.Marshal(in.Answers)
+		return prompt.Messages(map[string]string{
+			"PROJECT":                 string(projectJSON),
+			"CURRENT_SPEC_JSON":       string(currentSpec),
+			"CURRENT_ISSUES_JSON":     string(issuesJSON),
+			"EXISTING_QUESTIONS_JSON": string(questionsJSON),
+			"LATEST_ANSWERS_JSON":     string(answersJSON),
+		})
+	}
+
+	// The spec sections the open questions and issues are about matter most
+	var relevantPaths []string
+	for _, q := range input.ExistingQuestions {
+		if q.Status != domain.QuestionStatusAnswered {
+			relevantPaths = append(relevantPaths, q.SpecPaths...)
+		}
+	}
+	for _, issue := range input.CurrentIssues {
+		relevantPaths = append(relevantPaths, issue.RelatedSpecPaths...)
+	}
+	in, trim := s.fitContext(llmClient, promptInputs{
+		Spec:      input.CurrentSpec,
+		Issues:    input.CurrentIssues,
+		Questions: input.ExistingQuestions,
+		Answers:   input.LatestAnswers,
+	}, relevantPaths, stageMaxTokens, render)
+	reportTrim("planning", trim, input.Stream)
+
+	messages, err := render(in)
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
 
 	req := llm.Request{
-		Messages: []llm.Message{
-			{Role: "user", Content: renderedPrompt},
-		},
-		Temperature: 0,
-		MaxTokens:   4000,
+		Messages:      messages,
+		Temperature:   0,
+		MaxTokens:     stageMaxTokens,
+		Schema:        plannerSchema,
+		PromptVersion: version,
 	}
 
-	resp, err := llmClient.Complete(ctx, req)
+	resp, err := complete(ctx, llmClient, req, "planning", input.Stream)
 	if err != nil {
 		return nil, fmt.Errorf("llm call: %w", err)
 	}
@@ -146,19 +173,18 @@ type AskInput struct {
 	Mode               QuestionMode // basic or advanced
 	Provider           llm.Provider // optional: override default provider
 	Model              string       // optional: override default model
+	Stream             StreamFunc   // optional: receives token counts and retries while the model runs
 }
 
 // Ask generates questions based on planner suggestions.
 func (s *Service) Ask(ctx context.Context, input AskInput) (*AskerOutput, error) {
-	var llmClient llm.Client
-	var err error
-	if input.Provider != "" && input.Model != "" {
-		llmClient, err = s.factory.CreateClient(input.Provider, input.Model)
-	} else {
-		llmClient, err = s.factory.CreateDefaultClient()
+	llmClient, err := s.client(domain.LLMRoleAsker, input.Project, input.Provider, input.Model)
+	if err != nil {
+		return nil, err
 	}
+	version, err := s.resolvePromptVersion(input.Project, "")
 	if err != nil {
-		return nil, fmt.Errorf("create llm client: %w", err)
+		return nil, err
 	}
 
 	// Select prompt based on mode
@@ -167,37 +193,55 @@ func (s *Service) Ask(ctx context.Context, input AskInput) (*AskerOutput, error)
 		promptName = "asker_basic"
 	}
 
-	prompt, err := llm.LoadPrompt(promptName, s.promptVersion)
+	prompt, err := s.prompts.Load(promptName, version)
 	if err != nil {
 		return nil, fmt.Errorf("load prompt: %w", err)
 	}
 
 	projectJSON, _ := json.Marshal(input.Project)
 	suggestionsJSON, _ := json.Marshal(input.PlannerSuggestions)
-	currentSpec := input.CurrentSpec
-	if len(currentSpec) == 0 {
-		currentSpec = []byte("{}")
+	render := func(in promptInputs) ([]llm.Message, error) {
+		currentSpec := in.Spec
+		if len(currentSpec) == 0 {
+			currentSpec = []byte("{}")
+		}
+		questionsJSON, _ := json.Marshal(in.Questions)
+		answersJSON, _ := json.Marshal(in.Answers)
+		return prompt.Messages(map[string]string{
+			"PROJECT":                  string(projectJSON),
+			"PLANNER_SUGGESTIONS_JSON": string(suggestionsJSON),
+			"CURRENT_SPEC_JSON":        string(currentSpec),
+			"EXISTING_QUESTIONS_JSON":  string(questionsJSON),
+			"LATEST_ANSWERS_JSON":      string(answersJSON),
+		})
 	}
-	questionsJSON, _ := json.Marshal(input.ExistingQuestions)
-	answersJSON, _ := json.Marshal(input.LatestAnswers)
 
-	renderedPrompt := prompt.Render(map[string]string{
-		"PROJECT":                  string(projectJSON),
-		"PLANNER_SUGGESTIONS_JSON": string(suggestionsJSON),
-		"CURRENT_SPEC_JSON":        string(currentSpec),
-		"EXISTING_QUESTIONS_JSON":  string(questionsJSON),
-		"LATEST_ANSWERS_JSON":      string(answersJSON),
-	})
+	// The spec sections the planner suggested asking about matter most
+	var relevantPaths []string
+	for _, suggestion := range input.PlannerSuggestions {
+		relevantPaths = append(relevantPaths, suggestion.SpecPaths...)
+	}
+	in, trim := s.fitContext(llmClient, promptInputs{
+		Spec:      input.CurrentSpec,
+		Questions: input.ExistingQuestions,
+		Answers:   input.LatestAnswers,
+	}, relevantPaths, stageMaxTokens, render)
+	reportTrim("asking", trim, input.Stream)
+
+	messages, err := render(in)
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
 
 	req := llm.Request{
-		Messages: []llm.Message{
-			{Role: "user", Content: renderedPrompt},
-		},
-		Temperature: 0,
-		MaxTokens:   4000,
+		Messages:      messages,
+		Temperature:   0,
+		MaxTokens:     stageMaxTokens,
+		Schema:        askerSchema,
+		PromptVersion: version,
 	}
 
-	resp, err := llmClient.Complete(ctx, req)
+	resp, err := complete(ctx, llmClient, req, "asking", input.Stream)
 	if err != nil {
 		return nil, fmt.Errorf("llm call: %w", err)
 	}
@@ -232,6 +276,7 @@ type SuggestInput struct {
 	Mode                QuestionMode // basic or advanced
 	Provider            llm.Provider // optional: override default provider
 	Model               string       // optional: override default model
+	Stream              StreamFunc   // optional: receives token counts and retries while the model runs
 }
 
 // Suggest generates suggested answers for unanswered questions.
@@ -240,15 +285,13 @@ func (s *Service) Suggest(ctx context.Context, input SuggestInput) (*SuggesterOu
 		return &SuggesterOutput{Suggestions: []SuggesterSuggestion{}}, nil
 	}
 
-	var llmClient llm.Client
-	var err error
-	if input.Provider != "" && input.Model != "" {
-		llmClient, err = s.factory.CreateClient(input.Provider, input.Model)
-	} else {
-		llmClient, err = s.factory.CreateDefaultClient()
+	llmClient, err := s.client(domain.LLMRoleSuggester, input.Project, input.Provider, input.Model)
+	if err != nil {
+		return nil, err
 	}
+	version, err := s.resolvePromptVersion(input.Project, "")
 	if err != nil {
-		return nil, fmt.Errorf("create llm client: %w", err)
+		return nil, err
 	}
 
 	// Select prompt based on mode
@@ -258,16 +301,14 @@ func (s *Service) Suggest(ctx context.Context, input SuggestInput) (*SuggesterOu
 	}
 	log.Printf("Suggest: using prompt %s (mode=%s)", promptName, input.Mode)
 
-	prompt, err := llm.LoadPrompt(promptName, s.promptVersion)
+	prompt, err := s.prompts.Load(promptName, version)
 	if err != nil {
 		return nil, fmt.Errorf("load prompt: %w", err)
 	}
 
-	// Format existing answers for the prompt
-	answersText := "No answers yet."
-	if len(input.LatestAnswers) > 0 {
-		answersJSON, _ := json.MarshalIndent(input.LatestAnswers, "", "  ")
-		answersText = string(answersJSON)
+	modeStr := "advanced"
+	if input.Mode == ModeBasic {
+		modeStr = "basic"
 	}
 
 	// Format unanswered questions for the prompt
@@ -278,49 +319,70 @@ func (s *Service) Suggest(ctx context.Context, input SuggestInput) (*SuggesterOu
 		Options  []string `json:"options,omitempty"`
 		SpecPath string   `json:"spec_path,omitempty"`
 	}
-	questionsForPrompt := make([]questionForPrompt, len(input.UnansweredQuestions))
-	for i, q := range input.UnansweredQuestions {
-		specPath := ""
-		if len(q.SpecPaths) > 0 {
-			specPath = q.SpecPaths[0]
+	render := func(in promptInputs) ([]llm.Message, error) {
+		// Format existing answers for the prompt
+		answers := in.Answers
+		if answers == nil {
+			answers = []*domain.Answer{}
 		}
-		questionsForPrompt[i] = questionForPrompt{
-			ID:       q.ID.String(),
-			Text:     q.Text,
-			Type:     string(q.Type),
-			Options:  q.Options,
-			SpecPath: specPath,
+		answersJSON, _ := json.MarshalIndent(answers, "", "  ")
+
+		questionsForPrompt := make([]questionForPrompt, len(in.Targets))
+		for i, q := range in.Targets {
+			specPath := ""
+			if len(q.SpecPaths) > 0 {
+				specPath = q.SpecPaths[0]
+			}
+			questionsForPrompt[i] = questionForPrompt{
+				ID:       q.ID.String(),
+				Text:     q.Text,
+				Type:     string(q.Type),
+				Options:  q.Options,
+				SpecPath: specPath,
+			}
 		}
-	}
-	questionsJSON, _ := json.MarshalIndent(questionsForPrompt, "", "  ")
+		questionsJSON, _ := json.MarshalIndent(questionsForPrompt, "", "  ")
 
-	currentSpec := input.CurrentSpec
-	if len(currentSpec) == 0 {
-		currentSpec = []byte("{}")
-	}
+		currentSpec := in.Spec
+		if len(currentSpec) == 0 {
+			currentSpec = []byte("{}")
+		}
 
-	modeStr := "advanced"
-	if input.Mode == ModeBasic {
-		modeStr = "basic"
+		return prompt.Messages(map[string]string{
+			"PROJECT_NAME":         input.Project.Name,
+			"PROJECT_MODE":         modeStr,
+			"EXISTING_ANSWERS":     string(answersJSON),
+			"CURRENT_SPEC":         string(currentSpec),
+			"UNANSWERED_QUESTIONS": string(questionsJSON),
+		})
 	}
 
-	renderedPrompt := prompt.Render(map[string]string{
-		"PROJECT_NAME":         input.Project.Name,
-		"PROJECT_MODE":         modeStr,
-		"EXISTING_ANSWERS":     answersText,
-		"CURRENT_SPEC":         string(currentSpec),
-		"UNANSWERED_QUESTIONS": string(questionsJSON),
-	})
+	// The spec sections of the questions to answer matter most
+	var relevantPaths []string
+	for _, q := range input.UnansweredQuestions {
+		relevantPaths = append(relevantPaths, q.SpecPaths...)
+	}
+	in, trim := s.fitContext(llmClient, promptInputs{
+		Spec:    input.CurrentSpec,
+		Answers: input.LatestAnswers,
+		Targets: input.UnansweredQuestions,
+	}, relevantPaths, stageMaxTokens, render)
+	reportTrim("suggesting", trim, input.Stream)
+
+	messages, err := render(in)
+	if err != nil {
+		return nil, fmt.Errorf("render prompt: %w", err)
+	}
 
 	req := llm.Request{
-		Messages: []llm.Message{
-			{Role: "user", Content: renderedPrompt},
-		},
-		Temperature: 0.3, // Slightly higher temp for more creative suggestions
-		MaxTokens:   4000,
+		Messages:      messages,
+		Temperature:   0.3, // Slightly higher temp for more creative suggestions
+		MaxTokens:     stageMaxTokens,
+		Schema:        suggesterSchema,
+		PromptVersion: version,
 	}
 
-	resp, err := llmClient.Complete(ctx, req)
+	resp, err := complete(ctx, llmClient, req, "suggesting", input.Stream)
 	if err != nil {
 		return nil, fmt.Errorf("llm call: %w", err)
 	}
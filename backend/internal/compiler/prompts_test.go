@@ -0,0 +1,141 @@
+package compiler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+// promptRecorder records the messages of every request it completes.
+type promptRecorder struct {
+	*llm.MockClient
+
+	mu      sync.Mutex
+	prompts [][]llm.Message
+}
+
+func (c *promptRecorder) Complete(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	c.mu.Lock()
+	c.prompts = append(c.prompts, req.Messages)
+	c.mu.Unlock()
+	return c.MockClient.Complete(ctx, req)
+}
+
+func (c *promptRecorder) CompleteStream(ctx context.Context, req llm.Request, onDelta llm.StreamFunc) (*llm.Response, error) {
+	return c.Complete(ctx, req)
+}
+
+// TestStagePromptsRender runs every stage with user content that looks like
+// prompt placeholders, and checks that each prompt is sent as a static system
+// message and a user message that renders completely and leaves the user
+// content as it is.
+func TestStagePromptsRender(t *testing.T) {
+	const trick = "Shop {{PROJECT_MODE}}"
+	project := &domain.Project{ID: uuid.New(), Name: trick, CreatedAt: time.Now().UTC()}
+	question := &domain.Question{
+		ID:        uuid.New(),
+		ProjectID: project.ID,
+		Text:      "What should {{CURRENT_SPEC_JSON}} contain?",
+		Type:      domain.QuestionTypeFreeform,
+		SpecPaths: []string{"/product/name"},
+		Status:    domain.QuestionStatusUnanswered,
+	}
+	answer := &domain.Answer{ID: uuid.New(), ProjectID: project.ID, QuestionID: question.ID, Value: json.RawMessage(`"Use {{QA_BUNDLE_JSON}} literally"`), Version: 1}
+	issue := &domain.Issue{ID: uuid.New(), ProjectID: project.ID, Type: domain.IssueTypeMissing, Severity: domain.IssueSeverityWarn, Message: "No {{TRACE_JSON}} yet"}
+	bundles := []QABundle{{
+		QuestionID:    question.ID,
+		QuestionText:  question.Text,
+		QuestionType:  string(question.Type),
+		QuestionPaths: []string{"product.name"},
+		AnswerID:      answer.ID,
+		AnswerValue:   answer.Value,
+		AnswerVersion: 2,
+	}}
+	spec := json.RawMessage(validSpecJSON)
+
+	for _, tt := range []struct {
+		name      string
+		wantCalls int
+		run       func(ctx context.Context, s *Service) error
+	}{
+		{"plan", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Plan(ctx, PlanInput{Project: project, CurrentSpec: spec, CurrentIssues: []*domain.Issue{issue}, ExistingQuestions: []*domain.Question{question}, LatestAnswers: []*domain.Answer{answer}})
+			return err
+		}},
+		{"plan basic", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Plan(ctx, PlanInput{Project: project, Mode: ModeBasic})
+			return err
+		}},
+		{"ask", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Ask(ctx, AskInput{Project: project, PlannerSuggestions: []PlannerSuggestion{{Key: "name", QuestionIntent: "Name the {{PROJECT}}"}}, CurrentSpec: spec, ExistingQuestions: []*domain.Question{question}, LatestAnswers: []*domain.Answer{answer}})
+			return err
+		}},
+		{"ask basic", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Ask(ctx, AskInput{Project: project, Mode: ModeBasic})
+			return err
+		}},
+		{"suggest", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Suggest(ctx, SuggestInput{Project: project, UnansweredQuestions: []*domain.Question{question}, LatestAnswers: []*domain.Answer{answer}, CurrentSpec: spec})
+			return err
+		}},
+		{"suggest basic", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Suggest(ctx, SuggestInput{Project: project, UnansweredQuestions: []*domain.Question{question}, Mode: ModeBasic})
+			return err
+		}},
+		{"compile and repair", 3, func(ctx context.Context, s *Service) error {
+			_, err := s.Compile(ctx, CompileInput{Project: project, QABundles: bundles})
+			return err
+		}},
+		{"compile sections", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Compile(ctx, CompileInput{Project: project, QABundles: bundles, CurrentSpec: spec, Incremental: true, PreviousDerivedFrom: map[uuid.UUID]int{question.ID: 1}})
+			return err
+		}},
+		{"validate", 1, func(ctx context.Context, s *Service) error {
+			_, err := s.Validate(ctx, ValidateInput{Project: project, Spec: spec, QABundles: bundles})
+			return err
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &promptRecorder{MockClient: llm.NewMockClient(`{"spec": {}, "trace": {}}`)}
+			val, err := validator.New()
+			if err != nil {
+				t.Fatalf("Failed to create validator: %v", err)
+			}
+			service := NewService(&llm.MockFactory{Client: client.MockClient, Default: client}, val, `{}`)
+
+			// The mock's responses don't fit every stage; only the prompts matter here
+			if err := tt.run(testContext(t), service); err != nil && strings.Contains(err.Error(), "render prompt") {
+				t.Fatalf("%s error = %v", tt.name, err)
+			}
+			if len(client.prompts) != tt.wantCalls {
+				t.Fatalf("%s made %d LLM calls, want %d", tt.name, len(client.prompts), tt.wantCalls)
+			}
+			for _, messages := range client.prompts {
+				if len(messages) != 2 || messages[0].Role != "system" || messages[1].Role != "user" {
+					t.Fatalf("messages = %+v, want a system and a user message", messages)
+				}
+				if strings.Contains(messages[0].Content, "{{") || strings.Contains(messages[0].Content, project.ID.String()) {
+					t.Errorf("system message isn't static:\n%.300s", messages[0].Content)
+				}
+				prompt := messages[1].Content
+				if !strings.Contains(prompt, trick) {
+					t.Errorf("prompt doesn't include the project name as given:\n%.300s", prompt)
+				}
+				for _, user := range []string{trick, question.Text, "Use {{QA_BUNDLE_JSON}} literally", "Name the {{PROJECT}}", "No {{TRACE_JSON}} yet"} {
+					prompt = strings.ReplaceAll(prompt, user, "")
+				}
+				if i := strings.Index(prompt, "{{"); i >= 0 {
+					t.Errorf("prompt has an unrendered placeholder: %.60q", prompt[i:])
+				}
+			}
+		})
+	}
+}
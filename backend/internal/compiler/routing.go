@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+// RouteSource says which routing level chose the model of a role.
+type RouteSource string
+
+const (
+	RouteSourceDefault RouteSource = "default" // The server's default model, with its fallback chain
+	RouteSourceServer  RouteSource = "server"  // The server-wide routing
+	RouteSourceProject RouteSource = "project" // The project's routing
+)
+
+// Route is the model that serves an LLM role.
+type Route struct {
+	Provider llm.Provider `json:"provider"`
+	Model    string       `json:"model"`
+	Source   RouteSource  `json:"source"`
+}
+
+// SetRouting sets the server-wide model routing. Roles it leaves out use the
+// default model; projects can route roles themselves.
+func (s *Service) SetRouting(routing domain.ModelRouting) error {
+	if err := routing.Validate(); err != nil {
+		return fmt.Errorf("model routing: %w", err)
+	}
+	available := make(map[llm.Provider]bool)
+	for _, p := range s.factory.ListProviders() {
+		available[p.ID] = p.Available
+	}
+	for _, role := range domain.LLMRoles {
+		if ref, ok := routing[role]; ok && !available[llm.Provider(ref.Provider)] {
+			log.Printf("Warning: model routing: %s calls will fail until provider %s is available", role, ref.Provider)
+		}
+	}
+	s.routing = routing
+	return nil
+}
+
+// Routing returns the model every role is routed to for project, or for
+// projects without routing of their own if project is nil.
+func (s *Service) Routing(project *domain.Project) map[domain.LLMRole]Route {
+	routes := make(map[domain.LLMRole]Route, len(domain.LLMRoles))
+	for _, role := range domain.LLMRoles {
+		routes[role] = s.route(role, project)
+	}
+	return routes
+}
+
+// route returns the model of role: the project's route if it has one, else
+// the server's, else the default model.
+func (s *Service) route(role domain.LLMRole, project *domain.Project) Route {
+	if project != nil {
+		if ref, ok := project.ModelRouting[role]; ok {
+			return Route{Provider: llm.Provider(ref.Provider), Model: ref.Model, Source: RouteSourceProject}
+		}
+	}
+	if ref, ok := s.routing[role]; ok {
+		return Route{Provider: llm.Provider(ref.Provider), Model: ref.Model, Source: RouteSourceServer}
+	}
+	return Route{Provider: s.factory.DefaultProvider(), Model: s.factory.DefaultModel(), Source: RouteSourceDefault}
+}
+
+// client creates the client of an LLM call for role: the requested provider
+// and model if both are set, else the model the role is routed to.
+func (s *Service) client(role domain.LLMRole, project *domain.Project, provider llm.Provider, model string) (llm.Client, error) {
+	var llmClient llm.Client
+	var err error
+	if provider != "" && model != "" {
+		llmClient, err = s.factory.CreateClient(provider, model)
+	} else if r := s.route(role, project); r.Source != RouteSourceDefault {
+		llmClient, err = s.factory.CreateClient(r.Provider, r.Model)
+	} else {
+		llmClient, err = s.factory.CreateDefaultClient()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create llm client: %w", err)
+	}
+	return llmClient, nil
+}
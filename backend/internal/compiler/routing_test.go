@@ -0,0 +1,85 @@
+package compiler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+func TestModelRouting(t *testing.T) {
+	mockFactory := llm.NewMockFactory(`{"rationale": "ok", "targets": [], "suggestions": []}`)
+	planner := llm.NewMockClient(`{"rationale": "ok", "targets": [], "suggestions": []}`)
+	validatorClient := llm.NewMockClient(`{"issues": []}`)
+	override := llm.NewMockClient(`{"issues": []}`)
+	mockFactory.Clients = map[string]*llm.MockClient{
+		"planner-model":   planner,
+		"validator-model": validatorClient,
+		"override-model":  override,
+	}
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	service := NewService(mockFactory, val, `{}`)
+	ctx := testContext(t)
+
+	if err := service.SetRouting(domain.ModelRouting{"plannr": {Provider: "mock", Model: "m"}}); err == nil {
+		t.Error("SetRouting() accepted an unknown role")
+	}
+	if err := service.SetRouting(domain.ModelRouting{
+		domain.LLMRoleValidator: {Provider: "mock", Model: "validator-model"},
+	}); err != nil {
+		t.Fatalf("SetRouting() error = %v", err)
+	}
+
+	project := &domain.Project{
+		ID:   uuid.New(),
+		Name: "Test Project",
+		ModelRouting: domain.ModelRouting{
+			domain.LLMRolePlanner: {Provider: "mock", Model: "planner-model"},
+		},
+	}
+	routes := service.Routing(project)
+	want := map[domain.LLMRole]RouteSource{
+		domain.LLMRolePlanner:   RouteSourceProject,
+		domain.LLMRoleValidator: RouteSourceServer,
+		domain.LLMRoleCompiler:  RouteSourceDefault,
+	}
+	for role, source := range want {
+		if routes[role].Source != source {
+			t.Errorf("route of %s = %+v, want source %s", role, routes[role], source)
+		}
+	}
+	if r := routes[domain.LLMRoleCompiler]; r.Provider != "mock" || r.Model != "mock-model" {
+		t.Errorf("compiler route = %+v, want the default model", r)
+	}
+	if r := service.Routing(nil)[domain.LLMRolePlanner]; r.Source != RouteSourceDefault {
+		t.Errorf("planner route without a project = %+v, want the default model", r)
+	}
+
+	if _, err := service.Plan(ctx, PlanInput{Project: project, CurrentSpec: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if planner.CallCount != 1 || mockFactory.Client.CallCount != 0 {
+		t.Errorf("planner calls = %d, default calls = %d; want Plan on the project's planner model", planner.CallCount, mockFactory.Client.CallCount)
+	}
+
+	spec := json.RawMessage(`{"product": {"name": "Test"}}`)
+	if _, err := service.Validate(ctx, ValidateInput{Project: project, Spec: spec}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if validatorClient.CallCount != 1 {
+		t.Errorf("validator calls = %d, want Validate on the server's validator model", validatorClient.CallCount)
+	}
+
+	if _, err := service.Validate(ctx, ValidateInput{Project: project, Spec: spec, Provider: "mock", Model: "override-model"}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if override.CallCount != 1 || validatorClient.CallCount != 1 {
+		t.Errorf("override calls = %d, want the requested model to win over the route", override.CallCount)
+	}
+}
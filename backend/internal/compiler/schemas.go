@@ -0,0 +1,101 @@
+package compiler
+
+import (
+	"embed"
+	"encoding/json"
+	"log"
+
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+//go:embed schemas/*.json
+var schemasFS embed.FS
+
+// Response schemas for the services' LLM calls, passed to the provider's
+// structured-output mode so replies parse as the output types below.
+var (
+	plannerSchema   = loadSchema("planner", "planner_output")
+	askerSchema     = loadSchema("asker", "asker_output")
+	suggesterSchema = loadSchema("suggester", "suggester_output")
+	validatorSchema = loadSchema("validator", "validator_output")
+)
+
+// loadSchema loads an embedded response schema by file name.
+func loadSchema(file, name string) *llm.Schema {
+	data, err := schemasFS.ReadFile("schemas/" + file + ".json")
+	if err != nil {
+		panic(err)
+	}
+	return &llm.Schema{Name: name, JSON: data}
+}
+
+// specResponseSchema builds the schema of a response that embeds parts of the
+// spec. properties receives the spec schema's top-level properties and returns
+// the response's; the spec schema's $defs are hoisted to the response root so
+// its references still resolve. It returns nil if the spec schema can't be
+// parsed, leaving the call to plain JSON mode.
+func (s *Service) specResponseSchema(name string, properties func(spec map[string]any) map[string]any, required ...string) *llm.Schema {
+	var spec map[string]any
+	if err := json.Unmarshal([]byte(s.specSchema), &spec); err != nil {
+		log.Printf("Warning: spec schema is not valid JSON, requesting %s without a schema: %v", name, err)
+		return nil
+	}
+	defs := spec["$defs"]
+	for _, key := range []string{"$schema", "$id", "$defs"} {
+		delete(spec, key)
+	}
+
+	root := map[string]any{
+		"type":       "object",
+		"required":   required,
+		"properties": properties(spec),
+	}
+	if defs != nil {
+		root["$defs"] = defs
+	}
+	data, err := json.Marshal(root)
+	if err != nil {
+		log.Printf("Warning: failed to build %s schema: %v", name, err)
+		return nil
+	}
+	return &llm.Schema{Name: name, JSON: data}
+}
+
+// specProperty returns the schema of a top-level spec property, or an
+// unconstrained schema if the spec schema doesn't declare it.
+func specProperty(spec map[string]any, name string) any {
+	if props, ok := spec["properties"].(map[string]any); ok {
+		if p, ok := props[name]; ok {
+			return p
+		}
+	}
+	return map[string]any{}
+}
+
+// compilerSchema is the schema of a full compile: the spec and its trace.
+func (s *Service) compilerSchema() *llm.Schema {
+	return s.specResponseSchema("compiler_output", func(spec map[string]any) map[string]any {
+		return map[string]any{"spec": spec, "trace": specProperty(spec, "trace")}
+	}, "spec", "trace")
+}
+
+// repairSchema is the schema of a repaired spec.
+func (s *Service) repairSchema() *llm.Schema {
+	return s.specResponseSchema("repair_output", func(spec map[string]any) map[string]any {
+		return map[string]any{"spec": spec}
+	}, "spec")
+}
+
+// sectionSchema is the schema of an incremental compile of the given sections.
+func (s *Service) sectionSchema(sections []string) *llm.Schema {
+	return s.specResponseSchema("section_output", func(spec map[string]any) map[string]any {
+		props := make(map[string]any, len(sections))
+		for _, sec := range sections {
+			props[sec] = specProperty(spec, sec)
+		}
+		return map[string]any{
+			"sections": map[string]any{"type": "object", "required": sections, "properties": props},
+			"trace":    specProperty(spec, "trace"),
+		}
+	}, "sections", "trace")
+}
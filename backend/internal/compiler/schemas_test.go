@@ -0,0 +1,126 @@
+package compiler
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+	"github.com/dshills/specbuilder/backend/internal/validator"
+	"github.com/google/uuid"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// compileSchema compiles a response schema, failing the test if it is not a
+// valid JSON Schema or has unresolved references.
+func compileSchema(t *testing.T, schema *llm.Schema) *jsonschema.Schema {
+	t.Helper()
+	if schema == nil {
+		t.Fatal("schema is nil")
+	}
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(string(schema.JSON)))
+	if err != nil {
+		t.Fatalf("%s: unmarshal: %v", schema.Name, err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(schema.Name+".json", doc); err != nil {
+		t.Fatalf("%s: add resource: %v", schema.Name, err)
+	}
+	compiled, err := c.Compile(schema.Name + ".json")
+	if err != nil {
+		t.Fatalf("%s: compile: %v", schema.Name, err)
+	}
+	return compiled
+}
+
+func TestServiceSchemasAcceptOutputs(t *testing.T) {
+	tests := []struct {
+		schema *llm.Schema
+		output string
+	}{
+		{plannerSchema, `{"rationale": "r", "targets": [{"spec_paths": ["/api"], "gap_type": "missing", "why_now": "w", "suggested_question_count": 1}],
+			"suggestions": [{"key": "k", "spec_paths": ["/api"], "question_intent": "i", "recommended_type": "single", "recommended_options": null, "priority": 1, "tags": ["api"]}]}`},
+		{askerSchema, `{"questions": [{"text": "Which database?", "type": "single", "options": ["Postgres", "SQLite"], "tags": ["data_model"], "priority": 5, "spec_paths": ["/data_model"]}]}`},
+		{suggesterSchema, `{"suggestions": [{"question_id": "q1", "suggested_value": ["a", "b"], "confidence": "high", "reasoning": "r"},
+			{"question_id": "q2", "suggested_value": "text", "confidence": "low", "reasoning": "r"}]}`},
+		{validatorSchema, `{"issues": [{"type": "conflict", "severity": "warn", "message": "m", "related_spec_paths": [], "related_question_ids": []}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema.Name, func(t *testing.T) {
+			schema := compileSchema(t, tt.schema)
+			output, err := jsonschema.UnmarshalJSON(strings.NewReader(tt.output))
+			if err != nil {
+				t.Fatalf("unmarshal output: %v", err)
+			}
+			if err := schema.Validate(output); err != nil {
+				t.Errorf("output rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestSpecResponseSchemas(t *testing.T) {
+	specSchema, err := os.ReadFile("../validator/schemas/ProjectImplementationSpec.schema.json")
+	if err != nil {
+		t.Fatalf("read spec schema: %v", err)
+	}
+	val, err := validator.New()
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	service := NewService(llm.NewMockFactory("{}"), val, string(specSchema))
+
+	// The spec's $defs must be reachable from the wrapped spec
+	for _, schema := range []*llm.Schema{service.compilerSchema(), service.repairSchema(), service.sectionSchema([]string{"api", "personas"})} {
+		compileSchema(t, schema)
+	}
+
+	var section struct {
+		Properties struct {
+			Sections struct {
+				Required   []string                   `json:"required"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"sections"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(service.sectionSchema([]string{"api", "personas"}).JSON, &section); err != nil {
+		t.Fatalf("unmarshal section schema: %v", err)
+	}
+	if got := section.Properties.Sections.Required; len(got) != 2 || got[0] != "api" || got[1] != "personas" {
+		t.Errorf("required sections = %v, want [api personas]", got)
+	}
+	if got := string(section.Properties.Sections.Properties["api"]); got != `{"$ref":"#/$defs/API"}` {
+		t.Errorf("api section schema = %s, want the spec's", got)
+	}
+
+	if s := NewService(llm.NewMockFactory("{}"), val, "not json").compilerSchema(); s != nil {
+		t.Errorf("compilerSchema() with an invalid spec schema = %s, want nil", s.JSON)
+	}
+}
+
+func TestCompileRequestsSchema(t *testing.T) {
+	service := setupCompilerService(t, `{"spec": {"product": {}}, "trace": {}}`)
+	service.SetRepairPolicy(0, false)
+	project := &domain.Project{ID: uuid.New(), Name: "Test Project"}
+	if _, err := service.Compile(testContext(t), CompileInput{Project: project}); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	req := service.factory.(*llm.MockFactory).Client.LastRequest
+	if req.PromptVersion != llm.PromptVersionV1 {
+		t.Errorf("request prompt version = %q, want v1", req.PromptVersion)
+	}
+	if req.Schema == nil || req.Schema.Name != "compiler_output" {
+		t.Fatalf("request schema = %+v, want compiler_output", req.Schema)
+	}
+	var schema struct {
+		Required []string `json:"required"`
+	}
+	if err := json.Unmarshal(req.Schema.JSON, &schema); err != nil {
+		t.Fatalf("unmarshal schema: %v", err)
+	}
+	if len(schema.Required) != 2 {
+		t.Errorf("required = %v, want [spec trace]", schema.Required)
+	}
+}
@@ -0,0 +1,164 @@
+package compiler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+// streamInterval is the minimum time between StreamProgress updates, unless
+// the output reaches a new section.
+const streamInterval = 250 * time.Millisecond
+
+// StreamProgress reports the progress of an LLM call: the output generated
+// so far by a streaming call, a failed attempt that is being retried, a
+// response served from the cache, or inputs trimmed to fit the model.
+type StreamProgress struct {
+	Stage   string          // Stage the call belongs to ("compiling", "repairing", "planning", ...)
+	Tokens  int             // Output tokens generated so far
+	Section string          // Top-level section the output has reached, if known
+	Model   string          // Ensemble compiles only: the member writing the output ("provider/model")
+	Retry   *llm.RetryEvent // Set when a failed attempt is about to be retried
+	Cached  bool            // Set when the response came from the response cache
+	Trimmed *ContextTrim    // Set when the call's inputs were cut to fit the model's context window
+}
+
+// StreamFunc receives StreamProgress updates. It may be nil.
+type StreamFunc func(StreamProgress)
+
+// complete calls the LLM, streaming progress to onStream when the client
+// supports it and falling back to a blocking call otherwise. Retries of the
+// call and cache hits are reported to onStream too, and the completed call to
+// the context's call recorder, whether or not it succeeds.
+func complete(ctx context.Context, llmClient llm.Client, req llm.Request, stage string, onStream StreamFunc) (*llm.Response, error) {
+	if req.Role == "" {
+		req.Role = string(stageRoles[stage])
+	}
+	done, err := guardCall(ctx, stage, llmClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	start := time.Now()
+	resp, err := completeWithProgress(ctx, llmClient, req, stage, onStream)
+	recordCall(ctx, stage, llmClient, req, resp, err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	if resp.CacheHit && onStream != nil {
+		onStream(StreamProgress{Stage: stage, Cached: true})
+	}
+	return resp, nil
+}
+
+func completeWithProgress(ctx context.Context, llmClient llm.Client, req llm.Request, stage string, onStream StreamFunc) (*llm.Response, error) {
+	if onStream == nil {
+		return llmClient.Complete(ctx, req)
+	}
+
+	var tracker sectionTracker
+	var last time.Time
+	var lastSection string
+	ctx = llm.WithRetryObserver(ctx, func(e llm.RetryEvent) {
+		// A retried stream starts over
+		tracker = sectionTracker{}
+		last, lastSection = time.Time{}, ""
+		onStream(StreamProgress{Stage: stage, Retry: &e})
+	})
+
+	streaming, ok := llmClient.(llm.StreamingClient)
+	if !ok {
+		return llmClient.Complete(ctx, req)
+	}
+	return streaming.CompleteStream(ctx, req, func(d llm.StreamDelta) {
+		tracker.Write(d.Text)
+		now := time.Now()
+		if tracker.Section == lastSection && now.Sub(last) < streamInterval {
+			return
+		}
+		last, lastSection = now, tracker.Section
+		onStream(StreamProgress{Stage: stage, Tokens: d.OutputTokens, Section: tracker.Section})
+	})
+}
+
+// sectionTracker follows a JSON document as it streams in and records the
+// top-level section being written: the key under "spec" or "sections" for
+// compiler output, otherwise the top-level key.
+type sectionTracker struct {
+	Section string
+
+	stack     []byte   // Open containers ('{' or '[')
+	keys      []string // Latest key in each open container
+	inString  bool
+	escaped   bool
+	isKey     bool
+	expectKey bool
+	key       []byte
+}
+
+// Write consumes the next chunk of the document.
+func (t *sectionTracker) Write(chunk string) {
+	for i := 0; i < len(chunk); i++ {
+		c := chunk[i]
+		if t.inString {
+			switch {
+			case t.escaped:
+				t.escaped = false
+				t.appendKey(c)
+			case c == '\\':
+				t.escaped = true
+			case c == '"':
+				t.inString = false
+				if t.isKey {
+					t.setKey(string(t.key))
+				}
+			default:
+				t.appendKey(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			t.inString = true
+			t.isKey = t.expectKey
+			t.key = t.key[:0]
+		case '{', '[':
+			t.stack = append(t.stack, c)
+			t.keys = append(t.keys, "")
+			t.expectKey = c == '{'
+		case '}', ']':
+			if n := len(t.stack); n > 0 {
+				t.stack = t.stack[:n-1]
+				t.keys = t.keys[:n-1]
+			}
+			t.expectKey = false
+		case ':':
+			t.expectKey = false
+		case ',':
+			t.expectKey = len(t.stack) > 0 && t.stack[len(t.stack)-1] == '{'
+		}
+	}
+}
+
+func (t *sectionTracker) appendKey(c byte) {
+	if t.isKey {
+		t.key = append(t.key, c)
+	}
+}
+
+func (t *sectionTracker) setKey(key string) {
+	depth := len(t.keys)
+	if depth == 0 {
+		return
+	}
+	t.keys[depth-1] = key
+
+	switch {
+	case depth == 1 && key != "spec" && key != "sections":
+		t.Section = key
+	case depth == 2 && (t.keys[0] == "spec" || t.keys[0] == "sections"):
+		t.Section = key
+	}
+}
@@ -0,0 +1,229 @@
+package compiler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+func TestSectionTracker(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []string // Sections in the order they are reached
+	}{
+		{
+			name: "compiler output",
+			doc:  `{"spec": {"product": {"name": "A \"quoted\" name"}, "scope": {"in_scope": ["x"]}}, "trace": {"product.name": {}}}`,
+			want: []string{"product", "scope", "trace"},
+		},
+		{
+			name: "section output",
+			doc:  `{"sections": {"api": {"endpoints": []}, "data_model": {}}}`,
+			want: []string{"api", "data_model"},
+		},
+		{
+			name: "planner output",
+			doc:  "```json\n{\"suggestions\": [{\"topic\": \"auth\"}]}\n```",
+			want: []string{"suggestions"},
+		},
+		{
+			name: "string values are not keys",
+			doc:  `{"spec": {"product": {"purpose": "has {\"spec\": braces}"}, "plan": {}}}`,
+			want: []string{"product", "plan"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Feed the document a few bytes at a time, as a stream would
+			var tracker sectionTracker
+			var got []string
+			for rest := tt.doc; rest != ""; {
+				n := min(3, len(rest))
+				tracker.Write(rest[:n])
+				rest = rest[n:]
+				if tracker.Section != "" && (len(got) == 0 || got[len(got)-1] != tracker.Section) {
+					got = append(got, tracker.Section)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("sections = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleteStreamsProgress(t *testing.T) {
+	client := llm.NewMockClient(`{"spec": {"product": {"name": "Streamed"}, "scope": {"in_scope": []}}, "trace": {}}`)
+
+	var updates []StreamProgress
+	resp, err := complete(testContext(t), client, llm.Request{}, "compiling", func(p StreamProgress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	if !strings.Contains(resp.Content, "Streamed") {
+		t.Errorf("content = %q, want the full response", resp.Content)
+	}
+
+	// Each new section is reported even though the mock streams instantly
+	var sections []string
+	for i, u := range updates {
+		if u.Stage != "compiling" {
+			t.Errorf("update stage = %q, want compiling", u.Stage)
+		}
+		if i > 0 && u.Tokens <= updates[i-1].Tokens {
+			t.Errorf("token counts not increasing: %d after %d", u.Tokens, updates[i-1].Tokens)
+		}
+		if u.Section != "" {
+			sections = append(sections, u.Section)
+		}
+	}
+	if strings.Join(sections, ",") != "product,scope,trace" {
+		t.Errorf("sections = %v, want product, scope, trace", sections)
+	}
+}
+
+func TestCompleteReportsRetries(t *testing.T) {
+	client := llm.NewRetryClient(&failOnceClient{MockClient: llm.NewMockClient(`{"spec": {}}`)},
+		llm.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, nil)
+
+	var retries []*llm.RetryEvent
+	_, err := complete(testContext(t), client, llm.Request{}, "planning", func(p StreamProgress) {
+		if p.Retry != nil {
+			if p.Stage != "planning" {
+				t.Errorf("retry stage = %q, want planning", p.Stage)
+			}
+			retries = append(retries, p.Retry)
+		}
+	})
+	if err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	if len(retries) != 1 || retries[0].Attempt != 1 || retries[0].MaxAttempts != 2 {
+		t.Errorf("retries = %+v, want attempt 1 of 2", retries)
+	}
+}
+
+func TestCompleteRecordsCalls(t *testing.T) {
+	client := llm.NewMockClient(`{"issues": []}`)
+	client.ModelName = "mock-validator"
+	client.Usage = llm.Usage{InputTokens: 120, OutputTokens: 30, StopReason: "end_turn"}
+
+	var calls []LLMCall
+	ctx := WithCallRecorder(testContext(t), func(c LLMCall) { calls = append(calls, c) })
+	if _, err := complete(ctx, client, llm.Request{}, "validating", nil); err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	if _, err := complete(testContext(t), client, llm.Request{}, "compiling", nil); err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("recorded %d calls, want only the one made with a recorder", len(calls))
+	}
+	c := calls[0]
+	if c.Role != domain.LLMRoleValidator || c.Model != "mock-validator" || c.Usage.InputTokens != 120 || c.Usage.OutputTokens != 30 {
+		t.Errorf("recorded call = %+v, want the validator call and its usage", c)
+	}
+	if role := client.LastRequest.Role; role != "compiler" {
+		t.Errorf("request role = %q, want compiler", role)
+	}
+}
+
+func TestCompleteRecordsFailedCalls(t *testing.T) {
+	client := llm.NewMockClient("")
+	client.Error = errors.New("connection refused")
+
+	var calls []LLMCall
+	ctx := WithCallRecorder(testContext(t), func(c LLMCall) { calls = append(calls, c) })
+	req := llm.Request{Messages: []llm.Message{{Role: "user", Content: "Plan"}}}
+	if _, err := complete(ctx, client, req, "planning", nil); err == nil {
+		t.Fatal("complete() error = nil, want the client's error")
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("recorded %d calls, want 1", len(calls))
+	}
+	c := calls[0]
+	if c.Err == nil || c.Role != domain.LLMRolePlanner || c.Stage != "planning" || c.Model != "mock-model" ||
+		len(c.Request.Messages) != 1 || c.Content != "" {
+		t.Errorf("recorded call = %+v, want the failed planner call and its request", c)
+	}
+}
+
+func TestCompleteGuardsCalls(t *testing.T) {
+	client := llm.NewMockClient(`{"issues": []}`)
+	var events []string
+	ctx := WithCallRecorder(testContext(t), func(c LLMCall) { events = append(events, "recorded") })
+	ctx = WithCallGuard(ctx, func(c LLMCall) (func(), error) {
+		if c.Stage == "compiling" {
+			return nil, errors.New("over budget")
+		}
+		if c.Role != domain.LLMRoleValidator || c.Request.MaxTokens != 100 {
+			t.Errorf("guarded call = %+v, want the validator call and its request", c)
+		}
+		return func() { events = append(events, "done") }, nil
+	})
+
+	if _, err := complete(ctx, client, llm.Request{MaxTokens: 100}, "validating", nil); err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	if _, err := complete(ctx, client, llm.Request{}, "compiling", nil); !errors.Is(err, ErrCallRefused) {
+		t.Errorf("complete() error = %v, want ErrCallRefused", err)
+	}
+
+	if client.CallCount != 1 {
+		t.Errorf("LLM calls = %d, want only the allowed one", client.CallCount)
+	}
+	if !reflect.DeepEqual(events, []string{"recorded", "done"}) {
+		t.Errorf("events = %v, want the allowed call recorded before it is done", events)
+	}
+}
+
+func TestCompleteReportsCacheHits(t *testing.T) {
+	client := llm.NewCachingClient(llm.NewMockClient(`{"issues": []}`), llm.NewDirCache(t.TempDir()), time.Hour)
+
+	var calls []LLMCall
+	var cached []StreamProgress
+	ctx := WithCallRecorder(testContext(t), func(c LLMCall) { calls = append(calls, c) })
+	onStream := func(p StreamProgress) {
+		if p.Cached {
+			cached = append(cached, p)
+		}
+	}
+	for range 2 {
+		if _, err := complete(ctx, client, llm.Request{}, "validating", onStream); err != nil {
+			t.Fatalf("complete() error = %v", err)
+		}
+	}
+
+	if len(cached) != 1 || cached[0].Stage != "validating" {
+		t.Errorf("cache hit progress = %+v, want one for the second call", cached)
+	}
+	if len(calls) != 2 || calls[0].CacheHit || !calls[1].CacheHit {
+		t.Errorf("recorded calls = %+v, want the second marked as a cache hit", calls)
+	}
+}
+
+// failOnceClient fails its first call with an overloaded error.
+type failOnceClient struct {
+	*llm.MockClient
+	failed bool
+}
+
+func (c *failOnceClient) CompleteStream(ctx context.Context, req llm.Request, onDelta llm.StreamFunc) (*llm.Response, error) {
+	if !c.failed {
+		c.failed = true
+		return nil, &llm.APIError{Provider: c.Provider(), StatusCode: 529, Type: "overloaded_error"}
+	}
+	return c.MockClient.CompleteStream(ctx, req, onDelta)
+}
@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/llm"
+)
+
+// LLMCall describes an LLM call, for usage accounting and auditing.
+type LLMCall struct {
+	Role     domain.LLMRole
+	Stage    string       // Stage the call belongs to ("compiling", "repairing", "planning", ...)
+	Provider llm.Provider // Provider that served the call
+	Model    string       // Model that served the call
+	Usage    llm.Usage
+	CacheHit bool // Served from the response cache
+
+	Request llm.Request   // What the model was sent
+	Content string        // The raw response; empty if the call failed
+	Err     error         // Set if the call failed, after any retries
+	Latency time.Duration // Time the call took, including retries
+}
+
+// CallRecorder receives each LLM call the Service makes, including those
+// that fail. Ensemble compiles call it from several goroutines at once.
+type CallRecorder func(LLMCall)
+
+type callRecorderKey struct{}
+
+// WithCallRecorder returns a context that makes the Service report the LLM
+// calls it completes on behalf of ctx to fn.
+func WithCallRecorder(ctx context.Context, fn CallRecorder) context.Context {
+	return context.WithValue(ctx, callRecorderKey{}, fn)
+}
+
+// ErrCallRefused is returned, wrapping the guard's error, for LLM calls a
+// CallGuard refused.
+var ErrCallRefused = errors.New("llm call refused")
+
+// CallGuard is asked before each LLM call the Service makes, with the
+// call's role, stage, provider, model and request set, and may refuse it by
+// returning an error. Otherwise done is called once the call has finished
+// and been recorded. Ensemble compiles call it from several goroutines at
+// once.
+type CallGuard func(call LLMCall) (done func(), err error)
+
+type callGuardKey struct{}
+
+// WithCallGuard returns a context that makes the Service ask fn before each
+// LLM call it makes on behalf of ctx.
+func WithCallGuard(ctx context.Context, fn CallGuard) context.Context {
+	return context.WithValue(ctx, callGuardKey{}, fn)
+}
+
+// guardCall asks the context's call guard whether the call may go ahead,
+// returning the function to call when it has finished.
+func guardCall(ctx context.Context, stage string, llmClient llm.Client, req llm.Request) (func(), error) {
+	fn, ok := ctx.Value(callGuardKey{}).(CallGuard)
+	if !ok || fn == nil {
+		return func() {}, nil
+	}
+	done, err := fn(LLMCall{
+		Role:     stageRoles[stage],
+		Stage:    stage,
+		Provider: llmClient.Provider(),
+		Model:    llmClient.Model(),
+		Request:  req,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCallRefused, err)
+	}
+	return done, nil
+}
+
+// stageRoles maps the stages passed to complete to the role of the call.
+var stageRoles = map[string]domain.LLMRole{
+	"compiling":  domain.LLMRoleCompiler,
+	"repairing":  domain.LLMRoleCompiler,
+	"validating": domain.LLMRoleValidator,
+	"planning":   domain.LLMRolePlanner,
+	"asking":     domain.LLMRoleAsker,
+	"suggesting": domain.LLMRoleSuggester,
+}
+
+// recordCall reports a call to the context's call recorder. resp is nil if
+// the call failed with err.
+func recordCall(ctx context.Context, stage string, llmClient llm.Client, req llm.Request, resp *llm.Response, err error, latency time.Duration) {
+	fn, ok := ctx.Value(callRecorderKey{}).(CallRecorder)
+	if !ok || fn == nil {
+		return
+	}
+	call := LLMCall{
+		Role:     stageRoles[stage],
+		Stage:    stage,
+		Provider: llmClient.Provider(),
+		Model:    llmClient.Model(),
+		Request:  req,
+		Err:      err,
+		Latency:  latency,
+	}
+	if resp != nil {
+		call.Provider = cmp.Or(resp.Provider, call.Provider)
+		call.Model = cmp.Or(resp.Model, call.Model)
+		call.Usage = resp.Usage
+		call.CacheHit = resp.CacheHit
+		call.Content = resp.Content
+	}
+	fn(call)
+}
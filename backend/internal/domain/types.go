@@ -1,7 +1,12 @@
 package domain
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -48,6 +53,7 @@ const (
 	IssueTypeConflict   IssueType = "conflict"
 	IssueTypeMissing    IssueType = "missing"
 	IssueTypeAssumption IssueType = "assumption"
+	IssueTypeBudget     IssueType = "budget" // LLM usage is nearing a budget limit
 )
 
 // IssueSeverity represents the severity of an issue.
@@ -79,11 +85,84 @@ const (
 
 // Project represents a specification project.
 type Project struct {
-	ID        uuid.UUID   `json:"id"`
-	Name      string      `json:"name"`
-	Mode      ProjectMode `json:"mode"` // basic or advanced
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	ID            uuid.UUID    `json:"id"`
+	Name          string       `json:"name"`
+	Mode          ProjectMode  `json:"mode"` // basic or advanced
+	Budget        *Budget      `json:"budget,omitempty"`
+	PromptVersion string       `json:"prompt_version,omitempty"` // Pinned prompt version; empty uses the server default
+	ModelRouting  ModelRouting `json:"model_routing,omitempty"`  // Models of the roles the project routes; others use the server's
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// BudgetPeriod is the window an LLM budget applies to.
+type BudgetPeriod string
+
+const (
+	// BudgetPeriodMonthly counts usage since the start of the calendar month (UTC)
+	BudgetPeriodMonthly BudgetPeriod = "monthly"
+	// BudgetPeriodLifetime counts all usage
+	BudgetPeriodLifetime BudgetPeriod = "lifetime"
+)
+
+// DefaultBudgetWarnAt is the share of a budget limit that raises a warning
+// when a budget does not set one.
+const DefaultBudgetWarnAt = 0.8
+
+// Budget limits the LLM usage of a project, or of the whole server. LLM
+// calls are refused once either limit is reached.
+type Budget struct {
+	Period     BudgetPeriod `json:"period"`
+	MaxTokens  int          `json:"max_tokens,omitempty"`   // Input plus output tokens; 0 for no limit
+	MaxCostUSD float64      `json:"max_cost_usd,omitempty"` // Estimated cost; 0 for no limit
+	WarnAt     float64      `json:"warn_at,omitempty"`      // Share of a limit (0-1) that raises a warning; 0 for DefaultBudgetWarnAt
+}
+
+// Validate checks that the budget is well formed.
+func (b *Budget) Validate() error {
+	switch {
+	case b.Period != BudgetPeriodMonthly && b.Period != BudgetPeriodLifetime:
+		return fmt.Errorf("period must be %q or %q", BudgetPeriodMonthly, BudgetPeriodLifetime)
+	case b.MaxTokens < 0 || b.MaxCostUSD < 0:
+		return errors.New("limits must not be negative")
+	case b.MaxTokens == 0 && b.MaxCostUSD == 0:
+		return errors.New("max_tokens or max_cost_usd is required")
+	case b.WarnAt < 0 || b.WarnAt > 1:
+		return errors.New("warn_at must be between 0 and 1")
+	}
+	return nil
+}
+
+// Start returns the start of the budget period containing now, or the zero
+// time for a lifetime budget.
+func (b *Budget) Start(now time.Time) time.Time {
+	if b.Period != BudgetPeriodMonthly {
+		return time.Time{}
+	}
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Used returns the share of the budget used by usage: the larger of the
+// token and cost shares, for the limits that are set.
+func (b *Budget) Used(usage UsageTotals) float64 {
+	var used float64
+	if b.MaxTokens > 0 {
+		used = float64(usage.InputTokens+usage.OutputTokens) / float64(b.MaxTokens)
+	}
+	if b.MaxCostUSD > 0 {
+		used = max(used, usage.CostUSD/b.MaxCostUSD)
+	}
+	return used
+}
+
+// Warning reports whether usage has reached the budget's warning threshold.
+func (b *Budget) Warning(usage UsageTotals) bool {
+	warnAt := b.WarnAt
+	if warnAt == 0 {
+		warnAt = DefaultBudgetWarnAt
+	}
+	return b.Used(usage) >= warnAt
 }
 
 // Question represents a question in a project.
@@ -118,16 +197,67 @@ type CompilerConfig struct {
 	PromptVersion string  `json:"prompt_version"`
 	Temperature   float64 `json:"temperature"`
 	Seed          *int    `json:"seed,omitempty"`
+	// Sections lists the top-level spec sections regenerated by an incremental
+	// compile. Empty for a full compile.
+	Sections []string `json:"sections,omitempty"`
+	// Models lists every model whose output contributed to an ensemble
+	// compile, primary first (matching Model). Empty for a single-model compile.
+	Models []ModelRef `json:"models,omitempty"`
+}
+
+// ModelRef identifies an LLM provider/model pair.
+type ModelRef struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// ModelRouting maps LLM roles to the models that serve them, so that cheap
+// models can generate questions while strong ones compile.
+type ModelRouting map[LLMRole]ModelRef
+
+// Validate checks that every route is for a known role and names both a
+// provider and a model.
+func (r ModelRouting) Validate() error {
+	for _, role := range slices.Sorted(maps.Keys(r)) {
+		switch {
+		case !slices.Contains(LLMRoles, role):
+			return fmt.Errorf("unknown role %q; roles are %v", role, LLMRoles)
+		case r[role].Provider == "" || r[role].Model == "":
+			return fmt.Errorf("%s: provider and model are required", role)
+		}
+	}
+	return nil
 }
 
 // SpecSnapshot represents an immutable compiled specification snapshot.
 type SpecSnapshot struct {
-	ID          uuid.UUID         `json:"id"`
-	ProjectID   uuid.UUID         `json:"project_id"`
-	Spec        json.RawMessage   `json:"spec"` // ProjectImplementationSpec JSON
-	CreatedAt   time.Time         `json:"created_at"`
-	DerivedFrom map[uuid.UUID]int `json:"derived_from"` // question_id -> answer_version
-	Compiler    CompilerConfig    `json:"compiler"`
+	ID               uuid.UUID         `json:"id"`
+	ProjectID        uuid.UUID         `json:"project_id"`
+	ParentSnapshotID *uuid.UUID        `json:"parent_snapshot_id"` // Latest snapshot when this one was compiled; nil for the first
+	Spec             json.RawMessage   `json:"spec"`               // ProjectImplementationSpec JSON
+	CreatedAt        time.Time         `json:"created_at"`
+	DerivedFrom      map[uuid.UUID]int `json:"derived_from"` // question_id -> answer_version
+	Compiler         CompilerConfig    `json:"compiler"`
+	Trace            json.RawMessage   `json:"-"`               // Trace JSON, served by the trace endpoint
+	Usage            *UsageTotals      `json:"usage,omitempty"` // LLM usage and estimated cost of the compile that produced it
+}
+
+// TraceSource identifies an answer version a spec path was derived from.
+type TraceSource struct {
+	QuestionID    string `json:"question_id"` // string UUIDs from LLM
+	AnswerID      string `json:"answer_id"`
+	AnswerVersion int    `json:"answer_version"`
+}
+
+// Trace maps spec paths (JSON pointers) to the answers they were derived from.
+type Trace struct {
+	SpecPathToSources map[string][]TraceSource `json:"spec_path_to_sources"`
+}
+
+// TraceEntry is a single spec path -> source link, used for trace lookups.
+type TraceEntry struct {
+	SpecPath string `json:"spec_path"`
+	TraceSource
 }
 
 // Issue represents a validation issue for a snapshot.
@@ -168,3 +298,213 @@ type Suggestion struct {
 	Confidence     SuggestionConfidence `json:"confidence"`
 	Reasoning      string               `json:"reasoning"`
 }
+
+// JobKind identifies the work a background job performs.
+type JobKind string
+
+const (
+	JobKindCompile       JobKind = "compile"
+	JobKindNextQuestions JobKind = "next_questions"
+	JobKindSuggestions   JobKind = "suggestions"
+)
+
+// JobStatus represents the lifecycle state of a background job.
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// IsFinished reports whether the job has reached a terminal state.
+func (s JobStatus) IsFinished() bool {
+	return s == JobStatusSucceeded || s == JobStatusFailed
+}
+
+// Job is a background LLM task whose progress outlives the request that started it.
+type Job struct {
+	ID         uuid.UUID       `json:"id"`
+	ProjectID  uuid.UUID       `json:"project_id"`
+	Kind       JobKind         `json:"kind"`
+	Status     JobStatus       `json:"status"`
+	Params     json.RawMessage `json:"params"`           // Request parameters
+	Result     json.RawMessage `json:"result,omitempty"` // "complete" or "fail" event payload
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// JobEvent is a progress event emitted by a job. Seq orders events within a job
+// and is used as the SSE event ID for reconnects.
+type JobEvent struct {
+	JobID     uuid.UUID       `json:"job_id"`
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"` // "stage", "complete", or "fail"
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// LLMRole identifies what an LLM call was made for.
+type LLMRole string
+
+const (
+	LLMRolePlanner   LLMRole = "planner"
+	LLMRoleAsker     LLMRole = "asker"
+	LLMRoleCompiler  LLMRole = "compiler"
+	LLMRoleValidator LLMRole = "validator"
+	LLMRoleSuggester LLMRole = "suggester"
+)
+
+// LLMRoles lists every LLMRole, in pipeline order.
+var LLMRoles = []LLMRole{LLMRolePlanner, LLMRoleAsker, LLMRoleSuggester, LLMRoleCompiler, LLMRoleValidator}
+
+// LLMCall records the token usage and estimated cost of one LLM call.
+type LLMCall struct {
+	ID           uuid.UUID  `json:"id"`
+	ProjectID    uuid.UUID  `json:"project_id"`
+	SnapshotID   *uuid.UUID `json:"snapshot_id"` // Snapshot the call contributed to, if any
+	Role         LLMRole    `json:"role"`
+	Provider     string     `json:"provider"`
+	Model        string     `json:"model"`
+	InputTokens  int        `json:"input_tokens"` // Includes cached tokens
+	OutputTokens int        `json:"output_tokens"`
+	CachedTokens int        `json:"cached_tokens"`
+	LatencyMs    int64      `json:"latency_ms"`
+	StopReason   string     `json:"stop_reason,omitempty"`
+	CostUSD      *float64   `json:"cost_usd"`  // Estimated; nil if the model has no known price
+	CacheHit     bool       `json:"cache_hit"` // Served from the response cache, so no tokens were billed
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// LLMCallOutcome is how an audited LLM call ended.
+type LLMCallOutcome string
+
+const (
+	LLMCallOK          LLMCallOutcome = "ok"           // The response parsed as JSON
+	LLMCallInvalidJSON LLMCallOutcome = "invalid_json" // The response didn't parse as JSON
+	LLMCallFailed      LLMCallOutcome = "failed"       // The call failed, after any retries
+)
+
+// LLMAuditEntry records what an LLM call was sent and what it returned, with
+// secrets and personal data redacted.
+type LLMAuditEntry struct {
+	ID            uuid.UUID      `json:"id"` // The ID of the call's LLMCall, if it has one
+	ProjectID     uuid.UUID      `json:"project_id"`
+	SnapshotID    *uuid.UUID     `json:"snapshot_id"`  // Snapshot the call contributed to, if any
+	QuestionIDs   []uuid.UUID    `json:"question_ids"` // Questions the call contributed to, if any
+	Role          LLMRole        `json:"role"`
+	Stage         string         `json:"stage"` // "compiling", "repairing", "planning", ...
+	Provider      string         `json:"provider"`
+	Model         string         `json:"model"`
+	PromptVersion string         `json:"prompt_version,omitempty"`
+	Messages      []LLMMessage   `json:"messages"`
+	Response      string         `json:"response"` // The raw response; empty if the call failed
+	Outcome       LLMCallOutcome `json:"outcome"`
+	Error         string         `json:"error,omitempty"`
+	InputTokens   int            `json:"input_tokens"`
+	OutputTokens  int            `json:"output_tokens"`
+	LatencyMs     int64          `json:"latency_ms"`
+	StopReason    string         `json:"stop_reason,omitempty"`
+	CacheHit      bool           `json:"cache_hit"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// LLMMessage is a message sent to an LLM.
+type LLMMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMAuditFilter selects audit entries. Zero fields match everything.
+type LLMAuditFilter struct {
+	SnapshotID *uuid.UUID
+	QuestionID *uuid.UUID
+	Role       LLMRole
+	Outcome    LLMCallOutcome
+	Limit      int // Defaults to 50
+}
+
+// UsageTotals sums the usage and estimated cost of a set of LLM calls.
+type UsageTotals struct {
+	Calls         int     `json:"calls"`
+	InputTokens   int     `json:"input_tokens"`
+	OutputTokens  int     `json:"output_tokens"`
+	CachedTokens  int     `json:"cached_tokens"`
+	CostUSD       float64 `json:"cost_usd"`       // Estimated cost of the priced calls
+	UnpricedCalls int     `json:"unpriced_calls"` // Calls to models without a known price, excluded from CostUSD
+	CacheHits     int     `json:"cache_hits"`     // Calls served from the response cache
+}
+
+// Add adds a call to the totals.
+func (t *UsageTotals) Add(call *LLMCall) {
+	t.Calls++
+	t.InputTokens += call.InputTokens
+	t.OutputTokens += call.OutputTokens
+	t.CachedTokens += call.CachedTokens
+	if call.CostUSD != nil {
+		t.CostUSD += *call.CostUSD
+	} else {
+		t.UnpricedCalls++
+	}
+	if call.CacheHit {
+		t.CacheHits++
+	}
+}
+
+// Merge adds other's totals to t.
+func (t *UsageTotals) Merge(other UsageTotals) {
+	t.Calls += other.Calls
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.CachedTokens += other.CachedTokens
+	t.CostUSD += other.CostUSD
+	t.UnpricedCalls += other.UnpricedCalls
+	t.CacheHits += other.CacheHits
+}
+
+// Add adds the totals of calls made for role and served by provider/model
+// to the project's usage, keeping ByRole sorted by role and ByModel by
+// provider and model.
+func (u *ProjectUsage) Add(role LLMRole, provider, model string, totals UsageTotals) {
+	u.Total.Merge(totals)
+
+	i, found := slices.BinarySearchFunc(u.ByRole, role, func(r RoleUsage, role LLMRole) int {
+		return cmp.Compare(r.Role, role)
+	})
+	if !found {
+		u.ByRole = slices.Insert(u.ByRole, i, RoleUsage{Role: role})
+	}
+	u.ByRole[i].Merge(totals)
+
+	i, found = slices.BinarySearchFunc(u.ByModel, provider+"/"+model, func(m ModelUsage, key string) int {
+		return cmp.Compare(m.Provider+"/"+m.Model, key)
+	})
+	if !found {
+		u.ByModel = slices.Insert(u.ByModel, i, ModelUsage{Provider: provider, Model: model})
+	}
+	u.ByModel[i].Merge(totals)
+}
+
+// RoleUsage is the usage of a project's LLM calls made for one role.
+type RoleUsage struct {
+	Role LLMRole `json:"role"`
+	UsageTotals
+}
+
+// ModelUsage is the usage of a project's LLM calls served by one model.
+type ModelUsage struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	UsageTotals
+}
+
+// ProjectUsage summarizes a project's LLM usage and estimated cost.
+type ProjectUsage struct {
+	ProjectID uuid.UUID    `json:"project_id"`
+	Total     UsageTotals  `json:"total"`
+	ByRole    []RoleUsage  `json:"by_role"`
+	ByModel   []ModelUsage `json:"by_model"`
+}
@@ -0,0 +1,392 @@
+// Package jobs runs long LLM tasks (compile, next-questions, suggestions) in the
+// background so their progress survives client disconnects. Jobs run on a
+// bounded worker pool; jobs for the same project run one at a time, in order.
+// Every progress event is persisted, so SSE subscribers can reconnect and
+// replay what they missed.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Defaults for Options fields left at zero.
+const (
+	DefaultWorkers   = 4
+	DefaultTimeout   = 10 * time.Minute
+	DefaultMaxQueued = 100
+)
+
+// Event types. "fail" is used instead of "error" because "error" is reserved
+// in the EventSource API.
+const (
+	EventStage    = "stage"
+	EventComplete = "complete"
+	EventFail     = "fail"
+)
+
+// ErrQueueFull is returned by Submit when too many jobs are waiting.
+var ErrQueueFull = errors.New("job queue full")
+
+// Error is a job failure with a machine-readable code, sent as the "fail" event.
+type Error struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Fail returns a job failure with the given code and message.
+func Fail(code, message string) error {
+	return &Error{Code: code, Message: message}
+}
+
+// EmitFunc records a progress event for the running job.
+type EmitFunc func(eventType string, data any)
+
+// Func performs a job. Its result becomes the "complete" event payload; an
+// error becomes the "fail" event payload.
+type Func func(ctx context.Context, emit EmitFunc) (any, error)
+
+// Task is a job submitted to the Runner.
+type Task struct {
+	Job *domain.Job
+	Run Func
+	// Queued, if set, is emitted as a "stage" event when the job has to wait
+	// for an earlier job on the same project.
+	Queued any
+}
+
+// Options configures a Runner.
+type Options struct {
+	Workers   int           // Concurrent jobs across all projects
+	Timeout   time.Duration // Per-job timeout
+	MaxQueued int           // Jobs waiting to run before Submit returns ErrQueueFull
+}
+
+type task struct {
+	Task
+	mu  sync.Mutex
+	seq int
+}
+
+// Runner executes jobs on a bounded worker pool with per-project serialization.
+type Runner struct {
+	repo repository.Repository
+	opts Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[uuid.UUID][]*task // Per-project FIFO of jobs not yet started
+	active  map[uuid.UUID]bool    // Projects that are ready or have a running job
+	ready   []uuid.UUID           // Projects with a job ready to start
+	queued  int
+	closed  bool
+
+	subsMu sync.Mutex
+	subs   map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+// NewRunner creates a Runner and starts its workers.
+func NewRunner(repo repository.Repository, opts Options) *Runner {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxQueued <= 0 {
+		opts.MaxQueued = DefaultMaxQueued
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Runner{
+		repo:    repo,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[uuid.UUID][]*task),
+		active:  make(map[uuid.UUID]bool),
+		subs:    make(map[uuid.UUID]map[chan struct{}]struct{}),
+	}
+	r.cond = sync.NewCond(&r.mu)
+
+	for i := 0; i < opts.Workers; i++ {
+		r.wg.Add(1)
+		go r.worker()
+	}
+	return r
+}
+
+// Recover fails jobs left queued or running by a previous process, so their
+// subscribers receive a terminal event instead of waiting forever.
+func (r *Runner) Recover(ctx context.Context) error {
+	jobs, err := r.repo.ListUnfinishedJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("list unfinished jobs: %w", err)
+	}
+	for _, job := range jobs {
+		events, err := r.repo.ListJobEvents(ctx, job.ID, 0)
+		if err != nil {
+			return fmt.Errorf("list job events: %w", err)
+		}
+		t := &task{Task: Task{Job: job}, seq: len(events)}
+		r.finish(t, nil, Fail("interrupted", "Job was interrupted by a server restart"))
+	}
+	if len(jobs) > 0 {
+		log.Printf("Jobs: marked %d interrupted jobs as failed", len(jobs))
+	}
+	return nil
+}
+
+// Submit persists the job as queued and schedules it. Jobs for the same
+// project run in submission order.
+func (r *Runner) Submit(ctx context.Context, t Task) error {
+	// Reserve a queue slot, then persist the job without holding r.mu so a
+	// slow write doesn't stall other submissions or the dispatch of jobs
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return errors.New("job runner closed")
+	}
+	if r.queued >= r.opts.MaxQueued {
+		r.mu.Unlock()
+		return ErrQueueFull
+	}
+	r.queued++
+	r.mu.Unlock()
+
+	t.Job.Status = domain.JobStatusQueued
+	if t.Job.CreatedAt.IsZero() {
+		t.Job.CreatedAt = time.Now().UTC()
+	}
+	if err := r.repo.CreateJob(ctx, t.Job); err != nil {
+		r.mu.Lock()
+		r.queued--
+		r.mu.Unlock()
+		return fmt.Errorf("create job: %w", err)
+	}
+
+	// The job can start as soon as it is scheduled; holding tk.mu until the
+	// queued event is saved keeps that event ahead of the job's own
+	tk := &task{Task: t}
+	tk.mu.Lock()
+	r.mu.Lock()
+	if r.closed {
+		r.queued--
+		r.mu.Unlock()
+		tk.mu.Unlock()
+		r.finish(tk, nil, Fail("shutdown", "Server is shutting down"))
+		return errors.New("job runner closed")
+	}
+	projectID := t.Job.ProjectID
+	waiting := r.active[projectID]
+	if !waiting {
+		r.active[projectID] = true
+		r.ready = append(r.ready, projectID)
+		r.cond.Signal()
+	}
+	r.pending[projectID] = append(r.pending[projectID], tk)
+	r.mu.Unlock()
+
+	if waiting && t.Queued != nil {
+		r.emitLocked(tk, EventStage, t.Queued)
+	}
+	tk.mu.Unlock()
+	return nil
+}
+
+// Subscribe returns a channel that receives a value whenever the job emits an
+// event. Events themselves are read from the repository; the channel only
+// signals that there is something new. Call the returned func to unsubscribe.
+func (r *Runner) Subscribe(jobID uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	r.subsMu.Lock()
+	if r.subs[jobID] == nil {
+		r.subs[jobID] = make(map[chan struct{}]struct{})
+	}
+	r.subs[jobID][ch] = struct{}{}
+	r.subsMu.Unlock()
+
+	return ch, func() {
+		r.subsMu.Lock()
+		delete(r.subs[jobID], ch)
+		if len(r.subs[jobID]) == 0 {
+			delete(r.subs, jobID)
+		}
+		r.subsMu.Unlock()
+	}
+}
+
+// Close stops accepting jobs, cancels running ones, and waits for the workers.
+// Jobs still queued are failed.
+func (r *Runner) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *Runner) worker() {
+	defer r.wg.Done()
+
+	for {
+		r.mu.Lock()
+		for len(r.ready) == 0 && !r.closed {
+			r.cond.Wait()
+		}
+		if len(r.ready) == 0 {
+			r.mu.Unlock()
+			return
+		}
+		projectID := r.ready[0]
+		r.ready = r.ready[1:]
+		t := r.pending[projectID][0]
+		r.pending[projectID] = r.pending[projectID][1:]
+		r.queued--
+		r.mu.Unlock()
+
+		r.run(t)
+
+		r.mu.Lock()
+		if len(r.pending[projectID]) > 0 {
+			r.ready = append(r.ready, projectID)
+			r.cond.Signal()
+		} else {
+			delete(r.pending, projectID)
+			delete(r.active, projectID)
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *Runner) run(t *task) {
+	job := t.Job
+
+	if err := r.ctx.Err(); err != nil {
+		r.finish(t, nil, Fail("shutdown", "Server is shutting down"))
+		return
+	}
+
+	now := time.Now().UTC()
+	job.Status = domain.JobStatusRunning
+	job.StartedAt = &now
+	if err := r.repo.UpdateJob(context.Background(), job); err != nil {
+		log.Printf("Jobs: failed to mark job %s running: %v", job.ID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.opts.Timeout)
+	defer cancel()
+
+	result, err := r.call(ctx, t)
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = Fail("timeout", fmt.Sprintf("Job timed out after %s", r.opts.Timeout))
+		} else {
+			err = Fail("shutdown", "Server is shutting down")
+		}
+	}
+	r.finish(t, result, err)
+}
+
+// call runs the job function, converting a panic into a failure.
+func (r *Runner) call(ctx context.Context, t *task) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Jobs: job %s panicked: %v", t.Job.ID, p)
+			result, err = nil, Fail("internal_error", "Job failed unexpectedly")
+		}
+	}()
+	return t.Run(ctx, func(eventType string, data any) {
+		r.emit(t, eventType, data)
+	})
+}
+
+// finish records the job outcome and emits its terminal event.
+func (r *Runner) finish(t *task, result any, err error) {
+	job := t.Job
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+
+	eventType := EventComplete
+	payload := result
+	if err != nil {
+		var jobErr *Error
+		if !errors.As(err, &jobErr) {
+			jobErr = &Error{Code: "job_failed", Message: err.Error()}
+		}
+		eventType = EventFail
+		payload = jobErr
+		job.Status = domain.JobStatusFailed
+		job.Error = jobErr.Message
+	} else {
+		job.Status = domain.JobStatusSucceeded
+	}
+	job.Result, _ = json.Marshal(payload)
+
+	if err := r.repo.UpdateJob(context.Background(), job); err != nil {
+		log.Printf("Jobs: failed to save job %s: %v", job.ID, err)
+	}
+	r.emit(t, eventType, payload)
+}
+
+// emit persists an event and notifies subscribers.
+func (r *Runner) emit(t *task, eventType string, data any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r.emitLocked(t, eventType, data)
+}
+
+// emitLocked is emit for callers that hold t.mu.
+func (r *Runner) emitLocked(t *task, eventType string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Jobs: failed to marshal %s event for job %s: %v", eventType, t.Job.ID, err)
+		return
+	}
+
+	t.seq++
+	event := &domain.JobEvent{
+		JobID:     t.Job.ID,
+		Seq:       t.seq,
+		Type:      eventType,
+		Data:      payload,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := r.repo.CreateJobEvent(context.Background(), event); err != nil {
+		log.Printf("Jobs: failed to save %s event for job %s: %v", eventType, t.Job.ID, err)
+		return
+	}
+
+	r.subsMu.Lock()
+	for ch := range r.subs[t.Job.ID] {
+		select {
+		case ch <- struct{}{}:
+		default: // Subscriber already has a pending notification
+		}
+	}
+	r.subsMu.Unlock()
+}
+
+// IsTerminal reports whether an event type ends a job's event stream.
+func IsTerminal(eventType string) bool {
+	return eventType == EventComplete || eventType == EventFail
+}
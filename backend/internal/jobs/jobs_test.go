@@ -0,0 +1,321 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/dshills/specbuilder/backend/internal/repository/mock"
+	"github.com/google/uuid"
+)
+
+func newJob(projectID uuid.UUID) *domain.Job {
+	return &domain.Job{ID: uuid.New(), ProjectID: projectID, Kind: domain.JobKindCompile, Params: json.RawMessage(`{}`)}
+}
+
+// waitFinished blocks until the job's terminal event is stored.
+func waitFinished(t *testing.T, r *Runner, repo *mock.Repository, jobID uuid.UUID) []*domain.JobEvent {
+	t.Helper()
+	notify, unsubscribe := r.Subscribe(jobID)
+	defer unsubscribe()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		events, err := repo.ListJobEvents(context.Background(), jobID, 0)
+		if err != nil {
+			t.Fatalf("ListJobEvents: %v", err)
+		}
+		if n := len(events); n > 0 && IsTerminal(events[n-1].Type) {
+			return events
+		}
+		select {
+		case <-notify:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("job %s did not finish", jobID)
+		}
+	}
+}
+
+func TestRunnerCompletesJob(t *testing.T) {
+	repo := mock.New()
+	r := NewRunner(repo, Options{Workers: 2})
+	defer r.Close()
+
+	job := newJob(uuid.New())
+	err := r.Submit(context.Background(), Task{Job: job, Run: func(ctx context.Context, emit EmitFunc) (any, error) {
+		emit(EventStage, map[string]string{"stage": "compiling"})
+		return map[string]string{"stage": "complete"}, nil
+	}})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	events := waitFinished(t, r, repo, job.ID)
+	if len(events) != 2 || events[0].Type != EventStage || events[1].Type != EventComplete {
+		t.Fatalf("events = %+v, want stage then complete", events)
+	}
+	if events[0].Seq != 1 || events[1].Seq != 2 {
+		t.Errorf("seqs = %d, %d; want 1, 2", events[0].Seq, events[1].Seq)
+	}
+
+	got, err := repo.GetJob(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.Status != domain.JobStatusSucceeded || got.StartedAt == nil || got.FinishedAt == nil {
+		t.Errorf("job = %+v, want succeeded with start and finish times", got)
+	}
+	if string(got.Result) != `{"stage":"complete"}` {
+		t.Errorf("result = %s", got.Result)
+	}
+}
+
+func TestRunnerFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      Func
+		wantCode string
+	}{
+		{
+			name: "job error",
+			run: func(ctx context.Context, emit EmitFunc) (any, error) {
+				return nil, Fail("no_answers", "No answers to compile")
+			},
+			wantCode: "no_answers",
+		},
+		{
+			name:     "plain error",
+			run:      func(ctx context.Context, emit EmitFunc) (any, error) { return nil, errors.New("boom") },
+			wantCode: "job_failed",
+		},
+		{
+			name:     "panic",
+			run:      func(ctx context.Context, emit EmitFunc) (any, error) { panic("boom") },
+			wantCode: "internal_error",
+		},
+		{
+			name: "timeout",
+			run: func(ctx context.Context, emit EmitFunc) (any, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			wantCode: "timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mock.New()
+			r := NewRunner(repo, Options{Timeout: 50 * time.Millisecond})
+			defer r.Close()
+
+			job := newJob(uuid.New())
+			if err := r.Submit(context.Background(), Task{Job: job, Run: tt.run}); err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+
+			events := waitFinished(t, r, repo, job.ID)
+			last := events[len(events)-1]
+			if last.Type != EventFail {
+				t.Fatalf("terminal event = %s, want fail", last.Type)
+			}
+			var payload Error
+			if err := json.Unmarshal(last.Data, &payload); err != nil {
+				t.Fatalf("decode fail payload: %v", err)
+			}
+			if payload.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", payload.Code, tt.wantCode)
+			}
+
+			got, _ := repo.GetJob(context.Background(), job.ID)
+			if got.Status != domain.JobStatusFailed || got.Error == "" {
+				t.Errorf("job = %+v, want failed with error", got)
+			}
+		})
+	}
+}
+
+func TestRunnerSerializesProjectJobs(t *testing.T) {
+	repo := mock.New()
+	r := NewRunner(repo, Options{Workers: 4})
+	defer r.Close()
+
+	projectID := uuid.New()
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var order []int
+	running := 0
+	maxRunning := 0
+
+	var submitted []*domain.Job
+	for i := 0; i < 3; i++ {
+		job := newJob(projectID)
+		submitted = append(submitted, job)
+		err := r.Submit(context.Background(), Task{
+			Job:    job,
+			Queued: map[string]string{"stage": "preparing"},
+			Run: func(ctx context.Context, emit EmitFunc) (any, error) {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				order = append(order, i)
+				mu.Unlock()
+
+				<-release
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("Submit %d: %v", i, err)
+		}
+	}
+	close(release)
+
+	for _, job := range submitted {
+		waitFinished(t, r, repo, job.ID)
+	}
+
+	if maxRunning != 1 {
+		t.Errorf("max concurrent jobs for one project = %d, want 1", maxRunning)
+	}
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Errorf("run order = %v, want [0 1 2]", order)
+	}
+
+	// Jobs that had to wait get the queued event first
+	events, _ := repo.ListJobEvents(context.Background(), submitted[2].ID, 0)
+	if len(events) != 2 || events[0].Type != EventStage || events[1].Type != EventComplete {
+		t.Errorf("queued job events = %+v, want queued stage then complete", events)
+	}
+}
+
+func TestRunnerQueueFull(t *testing.T) {
+	repo := mock.New()
+	r := NewRunner(repo, Options{Workers: 1, MaxQueued: 1})
+	defer r.Close()
+
+	block := make(chan struct{})
+	defer close(block)
+	run := func(ctx context.Context, emit EmitFunc) (any, error) {
+		select {
+		case <-block:
+		case <-ctx.Done():
+		}
+		return nil, nil
+	}
+
+	projectID := uuid.New()
+	first := newJob(projectID)
+	if err := r.Submit(context.Background(), Task{Job: first, Run: run}); err != nil {
+		t.Fatalf("Submit first: %v", err)
+	}
+	// Wait for the first job to leave the queue
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := repo.GetJob(context.Background(), first.ID)
+		if got != nil && got.Status == domain.JobStatusRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first job never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := r.Submit(context.Background(), Task{Job: newJob(projectID), Run: run}); err != nil {
+		t.Fatalf("Submit second: %v", err)
+	}
+	if err := r.Submit(context.Background(), Task{Job: newJob(projectID), Run: run}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit third err = %v, want ErrQueueFull", err)
+	}
+}
+
+// slowCreateRepo holds CreateJob for one job until release is closed.
+type slowCreateRepo struct {
+	*mock.Repository
+	slowID  uuid.UUID
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (r *slowCreateRepo) CreateJob(ctx context.Context, job *domain.Job) error {
+	if job.ID == r.slowID {
+		close(r.entered)
+		<-r.release
+	}
+	return r.Repository.CreateJob(ctx, job)
+}
+
+func TestRunnerSubmitDuringSlowWrite(t *testing.T) {
+	slow := newJob(uuid.New())
+	repo := &slowCreateRepo{Repository: mock.New(), slowID: slow.ID, entered: make(chan struct{}), release: make(chan struct{})}
+	r := NewRunner(repo, Options{Workers: 2})
+	defer r.Close()
+
+	run := func(ctx context.Context, emit EmitFunc) (any, error) { return nil, nil }
+	slowErr := make(chan error, 1)
+	go func() { slowErr <- r.Submit(context.Background(), Task{Job: slow, Run: run}) }()
+	<-repo.entered
+
+	fast := newJob(uuid.New())
+	fastErr := make(chan error, 1)
+	go func() { fastErr <- r.Submit(context.Background(), Task{Job: fast, Run: run}) }()
+	select {
+	case err := <-fastErr:
+		if err != nil {
+			t.Fatalf("Submit fast: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit waited for another job's write")
+	}
+	waitFinished(t, r, repo.Repository, fast.ID)
+
+	close(repo.release)
+	if err := <-slowErr; err != nil {
+		t.Fatalf("Submit slow: %v", err)
+	}
+	waitFinished(t, r, repo.Repository, slow.ID)
+}
+
+func TestRunnerRecover(t *testing.T) {
+	repo := mock.New()
+	ctx := context.Background()
+
+	job := newJob(uuid.New())
+	job.Status = domain.JobStatusRunning
+	job.CreatedAt = time.Now().UTC()
+	if err := repo.CreateJob(ctx, job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	stage := &domain.JobEvent{JobID: job.ID, Seq: 1, Type: EventStage, Data: json.RawMessage(`{}`), CreatedAt: job.CreatedAt}
+	if err := repo.CreateJobEvent(ctx, stage); err != nil {
+		t.Fatalf("CreateJobEvent: %v", err)
+	}
+
+	r := NewRunner(repo, Options{})
+	defer r.Close()
+	if err := r.Recover(ctx); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+
+	got, _ := repo.GetJob(ctx, job.ID)
+	if got.Status != domain.JobStatusFailed {
+		t.Errorf("status = %s, want failed", got.Status)
+	}
+	events, _ := repo.ListJobEvents(ctx, job.ID, 1)
+	if len(events) != 1 || events[0].Type != EventFail || events[0].Seq != 2 {
+		t.Errorf("events after recover = %+v, want fail at seq 2", events)
+	}
+}
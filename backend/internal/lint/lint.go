@@ -0,0 +1,353 @@
+// Package lint checks the internal references of a compiled spec that JSON
+// Schema cannot express: IDs that must exist, be unique, or be acyclic.
+// Rules are deterministic and make no LLM calls.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+)
+
+// rule inspects a parsed spec and returns issue drafts for violations.
+type rule func(s *spec) []domain.IssueDraft
+
+// rules lists the rules run by Spec, in order.
+var rules = []rule{
+	uniqueIDs,
+	uniqueEntityNames,
+	taskMilestones,
+	taskDependencies,
+	requirementDependencies,
+	relationshipEntities,
+	uniqueEndpoints,
+}
+
+// spec holds the parts of a ProjectImplementationSpec the rules look at.
+type spec struct {
+	Requirements struct {
+		Functional []struct {
+			ID           string   `json:"id"`
+			Dependencies []string `json:"dependencies"`
+		} `json:"functional"`
+		NonFunctional []struct {
+			ID string `json:"id"`
+		} `json:"non_functional"`
+	} `json:"requirements"`
+	Workflows []struct {
+		ID string `json:"id"`
+	} `json:"workflows"`
+	DataModel struct {
+		Entities []struct {
+			Name string `json:"name"`
+		} `json:"entities"`
+		Relationships []struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"relationships"`
+	} `json:"data_model"`
+	API struct {
+		Endpoints []struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+			Path   string `json:"path"`
+		} `json:"endpoints"`
+	} `json:"api"`
+	UI struct {
+		Screens []struct {
+			ID string `json:"id"`
+		} `json:"screens"`
+	} `json:"ui"`
+	Acceptance struct {
+		TestCases []struct {
+			ID string `json:"id"`
+		} `json:"test_cases"`
+	} `json:"acceptance"`
+	Plan struct {
+		Milestones []struct {
+			ID string `json:"id"`
+		} `json:"milestones"`
+		Tasks []struct {
+			ID          string   `json:"id"`
+			MilestoneID string   `json:"milestone_id"`
+			DependsOn   []string `json:"depends_on"`
+		} `json:"tasks"`
+	} `json:"plan"`
+}
+
+// Spec runs every rule against a compiled spec. A spec that can't be parsed
+// yields no issues; schema validation reports those problems.
+func Spec(specJSON json.RawMessage) []domain.IssueDraft {
+	var s spec
+	if err := json.Unmarshal(specJSON, &s); err != nil {
+		return []domain.IssueDraft{}
+	}
+
+	drafts := make([]domain.IssueDraft, 0)
+	for _, r := range rules {
+		drafts = append(drafts, r(&s)...)
+	}
+	return drafts
+}
+
+func issue(issueType domain.IssueType, msg string, paths ...string) domain.IssueDraft {
+	return domain.IssueDraft{
+		Type:               issueType,
+		Severity:           domain.IssueSeverityError,
+		Message:            msg,
+		RelatedSpecPaths:   paths,
+		RelatedQuestionIDs: []string{},
+	}
+}
+
+// uniqueIDs requires every ID to be unique across requirements, workflows,
+// endpoints, screens, test cases, milestones, and tasks.
+func uniqueIDs(s *spec) []domain.IssueDraft {
+	seen := make(map[string][]string)
+	var order []string
+	add := func(id, path string) {
+		if id == "" {
+			return
+		}
+		if _, ok := seen[id]; !ok {
+			order = append(order, id)
+		}
+		seen[id] = append(seen[id], path)
+	}
+
+	for i, r := range s.Requirements.Functional {
+		add(r.ID, fmt.Sprintf("/requirements/functional/%d/id", i))
+	}
+	for i, r := range s.Requirements.NonFunctional {
+		add(r.ID, fmt.Sprintf("/requirements/non_functional/%d/id", i))
+	}
+	for i, w := range s.Workflows {
+		add(w.ID, fmt.Sprintf("/workflows/%d/id", i))
+	}
+	for i, e := range s.API.Endpoints {
+		add(e.ID, fmt.Sprintf("/api/endpoints/%d/id", i))
+	}
+	for i, sc := range s.UI.Screens {
+		add(sc.ID, fmt.Sprintf("/ui/screens/%d/id", i))
+	}
+	for i, tc := range s.Acceptance.TestCases {
+		add(tc.ID, fmt.Sprintf("/acceptance/test_cases/%d/id", i))
+	}
+	for i, m := range s.Plan.Milestones {
+		add(m.ID, fmt.Sprintf("/plan/milestones/%d/id", i))
+	}
+	for i, t := range s.Plan.Tasks {
+		add(t.ID, fmt.Sprintf("/plan/tasks/%d/id", i))
+	}
+
+	drafts := make([]domain.IssueDraft, 0)
+	for _, id := range order {
+		if paths := seen[id]; len(paths) > 1 {
+			drafts = append(drafts, issue(domain.IssueTypeConflict,
+				fmt.Sprintf("ID %q is used %d times", id, len(paths)), paths...))
+		}
+	}
+	return drafts
+}
+
+// uniqueEntityNames requires data model entity names to be unique.
+func uniqueEntityNames(s *spec) []domain.IssueDraft {
+	seen := make(map[string][]string)
+	var order []string
+	for i, e := range s.DataModel.Entities {
+		if e.Name == "" {
+			continue
+		}
+		if _, ok := seen[e.Name]; !ok {
+			order = append(order, e.Name)
+		}
+		seen[e.Name] = append(seen[e.Name], fmt.Sprintf("/data_model/entities/%d/name", i))
+	}
+
+	drafts := make([]domain.IssueDraft, 0)
+	for _, name := range order {
+		if paths := seen[name]; len(paths) > 1 {
+			drafts = append(drafts, issue(domain.IssueTypeConflict,
+				fmt.Sprintf("Entity %q is defined %d times", name, len(paths)), paths...))
+		}
+	}
+	return drafts
+}
+
+// taskMilestones requires every plan task to reference an existing milestone.
+func taskMilestones(s *spec) []domain.IssueDraft {
+	milestones := make(map[string]bool, len(s.Plan.Milestones))
+	for _, m := range s.Plan.Milestones {
+		milestones[m.ID] = true
+	}
+
+	drafts := make([]domain.IssueDraft, 0)
+	for i, t := range s.Plan.Tasks {
+		if !milestones[t.MilestoneID] {
+			drafts = append(drafts, issue(domain.IssueTypeMissing,
+				fmt.Sprintf("Task %s references unknown milestone %q", t.ID, t.MilestoneID),
+				fmt.Sprintf("/plan/tasks/%d/milestone_id", i)))
+		}
+	}
+	return drafts
+}
+
+// taskDependencies requires plan task depends_on entries to name existing
+// tasks and to form no cycles.
+func taskDependencies(s *spec) []domain.IssueDraft {
+	nodes := make([]node, len(s.Plan.Tasks))
+	for i, t := range s.Plan.Tasks {
+		nodes[i] = node{id: t.ID, deps: t.DependsOn, path: fmt.Sprintf("/plan/tasks/%d/depends_on", i)}
+	}
+	return checkGraph("Task", nodes)
+}
+
+// requirementDependencies requires functional requirement dependencies to name
+// existing requirements and to form no cycles.
+func requirementDependencies(s *spec) []domain.IssueDraft {
+	nodes := make([]node, 0, len(s.Requirements.Functional)+len(s.Requirements.NonFunctional))
+	for i, r := range s.Requirements.Functional {
+		nodes = append(nodes, node{id: r.ID, deps: r.Dependencies, path: fmt.Sprintf("/requirements/functional/%d/dependencies", i)})
+	}
+	// Non-functional requirements can be depended on but have no dependencies of their own
+	for _, r := range s.Requirements.NonFunctional {
+		nodes = append(nodes, node{id: r.ID})
+	}
+	return checkGraph("Requirement", nodes)
+}
+
+// relationshipEntities requires data model relationships to name existing entities.
+func relationshipEntities(s *spec) []domain.IssueDraft {
+	entities := make(map[string]bool, len(s.DataModel.Entities))
+	for _, e := range s.DataModel.Entities {
+		entities[e.Name] = true
+	}
+
+	drafts := make([]domain.IssueDraft, 0)
+	for i, r := range s.DataModel.Relationships {
+		if !entities[r.From] {
+			drafts = append(drafts, issue(domain.IssueTypeMissing,
+				fmt.Sprintf("Relationship references unknown entity %q", r.From),
+				fmt.Sprintf("/data_model/relationships/%d/from", i)))
+		}
+		if !entities[r.To] {
+			drafts = append(drafts, issue(domain.IssueTypeMissing,
+				fmt.Sprintf("Relationship references unknown entity %q", r.To),
+				fmt.Sprintf("/data_model/relationships/%d/to", i)))
+		}
+	}
+	return drafts
+}
+
+var pathParam = regexp.MustCompile(`\{[^}]*\}|:[^/]+`)
+
+// uniqueEndpoints requires each method+path pair to appear once. Paths that
+// differ only in parameter names ("/users/{id}" vs "/users/:userId") collide.
+func uniqueEndpoints(s *spec) []domain.IssueDraft {
+	seen := make(map[string][]string)
+	var order []string
+	for i, e := range s.API.Endpoints {
+		path := strings.TrimSuffix(pathParam.ReplaceAllString(strings.TrimSpace(e.Path), "{}"), "/")
+		key := strings.ToUpper(strings.TrimSpace(e.Method)) + " " + path
+		if _, ok := seen[key]; !ok {
+			order = append(order, key)
+		}
+		seen[key] = append(seen[key], fmt.Sprintf("/api/endpoints/%d", i))
+	}
+
+	drafts := make([]domain.IssueDraft, 0)
+	for _, key := range order {
+		if paths := seen[key]; len(paths) > 1 {
+			drafts = append(drafts, issue(domain.IssueTypeConflict,
+				fmt.Sprintf("Endpoint %s is defined %d times", key, len(paths)), paths...))
+		}
+	}
+	return drafts
+}
+
+// node is a vertex in a dependency graph; path locates its dependency list.
+type node struct {
+	id   string
+	deps []string
+	path string
+}
+
+// checkGraph reports dependencies on unknown IDs and every dependency cycle.
+func checkGraph(kind string, nodes []node) []domain.IssueDraft {
+	drafts := make([]domain.IssueDraft, 0)
+
+	byID := make(map[string]node, len(nodes))
+	for _, n := range nodes {
+		if _, ok := byID[n.id]; !ok {
+			byID[n.id] = n
+		}
+	}
+
+	for _, n := range nodes {
+		for j, dep := range n.deps {
+			if _, ok := byID[dep]; !ok {
+				drafts = append(drafts, issue(domain.IssueTypeMissing,
+					fmt.Sprintf("%s %s depends on unknown ID %q", kind, n.id, dep),
+					fmt.Sprintf("%s/%d", n.path, j)))
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(byID))
+	var stack []string
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		stack = append(stack, id)
+
+		deps := append([]string(nil), byID[id].deps...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if _, ok := byID[dep]; !ok {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				// Back edge: the cycle is the stack from dep to the current node
+				start := len(stack) - 1
+				for stack[start] != dep {
+					start--
+				}
+				cycle := append(append([]string(nil), stack[start:]...), dep)
+				paths := make([]string, 0, len(cycle)-1)
+				for _, cid := range cycle[:len(cycle)-1] {
+					paths = append(paths, byID[cid].path)
+				}
+				drafts = append(drafts, issue(domain.IssueTypeConflict,
+					fmt.Sprintf("%s dependency cycle: %s", kind, strings.Join(cycle, " -> ")), paths...))
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[id] = done
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return drafts
+}
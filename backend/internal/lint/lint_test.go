@@ -0,0 +1,125 @@
+package lint
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+)
+
+func TestSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		wantMsgs  []string
+		wantPaths [][]string
+	}{
+		{
+			name: "clean spec",
+			spec: `{
+				"requirements": {"functional": [{"id": "FR-1"}, {"id": "FR-2", "dependencies": ["FR-1", "NFR-1"]}], "non_functional": [{"id": "NFR-1"}]},
+				"data_model": {"entities": [{"name": "User"}, {"name": "Post"}], "relationships": [{"from": "User", "to": "Post"}]},
+				"api": {"endpoints": [{"id": "EP-1", "method": "GET", "path": "/posts"}, {"id": "EP-2", "method": "POST", "path": "/posts"}]},
+				"plan": {"milestones": [{"id": "M1"}], "tasks": [{"id": "T-1", "milestone_id": "M1"}, {"id": "T-2", "milestone_id": "M1", "depends_on": ["T-1"]}]}
+			}`,
+		},
+		{
+			name:      "unknown milestone",
+			spec:      `{"plan": {"milestones": [{"id": "M1"}], "tasks": [{"id": "T-1", "milestone_id": "M2"}]}}`,
+			wantMsgs:  []string{`Task T-1 references unknown milestone "M2"`},
+			wantPaths: [][]string{{"/plan/tasks/0/milestone_id"}},
+		},
+		{
+			name: "task dependency cycle and unknown dependency",
+			spec: `{"plan": {"milestones": [{"id": "M1"}], "tasks": [
+				{"id": "T-1", "milestone_id": "M1", "depends_on": ["T-3"]},
+				{"id": "T-2", "milestone_id": "M1", "depends_on": ["T-1", "T-9"]},
+				{"id": "T-3", "milestone_id": "M1", "depends_on": ["T-2"]}
+			]}}`,
+			wantMsgs: []string{
+				`Task T-2 depends on unknown ID "T-9"`,
+				"Task dependency cycle: T-1 -> T-3 -> T-2 -> T-1",
+			},
+			wantPaths: [][]string{
+				{"/plan/tasks/1/depends_on/1"},
+				{"/plan/tasks/0/depends_on", "/plan/tasks/2/depends_on", "/plan/tasks/1/depends_on"},
+			},
+		},
+		{
+			name:      "requirement self dependency",
+			spec:      `{"requirements": {"functional": [{"id": "FR-1", "dependencies": ["FR-1"]}]}}`,
+			wantMsgs:  []string{"Requirement dependency cycle: FR-1 -> FR-1"},
+			wantPaths: [][]string{{"/requirements/functional/0/dependencies"}},
+		},
+		{
+			name:      "relationship to unknown entity",
+			spec:      `{"data_model": {"entities": [{"name": "User"}], "relationships": [{"from": "User", "to": "Comment"}]}}`,
+			wantMsgs:  []string{`Relationship references unknown entity "Comment"`},
+			wantPaths: [][]string{{"/data_model/relationships/0/to"}},
+		},
+		{
+			name: "duplicate IDs and entity names",
+			spec: `{
+				"requirements": {"functional": [{"id": "X-1"}]},
+				"ui": {"screens": [{"id": "X-1"}]},
+				"data_model": {"entities": [{"name": "User"}, {"name": "User"}]}
+			}`,
+			wantMsgs:  []string{`ID "X-1" is used 2 times`, `Entity "User" is defined 2 times`},
+			wantPaths: [][]string{{"/requirements/functional/0/id", "/ui/screens/0/id"}, {"/data_model/entities/0/name", "/data_model/entities/1/name"}},
+		},
+		{
+			name: "duplicate endpoint with different parameter names",
+			spec: `{"api": {"endpoints": [
+				{"id": "EP-1", "method": "GET", "path": "/users/{id}"},
+				{"id": "EP-2", "method": "get", "path": "/users/:userId/"}
+			]}}`,
+			wantMsgs:  []string{"Endpoint GET /users/{} is defined 2 times"},
+			wantPaths: [][]string{{"/api/endpoints/0", "/api/endpoints/1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drafts := Spec(json.RawMessage(tt.spec))
+
+			if len(drafts) != len(tt.wantMsgs) {
+				t.Fatalf("Spec() returned %d issues, want %d: %+v", len(drafts), len(tt.wantMsgs), drafts)
+			}
+			for i, d := range drafts {
+				if d.Message != tt.wantMsgs[i] {
+					t.Errorf("issue[%d].Message = %q, want %q", i, d.Message, tt.wantMsgs[i])
+				}
+				if !reflect.DeepEqual(d.RelatedSpecPaths, tt.wantPaths[i]) {
+					t.Errorf("issue[%d].RelatedSpecPaths = %v, want %v", i, d.RelatedSpecPaths, tt.wantPaths[i])
+				}
+				if d.Severity != domain.IssueSeverityError {
+					t.Errorf("issue[%d].Severity = %s, want error", i, d.Severity)
+				}
+			}
+		})
+	}
+}
+
+func TestSpecIssueTypes(t *testing.T) {
+	drafts := Spec(json.RawMessage(`{"plan": {"milestones": [{"id": "M1"}, {"id": "M1"}], "tasks": [{"id": "T-1", "milestone_id": "M9"}]}}`))
+	for _, d := range drafts {
+		switch {
+		case strings.Contains(d.Message, "unknown"):
+			if d.Type != domain.IssueTypeMissing {
+				t.Errorf("%q: type = %s, want missing", d.Message, d.Type)
+			}
+		default:
+			if d.Type != domain.IssueTypeConflict {
+				t.Errorf("%q: type = %s, want conflict", d.Message, d.Type)
+			}
+		}
+	}
+}
+
+func TestSpecInvalidJSON(t *testing.T) {
+	if drafts := Spec(json.RawMessage(`{invalid`)); len(drafts) != 0 {
+		t.Errorf("Spec() on invalid JSON = %v, want no issues", drafts)
+	}
+}
@@ -18,9 +18,10 @@ const anthropicAPIVersion = "2023-06-01"
 
 // AnthropicClient implements Client for Anthropic Claude.
 type AnthropicClient struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey   string
+	model    string
+	endpoint string
+	client   *http.Client
 }
 
 // NewAnthropicClient creates a new Anthropic client.
@@ -29,9 +30,10 @@ func NewAnthropicClient(apiKey, model string) *AnthropicClient {
 		model = "claude-sonnet-4-20250514"
 	}
 	return &AnthropicClient{
-		apiKey: apiKey,
-		model:  model,
-		client: &http.Client{Timeout: 300 * time.Second},
+		apiKey:   apiKey,
+		model:    model,
+		endpoint: anthropicMessagesEndpoint,
+		client:   &http.Client{Timeout: 300 * time.Second},
 	}
 }
 
@@ -39,10 +41,39 @@ func (c *AnthropicClient) Provider() Provider { return ProviderAnthropic }
 func (c *AnthropicClient) Model() string      { return c.model }
 
 type anthropicRequest struct {
-	Model     string             `json:"model"`
-	MaxTokens int                `json:"max_tokens"`
-	System    string             `json:"system,omitempty"`
-	Messages  []anthropicMessage `json:"messages"`
+	Model     string               `json:"model"`
+	MaxTokens int                  `json:"max_tokens"`
+	System    []anthropicTextBlock `json:"system,omitempty"`
+	Messages  []anthropicMessage   `json:"messages"`
+	Stream    bool                 `json:"stream,omitempty"`
+	// A request with a schema forces a call to a single tool whose input
+	// schema is the response schema; the tool input is the response.
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"` // "tool"
+	Name string `json:"name"`
+}
+
+// anthropicTextBlock is a text content block. The system prompt is sent as
+// one with a cache breakpoint, so that the tools and system prompt are read
+// from Anthropic's prompt cache by later calls that share them.
+type anthropicTextBlock struct {
+	Type         string                 `json:"type"` // "text"
+	Text         string                 `json:"text"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"` // "ephemeral"
 }
 
 type anthropicMessage struct {
@@ -55,26 +86,60 @@ type anthropicResponse struct {
 	Type    string `json:"type"`
 	Role    string `json:"role"`
 	Content []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Input json.RawMessage `json:"input"` // tool_use blocks only
 	} `json:"content"`
-	Model        string `json:"model"`
-	StopReason   string `json:"stop_reason"`
-	StopSequence string `json:"stop_sequence"`
-	Usage        struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage"`
-	Error *struct {
+	Model        string         `json:"model"`
+	StopReason   string         `json:"stop_reason"`
+	StopSequence string         `json:"stop_sequence"`
+	Usage        anthropicUsage `json:"usage"`
+	Error        *struct {
 		Type    string `json:"type"`
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-// Complete sends a completion request to Anthropic.
-func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response, error) {
-	log.Printf("Anthropic: starting request to model %s", c.model)
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"` // Excludes cache reads and writes
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage converts Anthropic's usage, which counts cached prompt tokens
+// separately, to a Usage.
+func (u anthropicUsage) toUsage(stopReason string, latency time.Duration) Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens: u.OutputTokens,
+		CachedTokens: u.CacheReadInputTokens,
+		Latency:      latency,
+		StopReason:   stopReason,
+	}
+}
+
+// anthropicStreamEvent is one server-sent event of a streaming Messages call.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"` // message_start only
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"` // input_json_delta only: a piece of a tool input
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"` // message_delta only: output tokens so far
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
 
+// buildRequest converts a Request to the Messages API format.
+func (c *AnthropicClient) buildRequest(req Request) anthropicRequest {
 	// Build messages, extracting system message
 	var systemPrompt string
 	messages := make([]anthropicMessage, 0, len(req.Messages))
@@ -98,16 +163,35 @@ func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response,
 	anthropicReq := anthropicRequest{
 		Model:     c.model,
 		MaxTokens: maxTokens,
-		System:    systemPrompt,
 		Messages:  messages,
 	}
+	if systemPrompt != "" {
+		anthropicReq.System = []anthropicTextBlock{{
+			Type:         "text",
+			Text:         systemPrompt,
+			CacheControl: &anthropicCacheControl{Type: "ephemeral"},
+		}}
+	}
+	if req.Schema != nil {
+		name := req.Schema.name()
+		anthropicReq.Tools = []anthropicTool{{
+			Name:        name,
+			Description: "Return the response. The input is the JSON document the instructions ask for.",
+			InputSchema: req.Schema.JSON,
+		}}
+		anthropicReq.ToolChoice = &anthropicToolChoice{Type: "tool", Name: name}
+	}
+	return anthropicReq
+}
 
+// send posts a Messages API request.
+func (c *AnthropicClient) send(ctx context.Context, anthropicReq anthropicRequest) (*http.Response, error) {
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", anthropicMessagesEndpoint, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -122,6 +206,19 @@ func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response,
 		log.Printf("Anthropic: HTTP error: %v", err)
 		return nil, fmt.Errorf("send request: %w", err)
 	}
+	return resp, nil
+}
+
+// Complete sends a completion request to Anthropic.
+func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	log.Printf("Anthropic: starting request to model %s", c.model)
+	start := time.Now()
+
+	anthropicReq := c.buildRequest(req)
+	resp, err := c.send(ctx, anthropicReq)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	log.Printf("Anthropic: received response status %d", resp.StatusCode)
 
@@ -131,8 +228,8 @@ func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response,
 	}
 	log.Printf("Anthropic: response body size: %d bytes", len(respBody))
 
-	if resp.StatusCode == 429 {
-		return nil, ErrRateLimit
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(ProviderAnthropic, resp, respBody)
 	}
 
 	var anthropicResp anthropicResponse
@@ -141,7 +238,7 @@ func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response,
 	}
 
 	if anthropicResp.Error != nil {
-		return nil, fmt.Errorf("%w: %s", ErrProviderError, anthropicResp.Error.Message)
+		return nil, &APIError{Provider: ProviderAnthropic, StatusCode: resp.StatusCode, Type: anthropicResp.Error.Type, Message: anthropicResp.Error.Message}
 	}
 
 	log.Printf("Anthropic: stop_reason=%s, input_tokens=%d, output_tokens=%d",
@@ -154,14 +251,17 @@ func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response,
 	// Check if output was truncated due to max_tokens limit
 	if anthropicResp.StopReason == "max_tokens" {
 		return nil, fmt.Errorf("%w: response truncated (hit max_tokens limit of %d, used %d output tokens)",
-			ErrInvalidResponse, maxTokens, anthropicResp.Usage.OutputTokens)
+			ErrInvalidResponse, anthropicReq.MaxTokens, anthropicResp.Usage.OutputTokens)
 	}
 
-	// Extract text content
+	// Extract text content, or the tool input when a schema forced a tool call
 	var content string
 	for _, c := range anthropicResp.Content {
-		if c.Type == "text" {
+		switch c.Type {
+		case "text":
 			content += c.Text
+		case "tool_use":
+			content = string(c.Input)
 		}
 	}
 
@@ -169,8 +269,77 @@ func (c *AnthropicClient) Complete(ctx context.Context, req Request) (*Response,
 	content = stripMarkdownCodeBlock(content)
 
 	return &Response{
-		Content: content,
-		Model:   c.model,
+		Content:  content,
+		Provider: ProviderAnthropic,
+		Model:    c.model,
+		Usage:    anthropicResp.Usage.toUsage(anthropicResp.StopReason, time.Since(start)),
+	}, nil
+}
+
+// CompleteStream sends a streaming completion request to Anthropic.
+func (c *AnthropicClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	log.Printf("Anthropic: starting streaming request to model %s", c.model)
+	start := time.Now()
+
+	anthropicReq := c.buildRequest(req)
+	anthropicReq.Stream = true
+	resp, err := c.send(ctx, anthropicReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStreamStatus(ProviderAnthropic, resp); err != nil {
+		return nil, err
+	}
+
+	acc := streamAccumulator{onDelta: onDelta}
+	var stopReason string
+	var usage anthropicUsage
+	err = readSSE(resp.Body, func(_, data string) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("unmarshal stream event: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				acc.add(event.Delta.Text, 0)
+			case "input_json_delta":
+				acc.add(event.Delta.PartialJSON, 0)
+			}
+		case "message_delta":
+			stopReason = event.Delta.StopReason
+			usage.OutputTokens = event.Usage.OutputTokens
+			acc.add("", event.Usage.OutputTokens)
+		case "error":
+			if event.Error != nil {
+				return &APIError{Provider: ProviderAnthropic, Type: event.Error.Type, Message: event.Error.Message}
+			}
+			return &APIError{Provider: ProviderAnthropic, Message: "stream error"}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Anthropic: stream finished, stop_reason=%s, output_tokens=%d", stopReason, acc.tokens)
+
+	if stopReason == "max_tokens" {
+		return nil, fmt.Errorf("%w: response truncated (hit max_tokens limit of %d, used %d output tokens)",
+			ErrInvalidResponse, anthropicReq.MaxTokens, acc.tokens)
+	}
+	if acc.content.Len() == 0 {
+		return nil, fmt.Errorf("%w: no content in response", ErrInvalidResponse)
+	}
+
+	return &Response{
+		Content:  stripMarkdownCodeBlock(acc.content.String()),
+		Provider: ProviderAnthropic,
+		Model:    c.model,
+		Usage:    usage.toUsage(stopReason, time.Since(start)),
 	}, nil
 }
 
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen indicates calls to a provider are suspended after repeated failures.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreaker tracks provider health. After threshold consecutive
+// retryable failures a provider's circuit opens and calls fail fast with
+// ErrCircuitOpen. Once cooldown has passed a single trial call is let through;
+// its success closes the circuit and its failure reopens it.
+// It is safe for concurrent use.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	states map[Provider]*breakerState
+}
+
+type breakerState struct {
+	failures int
+	openedAt time.Time // Zero while closed
+	probing  bool      // A trial call is in flight
+}
+
+// NewCircuitBreaker creates a circuit breaker. A threshold of 0 disables it.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		states:    make(map[Provider]*breakerState),
+	}
+}
+
+func (b *CircuitBreaker) state(provider Provider) *breakerState {
+	s, ok := b.states[provider]
+	if !ok {
+		s = &breakerState{}
+		b.states[provider] = s
+	}
+	return s
+}
+
+// Allow returns an ErrCircuitOpen error if calls to provider are suspended.
+func (b *CircuitBreaker) Allow(provider Provider) error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(provider)
+	if s.openedAt.IsZero() {
+		return nil
+	}
+	if wait := s.openedAt.Add(b.cooldown).Sub(b.now()); wait > 0 || s.probing {
+		if wait < 0 {
+			wait = 0
+		}
+		return fmt.Errorf("%w: %s failed %d times in a row; retry in %s", ErrCircuitOpen, provider, s.failures, wait.Round(time.Second))
+	}
+	s.probing = true
+	return nil
+}
+
+// Record updates provider health with the outcome of a call. Only retryable
+// failures count against the provider; fatal errors such as a bad request
+// say nothing about its health.
+func (b *CircuitBreaker) Record(provider Provider, err error) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(provider)
+	wasProbing := s.probing
+	s.probing = false
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return // The caller gave up; the call says nothing either way
+	}
+	switch {
+	case err == nil || !IsRetryable(err):
+		if err == nil || wasProbing {
+			s.failures = 0
+			s.openedAt = time.Time{}
+		}
+	default:
+		s.failures++
+		if wasProbing || s.failures >= b.threshold {
+			s.openedAt = b.now()
+		}
+	}
+}
+
+// Open reports whether provider's circuit is currently open.
+func (b *CircuitBreaker) Open(provider Provider) bool {
+	if b == nil || b.threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.state(provider).openedAt.IsZero()
+}
@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheTTL is how long cached responses are kept unless configured
+// otherwise.
+const DefaultCacheTTL = 24 * time.Hour
+
+// CacheStore persists cached responses by key. Values are opaque JSON
+// documents; expired entries must not be returned.
+type CacheStore interface {
+	GetCachedResponse(ctx context.Context, key string, now time.Time) ([]byte, bool, error)
+	PutCachedResponse(ctx context.Context, key string, value []byte, expiresAt time.Time) error
+}
+
+type cacheBypassKey struct{}
+
+// WithoutCache returns a context whose LLM calls skip the response cache
+// lookup. Their responses still replace the cached ones.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+// CacheKey identifies a request to a model in the response cache: a SHA-256
+// hash of the provider, model, sampling parameters, response schema and
+// messages.
+func CacheKey(provider Provider, model string, req Request) string {
+	var schema json.RawMessage
+	if req.Schema != nil {
+		schema = req.Schema.JSON
+	}
+	data, _ := json.Marshal(struct {
+		Provider    Provider        `json:"provider"`
+		Model       string          `json:"model"`
+		Temperature float64         `json:"temperature"`
+		Seed        *int            `json:"seed"`
+		MaxTokens   int             `json:"max_tokens"`
+		Schema      json.RawMessage `json:"schema,omitempty"`
+		Messages    []Message       `json:"messages"`
+	}{provider, model, req.Temperature, req.Seed, req.MaxTokens, schema, req.Messages})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheable reports whether a request is deterministic enough to cache: run
+// at temperature 0 or with a fixed seed.
+func cacheable(req Request) bool {
+	return req.Temperature == 0 || req.Seed != nil
+}
+
+// CachingClient wraps a Client and serves repeated deterministic requests
+// from a CacheStore. Responses served from the cache have CacheHit set and no
+// token usage, since the provider isn't called.
+type CachingClient struct {
+	client Client
+	store  CacheStore
+	ttl    time.Duration
+}
+
+// NewCachingClient creates a client that caches client's responses in store
+// for ttl.
+func NewCachingClient(client Client, store CacheStore, ttl time.Duration) *CachingClient {
+	return &CachingClient{client: client, store: store, ttl: ttl}
+}
+
+func (c *CachingClient) Provider() Provider { return c.client.Provider() }
+func (c *CachingClient) Model() string      { return c.client.Model() }
+
+// Complete returns the cached response for req, or calls the wrapped client
+// and caches its response.
+func (c *CachingClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	return c.complete(ctx, req, c.client.Complete)
+}
+
+// CompleteStream behaves like Complete, streaming from the wrapped client, if
+// it can, on a cache miss. A cache hit returns without calling onDelta.
+func (c *CachingClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	streaming, ok := c.client.(StreamingClient)
+	if !ok {
+		return c.Complete(ctx, req)
+	}
+	return c.complete(ctx, req, func(ctx context.Context, req Request) (*Response, error) {
+		return streaming.CompleteStream(ctx, req, onDelta)
+	})
+}
+
+func (c *CachingClient) complete(ctx context.Context, req Request, call func(context.Context, Request) (*Response, error)) (*Response, error) {
+	if !cacheable(req) {
+		return call(ctx, req)
+	}
+	key := CacheKey(c.client.Provider(), c.client.Model(), req)
+
+	if !cacheBypassed(ctx) {
+		if resp := c.lookup(ctx, key); resp != nil {
+			return resp, nil
+		}
+	}
+
+	resp, err := call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.save(ctx, key, resp)
+	return resp, nil
+}
+
+// lookup returns the cached response for key, or nil. Store errors are
+// logged and treated as misses.
+func (c *CachingClient) lookup(ctx context.Context, key string) *Response {
+	start := time.Now()
+	data, ok, err := c.store.GetCachedResponse(ctx, key, start)
+	if err != nil {
+		log.Printf("Warning: LLM cache lookup failed: %v", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	var rec Recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Printf("Warning: ignoring corrupt LLM cache entry %s: %v", key, err)
+		return nil
+	}
+	return &Response{
+		Content:  rec.Content,
+		Provider: rec.Provider,
+		Model:    rec.Model,
+		Usage:    Usage{Latency: time.Since(start), StopReason: rec.StopReason},
+		CacheHit: true,
+	}
+}
+
+// save caches a response. A failed write is logged rather than failing the
+// call.
+func (c *CachingClient) save(ctx context.Context, key string, resp *Response) {
+	data, err := json.Marshal(Recording{
+		Content:      resp.Content,
+		Provider:     resp.Provider,
+		Model:        resp.Model,
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+		CachedTokens: resp.Usage.CachedTokens,
+		LatencyMs:    resp.Usage.Latency.Milliseconds(),
+		StopReason:   resp.Usage.StopReason,
+	})
+	if err == nil {
+		err = c.store.PutCachedResponse(context.WithoutCancel(ctx), key, data, time.Now().Add(c.ttl))
+	}
+	if err != nil {
+		log.Printf("Warning: failed to cache LLM response: %v", err)
+	}
+}
+
+// DirCache is a CacheStore that keeps each entry in its own file in a
+// directory.
+type DirCache struct {
+	dir string
+}
+
+// NewDirCache creates a cache store in dir, which is created on first write.
+func NewDirCache(dir string) *DirCache {
+	return &DirCache{dir: dir}
+}
+
+type dirCacheEntry struct {
+	ExpiresAt time.Time       `json:"expires_at"`
+	Value     json.RawMessage `json:"value"`
+}
+
+func (d *DirCache) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
+
+// GetCachedResponse returns the entry for key unless it is missing or has
+// expired. Expired entries are removed.
+func (d *DirCache) GetCachedResponse(ctx context.Context, key string, now time.Time) ([]byte, bool, error) {
+	data, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read cache entry: %w", err)
+	}
+	var entry dirCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("parse cache entry %s: %w", key, err)
+	}
+	if !now.Before(entry.ExpiresAt) {
+		_ = os.Remove(d.path(key))
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// PutCachedResponse writes the entry for key, replacing it atomically.
+func (d *DirCache) PutCachedResponse(ctx context.Context, key string, value []byte, expiresAt time.Time) error {
+	data, err := json.Marshal(dirCacheEntry{ExpiresAt: expiresAt.UTC(), Value: value})
+	if err != nil {
+		return fmt.Errorf("marshal cache entry: %w", err)
+	}
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(d.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Ensure CachingClient implements StreamingClient and DirCache implements
+// CacheStore
+var (
+	_ StreamingClient = (*CachingClient)(nil)
+	_ CacheStore      = (*DirCache)(nil)
+)
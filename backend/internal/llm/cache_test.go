@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	seed := 7
+	base := Request{Messages: []Message{{Role: "user", Content: "compile"}}}
+	key := CacheKey(ProviderAnthropic, "claude-test", base)
+
+	for name, k := range map[string]string{
+		"provider":    CacheKey(ProviderOpenAI, "claude-test", base),
+		"model":       CacheKey(ProviderAnthropic, "claude-other", base),
+		"temperature": CacheKey(ProviderAnthropic, "claude-test", Request{Messages: base.Messages, Temperature: 0.2}),
+		"seed":        CacheKey(ProviderAnthropic, "claude-test", Request{Messages: base.Messages, Seed: &seed}),
+		"messages":    CacheKey(ProviderAnthropic, "claude-test", Request{Messages: []Message{{Role: "user", Content: "validate"}}}),
+	} {
+		if k == key {
+			t.Errorf("key ignores the %s", name)
+		}
+	}
+	if same := base; CacheKey(ProviderAnthropic, "claude-test", same) != key {
+		t.Error("key is not stable")
+	}
+}
+
+func TestCachingClient(t *testing.T) {
+	ctx := context.Background()
+	mock := &MockClient{
+		Responses: []string{`{"spec": 1}`, `{"spec": 2}`, `{"spec": 3}`},
+		Usage:     Usage{InputTokens: 100, OutputTokens: 40, StopReason: "end_turn"},
+	}
+	client := NewCachingClient(mock, NewDirCache(t.TempDir()), time.Hour)
+	req := Request{Messages: []Message{{Role: "user", Content: "compile"}}}
+
+	first, err := client.Complete(ctx, req)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	var deltas int
+	second, err := client.CompleteStream(ctx, req, func(StreamDelta) { deltas++ })
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+	if mock.CallCount != 1 || first.CacheHit || !second.CacheHit || deltas != 0 {
+		t.Fatalf("calls = %d, hits = %v/%v, deltas = %d; want the second call served from the cache",
+			mock.CallCount, first.CacheHit, second.CacheHit, deltas)
+	}
+	if second.Content != first.Content || second.Provider != "mock" || second.Usage.InputTokens != 0 || second.Usage.OutputTokens != 0 {
+		t.Errorf("cached response = %+v, want the first content with no token usage", second)
+	}
+
+	// Bypassing the lookup calls the model and refreshes the cache
+	fresh, err := client.Complete(WithoutCache(ctx), req)
+	if err != nil || fresh.CacheHit || fresh.Content != `{"spec": 2}` {
+		t.Fatalf("bypassed Complete() = %+v, %v; want a fresh response", fresh, err)
+	}
+	if cached, _ := client.Complete(ctx, req); cached.Content != `{"spec": 2}` || !cached.CacheHit {
+		t.Errorf("after bypass, cached content = %q, want the refreshed response", cached.Content)
+	}
+
+	// Sampled requests aren't cached
+	sampled := Request{Messages: req.Messages, Temperature: 0.3}
+	client.Complete(ctx, sampled)
+	if resp, _ := client.Complete(ctx, sampled); resp.CacheHit || mock.CallCount != 4 {
+		t.Errorf("sampled request served from the cache (calls = %d)", mock.CallCount)
+	}
+}
+
+func TestDirCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	cache := NewDirCache(t.TempDir())
+	now := time.Now()
+	if err := cache.PutCachedResponse(ctx, "key", []byte(`{"content":"{}"}`), now.Add(time.Minute)); err != nil {
+		t.Fatalf("PutCachedResponse() error = %v", err)
+	}
+
+	if value, ok, err := cache.GetCachedResponse(ctx, "key", now); err != nil || !ok || string(value) != `{"content":"{}"}` {
+		t.Errorf("GetCachedResponse() = %s, %v, %v; want the entry", value, ok, err)
+	}
+	if _, ok, err := cache.GetCachedResponse(ctx, "key", now.Add(time.Hour)); err != nil || ok {
+		t.Errorf("expired entry: ok = %v, err = %v; want a miss", ok, err)
+	}
+	if _, ok, _ := cache.GetCachedResponse(ctx, "missing", now); ok {
+		t.Error("missing entry reported as cached")
+	}
+}
@@ -0,0 +1,306 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrCassetteMiss is returned by ReplayClient for a request it has no
+// recording of.
+var ErrCassetteMiss = errors.New("no cassette recording for request")
+
+// Cassette modes, as set by SPECBUILDER_LLM_CASSETTE_MODE
+const (
+	CassetteRecord = "record" // Call the provider and save each response to the cassette
+	CassetteReplay = "replay" // Serve responses from the cassette without calling a provider
+)
+
+// ProviderReplay is reported by ReplayClient. The responses it serves carry
+// the provider and model they were recorded from.
+const ProviderReplay Provider = "replay"
+
+// Cassette is a set of recorded LLM calls stored as a JSON file. Calls are
+// keyed by CassetteKey, so a recording replays for any model as long as the
+// role, prompt version and rendered messages are the same. It is safe for
+// concurrent use.
+type Cassette struct {
+	path string
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	recorded     map[string]bool // Keys recorded since the cassette was loaded
+	replayed     map[string]int  // Responses served per key, so repeated requests replay in order
+}
+
+// Interaction is one recorded call.
+type Interaction struct {
+	Key           string        `json:"key"`
+	Role          string        `json:"role,omitempty"`
+	PromptVersion PromptVersion `json:"prompt_version,omitempty"`
+	Messages      []Message     `json:"messages"` // Kept for reviewing cassettes; not used for matching
+	Response      Recording     `json:"response"`
+	RecordedAt    time.Time     `json:"recorded_at"`
+}
+
+// Recording is a recorded response.
+type Recording struct {
+	Content      string   `json:"content"`
+	Provider     Provider `json:"provider"`
+	Model        string   `json:"model"`
+	InputTokens  int      `json:"input_tokens"`
+	OutputTokens int      `json:"output_tokens"`
+	CachedTokens int      `json:"cached_tokens,omitempty"`
+	LatencyMs    int64    `json:"latency_ms"`
+	StopReason   string   `json:"stop_reason,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// CassetteKey identifies a request in a cassette: a SHA-256 hash of its role,
+// prompt version and messages.
+func CassetteKey(req Request) string {
+	data, _ := json.Marshal(struct {
+		Role          string        `json:"role"`
+		PromptVersion PromptVersion `json:"prompt_version"`
+		Messages      []Message     `json:"messages"`
+	}{req.Role, req.PromptVersion, req.Messages})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadCassette reads the cassette at path. A missing file is an empty
+// cassette, which Save creates.
+func LoadCassette(path string) (*Cassette, error) {
+	c := newCassette(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	c.interactions = file.Interactions
+	return c, nil
+}
+
+// newCassette returns an empty cassette that saves to path.
+func newCassette(path string) *Cassette {
+	return &Cassette{path: path, recorded: make(map[string]bool), replayed: make(map[string]int)}
+}
+
+// Len returns the number of recorded calls.
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.interactions)
+}
+
+// Save writes the cassette to its file, replacing it atomically.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("create cassette directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	return nil
+}
+
+// record adds a response to the cassette. The first recording of a key since
+// the cassette was loaded replaces any older ones, so re-recording refreshes a
+// cassette; later ones are appended and replay in order.
+func (c *Cassette) record(req Request, resp *Response) {
+	key := CassetteKey(req)
+	interaction := &Interaction{
+		Key:           key,
+		Role:          req.Role,
+		PromptVersion: req.PromptVersion,
+		Messages:      req.Messages,
+		Response: Recording{
+			Content:      resp.Content,
+			Provider:     resp.Provider,
+			Model:        resp.Model,
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+			CachedTokens: resp.Usage.CachedTokens,
+			LatencyMs:    resp.Usage.Latency.Milliseconds(),
+			StopReason:   resp.Usage.StopReason,
+		},
+		RecordedAt: time.Now().UTC(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.recorded[key] {
+		c.recorded[key] = true
+		kept := c.interactions[:0]
+		for _, in := range c.interactions {
+			if in.Key != key {
+				kept = append(kept, in)
+			}
+		}
+		c.interactions = kept
+	}
+	c.interactions = append(c.interactions, interaction)
+}
+
+// replay returns the next recorded response for req. Once a key's recordings
+// are used up, the last one repeats.
+func (c *Cassette) replay(req Request) (*Recording, bool) {
+	key := CassetteKey(req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var matches []*Interaction
+	for _, in := range c.interactions {
+		if in.Key == key {
+			matches = append(matches, in)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, false
+	}
+	n := c.replayed[key]
+	c.replayed[key] = n + 1
+	return &matches[min(n, len(matches)-1)].Response, true
+}
+
+// RecordingClient wraps a Client and saves each successful call to a
+// cassette.
+type RecordingClient struct {
+	client   Client
+	cassette *Cassette
+}
+
+// NewRecordingClient creates a client that records client's responses to
+// cassette.
+func NewRecordingClient(client Client, cassette *Cassette) *RecordingClient {
+	return &RecordingClient{client: client, cassette: cassette}
+}
+
+func (c *RecordingClient) Provider() Provider { return c.client.Provider() }
+func (c *RecordingClient) Model() string      { return c.client.Model() }
+
+// Complete calls the wrapped client and records the response.
+func (c *RecordingClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := c.client.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.save(req, resp)
+	return resp, nil
+}
+
+// CompleteStream streams from the wrapped client, if it can, and records the
+// response.
+func (c *RecordingClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	streaming, ok := c.client.(StreamingClient)
+	if !ok {
+		return c.Complete(ctx, req)
+	}
+	resp, err := streaming.CompleteStream(ctx, req, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	c.save(req, resp)
+	return resp, nil
+}
+
+// save records a response and writes the cassette, so recordings survive a
+// crash. A failed write is logged rather than failing the call.
+func (c *RecordingClient) save(req Request, resp *Response) {
+	c.cassette.record(req, resp)
+	if err := c.cassette.Save(); err != nil {
+		log.Printf("Warning: failed to save LLM cassette: %v", err)
+	}
+}
+
+// ReplayClient serves responses from a cassette without calling a provider.
+// A request with no recording fails with ErrCassetteMiss.
+type ReplayClient struct {
+	cassette *Cassette
+}
+
+// NewReplayClient creates a client that replays cassette.
+func NewReplayClient(cassette *Cassette) *ReplayClient {
+	return &ReplayClient{cassette: cassette}
+}
+
+func (c *ReplayClient) Provider() Provider { return ProviderReplay }
+func (c *ReplayClient) Model() string      { return "cassette" }
+
+// Complete returns the recorded response for req.
+func (c *ReplayClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	rec, ok := c.cassette.replay(req)
+	if !ok {
+		excerpt := ""
+		if n := len(req.Messages); n > 0 {
+			excerpt = req.Messages[n-1].Content
+			excerpt = excerpt[:min(120, len(excerpt))]
+		}
+		log.Printf("LLM cassette miss: role=%s prompt_version=%s key=%s", req.Role, req.PromptVersion, CassetteKey(req))
+		return nil, fmt.Errorf("%w: role %q, prompt version %q, key %s (last message begins %q); re-record the cassette",
+			ErrCassetteMiss, req.Role, req.PromptVersion, CassetteKey(req), excerpt)
+	}
+	return &Response{
+		Content:  rec.Content,
+		Provider: rec.Provider,
+		Model:    rec.Model,
+		Usage: Usage{
+			InputTokens:  rec.InputTokens,
+			OutputTokens: rec.OutputTokens,
+			CachedTokens: rec.CachedTokens,
+			Latency:      time.Duration(rec.LatencyMs) * time.Millisecond,
+			StopReason:   rec.StopReason,
+		},
+	}, nil
+}
+
+// CompleteStream returns the recorded response for req, delivering it to
+// onDelta in chunks first.
+func (c *ReplayClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	resp, err := c.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	acc := streamAccumulator{onDelta: onDelta}
+	for rest := resp.Content; rest != ""; {
+		n := min(mockStreamChunkSize, len(rest))
+		acc.add(rest[:n], 0)
+		rest = rest[n:]
+	}
+	acc.add("", resp.Usage.OutputTokens)
+	return resp, nil
+}
+
+// Ensure the cassette clients implement StreamingClient
+var (
+	_ StreamingClient = (*RecordingClient)(nil)
+	_ StreamingClient = (*ReplayClient)(nil)
+)
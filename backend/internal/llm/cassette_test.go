@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func cassetteRequest(role, content string) Request {
+	return Request{
+		Messages:      []Message{{Role: "user", Content: content}},
+		Role:          role,
+		PromptVersion: PromptVersionV1,
+	}
+}
+
+func TestCassetteKey(t *testing.T) {
+	base := cassetteRequest("planner", "plan this")
+	same := base
+	same.Temperature, same.MaxTokens = 0.7, 100
+
+	if CassetteKey(base) != CassetteKey(same) {
+		t.Error("key depends on sampling parameters")
+	}
+	for name, req := range map[string]Request{
+		"role":           cassetteRequest("asker", "plan this"),
+		"prompt version": {Messages: base.Messages, Role: "planner", PromptVersion: "v2"},
+		"messages":       cassetteRequest("planner", "plan that"),
+	} {
+		if CassetteKey(req) == CassetteKey(base) {
+			t.Errorf("key ignores the %s", name)
+		}
+	}
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassettes", "flow.json")
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette() error = %v", err)
+	}
+	mock := &MockClient{
+		Responses: []string{`{"rationale": "first"}`, `{"rationale": "second"}`, `{"questions": []}`},
+		ModelName: "claude-test",
+		Usage:     Usage{InputTokens: 10, OutputTokens: 4, Latency: 1500 * time.Millisecond, StopReason: "end_turn"},
+	}
+	recorder := NewRecordingClient(mock, cassette)
+	for _, req := range []Request{cassetteRequest("planner", "plan"), cassetteRequest("planner", "plan"), cassetteRequest("asker", "ask")} {
+		if _, err := recorder.Complete(ctx, req); err != nil {
+			t.Fatalf("Complete() error = %v", err)
+		}
+	}
+
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette() error = %v", err)
+	}
+	if loaded.Len() != 3 {
+		t.Fatalf("loaded %d recordings, want 3", loaded.Len())
+	}
+
+	replay := NewReplayClient(loaded)
+	for i, want := range []string{`{"rationale": "first"}`, `{"rationale": "second"}`, `{"rationale": "second"}`} {
+		resp, err := replay.Complete(ctx, cassetteRequest("planner", "plan"))
+		if err != nil {
+			t.Fatalf("replay %d: error = %v", i, err)
+		}
+		if resp.Content != want {
+			t.Errorf("replay %d = %q, want %q", i, resp.Content, want)
+		}
+		if resp.Provider != "mock" || resp.Model != "claude-test" || resp.Usage != mock.Usage {
+			t.Errorf("replay %d from %s/%s with %+v, want the recorded call", i, resp.Provider, resp.Model, resp.Usage)
+		}
+	}
+
+	var deltas int
+	resp, err := replay.CompleteStream(ctx, cassetteRequest("asker", "ask"), func(StreamDelta) { deltas++ })
+	if err != nil || resp.Content != `{"questions": []}` || deltas == 0 {
+		t.Errorf("CompleteStream() = %v, %v after %d deltas, want the recorded questions", resp, err, deltas)
+	}
+
+	_, err = replay.Complete(ctx, cassetteRequest("compiler", "compile"))
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("unrecorded request: err = %v, want ErrCassetteMiss", err)
+	}
+	if IsRetryable(err) {
+		t.Error("a cassette miss is retryable")
+	}
+
+	// Re-recording replaces a key's old recordings
+	rerecord, _ := LoadCassette(path)
+	mock.Responses, mock.CallCount = []string{`{"rationale": "new"}`}, 0
+	if _, err := NewRecordingClient(mock, rerecord).Complete(ctx, cassetteRequest("planner", "plan")); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if rerecord.Len() != 2 {
+		t.Errorf("re-recorded cassette has %d recordings, want 2", rerecord.Len())
+	}
+}
+
+func TestFactoryReplaysCassette(t *testing.T) {
+	for _, name := range []string{"GEMINI_API_KEY", "OPENAI_API_KEY", "ANTHROPIC_API_KEY", "SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL", "SPECBUILDER_LLM_PROVIDER", "SPECBUILDER_LLM_MODEL"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("OLLAMA_HOST", "http://127.0.0.1:1") // Nothing listens here
+	t.Setenv("SPECBUILDER_LLM_CASSETTE", filepath.Join(t.TempDir(), "missing.json"))
+	t.Setenv("SPECBUILDER_LLM_CASSETTE_MODE", "")
+
+	f := NewFactory()
+	if !f.Available() || f.DefaultProvider() != ProviderReplay {
+		t.Fatalf("factory available=%v default=%s, want replay without API keys", f.Available(), f.DefaultProvider())
+	}
+	client, err := f.CreateClient(ProviderAnthropic, "claude-test")
+	if err != nil {
+		t.Fatalf("CreateClient() error = %v", err)
+	}
+	if _, err := client.Complete(context.Background(), cassetteRequest("planner", "plan")); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("err = %v, want ErrCassetteMiss", err)
+	}
+}
@@ -2,7 +2,13 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Provider represents an LLM provider.
@@ -13,6 +19,10 @@ const (
 	ProviderAnthropic Provider = "anthropic"
 	ProviderGoogle    Provider = "google"
 	ProviderOllama    Provider = "ollama"
+
+	// ProviderOpenAICompatible is a self-hosted or third-party server that
+	// implements the OpenAI chat completions API.
+	ProviderOpenAICompatible Provider = "openai_compatible"
 )
 
 // Config holds LLM configuration.
@@ -30,6 +40,11 @@ type Request struct {
 	Temperature float64
 	Seed        *int
 	MaxTokens   int
+	Schema      *Schema // Optional: expected shape of the JSON response
+
+	// Optional: where the messages came from, for matching recorded calls
+	Role          string        // Pipeline role making the call, e.g. "planner"
+	PromptVersion PromptVersion // Version of the prompt the messages were rendered from
 }
 
 // Message represents a chat message.
@@ -40,8 +55,20 @@ type Message struct {
 
 // Response represents a chat completion response.
 type Response struct {
-	Content string
-	Model   string
+	Content  string
+	Provider Provider // Provider that served the call
+	Model    string   // Model that served the call
+	Usage    Usage
+	CacheHit bool // Served from the response cache without calling the provider
+}
+
+// Usage reports the resources consumed by a completion call.
+type Usage struct {
+	InputTokens  int           // Prompt tokens, including cached ones
+	OutputTokens int           // Generated tokens, including any reasoning tokens
+	CachedTokens int           // Prompt tokens read from the provider's prompt cache
+	Latency      time.Duration // From sending the request to the end of the response
+	StopReason   string        // Why the model stopped, as reported by the provider (e.g. "end_turn", "stop")
 }
 
 // Client is the interface for LLM providers.
@@ -51,6 +78,24 @@ type Client interface {
 	Model() string
 }
 
+// StreamDelta is an incremental piece of a streamed completion.
+type StreamDelta struct {
+	Text         string // Content generated since the previous delta
+	OutputTokens int    // Output tokens generated so far (provider-reported when available, else estimated)
+}
+
+// StreamFunc receives deltas as a streamed completion arrives.
+type StreamFunc func(StreamDelta)
+
+// StreamingClient is implemented by clients that can stream output as it is
+// generated. Callers should type-assert a Client and fall back to Complete.
+type StreamingClient interface {
+	Client
+	// CompleteStream behaves like Complete, but calls onDelta with each chunk of
+	// output as it arrives. The returned Response holds the full content.
+	CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error)
+}
+
 var (
 	// ErrInvalidResponse indicates the LLM returned an invalid response.
 	ErrInvalidResponse = errors.New("invalid LLM response")
@@ -61,3 +106,88 @@ var (
 	// ErrProviderError indicates a provider-specific error.
 	ErrProviderError = errors.New("provider error")
 )
+
+// APIError is an error reported by a provider API, either as a non-200
+// response or as an error event inside a stream.
+type APIError struct {
+	Provider   Provider
+	StatusCode int           // HTTP status; 0 for errors reported inside a stream
+	Type       string        // Provider error type, if reported (e.g. "overloaded_error")
+	Message    string        // Provider error message, or the start of the response body
+	RetryAfter time.Duration // From the Retry-After header, if set
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s error: %s", e.Provider, msg)
+	}
+	return fmt.Sprintf("%s error: status %d: %s", e.Provider, e.StatusCode, msg)
+}
+
+// Is makes an APIError match ErrProviderError, and ErrRateLimit for rate limits.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrProviderError:
+		return true
+	case ErrRateLimit:
+		return e.StatusCode == http.StatusTooManyRequests || e.Type == "rate_limit_error" || e.Type == "RESOURCE_EXHAUSTED"
+	}
+	return false
+}
+
+// newAPIError builds an APIError from a non-200 response and its body,
+// extracting the message from the provider's error envelope when present.
+func newAPIError(provider Provider, resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	// Anthropic, OpenAI and Gemini use {"error": {...}}; Ollama uses {"error": "..."}
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && len(envelope.Error) > 0 {
+		var detail struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(envelope.Error, &detail) == nil {
+			e.Type = detail.Type
+			if e.Type == "" {
+				e.Type = detail.Status
+			}
+			e.Message = detail.Message
+		} else {
+			_ = json.Unmarshal(envelope.Error, &e.Message)
+		}
+	}
+	if e.Message == "" {
+		e.Message = strings.TrimSpace(string(body[:min(500, len(body))]))
+	}
+	return e
+}
+
+// parseRetryAfter parses a Retry-After header: delay seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
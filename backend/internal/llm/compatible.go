@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// CompatibleConfig configures a server that implements the OpenAI chat
+// completions API, such as vLLM, LM Studio, llama.cpp's server, LocalAI or an
+// API gateway.
+type CompatibleConfig struct {
+	Name         string   // Display name in the model list (default "OpenAI-Compatible")
+	BaseURL      string   // API root that /chat/completions and /models are appended to, e.g. http://localhost:8000/v1; a query string (e.g. ?api-version=...) is kept
+	APIKey       string   // Optional
+	APIKeyHeader string   // Header that carries APIKey as is; empty sends "Authorization: Bearer <key>"
+	Models       []string // Offered when the server doesn't list its models
+}
+
+// compatibleConfigFromEnv reads the OpenAI-compatible server configuration,
+// returning nil if no base URL is set.
+func compatibleConfigFromEnv() *CompatibleConfig {
+	baseURL := strings.TrimSpace(os.Getenv("SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL"))
+	if baseURL == "" {
+		return nil
+	}
+	cfg := &CompatibleConfig{
+		Name:         os.Getenv("SPECBUILDER_OPENAI_COMPATIBLE_NAME"),
+		BaseURL:      baseURL,
+		APIKey:       os.Getenv("SPECBUILDER_OPENAI_COMPATIBLE_API_KEY"),
+		APIKeyHeader: os.Getenv("SPECBUILDER_OPENAI_COMPATIBLE_API_KEY_HEADER"),
+	}
+	for _, m := range strings.Split(os.Getenv("SPECBUILDER_OPENAI_COMPATIBLE_MODELS"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			cfg.Models = append(cfg.Models, m)
+		}
+	}
+	return cfg
+}
+
+// displayName returns the provider name shown in the model list.
+func (c CompatibleConfig) displayName() string {
+	if c.Name == "" {
+		return "OpenAI-Compatible"
+	}
+	return c.Name
+}
+
+// endpoint returns the URL of an API path under the base URL.
+func (c CompatibleConfig) endpoint(path string) string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return strings.TrimSuffix(c.BaseURL, "/") + path
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	return u.String()
+}
+
+// setAuth adds the API key, if any, to a request.
+func (c CompatibleConfig) setAuth(h http.Header) {
+	switch {
+	case c.APIKey == "":
+	case c.APIKeyHeader != "":
+		h.Set(c.APIKeyHeader, c.APIKey)
+	default:
+		h.Set("Authorization", "Bearer "+c.APIKey)
+	}
+}
+
+// NewOpenAICompatibleClient creates a client for an OpenAI-compatible server.
+func NewOpenAICompatibleClient(cfg CompatibleConfig, model string) *OpenAIClient {
+	return &OpenAIClient{
+		provider: ProviderOpenAICompatible,
+		model:    model,
+		endpoint: cfg.endpoint("/chat/completions"),
+		setAuth:  cfg.setAuth,
+		client:   &http.Client{Timeout: 600 * time.Second}, // Self-hosted models can be slow
+	}
+}
+
+// FetchCompatibleModels fetches the models an OpenAI-compatible server lists
+// at /models. Unlike FetchOpenAIModels it keeps every model, since local
+// servers name them freely.
+func FetchCompatibleModels(cfg CompatibleConfig) ([]ModelInfo, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	req, err := http.NewRequest("GET", cfg.endpoint("/models"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	cfg.setAuth(req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetch models failed: status %d: %s", resp.StatusCode, string(body[:min(200, len(body))]))
+	}
+
+	var modelsResp OpenAIModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(modelsResp.Data))
+	for _, m := range modelsResp.Data {
+		models = append(models, ModelInfo{
+			ID:       m.ID,
+			Name:     m.ID,
+			Provider: ProviderOpenAICompatible,
+		})
+	}
+	return models, nil
+}
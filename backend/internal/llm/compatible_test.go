@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// compatibleServer stands in for an OpenAI-compatible server behind a gateway
+// that expects an api-key header and an api-version query parameter.
+func compatibleServer(t *testing.T, models string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("api-key"); got != "secret" {
+			t.Errorf("api-key header = %q, want secret", got)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected Authorization header")
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-10-21" {
+			t.Errorf("api-version = %q, want it kept from the base URL", got)
+		}
+
+		switch r.URL.Path {
+		case "/openai/v1/models":
+			if models == "" {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, models)
+		case "/openai/v1/chat/completions":
+			var req map[string]any
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["max_tokens"] != float64(100) || req["max_completion_tokens"] != nil {
+				t.Errorf("request = %v, want max_tokens", req)
+			}
+			io.WriteString(w, `{"model":"qwen2.5:7b","choices":[{"message":{"content":"{}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAICompatibleClient(t *testing.T) {
+	srv := compatibleServer(t, "")
+	cfg := CompatibleConfig{BaseURL: srv.URL + "/openai/v1/?api-version=2024-10-21", APIKey: "secret", APIKeyHeader: "api-key"}
+
+	client := NewOpenAICompatibleClient(cfg, "qwen2.5:7b")
+	resp, err := client.Complete(context.Background(), Request{
+		Messages:  []Message{{Role: "user", Content: "hi"}},
+		MaxTokens: 100,
+	})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Provider != ProviderOpenAICompatible || resp.Model != "qwen2.5:7b" {
+		t.Errorf("response from %s/%s, want openai_compatible/qwen2.5:7b", resp.Provider, resp.Model)
+	}
+}
+
+func TestFactoryOpenAICompatible(t *testing.T) {
+	for _, name := range []string{"GEMINI_API_KEY", "OPENAI_API_KEY", "ANTHROPIC_API_KEY", "SPECBUILDER_LLM_PROVIDER", "SPECBUILDER_LLM_MODEL"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("OLLAMA_HOST", "http://127.0.0.1:1") // Nothing listens here
+	t.Setenv("SPECBUILDER_OPENAI_COMPATIBLE_API_KEY", "secret")
+	t.Setenv("SPECBUILDER_OPENAI_COMPATIBLE_API_KEY_HEADER", "api-key")
+	t.Setenv("SPECBUILDER_OPENAI_COMPATIBLE_NAME", "vLLM")
+
+	compatibleModels := func(f *Factory) []ModelInfo {
+		for _, p := range f.ListProviders() {
+			if p.ID == ProviderOpenAICompatible {
+				if !p.Available || p.Name != "vLLM" {
+					t.Errorf("provider = %+v, want available vLLM", p)
+				}
+				return p.Models
+			}
+		}
+		t.Fatal("openai_compatible provider not listed")
+		return nil
+	}
+
+	t.Run("discovered models", func(t *testing.T) {
+		srv := compatibleServer(t, `{"object":"list","data":[{"id":"qwen2.5:7b","object":"model"},{"id":"llama-3.1-8b","object":"model"}]}`)
+		t.Setenv("SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL", srv.URL+"/openai/v1?api-version=2024-10-21")
+
+		f := NewFactory()
+		if models := compatibleModels(f); len(models) != 2 || models[0].ID != "qwen2.5:7b" {
+			t.Errorf("models = %+v, want the discovered ones", models)
+		}
+		if f.DefaultProvider() != ProviderOpenAICompatible || f.DefaultModel() != "qwen2.5:7b" {
+			t.Errorf("default = %s/%s, want openai_compatible/qwen2.5:7b", f.DefaultProvider(), f.DefaultModel())
+		}
+
+		client, err := f.CreateClient(ProviderOpenAICompatible, "qwen2.5:7b")
+		if err != nil {
+			t.Fatalf("CreateClient() error = %v", err)
+		}
+		if _, err := client.Complete(context.Background(), Request{MaxTokens: 100}); err != nil {
+			t.Errorf("Complete() error = %v", err)
+		}
+	})
+
+	t.Run("configured models", func(t *testing.T) {
+		srv := compatibleServer(t, "")
+		t.Setenv("SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL", srv.URL+"/openai/v1?api-version=2024-10-21")
+		t.Setenv("SPECBUILDER_OPENAI_COMPATIBLE_MODELS", "mistral-7b, phi-3")
+
+		if models := compatibleModels(NewFactory()); len(models) != 2 || models[1].ID != "phi-3" {
+			t.Errorf("models = %+v, want the configured ones", models)
+		}
+	})
+}
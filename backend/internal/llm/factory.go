@@ -1,9 +1,14 @@
 package llm
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // ModelInfo describes an available model.
@@ -29,6 +34,9 @@ type ClientFactory interface {
 	ListProviders() []ProviderInfo
 	CreateClient(provider Provider, model string) (Client, error)
 	CreateDefaultClient() (Client, error)
+	Prices() PriceTable
+	TokenEstimator(provider Provider, model string) TokenEstimator
+	PullOllamaModel(ctx context.Context, model string, onProgress func(OllamaPullProgress)) error
 }
 
 // Factory creates LLM clients on demand.
@@ -37,29 +45,75 @@ type Factory struct {
 	openAIKey       string
 	anthropicKey    string
 	ollamaAvailable bool
+	ollama          OllamaConfig
+	compatible      *CompatibleConfig // nil unless an OpenAI-compatible server is configured
 	defaultMod      string
 	defaultPrv      Provider
+	providersMu     sync.RWMutex // Guards providers, whose Ollama models change when one is pulled
 	providers       []ProviderInfo
+	retry           RetryPolicy
+	breaker         *CircuitBreaker // Shared by all clients, so health is tracked per provider
+	fallback        []fallbackEntry // Tried in order when the default client fails
+	prices          PriceTable
+	contextWindows  ContextWindowTable
+	cassette        *Cassette  // Set when recording or replaying LLM calls
+	cassetteMode    string     // CassetteRecord or CassetteReplay
+	cache           CacheStore // nil unless response caching is enabled
+	cacheTTL        time.Duration
+	geminiCache     *GeminiContextCache // Shared by all Gemini clients; nil if disabled
 }
 
 // NewFactory creates a new LLM client factory.
 // It fetches available models from each configured provider's API.
 // Environment variables:
-//   - SPECBUILDER_LLM_PROVIDER: Override default provider (anthropic, google, openai, ollama)
+//   - SPECBUILDER_LLM_PROVIDER: Override default provider (anthropic, google, openai, ollama, openai_compatible)
 //   - SPECBUILDER_LLM_MODEL: Override default model
 //   - OLLAMA_HOST: Ollama server URL (default: http://localhost:11434)
+//   - SPECBUILDER_OLLAMA_KEEP_ALIVE: How long Ollama keeps a model loaded after a call, as a
+//     duration (e.g. 30m) or seconds (-1 keeps it loaded; default: Ollama's own, 5m)
+//   - SPECBUILDER_OLLAMA_NUM_CTX: Context window Ollama loads models with, in tokens
+//     (default: Ollama's own, 4096); also the context window prompts are fitted to
+//   - SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL: API root of an OpenAI-compatible server
+//     (e.g. http://localhost:8000/v1), which enables the openai_compatible provider
+//   - SPECBUILDER_OPENAI_COMPATIBLE_API_KEY: Its API key, if it needs one
+//   - SPECBUILDER_OPENAI_COMPATIBLE_API_KEY_HEADER: Header for the key instead of a bearer token (e.g. api-key)
+//   - SPECBUILDER_OPENAI_COMPATIBLE_MODELS: Comma-separated models to offer if the server doesn't list them
+//   - SPECBUILDER_OPENAI_COMPATIBLE_NAME: Display name of the server (default: OpenAI-Compatible)
+//   - SPECBUILDER_LLM_MAX_ATTEMPTS: Attempts per LLM call, including retries (default: 3)
+//   - SPECBUILDER_LLM_BREAKER_THRESHOLD: Consecutive failures that suspend a provider (default: 5, 0 disables)
+//   - SPECBUILDER_LLM_BREAKER_COOLDOWN: How long a provider stays suspended (default: 30s)
+//   - SPECBUILDER_LLM_FALLBACK: Failover chain for the default client, as comma-separated
+//     provider:model pairs (e.g. anthropic:claude-sonnet-4-20250514,google:gemini-2.5-flash)
+//   - SPECBUILDER_LLM_PRICES: Price overrides in USD per million tokens, as a JSON object
+//     (or the path of a JSON file) like {"gpt-4o": {"input": 2.5, "output": 10, "cached_input": 1.25}}
+//   - SPECBUILDER_LLM_CONTEXT_WINDOWS: Context window overrides in tokens, as a JSON object
+//     (or the path of a JSON file) like {"llama3.2": 8192}
+//   - SPECBUILDER_GEMINI_CACHE_TTL: Lifetime of the cached contexts Gemini system instructions
+//     are sent as (default: 1h, 0 disables)
+//   - SPECBUILDER_LLM_CASSETTE: Path of a cassette file of recorded LLM calls
+//   - SPECBUILDER_LLM_CASSETTE_MODE: "replay" (default) serves every call from the cassette
+//     without contacting a provider; "record" makes real calls and saves them to it
 func NewFactory() *Factory {
 	f := &Factory{
-		geminiKey:       os.Getenv("GEMINI_API_KEY"),
-		openAIKey:       os.Getenv("OPENAI_API_KEY"),
-		anthropicKey:    os.Getenv("ANTHROPIC_API_KEY"),
-		ollamaAvailable: CheckOllamaAvailable(),
+		geminiKey:    os.Getenv("GEMINI_API_KEY"),
+		openAIKey:    os.Getenv("OPENAI_API_KEY"),
+		anthropicKey: os.Getenv("ANTHROPIC_API_KEY"),
+		ollama:       ollamaConfigFromEnv(),
+		compatible:   compatibleConfigFromEnv(),
+		retry:        DefaultRetryPolicy,
 	}
+	f.ollamaAvailable = CheckOllamaAvailable(f.ollama)
+
+	f.retry.MaxAttempts = envInt("SPECBUILDER_LLM_MAX_ATTEMPTS", f.retry.MaxAttempts)
+	f.breaker = NewCircuitBreaker(
+		envInt("SPECBUILDER_LLM_BREAKER_THRESHOLD", 5),
+		envDuration("SPECBUILDER_LLM_BREAKER_COOLDOWN", 30*time.Second),
+	)
 
 	// Fetch models from each provider
 	f.providers = f.fetchAllProviders()
 
-	// Set defaults based on available providers (prefer Anthropic > Google > OpenAI > Ollama)
+	// Set defaults based on available providers (prefer Anthropic > Google > OpenAI > OpenAI-compatible > Ollama)
 	// Ollama is last because cloud providers typically have better models for spec generation
 	if f.anthropicKey != "" {
 		f.defaultPrv = ProviderAnthropic
@@ -70,6 +124,9 @@ func NewFactory() *Factory {
 	} else if f.openAIKey != "" {
 		f.defaultPrv = ProviderOpenAI
 		f.defaultMod = f.getFirstModel(ProviderOpenAI, "gpt-4o")
+	} else if f.compatible != nil {
+		f.defaultPrv = ProviderOpenAICompatible
+		f.defaultMod = f.getFirstModel(ProviderOpenAICompatible, "")
 	} else if f.ollamaAvailable {
 		f.defaultPrv = ProviderOllama
 		f.defaultMod = f.getFirstModel(ProviderOllama, "llama3.2")
@@ -91,9 +148,126 @@ func NewFactory() *Factory {
 		f.defaultMod = envModel
 	}
 
+	if envFallback := os.Getenv("SPECBUILDER_LLM_FALLBACK"); envFallback != "" {
+		f.fallback = f.fallbackChain(envFallback)
+	}
+
+	prices, err := loadPriceTable(os.Getenv("SPECBUILDER_LLM_PRICES"))
+	if err != nil {
+		log.Printf("Warning: ignoring SPECBUILDER_LLM_PRICES: %v", err)
+		prices, _ = loadPriceTable("")
+	}
+	f.prices = prices
+
+	windows, err := loadContextWindows(os.Getenv("SPECBUILDER_LLM_CONTEXT_WINDOWS"))
+	if err != nil {
+		log.Printf("Warning: ignoring SPECBUILDER_LLM_CONTEXT_WINDOWS: %v", err)
+		windows, _ = loadContextWindows("")
+	}
+	f.contextWindows = windows
+
+	if ttl := envDuration("SPECBUILDER_GEMINI_CACHE_TTL", DefaultGeminiCacheTTL); ttl > 0 {
+		f.geminiCache = NewGeminiContextCache(ttl)
+	}
+
+	if path := os.Getenv("SPECBUILDER_LLM_CASSETTE"); path != "" {
+		f.useCassette(path, os.Getenv("SPECBUILDER_LLM_CASSETTE_MODE"))
+	}
+
 	return f
 }
 
+// useCassette sets up recording or replaying of LLM calls. A replay cassette
+// that can't be loaded is replaced by an empty one, so calls fail instead of
+// reaching a provider.
+func (f *Factory) useCassette(path, mode string) {
+	if mode == "" {
+		mode = CassetteReplay
+	}
+	if mode != CassetteRecord && mode != CassetteReplay {
+		log.Printf("Warning: ignoring SPECBUILDER_LLM_CASSETTE_MODE=%q (want %s or %s)", mode, CassetteRecord, CassetteReplay)
+		return
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		if mode == CassetteRecord {
+			log.Printf("Warning: not recording LLM calls: %v", err)
+			return
+		}
+		log.Printf("Warning: %v; every LLM call will fail", err)
+		cassette = newCassette(path)
+	}
+	f.cassette, f.cassetteMode = cassette, mode
+	log.Printf("LLM cassette: %s %s (%d recorded calls)", mode, path, cassette.Len())
+
+	if mode == CassetteReplay {
+		f.providers = append(f.providers, ProviderInfo{
+			ID:        ProviderReplay,
+			Name:      "Recorded (cassette)",
+			Available: true,
+			Models:    []ModelInfo{{ID: "cassette", Name: "Cassette", Provider: ProviderReplay}},
+		})
+		if f.defaultPrv == "" {
+			f.defaultPrv, f.defaultMod = ProviderReplay, "cassette"
+		}
+	}
+}
+
+// SetResponseCache makes the clients created from now on serve repeated
+// deterministic requests from store, keeping responses for ttl. A nil store
+// disables caching.
+func (f *Factory) SetResponseCache(store CacheStore, ttl time.Duration) {
+	f.cache, f.cacheTTL = store, ttl
+}
+
+// fallbackChain parses SPECBUILDER_LLM_FALLBACK, dropping entries whose
+// provider isn't available.
+func (f *Factory) fallbackChain(value string) []fallbackEntry {
+	chain, err := parseFallbackChain(value)
+	if err != nil {
+		log.Printf("Warning: ignoring SPECBUILDER_LLM_FALLBACK: %v", err)
+		return nil
+	}
+	available := make([]fallbackEntry, 0, len(chain))
+	for _, entry := range chain {
+		if !f.isProviderAvailable(entry.provider) {
+			log.Printf("Warning: SPECBUILDER_LLM_FALLBACK entry %s:%s is not available (missing API key), skipping", entry.provider, entry.model)
+			continue
+		}
+		available = append(available, entry)
+	}
+	return available
+}
+
+// envInt reads a non-negative integer environment variable, or returns def.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("Warning: invalid %s=%q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// envDuration reads a duration environment variable (e.g. "30s"), or returns def.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("Warning: invalid %s=%q, using %s", name, v, def)
+		return def
+	}
+	return d
+}
+
 // isProviderAvailable checks if a provider is configured and available.
 func (f *Factory) isProviderAvailable(provider Provider) bool {
 	switch provider {
@@ -105,6 +279,10 @@ func (f *Factory) isProviderAvailable(provider Provider) bool {
 		return f.openAIKey != ""
 	case ProviderOllama:
 		return f.ollamaAvailable
+	case ProviderOpenAICompatible:
+		return f.compatible != nil
+	case ProviderReplay:
+		return f.cassetteMode == CassetteReplay
 	default:
 		return false
 	}
@@ -112,7 +290,7 @@ func (f *Factory) isProviderAvailable(provider Provider) bool {
 
 // fetchAllProviders fetches models from all configured providers.
 func (f *Factory) fetchAllProviders() []ProviderInfo {
-	providers := make([]ProviderInfo, 0, 4)
+	providers := make([]ProviderInfo, 0, 5)
 
 	// Anthropic
 	anthropicInfo := ProviderInfo{
@@ -193,7 +371,7 @@ func (f *Factory) fetchAllProviders() []ProviderInfo {
 		Models:    []ModelInfo{},
 	}
 	if f.ollamaAvailable {
-		models, err := FetchOllamaModels("")
+		models, err := FetchOllamaModels(f.ollama)
 		if err != nil {
 			log.Printf("Warning: failed to fetch Ollama models: %v", err)
 			// Fall back to common models
@@ -209,6 +387,29 @@ func (f *Factory) fetchAllProviders() []ProviderInfo {
 	}
 	providers = append(providers, ollamaInfo)
 
+	// OpenAI-compatible server (vLLM, LM Studio, llama.cpp, LocalAI, gateways)
+	compatibleInfo := ProviderInfo{
+		ID:        ProviderOpenAICompatible,
+		Name:      "OpenAI-Compatible",
+		Available: f.compatible != nil,
+		Models:    []ModelInfo{},
+	}
+	if f.compatible != nil {
+		compatibleInfo.Name = f.compatible.displayName()
+		models, err := FetchCompatibleModels(*f.compatible)
+		if err != nil || len(models) == 0 {
+			if err != nil {
+				log.Printf("Warning: failed to fetch models from %s: %v", f.compatible.BaseURL, err)
+			}
+			// Fall back to the configured models
+			for _, m := range f.compatible.Models {
+				models = append(models, ModelInfo{ID: m, Name: m, Provider: ProviderOpenAICompatible})
+			}
+		}
+		compatibleInfo.Models = models
+	}
+	providers = append(providers, compatibleInfo)
+
 	return providers
 }
 
@@ -224,7 +425,8 @@ func (f *Factory) getFirstModel(provider Provider, fallback string) string {
 
 // Available returns true if at least one provider is configured.
 func (f *Factory) Available() bool {
-	return f.geminiKey != "" || f.openAIKey != "" || f.anthropicKey != "" || f.ollamaAvailable
+	return f.geminiKey != "" || f.openAIKey != "" || f.anthropicKey != "" || f.ollamaAvailable || f.compatible != nil ||
+		f.cassetteMode == CassetteReplay
 }
 
 // DefaultProvider returns the default provider.
@@ -239,11 +441,78 @@ func (f *Factory) DefaultModel() string {
 
 // ListProviders returns all providers with their availability status.
 func (f *Factory) ListProviders() []ProviderInfo {
+	f.providersMu.RLock()
+	defer f.providersMu.RUnlock()
 	return f.providers
 }
 
+// PullOllamaModel downloads a model to the Ollama server, reporting progress
+// to onProgress, and then refreshes the list of Ollama models.
+func (f *Factory) PullOllamaModel(ctx context.Context, model string, onProgress func(OllamaPullProgress)) error {
+	if !f.ollamaAvailable {
+		return fmt.Errorf("Ollama server not available (check OLLAMA_HOST or start Ollama)")
+	}
+	if err := PullOllamaModel(ctx, f.ollama, model, onProgress); err != nil {
+		return err
+	}
+
+	models, err := FetchOllamaModels(f.ollama)
+	if err != nil {
+		log.Printf("Warning: failed to refresh Ollama models: %v", err)
+		return nil
+	}
+	f.providersMu.Lock()
+	defer f.providersMu.Unlock()
+	providers := slices.Clone(f.providers)
+	for i, p := range providers {
+		if p.ID == ProviderOllama {
+			providers[i].Models = models
+		}
+	}
+	f.providers = providers
+	return nil
+}
+
+// Prices returns the price table used to estimate the cost of LLM calls.
+func (f *Factory) Prices() PriceTable {
+	return f.prices
+}
+
+// TokenEstimator returns the token estimator and context window of a
+// provider's model.
+func (f *Factory) TokenEstimator(provider Provider, model string) TokenEstimator {
+	est := f.contextWindows.Estimator(provider, model)
+	if provider == ProviderOllama && f.ollama.NumCtx > 0 {
+		est.ContextWindow = f.ollama.NumCtx // Ollama truncates prompts to num_ctx whatever the model supports
+	}
+	return est
+}
+
 // CreateClient creates a client for the specified provider and model.
+// Its calls are retried per the factory's retry policy and circuit breaker.
+// With a response cache set, repeated deterministic requests are served from
+// it. When replaying a cassette, every client replays it whatever the provider
+// and model; when recording, every client's calls are saved to it.
 func (f *Factory) CreateClient(provider Provider, model string) (Client, error) {
+	if f.cassetteMode == CassetteReplay {
+		return NewReplayClient(f.cassette), nil
+	}
+	client, err := f.createClient(provider, model)
+	if err != nil {
+		return nil, err
+	}
+	client = NewRetryClient(client, f.retry, f.breaker)
+	if f.cache != nil {
+		client = NewCachingClient(client, f.cache, f.cacheTTL)
+	}
+	if f.cassetteMode == CassetteRecord {
+		client = NewRecordingClient(client, f.cassette)
+	}
+	return client, nil
+}
+
+// createClient creates an undecorated provider client.
+func (f *Factory) createClient(provider Provider, model string) (Client, error) {
 	switch provider {
 	case ProviderAnthropic:
 		if f.anthropicKey == "" {
@@ -255,7 +524,11 @@ func (f *Factory) CreateClient(provider Provider, model string) (Client, error)
 		if f.geminiKey == "" {
 			return nil, fmt.Errorf("GEMINI_API_KEY not configured")
 		}
-		return NewGeminiClient(f.geminiKey, model), nil
+		client := NewGeminiClient(f.geminiKey, model)
+		if f.geminiCache != nil {
+			client.SetContextCache(f.geminiCache)
+		}
+		return client, nil
 
 	case ProviderOpenAI:
 		if f.openAIKey == "" {
@@ -267,7 +540,13 @@ func (f *Factory) CreateClient(provider Provider, model string) (Client, error)
 		if !f.ollamaAvailable {
 			return nil, fmt.Errorf("Ollama server not available (check OLLAMA_HOST or start Ollama)")
 		}
-		return NewOllamaClient(model), nil
+		return NewOllamaClient(f.ollama, model), nil
+
+	case ProviderOpenAICompatible:
+		if f.compatible == nil {
+			return nil, fmt.Errorf("SPECBUILDER_OPENAI_COMPATIBLE_BASE_URL not configured")
+		}
+		return NewOpenAICompatibleClient(*f.compatible, model), nil
 
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", provider)
@@ -275,11 +554,32 @@ func (f *Factory) CreateClient(provider Provider, model string) (Client, error)
 }
 
 // CreateDefaultClient creates a client with the default provider and model.
+// If a fallback chain is configured, the client fails over along it, starting
+// with the default model.
 func (f *Factory) CreateDefaultClient() (Client, error) {
 	if !f.Available() {
 		return nil, fmt.Errorf("no LLM API keys configured")
 	}
-	return f.CreateClient(f.defaultPrv, f.defaultMod)
+	client, err := f.CreateClient(f.defaultPrv, f.defaultMod)
+	if err != nil || len(f.fallback) == 0 || f.cassetteMode == CassetteReplay {
+		return client, err
+	}
+
+	chain := []Client{client}
+	for _, entry := range f.fallback {
+		if entry.provider == f.defaultPrv && entry.model == f.defaultMod {
+			continue
+		}
+		next, err := f.CreateClient(entry.provider, entry.model)
+		if err != nil {
+			return nil, fmt.Errorf("create fallback client %s:%s: %w", entry.provider, entry.model, err)
+		}
+		chain = append(chain, next)
+	}
+	if len(chain) == 1 {
+		return client, nil
+	}
+	return NewFallbackClient(chain...), nil
 }
 
 // Ensure Factory implements ClientFactory
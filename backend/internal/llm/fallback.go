@@ -0,0 +1,130 @@
+package llm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// FallbackClient tries a chain of clients in order, failing over to the next
+// one when a call fails with a provider error, a rate limit, an open circuit
+// or a transport failure. Provider and Model describe the first client; the
+// Response names the one that actually served the call. It implements
+// StreamingClient whether or not the chained clients do.
+type FallbackClient struct {
+	clients []Client
+}
+
+// NewFallbackClient creates a client that tries clients in the given order.
+// It panics if clients is empty.
+func NewFallbackClient(clients ...Client) *FallbackClient {
+	if len(clients) == 0 {
+		panic("llm: NewFallbackClient needs at least one client")
+	}
+	return &FallbackClient{clients: clients}
+}
+
+func (c *FallbackClient) Provider() Provider { return c.clients[0].Provider() }
+func (c *FallbackClient) Model() string      { return c.clients[0].Model() }
+
+// Clients returns the chain, in the order it is tried.
+func (c *FallbackClient) Clients() []Client { return c.clients }
+
+// Complete sends a completion request to each client in turn until one succeeds.
+func (c *FallbackClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	return c.do(ctx, func(client Client) (*Response, error) {
+		return client.Complete(ctx, req)
+	})
+}
+
+// CompleteStream streams a completion from each client in turn until one
+// succeeds. A stream that fails over starts over, so onDelta sees the next
+// client's output from the beginning; the context's retry observer is called
+// first.
+func (c *FallbackClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	return c.do(ctx, func(client Client) (*Response, error) {
+		if streaming, ok := client.(StreamingClient); ok {
+			return streaming.CompleteStream(ctx, req, onDelta)
+		}
+		return client.Complete(ctx, req)
+	})
+}
+
+func (c *FallbackClient) do(ctx context.Context, call func(Client) (*Response, error)) (*Response, error) {
+	var errs []error
+	for i, client := range c.clients {
+		resp, err := call(client)
+		if err == nil {
+			resp.Provider = cmp.Or(resp.Provider, client.Provider())
+			resp.Model = cmp.Or(resp.Model, client.Model())
+			return resp, nil
+		}
+		errs = append(errs, fmt.Errorf("%s/%s: %w", client.Provider(), client.Model(), err))
+		if !CanFailover(err) || i == len(c.clients)-1 {
+			break
+		}
+
+		next := c.clients[i+1]
+		log.Printf("LLM: %s/%s failed: %v; falling back to %s/%s",
+			client.Provider(), client.Model(), err, next.Provider(), next.Model())
+		observeRetry(ctx, RetryEvent{
+			Provider:    client.Provider(),
+			Model:       client.Model(),
+			Attempt:     i + 1,
+			MaxAttempts: len(c.clients),
+			Err:         err,
+			Fallback:    fmt.Sprintf("%s/%s", next.Provider(), next.Model()),
+		})
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, errors.Join(errs...)
+}
+
+// CanFailover reports whether a failed call may succeed on another provider:
+// provider errors (including rate limits and bad credentials), an open circuit
+// and transport failures. Cancellation and invalid responses are not.
+func CanFailover(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	return errors.Is(err, ErrProviderError) ||
+		errors.Is(err, ErrRateLimit) ||
+		errors.Is(err, ErrCircuitOpen) ||
+		IsRetryable(err)
+}
+
+// fallbackEntry is one provider/model pair of a fallback chain.
+type fallbackEntry struct {
+	provider Provider
+	model    string
+}
+
+// parseFallbackChain parses a comma-separated list of provider:model pairs,
+// e.g. "anthropic:claude-sonnet-4-20250514,google:gemini-2.5-flash".
+func parseFallbackChain(value string) ([]fallbackEntry, error) {
+	var chain []fallbackEntry
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		provider, model, ok := strings.Cut(item, ":")
+		provider, model = strings.TrimSpace(provider), strings.TrimSpace(model)
+		if !ok || provider == "" || model == "" {
+			return nil, fmt.Errorf("invalid fallback entry %q: want provider:model", item)
+		}
+		chain = append(chain, fallbackEntry{provider: Provider(provider), model: model})
+	}
+	return chain, nil
+}
+
+// Ensure FallbackClient implements StreamingClient
+var _ StreamingClient = (*FallbackClient)(nil)
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestFallbackClientFailsOver(t *testing.T) {
+	primary := NewMockClient("")
+	primary.Error = &APIError{Provider: "mock", StatusCode: http.StatusTooManyRequests}
+	backup := NewMockClient(`{"ok": true}`)
+	backup.ModelName = "backup-model"
+	client := NewFallbackClient(primary, backup)
+
+	var events []RetryEvent
+	ctx := WithRetryObserver(context.Background(), func(e RetryEvent) { events = append(events, e) })
+	var streamed string
+	resp, err := client.CompleteStream(ctx, Request{}, func(d StreamDelta) { streamed += d.Text })
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+	if resp.Model != "backup-model" || streamed != `{"ok": true}` {
+		t.Errorf("model = %q, streamed %q; want the backup's response", resp.Model, streamed)
+	}
+	if client.Model() != "mock-model" {
+		t.Errorf("Model() = %q, want the primary's model", client.Model())
+	}
+	if len(events) != 1 || events[0].Fallback != "mock/backup-model" || events[0].MaxAttempts != 2 {
+		t.Errorf("events = %+v, want one failover to mock/backup-model", events)
+	}
+}
+
+func TestFallbackClientStopsOnFatalError(t *testing.T) {
+	primary := NewMockClient("")
+	primary.Error = fmt.Errorf("%w: truncated", ErrInvalidResponse)
+	backup := NewMockClient("{}")
+	client := NewFallbackClient(primary, backup)
+
+	if _, err := client.Complete(context.Background(), Request{}); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("err = %v, want ErrInvalidResponse", err)
+	}
+	if backup.CallCount != 0 {
+		t.Errorf("backup called %d times, want no failover", backup.CallCount)
+	}
+}
+
+func TestFallbackClientAllFail(t *testing.T) {
+	primary := NewMockClient("")
+	primary.Error = fmt.Errorf("%w: anthropic", ErrCircuitOpen)
+	backup := NewMockClient("")
+	backup.Error = &APIError{Provider: "mock", StatusCode: http.StatusServiceUnavailable}
+	client := NewFallbackClient(primary, backup)
+
+	_, err := client.Complete(context.Background(), Request{})
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrProviderError) {
+		t.Errorf("err = %v, want both failures joined", err)
+	}
+}
+
+func TestParseFallbackChain(t *testing.T) {
+	chain, err := parseFallbackChain(" anthropic:claude-sonnet-4-20250514, google:gemini-2.5-flash,")
+	if err != nil {
+		t.Fatalf("parseFallbackChain() error = %v", err)
+	}
+	want := []fallbackEntry{
+		{provider: ProviderAnthropic, model: "claude-sonnet-4-20250514"},
+		{provider: ProviderGoogle, model: "gemini-2.5-flash"},
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("chain = %+v, want %+v", chain, want)
+	}
+
+	for _, bad := range []string{"anthropic", "google:", ":gpt-4o"} {
+		if _, err := parseFallbackChain(bad); err == nil {
+			t.Errorf("parseFallbackChain(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestFactoryDefaultClientFallback(t *testing.T) {
+	f := &Factory{
+		anthropicKey: "a",
+		geminiKey:    "g",
+		defaultPrv:   ProviderAnthropic,
+		defaultMod:   "claude-sonnet-4-20250514",
+		retry:        DefaultRetryPolicy,
+	}
+	f.fallback = f.fallbackChain("anthropic:claude-sonnet-4-20250514,google:gemini-2.5-flash,openai:gpt-4o")
+
+	client, err := f.CreateDefaultClient()
+	if err != nil {
+		t.Fatalf("CreateDefaultClient() error = %v", err)
+	}
+	fallback, ok := client.(*FallbackClient)
+	if !ok {
+		t.Fatalf("client = %T, want *FallbackClient", client)
+	}
+	// The default isn't repeated and OpenAI is skipped for lack of a key
+	var got []string
+	for _, c := range fallback.Clients() {
+		got = append(got, fmt.Sprintf("%s:%s", c.Provider(), c.Model()))
+	}
+	want := []string{"anthropic:claude-sonnet-4-20250514", "google:gemini-2.5-flash"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chain = %v, want %v", got, want)
+	}
+}
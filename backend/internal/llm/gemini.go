@@ -12,13 +12,15 @@ import (
 	"time"
 )
 
-const geminiEndpoint = "https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent"
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
 
 // GeminiClient implements Client for Google Gemini.
 type GeminiClient struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey       string
+	model        string
+	baseURL      string
+	client       *http.Client
+	contextCache *GeminiContextCache // nil unless system instructions are cached
 }
 
 // NewGeminiClient creates a new Gemini client.
@@ -27,12 +29,19 @@ func NewGeminiClient(apiKey, model string) *GeminiClient {
 		model = "gemini-2.5-flash"
 	}
 	return &GeminiClient{
-		apiKey: apiKey,
-		model:  model,
-		client: &http.Client{Timeout: 300 * time.Second},
+		apiKey:  apiKey,
+		model:   model,
+		baseURL: geminiBaseURL,
+		client:  &http.Client{Timeout: 300 * time.Second},
 	}
 }
 
+// SetContextCache makes the client send system instructions through cache,
+// as cached contexts.
+func (c *GeminiClient) SetContextCache(cache *GeminiContextCache) {
+	c.contextCache = cache
+}
+
 func (c *GeminiClient) Provider() Provider { return ProviderGoogle }
 func (c *GeminiClient) Model() string      { return c.model }
 
@@ -40,6 +49,7 @@ type geminiRequest struct {
 	Contents         []geminiContent  `json:"contents"`
 	GenerationConfig *geminiGenConfig `json:"generationConfig,omitempty"`
 	SystemInstruct   *geminiContent   `json:"system_instruction,omitempty"`
+	CachedContent    string           `json:"cachedContent,omitempty"` // Replaces SystemInstruct when it is cached
 }
 
 type geminiContent struct {
@@ -52,10 +62,11 @@ type geminiPart struct {
 }
 
 type geminiGenConfig struct {
-	Temperature      float64 `json:"temperature,omitempty"`
-	MaxOutputTokens  int     `json:"maxOutputTokens,omitempty"`
-	TopP             float64 `json:"topP,omitempty"`
-	ResponseMimeType string  `json:"responseMimeType,omitempty"`
+	Temperature      float64        `json:"temperature,omitempty"`
+	MaxOutputTokens  int            `json:"maxOutputTokens,omitempty"`
+	TopP             float64        `json:"topP,omitempty"`
+	ResponseMimeType string         `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
 }
 
 type geminiResponse struct {
@@ -67,17 +78,33 @@ type geminiResponse struct {
 		} `json:"content"`
 		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
-	Error *struct {
+	UsageMetadata geminiUsage `json:"usageMetadata"` // Cumulative when streaming
+	Error         *struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 		Status  string `json:"status"`
 	} `json:"error,omitempty"`
 }
 
-// Complete sends a completion request to Gemini.
-func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, error) {
-	log.Printf("Gemini: starting request to model %s", c.model)
+type geminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"` // Includes cached tokens
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"` // Billed as output
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+}
 
+func (u geminiUsage) toUsage(finishReason string, latency time.Duration) Usage {
+	return Usage{
+		InputTokens:  u.PromptTokenCount,
+		OutputTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		CachedTokens: u.CachedContentTokenCount,
+		Latency:      latency,
+		StopReason:   finishReason,
+	}
+}
+
+// buildRequest converts a Request to the generateContent format.
+func (c *GeminiClient) buildRequest(req Request) geminiRequest {
 	// Build contents from messages
 	contents := make([]geminiContent, 0, len(req.Messages))
 	var systemInstruct *geminiContent
@@ -102,23 +129,65 @@ func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, er
 		})
 	}
 
-	gemReq := geminiRequest{
-		Contents:       contents,
-		SystemInstruct: systemInstruct,
-		GenerationConfig: &geminiGenConfig{
-			Temperature:      req.Temperature,
-			MaxOutputTokens:  req.MaxTokens,
-			TopP:             0.95,
-			ResponseMimeType: "application/json", // Force JSON output
-		},
+	genConfig := &geminiGenConfig{
+		Temperature:      req.Temperature,
+		MaxOutputTokens:  req.MaxTokens,
+		TopP:             0.95,
+		ResponseMimeType: "application/json", // Force JSON output
+	}
+	if req.Schema != nil {
+		// responseSchema takes an OpenAPI subset; schemas it can't express
+		// still get plain JSON mode
+		schema, err := geminiSchema(req.Schema.JSON)
+		if err != nil {
+			log.Printf("Gemini: response schema %s not supported, requesting plain JSON: %v", req.Schema.name(), err)
+		} else {
+			genConfig.ResponseSchema = schema
+		}
 	}
 
+	return geminiRequest{
+		Contents:         contents,
+		SystemInstruct:   systemInstruct,
+		GenerationConfig: genConfig,
+	}
+}
+
+// send posts a request to the given model method ("generateContent" or
+// "streamGenerateContent?alt=sse"). If the client has a context cache, the
+// system instruction is sent as a cached context.
+func (c *GeminiClient) send(ctx context.Context, method string, gemReq geminiRequest) (*http.Response, error) {
+	if c.contextCache == nil || gemReq.SystemInstruct == nil {
+		return c.post(ctx, method, gemReq)
+	}
+	name, key := c.contextCache.lookup(ctx, c, gemReq.SystemInstruct)
+	if name == "" {
+		return c.post(ctx, method, gemReq)
+	}
+
+	cached := gemReq
+	cached.SystemInstruct = nil
+	cached.CachedContent = name
+	resp, err := c.post(ctx, method, cached)
+	if err != nil || (resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusForbidden) {
+		return resp, err
+	}
+	// The cached context is gone (deleted, or expired early); send the
+	// instruction itself
+	resp.Body.Close()
+	log.Printf("Gemini: cached context %s unavailable (status %d), sending the system instruction", name, resp.StatusCode)
+	c.contextCache.forget(key)
+	return c.post(ctx, method, gemReq)
+}
+
+// post posts a request to the given model method.
+func (c *GeminiClient) post(ctx context.Context, method string, gemReq geminiRequest) (*http.Response, error) {
 	body, err := json.Marshal(gemReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	endpoint := fmt.Sprintf(geminiEndpoint, c.model)
+	endpoint := fmt.Sprintf("%s/models/%s:%s", c.baseURL, c.model, method)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
@@ -133,6 +202,18 @@ func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, er
 		log.Printf("Gemini: HTTP error: %v", err)
 		return nil, fmt.Errorf("send request: %w", err)
 	}
+	return resp, nil
+}
+
+// Complete sends a completion request to Gemini.
+func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	log.Printf("Gemini: starting request to model %s", c.model)
+	start := time.Now()
+
+	resp, err := c.send(ctx, "generateContent", c.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	log.Printf("Gemini: received response status %d", resp.StatusCode)
 
@@ -142,8 +223,8 @@ func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 	log.Printf("Gemini: response body size: %d bytes", len(respBody))
 
-	if resp.StatusCode == 429 {
-		return nil, ErrRateLimit
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(ProviderGoogle, resp, respBody)
 	}
 
 	var gemResp geminiResponse
@@ -152,7 +233,7 @@ func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 
 	if gemResp.Error != nil {
-		return nil, fmt.Errorf("%w: %s (code: %d)", ErrProviderError, gemResp.Error.Message, gemResp.Error.Code)
+		return nil, &APIError{Provider: ProviderGoogle, StatusCode: gemResp.Error.Code, Type: gemResp.Error.Status, Message: gemResp.Error.Message}
 	}
 
 	if len(gemResp.Candidates) == 0 {
@@ -169,8 +250,65 @@ func (c *GeminiClient) Complete(ctx context.Context, req Request) (*Response, er
 	content = stripMarkdownCodeBlock(content)
 
 	return &Response{
-		Content: content,
-		Model:   c.model,
+		Content:  content,
+		Provider: ProviderGoogle,
+		Model:    c.model,
+		Usage:    gemResp.UsageMetadata.toUsage(candidate.FinishReason, time.Since(start)),
+	}, nil
+}
+
+// CompleteStream sends a streaming completion request to Gemini.
+func (c *GeminiClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	log.Printf("Gemini: starting streaming request to model %s", c.model)
+	start := time.Now()
+
+	resp, err := c.send(ctx, "streamGenerateContent?alt=sse", c.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStreamStatus(ProviderGoogle, resp); err != nil {
+		return nil, err
+	}
+
+	acc := streamAccumulator{onDelta: onDelta}
+	var finishReason string
+	var usage geminiUsage
+	err = readSSE(resp.Body, func(_, data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return &APIError{Provider: ProviderGoogle, StatusCode: chunk.Error.Code, Type: chunk.Error.Status, Message: chunk.Error.Message}
+		}
+		var text string
+		if len(chunk.Candidates) > 0 {
+			for _, part := range chunk.Candidates[0].Content.Parts {
+				text += part.Text
+			}
+			if chunk.Candidates[0].FinishReason != "" {
+				finishReason = chunk.Candidates[0].FinishReason
+			}
+		}
+		usage = chunk.UsageMetadata
+		acc.add(text, chunk.UsageMetadata.CandidatesTokenCount)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Gemini: stream finished, finish_reason=%s, output_tokens=%d", finishReason, acc.tokens)
+
+	if acc.content.Len() == 0 {
+		return nil, fmt.Errorf("%w: no candidates in response", ErrInvalidResponse)
+	}
+
+	return &Response{
+		Content:  stripMarkdownCodeBlock(acc.content.String()),
+		Provider: ProviderGoogle,
+		Model:    c.model,
+		Usage:    usage.toUsage(finishReason, time.Since(start)),
 	}, nil
 }
 
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultGeminiCacheTTL is how long a Gemini cached context lives.
+const DefaultGeminiCacheTTL = time.Hour
+
+// geminiCacheRenewBefore is how long before its expiry a cached context stops
+// being used, so that a call doesn't reference one that expires mid-flight.
+const geminiCacheRenewBefore = time.Minute
+
+// GeminiContextCache holds the cached contents created for the system
+// instructions of Gemini calls, so that later calls with the same model and
+// instruction send only their user message and are billed the cached-input
+// rate for the rest. It is shared by all Gemini clients and safe for
+// concurrent use.
+type GeminiContextCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]geminiCacheEntry // By model and instruction hash
+}
+
+type geminiCacheEntry struct {
+	name      string // "cachedContents/..."; empty if the instruction can't be cached
+	expiresAt time.Time
+}
+
+// NewGeminiContextCache returns a cache whose contexts live for ttl.
+func NewGeminiContextCache(ttl time.Duration) *GeminiContextCache {
+	return &GeminiContextCache{ttl: ttl, entries: make(map[string]geminiCacheEntry)}
+}
+
+func geminiCacheKey(model, instruction string) string {
+	sum := sha256.Sum256([]byte(instruction))
+	return model + ":" + hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached context for a client's model and system
+// instruction, creating it if needed, and the key it is stored under. It
+// returns an empty name if the instruction isn't cached, for instance because
+// it is shorter than the model's minimum.
+func (g *GeminiContextCache) lookup(ctx context.Context, c *GeminiClient, system *geminiContent) (name, key string) {
+	key = geminiCacheKey(c.model, system.Parts[0].Text)
+	now := time.Now()
+
+	g.mu.Lock()
+	entry, ok := g.entries[key]
+	g.mu.Unlock()
+	if ok && entry.name == "" && now.Before(entry.expiresAt) {
+		return "", key
+	}
+	if ok && entry.name != "" && now.Before(entry.expiresAt.Add(-geminiCacheRenewBefore)) {
+		return entry.name, key
+	}
+
+	name, expiresAt, err := c.createCachedContent(ctx, system, g.ttl)
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest:
+		// Too small to cache, or not supported by the model; don't ask again
+		// until the entry would have expired
+		log.Printf("Gemini: not caching system instruction for %s: %v", c.model, err)
+		expiresAt = now.Add(g.ttl)
+	case err != nil:
+		log.Printf("Warning: Gemini: failed to cache system instruction for %s: %v", c.model, err)
+		return "", key
+	default:
+		log.Printf("Gemini: cached system instruction for %s as %s", c.model, name)
+	}
+
+	g.mu.Lock()
+	g.entries[key] = geminiCacheEntry{name: name, expiresAt: expiresAt}
+	g.mu.Unlock()
+	return name, key
+}
+
+// forget drops a cached context that the API no longer knows.
+func (g *GeminiContextCache) forget(key string) {
+	g.mu.Lock()
+	delete(g.entries, key)
+	g.mu.Unlock()
+}
+
+type geminiCachedContent struct {
+	Model          string         `json:"model"`
+	SystemInstruct *geminiContent `json:"systemInstruction"`
+	TTL            string         `json:"ttl"`
+}
+
+type geminiCachedContentResponse struct {
+	Name       string    `json:"name"`
+	ExpireTime time.Time `json:"expireTime"`
+}
+
+// createCachedContent caches a system instruction for the client's model.
+func (c *GeminiClient) createCachedContent(ctx context.Context, system *geminiContent, ttl time.Duration) (string, time.Time, error) {
+	body, err := json.Marshal(geminiCachedContent{
+		Model:          "models/" + c.model,
+		SystemInstruct: system,
+		TTL:            fmt.Sprintf("%ds", int(ttl.Seconds())),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("marshal cached content: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/cachedContents", bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, newAPIError(ProviderGoogle, resp, respBody)
+	}
+
+	var cached geminiCachedContentResponse
+	if err := json.Unmarshal(respBody, &cached); err != nil || cached.Name == "" {
+		return "", time.Time{}, fmt.Errorf("%w: cached content response %s", ErrInvalidResponse, respBody[:min(200, len(respBody))])
+	}
+	if cached.ExpireTime.IsZero() {
+		cached.ExpireTime = time.Now().Add(ttl)
+	}
+	return cached.Name, cached.ExpireTime, nil
+}
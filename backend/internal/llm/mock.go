@@ -1,15 +1,22 @@
 package llm
 
 import (
+	"cmp"
 	"context"
+	"sync"
 )
 
-// MockClient is a mock LLM client for testing.
+// MockClient is a mock LLM client for testing. It is safe for concurrent use.
 type MockClient struct {
 	Response    string
+	Responses   []string // If set, returned in order (the last one repeats); overrides Response
 	Error       error
+	ModelName   string // Returned by Model(); defaults to "mock-model"
+	Usage       Usage  // Returned with every response
 	CallCount   int
 	LastRequest *Request
+
+	mu sync.Mutex
 }
 
 // NewMockClient creates a new mock LLM client.
@@ -19,6 +26,8 @@ func NewMockClient(response string) *MockClient {
 
 // Complete returns the mock response.
 func (c *MockClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.CallCount++
 	c.LastRequest = &req
 
@@ -26,12 +35,39 @@ func (c *MockClient) Complete(ctx context.Context, req Request) (*Response, erro
 		return nil, c.Error
 	}
 
+	content := c.Response
+	if len(c.Responses) > 0 {
+		content = c.Responses[min(c.CallCount, len(c.Responses))-1]
+	}
+
 	return &Response{
-		Content: c.Response,
-		Model:   "mock-model",
+		Content:  content,
+		Provider: c.Provider(),
+		Model:    c.Model(),
+		Usage:    c.Usage,
 	}, nil
 }
 
+// CompleteStream returns the mock response, delivering it to onDelta in
+// fixed-size chunks first.
+func (c *MockClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	resp, err := c.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := streamAccumulator{onDelta: onDelta}
+	for rest := resp.Content; rest != ""; {
+		n := min(mockStreamChunkSize, len(rest))
+		acc.add(rest[:n], 0)
+		rest = rest[n:]
+	}
+	return resp, nil
+}
+
+// mockStreamChunkSize is the number of bytes per MockClient stream delta.
+const mockStreamChunkSize = 16
+
 // Provider returns the mock provider.
 func (c *MockClient) Provider() Provider {
 	return "mock"
@@ -39,16 +75,27 @@ func (c *MockClient) Provider() Provider {
 
 // Model returns the mock model name.
 func (c *MockClient) Model() string {
+	if c.ModelName != "" {
+		return c.ModelName
+	}
 	return "mock-model"
 }
 
-// Ensure MockClient implements Client
-var _ Client = (*MockClient)(nil)
+// Ensure MockClient implements StreamingClient
+var _ StreamingClient = (*MockClient)(nil)
 
 // MockFactory is a mock LLM factory for testing.
-// It always returns the embedded MockClient regardless of provider/model.
+// It returns the embedded MockClient unless Clients has one for the requested model.
 type MockFactory struct {
-	Client *MockClient
+	Client  *MockClient
+	Clients map[string]*MockClient // Optional: per-model clients, keyed by model name
+	Default Client                 // Optional: returned by CreateDefaultClient instead of Client
+	Pricing PriceTable             // Optional: returned by Prices instead of DefaultPrices
+	Window  int                    // Optional: context window of every model; defaults to a million tokens
+
+	Providers    []ProviderInfo       // Optional: returned by ListProviders instead of the mock provider
+	PullProgress []OllamaPullProgress // Reported by PullOllamaModel
+	PullError    error                // Optional: returned by PullOllamaModel after its progress
 }
 
 // NewMockFactory creates a new mock factory with the given response.
@@ -82,6 +129,9 @@ func (f *MockFactory) DefaultModel() string {
 
 // ListProviders returns mock providers.
 func (f *MockFactory) ListProviders() []ProviderInfo {
+	if f.Providers != nil {
+		return f.Providers
+	}
 	return []ProviderInfo{
 		{
 			ID:        "mock",
@@ -94,15 +144,44 @@ func (f *MockFactory) ListProviders() []ProviderInfo {
 	}
 }
 
-// CreateClient returns the mock client.
+// CreateClient returns the client registered for model, or the default mock client.
 func (f *MockFactory) CreateClient(provider Provider, model string) (Client, error) {
+	if c, ok := f.Clients[model]; ok {
+		return c, nil
+	}
 	return f.Client, nil
 }
 
 // CreateDefaultClient returns the mock client.
 func (f *MockFactory) CreateDefaultClient() (Client, error) {
+	if f.Default != nil {
+		return f.Default, nil
+	}
 	return f.Client, nil
 }
 
+// Prices returns the mock price table.
+func (f *MockFactory) Prices() PriceTable {
+	if f.Pricing != nil {
+		return f.Pricing
+	}
+	return DefaultPrices
+}
+
+// TokenEstimator returns an estimator with the factory's context window.
+func (f *MockFactory) TokenEstimator(provider Provider, model string) TokenEstimator {
+	return TokenEstimator{ContextWindow: cmp.Or(f.Window, 1_000_000), BytesPerToken: 4}
+}
+
+// PullOllamaModel reports the factory's pull progress, then returns PullError.
+func (f *MockFactory) PullOllamaModel(ctx context.Context, model string, onProgress func(OllamaPullProgress)) error {
+	for _, p := range f.PullProgress {
+		if onProgress != nil {
+			onProgress(p)
+		}
+	}
+	return f.PullError
+}
+
 // Ensure MockFactory implements ClientFactory
 var _ ClientFactory = (*MockFactory)(nil)
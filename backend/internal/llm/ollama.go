@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,31 +17,71 @@ import (
 // Default Ollama endpoint
 const defaultOllamaHost = "http://localhost:11434"
 
-// OllamaClient implements Client for Ollama local LLM server.
-type OllamaClient struct {
-	baseURL string
-	model   string
-	client  *http.Client
+// OllamaConfig configures the Ollama server and how it runs models.
+type OllamaConfig struct {
+	Host      string          // Server URL (default http://localhost:11434)
+	KeepAlive json.RawMessage // How long a model stays loaded after a call, as a duration string or seconds; nil leaves Ollama's default (5m)
+	NumCtx    int             // Context window, in tokens, to load models with; 0 leaves Ollama's default
+}
+
+// ollamaConfigFromEnv reads the Ollama configuration.
+func ollamaConfigFromEnv() OllamaConfig {
+	cfg := OllamaConfig{
+		Host:   os.Getenv("OLLAMA_HOST"),
+		NumCtx: envInt("SPECBUILDER_OLLAMA_NUM_CTX", 0),
+	}
+	if v := strings.TrimSpace(os.Getenv("SPECBUILDER_OLLAMA_KEEP_ALIVE")); v != "" {
+		keepAlive, err := parseKeepAlive(v)
+		if err != nil {
+			log.Printf("Warning: ignoring SPECBUILDER_OLLAMA_KEEP_ALIVE: %v", err)
+		}
+		cfg.KeepAlive = keepAlive
+	}
+	return cfg
+}
+
+// parseKeepAlive converts a keep_alive setting to the form Ollama reads: a
+// number of seconds ("-1" keeps the model loaded, "0" unloads it after each
+// call) or a duration string such as "10m".
+func parseKeepAlive(v string) (json.RawMessage, error) {
+	if _, err := strconv.Atoi(v); err == nil {
+		return json.RawMessage(v), nil
+	}
+	if _, err := time.ParseDuration(v); err != nil {
+		return nil, fmt.Errorf("want a duration or a number of seconds, got %q", v)
+	}
+	return json.Marshal(v)
 }
 
-// NewOllamaClient creates a new Ollama client.
-// It uses OLLAMA_HOST environment variable if set, otherwise defaults to localhost:11434.
-func NewOllamaClient(model string) *OllamaClient {
-	baseURL := os.Getenv("OLLAMA_HOST")
-	if baseURL == "" {
-		baseURL = defaultOllamaHost
+// baseURL returns the server URL without a trailing slash.
+func (c OllamaConfig) baseURL() string {
+	if c.Host == "" {
+		return defaultOllamaHost
 	}
-	// Ensure no trailing slash
-	baseURL = strings.TrimSuffix(baseURL, "/")
+	return strings.TrimSuffix(c.Host, "/")
+}
+
+// OllamaClient implements Client for Ollama local LLM server.
+type OllamaClient struct {
+	baseURL   string
+	model     string
+	keepAlive json.RawMessage
+	numCtx    int
+	client    *http.Client
+}
 
+// NewOllamaClient creates a new Ollama client for the server in cfg.
+func NewOllamaClient(cfg OllamaConfig, model string) *OllamaClient {
 	if model == "" {
 		model = "llama3.2" // Default to a common model
 	}
 
 	return &OllamaClient{
-		baseURL: baseURL,
-		model:   model,
-		client:  &http.Client{Timeout: 600 * time.Second}, // Longer timeout for local inference
+		baseURL:   cfg.baseURL(),
+		model:     model,
+		keepAlive: cfg.KeepAlive,
+		numCtx:    cfg.NumCtx,
+		client:    &http.Client{Timeout: 600 * time.Second}, // Longer timeout for local inference
 	}
 }
 
@@ -49,11 +90,12 @@ func (c *OllamaClient) Model() string      { return c.model }
 
 // ollamaRequest represents the request to Ollama's /api/chat endpoint.
 type ollamaRequest struct {
-	Model    string          `json:"model"`
-	Messages []ollamaMessage `json:"messages"`
-	Stream   bool            `json:"stream"`
-	Options  *ollamaOptions  `json:"options,omitempty"`
-	Format   string          `json:"format,omitempty"`
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"`
+	Options   *ollamaOptions  `json:"options,omitempty"`
+	Format    json.RawMessage `json:"format,omitempty"`     // "json" or a JSON Schema
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"` // Duration string or seconds
 }
 
 type ollamaMessage struct {
@@ -65,6 +107,7 @@ type ollamaOptions struct {
 	Temperature float64 `json:"temperature,omitempty"`
 	Seed        int     `json:"seed,omitempty"`
 	NumPredict  int     `json:"num_predict,omitempty"` // max tokens
+	NumCtx      int     `json:"num_ctx,omitempty"`     // context window
 }
 
 // ollamaResponse represents the response from Ollama's /api/chat endpoint.
@@ -81,10 +124,17 @@ type ollamaResponse struct {
 	Error           string        `json:"error,omitempty"`
 }
 
-// Complete sends a completion request to Ollama.
-func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, error) {
-	log.Printf("Ollama: starting request to model %s at %s", c.model, c.baseURL)
+func (r ollamaResponse) usage(latency time.Duration) Usage {
+	return Usage{
+		InputTokens:  r.PromptEvalCount,
+		OutputTokens: r.EvalCount,
+		Latency:      latency,
+		StopReason:   r.DoneReason,
+	}
+}
 
+// buildRequest converts a Request to the /api/chat format.
+func (c *OllamaClient) buildRequest(req Request) ollamaRequest {
 	// Build messages (Ollama uses the same role format as OpenAI)
 	messages := make([]ollamaMessage, 0, len(req.Messages))
 	for _, m := range req.Messages {
@@ -97,6 +147,7 @@ func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, er
 	// Build options
 	options := &ollamaOptions{
 		Temperature: req.Temperature,
+		NumCtx:      c.numCtx,
 	}
 	if req.Seed != nil {
 		options.Seed = *req.Seed
@@ -105,14 +156,24 @@ func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, er
 		options.NumPredict = req.MaxTokens
 	}
 
-	ollamaReq := ollamaRequest{
-		Model:    c.model,
-		Messages: messages,
-		Stream:   false, // Non-streaming for simplicity
-		Options:  options,
-		Format:   "json", // Request JSON output
+	// Request JSON output, constrained to the schema if there is one
+	format := json.RawMessage(`"json"`)
+	if req.Schema != nil {
+		format = req.Schema.JSON
 	}
 
+	return ollamaRequest{
+		Model:     c.model,
+		Messages:  messages,
+		Stream:    false, // CompleteStream enables streaming
+		Options:   options,
+		Format:    format,
+		KeepAlive: c.keepAlive,
+	}
+}
+
+// send posts a /api/chat request.
+func (c *OllamaClient) send(ctx context.Context, ollamaReq ollamaRequest) (*http.Response, error) {
 	body, err := json.Marshal(ollamaReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -132,6 +193,18 @@ func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, er
 		log.Printf("Ollama: HTTP error: %v", err)
 		return nil, fmt.Errorf("send request: %w", err)
 	}
+	return resp, nil
+}
+
+// Complete sends a completion request to Ollama.
+func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	log.Printf("Ollama: starting request to model %s at %s", c.model, c.baseURL)
+	start := time.Now()
+
+	resp, err := c.send(ctx, c.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	log.Printf("Ollama: received response status %d", resp.StatusCode)
 
@@ -141,8 +214,8 @@ func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 	log.Printf("Ollama: response body size: %d bytes", len(respBody))
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("%w: status %d: %s", ErrProviderError, resp.StatusCode, string(respBody[:min(500, len(respBody))]))
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(ProviderOllama, resp, respBody)
 	}
 
 	var ollamaResp ollamaResponse
@@ -151,7 +224,7 @@ func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 
 	if ollamaResp.Error != "" {
-		return nil, fmt.Errorf("%w: %s", ErrProviderError, ollamaResp.Error)
+		return nil, &APIError{Provider: ProviderOllama, StatusCode: resp.StatusCode, Message: ollamaResp.Error}
 	}
 
 	if ollamaResp.Message.Content == "" {
@@ -172,8 +245,65 @@ func (c *OllamaClient) Complete(ctx context.Context, req Request) (*Response, er
 	content = stripMarkdownCodeBlock(content)
 
 	return &Response{
-		Content: content,
-		Model:   c.model,
+		Content:  content,
+		Provider: ProviderOllama,
+		Model:    c.model,
+		Usage:    ollamaResp.usage(time.Since(start)),
+	}, nil
+}
+
+// CompleteStream sends a streaming completion request to Ollama, which
+// responds with one JSON object per line.
+func (c *OllamaClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	log.Printf("Ollama: starting streaming request to model %s at %s", c.model, c.baseURL)
+	start := time.Now()
+
+	ollamaReq := c.buildRequest(req)
+	ollamaReq.Stream = true
+	resp, err := c.send(ctx, ollamaReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStreamStatus(ProviderOllama, resp); err != nil {
+		return nil, err
+	}
+
+	acc := streamAccumulator{onDelta: onDelta}
+	var final ollamaResponse
+	err = readLines(resp.Body, func(line []byte) error {
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return &APIError{Provider: ProviderOllama, Message: chunk.Error}
+		}
+		acc.add(chunk.Message.Content, chunk.EvalCount)
+		if chunk.Done {
+			final = chunk
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Ollama: stream finished, done_reason=%s, prompt_tokens=%d, completion_tokens=%d",
+		final.DoneReason, final.PromptEvalCount, final.EvalCount)
+
+	if final.DoneReason == "length" {
+		return nil, fmt.Errorf("%w: response truncated (hit token limit)", ErrInvalidResponse)
+	}
+	if acc.content.Len() == 0 {
+		return nil, fmt.Errorf("%w: no content in response", ErrInvalidResponse)
+	}
+
+	return &Response{
+		Content:  stripMarkdownCodeBlock(acc.content.String()),
+		Provider: ProviderOllama,
+		Model:    c.model,
+		Usage:    final.usage(time.Since(start)),
 	}, nil
 }
 
@@ -195,18 +325,10 @@ type ollamaTagsResponse struct {
 }
 
 // FetchOllamaModels fetches available models from a running Ollama instance.
-func FetchOllamaModels(baseURL string) ([]ModelInfo, error) {
-	if baseURL == "" {
-		baseURL = os.Getenv("OLLAMA_HOST")
-		if baseURL == "" {
-			baseURL = defaultOllamaHost
-		}
-	}
-	baseURL = strings.TrimSuffix(baseURL, "/")
-
+func FetchOllamaModels(cfg OllamaConfig) ([]ModelInfo, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
 
-	endpoint := baseURL + "/api/tags"
+	endpoint := cfg.baseURL() + "/api/tags"
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
@@ -253,17 +375,11 @@ func FetchOllamaModels(baseURL string) ([]ModelInfo, error) {
 }
 
 // CheckOllamaAvailable checks if Ollama server is running and accessible.
-func CheckOllamaAvailable() bool {
-	baseURL := os.Getenv("OLLAMA_HOST")
-	if baseURL == "" {
-		baseURL = defaultOllamaHost
-	}
-	baseURL = strings.TrimSuffix(baseURL, "/")
-
+func CheckOllamaAvailable(cfg OllamaConfig) bool {
 	client := &http.Client{Timeout: 2 * time.Second}
 
 	// Try to hit the tags endpoint
-	resp, err := client.Get(baseURL + "/api/tags")
+	resp, err := client.Get(cfg.baseURL() + "/api/tags")
 	if err != nil {
 		return false
 	}
@@ -271,3 +387,64 @@ func CheckOllamaAvailable() bool {
 
 	return resp.StatusCode == 200
 }
+
+// OllamaPullProgress is a progress update of a model pull, as Ollama's
+// /api/pull endpoint streams them.
+type OllamaPullProgress struct {
+	Status    string `json:"status"`              // e.g. "pulling manifest", "pulling <digest>", "verifying sha256 digest", "success"
+	Digest    string `json:"digest,omitempty"`    // Layer being downloaded
+	Total     int64  `json:"total,omitempty"`     // Size of the layer in bytes
+	Completed int64  `json:"completed,omitempty"` // Bytes of the layer downloaded so far
+}
+
+// PullOllamaModel downloads a model to the Ollama server, reporting each
+// progress update to onProgress, which may be nil. It returns once the model
+// is ready, or when ctx is cancelled.
+func PullOllamaModel(ctx context.Context, cfg OllamaConfig, model string, onProgress func(OllamaPullProgress)) error {
+	body, err := json.Marshal(map[string]any{"model": model, "stream": true})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", cfg.baseURL()+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	log.Printf("Ollama: pulling model %s", model)
+	resp, err := http.DefaultClient.Do(httpReq) // No timeout: downloads can take hours
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkStreamStatus(ProviderOllama, resp); err != nil {
+		return err
+	}
+
+	done := false
+	err = readLines(resp.Body, func(line []byte) error {
+		var chunk struct {
+			OllamaPullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("unmarshal pull progress: %w", err)
+		}
+		if chunk.Error != "" {
+			return &APIError{Provider: ProviderOllama, StatusCode: resp.StatusCode, Message: chunk.Error}
+		}
+		done = chunk.Status == "success"
+		if onProgress != nil {
+			onProgress(chunk.OllamaPullProgress)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("pull of %s ended before it finished", model)
+	}
+	log.Printf("Ollama: pulled model %s", model)
+	return nil
+}
@@ -0,0 +1,159 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ollamaStandIn stands in for an Ollama server: /api/chat answers with an
+// empty JSON object, /api/pull streams pull, and /api/tags lists tags. It
+// records the body of the last POST.
+type ollamaStandIn struct {
+	pull string
+	tags string
+	body map[string]any
+}
+
+func (s *ollamaStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		s.body = nil
+		json.NewDecoder(r.Body).Decode(&s.body)
+	}
+	switch r.URL.Path {
+	case "/api/chat":
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"llama-test","message":{"role":"assistant","content":"{}"},"done":true,"done_reason":"stop"}`)
+	case "/api/pull":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, s.pull)
+	case "/api/tags":
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, s.tags)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestOllamaRunOptions(t *testing.T) {
+	api := &ollamaStandIn{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	keepAlive, err := parseKeepAlive("30m")
+	if err != nil {
+		t.Fatalf("parseKeepAlive() error = %v", err)
+	}
+	c := NewOllamaClient(OllamaConfig{Host: srv.URL + "/", KeepAlive: keepAlive, NumCtx: 16384}, "llama-test")
+	if _, err := c.Complete(streamContext(t), Request{}); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	options, _ := api.body["options"].(map[string]any)
+	if api.body["keep_alive"] != "30m" || options["num_ctx"] != float64(16384) {
+		t.Errorf("request = %v, want keep_alive 30m and num_ctx 16384", api.body)
+	}
+
+	c = NewOllamaClient(OllamaConfig{Host: srv.URL}, "llama-test")
+	if _, err := c.Complete(streamContext(t), Request{}); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	options, _ = api.body["options"].(map[string]any)
+	if _, ok := api.body["keep_alive"]; ok || options["num_ctx"] != nil {
+		t.Errorf("request = %v, want Ollama's defaults", api.body)
+	}
+}
+
+func TestParseKeepAlive(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"-1", `-1`},
+		{"0", `0`},
+		{"10m", `"10m"`},
+		{"1h30m", `"1h30m"`},
+	}
+	for _, tt := range tests {
+		if got, err := parseKeepAlive(tt.value); err != nil || string(got) != tt.want {
+			t.Errorf("parseKeepAlive(%q) = %s, %v; want %s", tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := parseKeepAlive("forever"); err == nil {
+		t.Error("parseKeepAlive(forever) succeeded")
+	}
+}
+
+func TestPullOllamaModel(t *testing.T) {
+	pull := func(t *testing.T, body string) ([]OllamaPullProgress, error) {
+		t.Helper()
+		srv := httptest.NewServer(&ollamaStandIn{pull: body})
+		defer srv.Close()
+		var progress []OllamaPullProgress
+		err := PullOllamaModel(streamContext(t), OllamaConfig{Host: srv.URL}, "llama-test", func(p OllamaPullProgress) {
+			progress = append(progress, p)
+		})
+		return progress, err
+	}
+
+	t.Run("reports progress", func(t *testing.T) {
+		progress, err := pull(t, `{"status":"pulling manifest"}`+"\n"+
+			`{"status":"pulling abc","digest":"sha256:abc","total":100,"completed":40}`+"\n"+
+			`{"status":"pulling abc","digest":"sha256:abc","total":100,"completed":100}`+"\n"+
+			`{"status":"success"}`+"\n")
+		if err != nil {
+			t.Fatalf("PullOllamaModel() error = %v", err)
+		}
+		if len(progress) != 4 || progress[1].Completed != 40 || progress[1].Total != 100 || progress[3].Status != "success" {
+			t.Errorf("progress = %+v", progress)
+		}
+	})
+
+	t.Run("unknown model", func(t *testing.T) {
+		_, err := pull(t, `{"status":"pulling manifest"}`+"\n"+`{"error":"pull model manifest: file does not exist"}`+"\n")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Message != "pull model manifest: file does not exist" {
+			t.Errorf("err = %v, want the server's error", err)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		if _, err := pull(t, `{"status":"pulling manifest"}`+"\n"); err == nil {
+			t.Error("PullOllamaModel() succeeded without a success status")
+		}
+	})
+}
+
+func TestFactoryOllama(t *testing.T) {
+	api := &ollamaStandIn{
+		pull: `{"status":"success"}` + "\n",
+		tags: `{"models":[{"name":"llama-test:latest","details":{"parameter_size":"3B"}}]}`,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	f := &Factory{
+		ollamaAvailable: true,
+		ollama:          OllamaConfig{Host: srv.URL, NumCtx: 32768},
+		contextWindows:  DefaultContextWindows,
+		providers:       []ProviderInfo{{ID: ProviderOllama, Available: true, Models: []ModelInfo{}}},
+	}
+	if err := f.PullOllamaModel(streamContext(t), "llama-test", nil); err != nil {
+		t.Fatalf("PullOllamaModel() error = %v", err)
+	}
+	if api.body["model"] != "llama-test" || api.body["stream"] != true {
+		t.Errorf("pull request = %v", api.body)
+	}
+	if models := f.ListProviders()[0].Models; len(models) != 1 || models[0].ID != "llama-test:latest" {
+		t.Errorf("Ollama models = %+v, want the pulled model", models)
+	}
+
+	if got := f.TokenEstimator(ProviderOllama, "llama-test").ContextWindow; got != 32768 {
+		t.Errorf("Ollama context window = %d, want num_ctx", got)
+	}
+	if got := f.TokenEstimator(ProviderOpenAI, "gpt-4o").ContextWindow; got != 128000 {
+		t.Errorf("gpt-4o context window = %d, want 128000", got)
+	}
+}
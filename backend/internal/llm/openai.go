@@ -14,32 +14,54 @@ import (
 
 const openAIEndpoint = "https://api.openai.com/v1/chat/completions"
 
-// OpenAIClient implements Client for OpenAI.
+// OpenAIClient implements Client for OpenAI and OpenAI-compatible servers.
 type OpenAIClient struct {
-	apiKey string
-	model  string
-	client *http.Client
+	provider Provider
+	model    string
+	endpoint string
+	setAuth  func(http.Header) // Adds the API key to a request
+	client   *http.Client
 }
 
 // NewOpenAIClient creates a new OpenAI client.
 func NewOpenAIClient(apiKey, model string) *OpenAIClient {
 	return &OpenAIClient{
-		apiKey: apiKey,
-		model:  model,
-		client: &http.Client{Timeout: 300 * time.Second},
+		provider: ProviderOpenAI,
+		model:    model,
+		endpoint: openAIEndpoint,
+		setAuth:  func(h http.Header) { h.Set("Authorization", "Bearer "+apiKey) },
+		client:   &http.Client{Timeout: 300 * time.Second},
 	}
 }
 
-func (c *OpenAIClient) Provider() Provider { return ProviderOpenAI }
+func (c *OpenAIClient) Provider() Provider { return c.provider }
 func (c *OpenAIClient) Model() string      { return c.model }
 
 type openAIRequest struct {
-	Model               string          `json:"model"`
-	Messages            []openAIMessage `json:"messages"`
-	Temperature         float64         `json:"temperature,omitempty"`
-	MaxTokens           int             `json:"max_tokens,omitempty"`
-	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
-	Seed                *int            `json:"seed,omitempty"`
+	Model               string                `json:"model"`
+	Messages            []openAIMessage       `json:"messages"`
+	Temperature         float64               `json:"temperature,omitempty"`
+	MaxTokens           int                   `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                   `json:"max_completion_tokens,omitempty"`
+	Seed                *int                  `json:"seed,omitempty"`
+	Stream              bool                  `json:"stream,omitempty"`
+	StreamOptions       *openAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat      *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string            `json:"type"` // "json_schema"
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIMessage struct {
@@ -52,14 +74,50 @@ type openAIResponse struct {
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Model string      `json:"model"`
+	Usage openAIUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
+// openAIStreamChunk is one server-sent chunk of a streaming chat completion.
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
-	Model string `json:"model"`
+	Model string       `json:"model"`
+	Usage *openAIUsage `json:"usage"` // Final chunk only
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 	} `json:"error,omitempty"`
 }
 
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"` // Includes cached tokens
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+func (u openAIUsage) toUsage(finishReason string, latency time.Duration) Usage {
+	return Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		CachedTokens: u.PromptTokensDetails.CachedTokens,
+		Latency:      latency,
+		StopReason:   finishReason,
+	}
+}
+
 // usesCompletionTokens returns true if the model uses max_completion_tokens
 // instead of max_tokens. This applies to o1, o3, gpt-4o, gpt-5 and newer models.
 // Only legacy models (gpt-3.5, gpt-4 without suffix) use max_tokens.
@@ -73,9 +131,8 @@ func usesCompletionTokens(model string) bool {
 	return true
 }
 
-// Complete sends a completion request to OpenAI.
-func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, error) {
-	log.Printf("OpenAI: starting request to model %s", c.model)
+// buildRequest converts a Request to the chat completions format.
+func (c *OpenAIClient) buildRequest(req Request) openAIRequest {
 	messages := make([]openAIMessage, len(req.Messages))
 	for i, m := range req.Messages {
 		messages[i] = openAIMessage{Role: m.Role, Content: m.Content}
@@ -87,26 +144,40 @@ func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, er
 		Seed:     req.Seed,
 	}
 
-	// Newer models (o1, gpt-4o, etc.) use max_completion_tokens instead of max_tokens
-	if usesCompletionTokens(c.model) {
+	// Newer models (o1, gpt-4o, etc.) use max_completion_tokens instead of max_tokens;
+	// compatible servers expect max_tokens
+	if c.provider == ProviderOpenAI && usesCompletionTokens(c.model) {
 		oaiReq.MaxCompletionTokens = req.MaxTokens
 	} else {
 		oaiReq.Temperature = req.Temperature
 		oaiReq.MaxTokens = req.MaxTokens
 	}
 
+	// Strict mode would require every property to be required and closed,
+	// which the application's schemas are not
+	if req.Schema != nil {
+		oaiReq.ResponseFormat = &openAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &openAIJSONSchema{Name: req.Schema.name(), Schema: req.Schema.JSON},
+		}
+	}
+	return oaiReq
+}
+
+// send posts a chat completions request.
+func (c *OpenAIClient) send(ctx context.Context, oaiReq openAIRequest) (*http.Response, error) {
 	body, err := json.Marshal(oaiReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", openAIEndpoint, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	c.setAuth(httpReq.Header)
 
 	log.Printf("OpenAI: sending HTTP request (prompt size: %d bytes)", len(body))
 	resp, err := c.client.Do(httpReq)
@@ -114,6 +185,17 @@ func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, er
 		log.Printf("OpenAI: HTTP error: %v", err)
 		return nil, fmt.Errorf("send request: %w", err)
 	}
+	return resp, nil
+}
+
+// Complete sends a completion request to OpenAI.
+func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	log.Printf("OpenAI: starting request to model %s", c.model)
+	start := time.Now()
+	resp, err := c.send(ctx, c.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	log.Printf("OpenAI: received response status %d", resp.StatusCode)
 
@@ -123,8 +205,8 @@ func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 	log.Printf("OpenAI: response body size: %d bytes", len(respBody))
 
-	if resp.StatusCode == 429 {
-		return nil, ErrRateLimit
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(c.provider, resp, respBody)
 	}
 
 	var oaiResp openAIResponse
@@ -133,7 +215,7 @@ func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 
 	if oaiResp.Error != nil {
-		return nil, fmt.Errorf("%w: %s", ErrProviderError, oaiResp.Error.Message)
+		return nil, &APIError{Provider: c.provider, StatusCode: resp.StatusCode, Type: oaiResp.Error.Type, Message: oaiResp.Error.Message}
 	}
 
 	if len(oaiResp.Choices) == 0 {
@@ -141,8 +223,74 @@ func (c *OpenAIClient) Complete(ctx context.Context, req Request) (*Response, er
 	}
 
 	return &Response{
-		Content: oaiResp.Choices[0].Message.Content,
-		Model:   oaiResp.Model,
+		Content:  oaiResp.Choices[0].Message.Content,
+		Provider: c.provider,
+		Model:    oaiResp.Model,
+		Usage:    oaiResp.Usage.toUsage(oaiResp.Choices[0].FinishReason, time.Since(start)),
+	}, nil
+}
+
+// CompleteStream sends a streaming completion request to OpenAI.
+func (c *OpenAIClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	log.Printf("OpenAI: starting streaming request to model %s", c.model)
+	start := time.Now()
+	oaiReq := c.buildRequest(req)
+	oaiReq.Stream = true
+	oaiReq.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+
+	resp, err := c.send(ctx, oaiReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStreamStatus(c.provider, resp); err != nil {
+		return nil, err
+	}
+
+	acc := streamAccumulator{onDelta: onDelta}
+	model := c.model
+	var finishReason string
+	var usage openAIUsage
+	err = readSSE(resp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return &APIError{Provider: c.provider, Type: chunk.Error.Type, Message: chunk.Error.Message}
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		for _, choice := range chunk.Choices {
+			acc.add(choice.Delta.Content, 0)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+			acc.add("", chunk.Usage.CompletionTokens)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("OpenAI: stream finished, finish_reason=%s, completion_tokens=%d", finishReason, acc.tokens)
+
+	if acc.content.Len() == 0 {
+		return nil, ErrInvalidResponse
+	}
+
+	return &Response{
+		Content:  acc.content.String(),
+		Provider: c.provider,
+		Model:    model,
+		Usage:    usage.toUsage(finishReason, time.Since(start)),
 	}, nil
 }
 
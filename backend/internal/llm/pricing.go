@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// ModelPrice is a model's price in USD per million tokens.
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"` // Prompt tokens read from cache; defaults to Input
+}
+
+// Cost returns the cost of usage in USD.
+func (p ModelPrice) Cost(u Usage) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	uncached := max(u.InputTokens-u.CachedTokens, 0)
+	return (float64(uncached)*p.Input +
+		float64(u.CachedTokens)*cachedPrice +
+		float64(u.OutputTokens)*p.Output) / 1e6
+}
+
+// PriceTable maps model names to prices. A model is priced by the longest
+// entry that is a prefix of its name, so "gpt-4o" covers dated versions such
+// as "gpt-4o-2024-08-06" while "gpt-4o-mini" has an entry of its own.
+type PriceTable map[string]ModelPrice
+
+// DefaultPrices lists published list prices for the models the factory
+// offers. Prices change; override them with SPECBUILDER_LLM_PRICES.
+var DefaultPrices = PriceTable{
+	// Anthropic
+	"claude-opus-4":     {Input: 15, Output: 75, CachedInput: 1.5},
+	"claude-opus-4-5":   {Input: 5, Output: 25, CachedInput: 0.5},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CachedInput: 0.3},
+	"claude-haiku-4":    {Input: 1, Output: 5, CachedInput: 0.1},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CachedInput: 0.3},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CachedInput: 0.3},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CachedInput: 0.08},
+	"claude-3-opus":     {Input: 15, Output: 75, CachedInput: 1.5},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25, CachedInput: 0.03},
+
+	// Google
+	"gemini-2.5-pro":        {Input: 1.25, Output: 10, CachedInput: 0.31},
+	"gemini-2.5-flash":      {Input: 0.3, Output: 2.5, CachedInput: 0.075},
+	"gemini-2.5-flash-lite": {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+	"gemini-2.0-flash":      {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+	"gemini-2.0-flash-lite": {Input: 0.075, Output: 0.3},
+	"gemini-1.5-pro":        {Input: 1.25, Output: 5},
+	"gemini-1.5-flash":      {Input: 0.075, Output: 0.3},
+
+	// OpenAI
+	"gpt-5":        {Input: 1.25, Output: 10, CachedInput: 0.125},
+	"gpt-5-mini":   {Input: 0.25, Output: 2, CachedInput: 0.025},
+	"gpt-5-nano":   {Input: 0.05, Output: 0.4, CachedInput: 0.005},
+	"gpt-4.1":      {Input: 2, Output: 8, CachedInput: 0.5},
+	"gpt-4.1-mini": {Input: 0.4, Output: 1.6, CachedInput: 0.1},
+	"gpt-4.1-nano": {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+	"gpt-4o":       {Input: 2.5, Output: 10, CachedInput: 1.25},
+	"gpt-4o-mini":  {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+	"gpt-4-turbo":  {Input: 10, Output: 30},
+	"o1":           {Input: 15, Output: 60, CachedInput: 7.5},
+	"o1-mini":      {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+	"o3":           {Input: 2, Output: 8, CachedInput: 0.5},
+	"o3-mini":      {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+	"o4-mini":      {Input: 1.1, Output: 4.4, CachedInput: 0.275},
+}
+
+// Lookup returns the price of model.
+func (t PriceTable) Lookup(model string) (ModelPrice, bool) {
+	model = strings.TrimPrefix(model, "models/") // Gemini's resource names
+	var best string
+	var price ModelPrice
+	for prefix, p := range t {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, price = prefix, p
+		}
+	}
+	return price, best != ""
+}
+
+// Cost returns the estimated cost of a call in USD. It reports false if the
+// model has no known price. Calls to local Ollama models are free.
+func (t PriceTable) Cost(provider Provider, model string, u Usage) (float64, bool) {
+	if provider == ProviderOllama {
+		return 0, true
+	}
+	price, ok := t.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(u), true
+}
+
+// loadPriceTable returns DefaultPrices with overrides from
+// SPECBUILDER_LLM_PRICES: a JSON object mapping model names (or prefixes) to
+// prices, given inline or as the path of a JSON file.
+func loadPriceTable(value string) (PriceTable, error) {
+	table := maps.Clone(DefaultPrices)
+	var overrides PriceTable
+	if err := readOverrides(value, &overrides); err != nil {
+		return nil, fmt.Errorf("prices: %w", err)
+	}
+	maps.Copy(table, overrides)
+	return table, nil
+}
+
+// readOverrides decodes a JSON object of per-model overrides, given inline or
+// as the path of a JSON file, into v. An empty value leaves v as it is.
+func readOverrides(value string, v any) error {
+	if value == "" {
+		return nil
+	}
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	return nil
+}
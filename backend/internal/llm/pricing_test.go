@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPriceTableCost(t *testing.T) {
+	table := PriceTable{
+		"gpt-4o":      {Input: 2.5, Output: 10, CachedInput: 1.25},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+		"gemini-pro":  {Input: 1, Output: 2},
+	}
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CachedTokens: 400_000}
+
+	tests := []struct {
+		name     string
+		provider Provider
+		model    string
+		want     float64
+		wantOK   bool
+	}{
+		{"exact", ProviderOpenAI, "gpt-4o", 0.6*2.5 + 0.4*1.25 + 0.1*10, true},
+		{"dated version", ProviderOpenAI, "gpt-4o-2024-08-06", 0.6*2.5 + 0.4*1.25 + 0.1*10, true},
+		{"longest prefix wins", ProviderOpenAI, "gpt-4o-mini-2024-07-18", 1.0*0.15 + 0.1*0.6, true}, // Cached defaults to the input price
+		{"resource name", ProviderGoogle, "models/gemini-pro", 1 + 0.2, true},
+		{"unknown", ProviderOpenAI, "gpt-9", 0, false},
+		{"local", ProviderOllama, "llama3.2", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := table.Cost(tt.provider, tt.model, usage)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost(%s) = %v, %v; want %v, %v", tt.model, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	table, err := loadPriceTable(`{"my-model": {"input": 1, "output": 2}, "gpt-4o": {"input": 9, "output": 9}}`)
+	if err != nil {
+		t.Fatalf("loadPriceTable() error = %v", err)
+	}
+	if p, ok := table.Lookup("my-model-v2"); !ok || p.Output != 2 {
+		t.Errorf("Lookup(my-model-v2) = %+v, %v; want the override", p, ok)
+	}
+	if p, _ := table.Lookup("gpt-4o"); p.Input != 9 {
+		t.Errorf("Lookup(gpt-4o) = %+v, want the override", p)
+	}
+	if _, ok := table.Lookup("claude-sonnet-4-20250514"); !ok {
+		t.Error("defaults missing from the loaded table")
+	}
+	if DefaultPrices["gpt-4o"].Input == 9 {
+		t.Error("override modified DefaultPrices")
+	}
+
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"file-model": {"input": 3, "output": 4}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if table, err := loadPriceTable(path); err != nil || table["file-model"].Input != 3 {
+		t.Errorf("loadPriceTable(file) = %v, %v; want the file's prices", table["file-model"], err)
+	}
+	if _, err := loadPriceTable("{not json"); err == nil {
+		t.Error("loadPriceTable(invalid) succeeded")
+	}
+}
@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var cachedPromptRequest = Request{Messages: []Message{
+	{Role: "system", Content: "You are the Compiler."},
+	{Role: "user", Content: "Inputs: {}"},
+}}
+
+func TestAnthropicCachesSystemPrompt(t *testing.T) {
+	var body struct {
+		System   []anthropicTextBlock `json:"system"`
+		Messages []anthropicMessage   `json:"messages"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"content":[{"type":"text","text":"{}"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"cache_read_input_tokens":900,"output_tokens":5}}`)
+	}))
+	defer srv.Close()
+
+	c := NewAnthropicClient("key", "claude-test")
+	c.endpoint = srv.URL
+	resp, err := c.Complete(streamContext(t), cachedPromptRequest)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if len(body.System) != 1 || body.System[0].Text != "You are the Compiler." || body.System[0].CacheControl == nil || body.System[0].CacheControl.Type != "ephemeral" {
+		t.Errorf("system = %+v, want the system prompt with an ephemeral cache breakpoint", body.System)
+	}
+	if len(body.Messages) != 1 || body.Messages[0].Role != "user" {
+		t.Errorf("messages = %+v, want only the user message", body.Messages)
+	}
+	if resp.Usage.InputTokens != 910 || resp.Usage.CachedTokens != 900 {
+		t.Errorf("usage = %+v, want 910 input tokens of which 900 cached", resp.Usage)
+	}
+}
+
+// geminiCacheServer stands in for the Gemini API: it creates cached contents
+// with the given status, and answers generateContent calls, failing those that
+// reference a cached content in gone.
+type geminiCacheServer struct {
+	createStatus int
+	gone         map[string]bool
+
+	mu       sync.Mutex
+	creates  int
+	requests []geminiRequest
+}
+
+func (s *geminiCacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/cachedContents") {
+		s.creates++
+		var req geminiCachedContent
+		json.NewDecoder(r.Body).Decode(&req)
+		if s.createStatus != http.StatusOK {
+			w.WriteHeader(s.createStatus)
+			io.WriteString(w, `{"error":{"code":400,"message":"Cached content is too small","status":"INVALID_ARGUMENT"}}`)
+			return
+		}
+		if req.Model != "models/gemini-test" || req.TTL != "3600s" || req.SystemInstruct.Parts[0].Text != "You are the Compiler." {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"name":"cachedContents/c%d","expireTime":%q}`, s.creates, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		return
+	}
+
+	var req geminiRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.requests = append(s.requests, req)
+	if s.gone[req.CachedContent] {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error":{"code":403,"message":"CachedContent not found","status":"PERMISSION_DENIED"}}`)
+		return
+	}
+	io.WriteString(w, `{"candidates":[{"content":{"parts":[{"text":"{}"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":1000,"cachedContentTokenCount":900,"candidatesTokenCount":5}}`)
+}
+
+func TestGeminiContextCache(t *testing.T) {
+	complete := func(t *testing.T, srv *httptest.Server, cache *GeminiContextCache) {
+		t.Helper()
+		c := NewGeminiClient("key", "gemini-test")
+		c.baseURL = srv.URL
+		c.SetContextCache(cache)
+		if _, err := c.Complete(streamContext(t), cachedPromptRequest); err != nil {
+			t.Fatalf("Complete() error = %v", err)
+		}
+	}
+
+	t.Run("reuses the cached context", func(t *testing.T) {
+		api := &geminiCacheServer{createStatus: http.StatusOK}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+		cache := NewGeminiContextCache(time.Hour)
+
+		complete(t, srv, cache)
+		complete(t, srv, cache)
+		if api.creates != 1 {
+			t.Errorf("created %d cached contents, want 1", api.creates)
+		}
+		for _, req := range api.requests {
+			if req.CachedContent != "cachedContents/c1" || req.SystemInstruct != nil || len(req.Contents) != 1 {
+				t.Errorf("request = %+v, want the cached context and only the user message", req)
+			}
+		}
+	})
+
+	t.Run("recreates a context that is gone", func(t *testing.T) {
+		api := &geminiCacheServer{createStatus: http.StatusOK, gone: map[string]bool{"cachedContents/c1": true}}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+		cache := NewGeminiContextCache(time.Hour)
+
+		complete(t, srv, cache)
+		if len(api.requests) != 2 || api.requests[1].SystemInstruct == nil || api.requests[1].CachedContent != "" {
+			t.Fatalf("requests = %+v, want a retry with the system instruction", api.requests)
+		}
+		complete(t, srv, cache)
+		if api.creates != 2 || api.requests[2].CachedContent != "cachedContents/c2" {
+			t.Errorf("creates = %d, last request = %+v; want a new cached context", api.creates, api.requests[2])
+		}
+	})
+
+	t.Run("sends instructions too small to cache", func(t *testing.T) {
+		api := &geminiCacheServer{createStatus: http.StatusBadRequest}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+		cache := NewGeminiContextCache(time.Hour)
+
+		complete(t, srv, cache)
+		complete(t, srv, cache)
+		if api.creates != 1 {
+			t.Errorf("tried to create %d cached contents, want 1", api.creates)
+		}
+		for _, req := range api.requests {
+			if req.SystemInstruct == nil || req.CachedContent != "" {
+				t.Errorf("request = %+v, want the system instruction", req)
+			}
+		}
+	})
+}
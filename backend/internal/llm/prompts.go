@@ -2,11 +2,16 @@ package llm
 
 import (
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
 	"strings"
 )
 
-//go:embed prompts/v1/*.txt
+//go:embed prompts/*/*.txt
 var promptsFS embed.FS
 
 // PromptVersion represents a prompt version.
@@ -16,33 +21,144 @@ const (
 	PromptVersionV1 PromptVersion = "v1"
 )
 
+// DefaultPromptVersion is used unless the server, a project or a request
+// selects another. Versions that leave out a role inherit its prompt from it.
+const DefaultPromptVersion = PromptVersionV1
+
+// ErrUnknownPromptVersion is returned for a prompt version the registry
+// doesn't have.
+var ErrUnknownPromptVersion = errors.New("unknown prompt version")
+
 // PromptTemplate holds a loaded prompt template.
 type PromptTemplate struct {
 	Version  PromptVersion
 	Role     string // planner, asker, compiler, validator
-	Template string
+	System   string // Static instructions, sent as the system message; empty if the prompt has no system part
+	Template string // The user message
 }
 
-// LoadPrompt loads a prompt template by role and version.
-func LoadPrompt(role string, version PromptVersion) (*PromptTemplate, error) {
-	filename := fmt.Sprintf("prompts/%s/%s.txt", version, role)
-	data, err := promptsFS.ReadFile(filename)
+// PromptVersionInfo describes a prompt version in a PromptRegistry.
+type PromptVersionInfo struct {
+	Version PromptVersion `json:"version"`
+	Source  string        `json:"source"` // "embedded", or the override directory it was loaded from
+	Roles   []string      `json:"roles"`  // Roles the version has its own prompt for, sorted
+}
+
+// PromptRegistry holds the prompt templates of every available version: those
+// built into the server, plus any loaded from an override directory. It must
+// not be modified once in use.
+type PromptRegistry struct {
+	templates map[PromptVersion]map[string]string // version -> role -> template
+	sources   map[PromptVersion]string
+}
+
+// NewPromptRegistry returns a registry of the built-in prompts.
+func NewPromptRegistry() *PromptRegistry {
+	r := &PromptRegistry{
+		templates: make(map[PromptVersion]map[string]string),
+		sources:   make(map[PromptVersion]string),
+	}
+	files, _ := fs.Glob(promptsFS, "prompts/*/*.txt")
+	for _, name := range files {
+		data, err := promptsFS.ReadFile(name)
+		if err != nil {
+			panic(fmt.Sprintf("read embedded prompt %s: %v", name, err))
+		}
+		r.add(PromptVersion(path.Base(path.Dir(name))), strings.TrimSuffix(path.Base(name), ".txt"), string(data), "embedded")
+	}
+	return r
+}
+
+// LoadDir loads override prompts from dir, laid out like the built-in ones:
+// dir/<version>/<role>.txt. A file for an existing version and role replaces
+// its prompt; a new version directory only needs the roles it changes.
+func (r *PromptRegistry) LoadDir(dir string) error {
+	versions, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, fmt.Errorf("load prompt %s/%s: %w", version, role, err)
+		return fmt.Errorf("read prompts directory: %w", err)
+	}
+	for _, v := range versions {
+		if !v.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(path.Join(dir, v.Name()))
+		if err != nil {
+			return fmt.Errorf("read prompts directory: %w", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || path.Ext(f.Name()) != ".txt" {
+				continue
+			}
+			data, err := os.ReadFile(path.Join(dir, v.Name(), f.Name()))
+			if err != nil {
+				return fmt.Errorf("read prompt: %w", err)
+			}
+			role := strings.TrimSuffix(f.Name(), ".txt")
+			if err := checkTemplate(role, string(data)); err != nil {
+				return fmt.Errorf("%s: %w", path.Join(v.Name(), f.Name()), err)
+			}
+			r.add(PromptVersion(v.Name()), role, string(data), dir)
+		}
+	}
+	return nil
+}
+
+func (r *PromptRegistry) add(version PromptVersion, role, template, source string) {
+	if r.templates[version] == nil {
+		r.templates[version] = make(map[string]string)
+	}
+	r.templates[version][role] = template
+	r.sources[version] = source
+}
+
+// Has reports whether the registry has a prompt version.
+func (r *PromptRegistry) Has(version PromptVersion) bool {
+	_, ok := r.templates[version]
+	return ok
+}
+
+// Load returns the prompt template for role in version. A version without its
+// own prompt for role inherits the one of DefaultPromptVersion.
+func (r *PromptRegistry) Load(role string, version PromptVersion) (*PromptTemplate, error) {
+	roles, ok := r.templates[version]
+	if !ok {
+		return nil, fmt.Errorf("load prompt %s/%s: %w", version, role, ErrUnknownPromptVersion)
 	}
+	template, ok := roles[role]
+	if !ok {
+		template, ok = r.templates[DefaultPromptVersion][role]
+	}
+	if !ok {
+		return nil, fmt.Errorf("load prompt %s/%s: %w", version, role, fs.ErrNotExist)
+	}
+	system, user := splitPrompt(template)
 	return &PromptTemplate{
 		Version:  version,
 		Role:     role,
-		Template: string(data),
+		System:   system,
+		Template: user,
 	}, nil
 }
 
-// Render renders the template with the given variables.
-func (p *PromptTemplate) Render(vars map[string]string) string {
-	result := p.Template
-	for k, v := range vars {
-		placeholder := "{{" + k + "}}"
-		result = strings.ReplaceAll(result, placeholder, v)
+// Versions lists the available prompt versions, sorted by version.
+func (r *PromptRegistry) Versions() []PromptVersionInfo {
+	versions := make([]PromptVersionInfo, 0, len(r.templates))
+	for version, roles := range r.templates {
+		info := PromptVersionInfo{Version: version, Source: r.sources[version], Roles: make([]string, 0, len(roles))}
+		for role := range roles {
+			info.Roles = append(info.Roles, role)
+		}
+		slices.Sort(info.Roles)
+		versions = append(versions, info)
 	}
-	return result
+	slices.SortFunc(versions, func(a, b PromptVersionInfo) int { return strings.Compare(string(a.Version), string(b.Version)) })
+	return versions
+}
+
+// builtinPrompts backs LoadPrompt.
+var builtinPrompts = NewPromptRegistry()
+
+// LoadPrompt loads a built-in prompt template by role and version.
+func LoadPrompt(role string, version PromptVersion) (*PromptTemplate, error) {
+	return builtinPrompts.Load(role, version)
 }
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePrompt(t *testing.T, dir, version, role, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, version), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version, role+".txt"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPromptRegistry(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "v1", "repairer", "patched v1 repairer")
+	writePrompt(t, dir, "v2", "compiler", "v2 compiler {{PROJECT}}")
+
+	registry := NewPromptRegistry()
+	builtin, err := registry.Load("compiler", PromptVersionV1)
+	if err != nil {
+		t.Fatalf("Load(compiler, v1) error = %v", err)
+	}
+	if err := registry.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		role    string
+		version PromptVersion
+		want    string
+	}{
+		{"repairer", PromptVersionV1, "patched v1 repairer"},
+		{"compiler", "v2", "v2 compiler {{PROJECT}}"},
+		{"compiler", PromptVersionV1, builtin.Template},
+		{"asker", "v2", mustLoad(t, "asker", PromptVersionV1)}, // Inherited from v1
+	} {
+		prompt, err := registry.Load(tt.role, tt.version)
+		if err != nil {
+			t.Errorf("Load(%s, %s) error = %v", tt.role, tt.version, err)
+			continue
+		}
+		if prompt.Template != tt.want || prompt.Version != tt.version {
+			t.Errorf("Load(%s, %s) = %s %.40q, want %.40q", tt.role, tt.version, prompt.Version, prompt.Template, tt.want)
+		}
+	}
+
+	if _, err := registry.Load("compiler", "v9"); !errors.Is(err, ErrUnknownPromptVersion) {
+		t.Errorf("Load(compiler, v9) error = %v, want ErrUnknownPromptVersion", err)
+	}
+
+	versions := registry.Versions()
+	if len(versions) != 2 || versions[0].Version != PromptVersionV1 || versions[1].Version != "v2" {
+		t.Fatalf("Versions() = %+v, want v1 and v2", versions)
+	}
+	if v2 := versions[1]; v2.Source != dir || len(v2.Roles) != 1 || v2.Roles[0] != "compiler" {
+		t.Errorf("v2 = %+v, want the compiler prompt from %s", v2, dir)
+	}
+	if len(versions[0].Roles) < 10 {
+		t.Errorf("v1 roles = %v, want every built-in prompt", versions[0].Roles)
+	}
+}
+
+func mustLoad(t *testing.T, role string, version PromptVersion) string {
+	t.Helper()
+	prompt, err := LoadPrompt(role, version)
+	if err != nil {
+		t.Fatalf("LoadPrompt(%s, %s) error = %v", role, version, err)
+	}
+	return prompt.Template
+}
@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// varKind is the kind of value a prompt variable holds, which decides how it
+// is inserted into the prompt.
+type varKind int
+
+const (
+	varJSON varKind = iota // A JSON document, inserted as is
+	varText                // Free text, inserted as a JSON string so it can't break out of its place in the prompt
+)
+
+// promptVars declares the variables each prompt role's template may use.
+// Callers must supply every variable of the role; a template may leave some
+// out.
+var promptVars = map[string]map[string]varKind{
+	"planner":                plannerVars,
+	"planner_basic":          plannerVars,
+	"asker":                  askerVars,
+	"asker_basic":            askerVars,
+	"suggester":              suggesterVars,
+	"suggester_basic":        suggesterVars,
+	"compiler":               {"PROJECT": varJSON, "QA_BUNDLE_JSON": varJSON, "CURRENT_SPEC_JSON": varJSON},
+	"compiler_section":       {"PROJECT": varJSON, "SECTIONS_JSON": varJSON, "QA_BUNDLE_JSON": varJSON, "CURRENT_SPEC_JSON": varJSON},
+	"repairer":               {"PROJECT": varJSON, "SPEC_JSON": varJSON, "VALIDATION_ERRORS_JSON": varJSON, "QA_BUNDLE_JSON": varJSON},
+	"validator_llm_optional": {"PROJECT": varJSON, "COMPILED_SPEC_JSON": varJSON, "TRACE_JSON": varJSON, "SCHEMA_VALIDATION_JSON": varJSON, "QA_BUNDLE_JSON": varJSON},
+}
+
+var (
+	plannerVars = map[string]varKind{
+		"PROJECT":                 varJSON,
+		"CURRENT_SPEC_JSON":       varJSON,
+		"CURRENT_ISSUES_JSON":     varJSON,
+		"EXISTING_QUESTIONS_JSON": varJSON,
+		"LATEST_ANSWERS_JSON":     varJSON,
+	}
+	askerVars = map[string]varKind{
+		"PROJECT":                  varJSON,
+		"PLANNER_SUGGESTIONS_JSON": varJSON,
+		"CURRENT_SPEC_JSON":        varJSON,
+		"EXISTING_QUESTIONS_JSON":  varJSON,
+		"LATEST_ANSWERS_JSON":      varJSON,
+	}
+	suggesterVars = map[string]varKind{
+		"PROJECT_NAME":         varText,
+		"PROJECT_MODE":         varText,
+		"EXISTING_ANSWERS":     varJSON,
+		"CURRENT_SPEC":         varJSON,
+		"UNANSWERED_QUESTIONS": varJSON,
+	}
+)
+
+// placeholderPattern matches a {{NAME}} placeholder. It also matches
+// misspellings such as {{ name }}, so that they fail rather than reach the
+// model.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// promptUserMarker is the line that ends the system part of a prompt file;
+// the rest of the file is the user message. Providers cache the system part,
+// so it holds the static instructions and schema, and may not use variables.
+const promptUserMarker = "\n--- user ---\n"
+
+// splitPrompt splits a prompt file into its system and user parts. A file
+// without a user marker is all user message.
+func splitPrompt(content string) (system, user string) {
+	if system, user, ok := strings.Cut(content, promptUserMarker); ok {
+		return strings.TrimSpace(system), user
+	}
+	return "", content
+}
+
+// checkTemplate returns an error if role has no declared variables, or the
+// prompt file content uses a placeholder in its system part or one that isn't
+// declared for role.
+func checkTemplate(role, content string) error {
+	declared, ok := promptVars[role]
+	if !ok {
+		return fmt.Errorf("unknown prompt role %q", role)
+	}
+	system, user := splitPrompt(content)
+	if m := placeholderPattern.FindString(system); m != "" {
+		return fmt.Errorf("prompt %s: the system part can't use variables, found %s", role, m)
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(user, -1) {
+		if _, ok := declared[m[1]]; !ok {
+			return fmt.Errorf("prompt %s: unknown variable %s", role, m[0])
+		}
+	}
+	return nil
+}
+
+// Messages renders the prompt as a system message, if it has a system part,
+// followed by the user message.
+func (p *PromptTemplate) Messages(vars map[string]string) ([]Message, error) {
+	user, err := p.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	if p.System == "" {
+		return []Message{{Role: "user", Content: user}}, nil
+	}
+	return []Message{{Role: "system", Content: p.System}, {Role: "user", Content: user}}, nil
+}
+
+// Render renders the user message with the given variables in a single pass,
+// so placeholders inside inserted values are left as they are. vars must hold
+// exactly the variables declared for the template's role, and JSON variables
+// must be valid JSON.
+func (p *PromptTemplate) Render(vars map[string]string) (string, error) {
+	if err := checkTemplate(p.Role, p.System+promptUserMarker+p.Template); err != nil {
+		return "", err
+	}
+	declared := promptVars[p.Role]
+	for name := range vars {
+		if _, ok := declared[name]; !ok {
+			return "", fmt.Errorf("prompt %s: unknown variable %s", p.Role, name)
+		}
+	}
+	values := make(map[string]string, len(declared))
+	for name, kind := range declared {
+		value, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("prompt %s: missing variable %s", p.Role, name)
+		}
+		switch kind {
+		case varJSON:
+			if !json.Valid([]byte(value)) {
+				return "", fmt.Errorf("prompt %s: variable %s is not valid JSON", p.Role, name)
+			}
+		case varText:
+			quoted, _ := json.Marshal(value)
+			value = string(quoted)
+		}
+		values[name] = value
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(p.Template, -1) {
+		b.WriteString(p.Template[last:m[0]])
+		b.WriteString(values[p.Template[m[2]:m[3]]])
+		last = m[1]
+	}
+	b.WriteString(p.Template[last:])
+	return b.String(), nil
+}
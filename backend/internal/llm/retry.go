@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures RetryClient.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per call, including the first; 1 disables retries
+	BaseDelay   time.Duration // Backoff before the first retry; doubles for each later one
+	MaxDelay    time.Duration // Longest single wait; a longer Retry-After ends the retries
+}
+
+// DefaultRetryPolicy is the retry policy used by Factory unless overridden.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// RetryEvent describes a failed attempt that is about to be retried, either
+// against the same model or, for a FallbackClient, the next one in its chain.
+type RetryEvent struct {
+	Provider    Provider
+	Model       string
+	Attempt     int           // The attempt that failed, from 1
+	MaxAttempts int           // Attempts allowed per call
+	Delay       time.Duration // Wait before the next attempt
+	Err         error         // Why the attempt failed
+	Fallback    string        // Set when failing over: the model tried next ("provider/model")
+}
+
+type retryObserverKey struct{}
+
+// WithRetryObserver returns a context that makes RetryClient and
+// FallbackClient report each retry made on its behalf to fn.
+func WithRetryObserver(ctx context.Context, fn func(RetryEvent)) context.Context {
+	return context.WithValue(ctx, retryObserverKey{}, fn)
+}
+
+func observeRetry(ctx context.Context, event RetryEvent) {
+	if fn, ok := ctx.Value(retryObserverKey{}).(func(RetryEvent)); ok && fn != nil {
+		fn(event)
+	}
+}
+
+// IsRetryable reports whether a failed call may succeed if repeated: rate
+// limits, overload and server errors, and transport failures. Cancellation,
+// an open circuit and client errors such as a bad API key are fatal.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrCircuitOpen):
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.retryable()
+	}
+	if errors.Is(err, ErrRateLimit) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (e *APIError) retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests,
+		e.StatusCode >= 500: // Includes Anthropic's 529 overloaded
+		return true
+	case e.StatusCode == 0: // Error reported inside a stream
+		switch e.Type {
+		case "overloaded_error", "api_error", "rate_limit_error", "server_error",
+			"UNAVAILABLE", "INTERNAL", "RESOURCE_EXHAUSTED":
+			return true
+		}
+	}
+	return false
+}
+
+// RetryClient decorates a Client with retries: retryable failures are
+// repeated with exponential backoff and jitter, honoring the provider's
+// Retry-After, and a shared CircuitBreaker stops calls to a provider that
+// keeps failing. It implements StreamingClient whether or not the decorated
+// client does.
+type RetryClient struct {
+	inner   Client
+	policy  RetryPolicy
+	breaker *CircuitBreaker // May be nil
+
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+// NewRetryClient wraps inner with the given retry policy and circuit breaker
+// (which may be nil).
+func NewRetryClient(inner Client, policy RetryPolicy, breaker *CircuitBreaker) *RetryClient {
+	return &RetryClient{
+		inner:   inner,
+		policy:  policy,
+		breaker: breaker,
+		sleep:   sleepContext,
+		jitter:  equalJitter,
+	}
+}
+
+func (c *RetryClient) Provider() Provider { return c.inner.Provider() }
+func (c *RetryClient) Model() string      { return c.inner.Model() }
+
+// Unwrap returns the decorated client.
+func (c *RetryClient) Unwrap() Client { return c.inner }
+
+// Complete sends a completion request, retrying transient failures.
+func (c *RetryClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	return c.do(ctx, func() (*Response, error) {
+		return c.inner.Complete(ctx, req)
+	})
+}
+
+// CompleteStream streams a completion, retrying transient failures. A retried
+// stream starts over, so onDelta sees the new attempt's output from the
+// beginning; the context's retry observer is called first.
+func (c *RetryClient) CompleteStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	streaming, ok := c.inner.(StreamingClient)
+	if !ok {
+		return c.Complete(ctx, req)
+	}
+	return c.do(ctx, func() (*Response, error) {
+		return streaming.CompleteStream(ctx, req, onDelta)
+	})
+}
+
+func (c *RetryClient) do(ctx context.Context, call func() (*Response, error)) (*Response, error) {
+	maxAttempts := max(c.policy.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.Allow(c.Provider()); err != nil {
+			return nil, err
+		}
+
+		resp, err := call()
+		c.breaker.Record(c.Provider(), err)
+		if err == nil {
+			return resp, nil
+		}
+		if !IsRetryable(err) || attempt >= maxAttempts {
+			if attempt > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return nil, err
+		}
+
+		delay, ok := c.backoff(attempt, err)
+		if !ok {
+			return nil, err
+		}
+		log.Printf("LLM: %s/%s attempt %d of %d failed: %v; retrying in %s",
+			c.Provider(), c.Model(), attempt, maxAttempts, err, delay.Round(time.Millisecond))
+		observeRetry(ctx, RetryEvent{
+			Provider:    c.Provider(),
+			Model:       c.Model(),
+			Attempt:     attempt,
+			MaxAttempts: maxAttempts,
+			Delay:       delay,
+			Err:         err,
+		})
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the wait after a failed attempt: the provider's Retry-After
+// if it sent one, else exponential backoff with jitter. It reports false if
+// Retry-After asks for a longer wait than the policy allows.
+func (c *RetryClient) backoff(attempt int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if c.policy.MaxDelay > 0 && apiErr.RetryAfter > c.policy.MaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	delay := c.policy.BaseDelay << (attempt - 1)
+	if c.policy.MaxDelay > 0 && (delay > c.policy.MaxDelay || delay < c.policy.BaseDelay) {
+		delay = c.policy.MaxDelay // Also catches overflow
+	}
+	return c.jitter(delay), true
+}
+
+// equalJitter returns a random duration between d/2 and d, so concurrent
+// callers that failed together don't retry in lockstep.
+func equalJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Ensure RetryClient implements StreamingClient
+var _ StreamingClient = (*RetryClient)(nil)
@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyClient fails with each of errs in turn, then succeeds.
+type flakyClient struct {
+	errs  []error
+	calls int
+}
+
+func (c *flakyClient) Complete(ctx context.Context, req Request) (*Response, error) {
+	c.calls++
+	if c.calls <= len(c.errs) {
+		return nil, c.errs[c.calls-1]
+	}
+	return &Response{Content: "ok", Model: "flaky-model"}, nil
+}
+
+func (c *flakyClient) Provider() Provider { return "flaky" }
+func (c *flakyClient) Model() string      { return "flaky-model" }
+
+// newTestRetryClient returns a RetryClient that records its waits instead of sleeping.
+func newTestRetryClient(inner Client, policy RetryPolicy, breaker *CircuitBreaker) (*RetryClient, *[]time.Duration) {
+	var waits []time.Duration
+	c := NewRetryClient(inner, policy, breaker)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	c.jitter = func(d time.Duration) time.Duration { return d }
+	return c, &waits
+}
+
+func TestRetryClientRetriesTransientErrors(t *testing.T) {
+	inner := &flakyClient{errs: []error{
+		&APIError{Provider: "flaky", StatusCode: http.StatusServiceUnavailable},
+		fmt.Errorf("send request: %w", &netTimeout{}),
+	}}
+	client, waits := newTestRetryClient(inner, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}, nil)
+
+	var events []RetryEvent
+	ctx := WithRetryObserver(context.Background(), func(e RetryEvent) { events = append(events, e) })
+	resp, err := client.Complete(ctx, Request{})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Content != "ok" || inner.calls != 3 {
+		t.Errorf("content = %q after %d calls, want ok after 3", resp.Content, inner.calls)
+	}
+
+	// Exponential backoff: 1s, then 2s
+	if len(*waits) != 2 || (*waits)[0] != time.Second || (*waits)[1] != 2*time.Second {
+		t.Errorf("waits = %v, want [1s 2s]", *waits)
+	}
+	if len(events) != 2 || events[0].Attempt != 1 || events[1].Attempt != 2 || events[1].MaxAttempts != 3 {
+		t.Errorf("retry events = %+v, want attempts 1 and 2 of 3", events)
+	}
+}
+
+func TestRetryClientStopsOnFatalError(t *testing.T) {
+	inner := &flakyClient{errs: []error{&APIError{Provider: "flaky", StatusCode: http.StatusUnauthorized, Message: "bad key"}}}
+	client, waits := newTestRetryClient(inner, DefaultRetryPolicy, nil)
+
+	_, err := client.Complete(context.Background(), Request{})
+	if !errors.Is(err, ErrProviderError) || !strings.Contains(err.Error(), "bad key") {
+		t.Errorf("err = %v, want the provider error", err)
+	}
+	if inner.calls != 1 || len(*waits) != 0 {
+		t.Errorf("calls = %d, waits = %v; want a single attempt", inner.calls, *waits)
+	}
+}
+
+func TestRetryClientGivesUp(t *testing.T) {
+	fail := &APIError{Provider: "flaky", StatusCode: http.StatusInternalServerError}
+	inner := &flakyClient{errs: []error{fail, fail, fail, fail}}
+	client, waits := newTestRetryClient(inner, RetryPolicy{MaxAttempts: 3, BaseDelay: 20 * time.Second, MaxDelay: 30 * time.Second}, nil)
+
+	_, err := client.Complete(context.Background(), Request{})
+	if !errors.Is(err, ErrProviderError) || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("err = %v, want provider error after 3 attempts", err)
+	}
+	if inner.calls != 3 {
+		t.Errorf("calls = %d, want 3", inner.calls)
+	}
+	// The second backoff (40s) is capped at MaxDelay
+	if len(*waits) != 2 || (*waits)[1] != 30*time.Second {
+		t.Errorf("waits = %v, want [20s 30s]", *waits)
+	}
+}
+
+func TestRetryClientHonorsRetryAfter(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error": {"type": "rate_limit_error", "message": "slow down"}}`)
+			return
+		}
+		io.WriteString(w, `{"model": "gpt-test", "choices": [{"message": {"content": "{}"}}]}`)
+	}))
+	defer srv.Close()
+
+	inner := NewOpenAIClient("key", "gpt-test")
+	inner.endpoint = srv.URL
+	client, waits := newTestRetryClient(inner, DefaultRetryPolicy, nil)
+
+	resp, err := client.Complete(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Content != "{}" || calls != 2 {
+		t.Errorf("content = %q after %d calls, want {} after 2", resp.Content, calls)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+		t.Errorf("waits = %v, want [7s] from Retry-After", *waits)
+	}
+
+	// A Retry-After longer than MaxDelay ends the retries
+	inner2 := &flakyClient{errs: []error{&APIError{Provider: "flaky", StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}}}
+	client2, _ := newTestRetryClient(inner2, DefaultRetryPolicy, nil)
+	if _, err := client2.Complete(context.Background(), Request{}); !errors.Is(err, ErrRateLimit) || inner2.calls != 1 {
+		t.Errorf("err = %v after %d calls, want ErrRateLimit after 1", err, inner2.calls)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	transient := &APIError{Provider: "flaky", StatusCode: http.StatusBadGateway}
+	fatal := &APIError{Provider: "flaky", StatusCode: http.StatusBadRequest}
+
+	breaker.Record("flaky", transient)
+	breaker.Record("flaky", fatal) // Fatal errors don't count against the provider
+	if err := breaker.Allow("flaky"); err != nil {
+		t.Fatalf("Allow() after one failure = %v, want nil", err)
+	}
+	breaker.Record("flaky", transient)
+	if err := breaker.Allow("flaky"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() after two failures = %v, want ErrCircuitOpen", err)
+	}
+	if err := breaker.Allow("other"); err != nil {
+		t.Errorf("Allow(other) = %v, want providers tracked separately", err)
+	}
+
+	// After the cooldown a single trial call is let through
+	now = now.Add(time.Minute)
+	if err := breaker.Allow("flaky"); err != nil {
+		t.Fatalf("Allow() after cooldown = %v, want trial call", err)
+	}
+	if err := breaker.Allow("flaky"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow() during trial = %v, want ErrCircuitOpen", err)
+	}
+	breaker.Record("flaky", transient) // Failed trial reopens the circuit
+	if !breaker.Open("flaky") {
+		t.Error("circuit closed after failed trial")
+	}
+
+	now = now.Add(time.Minute)
+	if err := breaker.Allow("flaky"); err != nil {
+		t.Fatalf("Allow() after second cooldown = %v", err)
+	}
+	breaker.Record("flaky", nil)
+	if breaker.Open("flaky") {
+		t.Error("circuit still open after successful trial")
+	}
+
+	// An open circuit fails RetryClient calls fast
+	breaker.Record("flaky", transient)
+	breaker.Record("flaky", transient)
+	inner := &flakyClient{}
+	client, _ := newTestRetryClient(inner, DefaultRetryPolicy, breaker)
+	if _, err := client.Complete(context.Background(), Request{}); !errors.Is(err, ErrCircuitOpen) || inner.calls != 0 {
+		t.Errorf("err = %v after %d calls, want ErrCircuitOpen without calling", err, inner.calls)
+	}
+}
+
+// netTimeout is a net.Error for transport failures.
+type netTimeout struct{}
+
+func (netTimeout) Error() string   { return "i/o timeout" }
+func (netTimeout) Timeout() bool   { return true }
+func (netTimeout) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limit", &APIError{StatusCode: 429}, true},
+		{"overloaded", &APIError{StatusCode: 529}, true},
+		{"server error", fmt.Errorf("llm call: %w", &APIError{StatusCode: 502}), true},
+		{"stream overload", &APIError{Type: "overloaded_error"}, true},
+		{"transport", fmt.Errorf("send request: %w", &netTimeout{}), true},
+		{"truncated body", fmt.Errorf("read stream: %w", io.ErrUnexpectedEOF), true},
+		{"bad request", &APIError{StatusCode: 400}, false},
+		{"unauthorized", &APIError{StatusCode: 401}, false},
+		{"invalid response", ErrInvalidResponse, false},
+		{"canceled", fmt.Errorf("send request: %w", context.Canceled), false},
+		{"circuit open", fmt.Errorf("%w: flaky", ErrCircuitOpen), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
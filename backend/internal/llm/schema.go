@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Schema describes the JSON document a request expects back. Clients pass it
+// to their provider's structured-output feature so the model is constrained
+// to valid JSON of that shape rather than relying on prompt instructions.
+type Schema struct {
+	Name string          // Identifier for the response shape, e.g. "planner_output" (letters, digits, '_' and '-')
+	JSON json.RawMessage // JSON Schema of the response; the root must be an object
+}
+
+// name returns the schema's name, or "response" if it has none.
+func (s *Schema) name() string {
+	if s.Name == "" {
+		return "response"
+	}
+	return s.Name
+}
+
+// geminiFormats are the string formats Gemini's responseSchema accepts.
+var geminiFormats = map[string]bool{"date-time": true, "int32": true, "int64": true, "float": true, "double": true}
+
+// geminiSchema converts a JSON Schema to the OpenAPI subset accepted by
+// Gemini's responseSchema: local $refs are inlined, type unions with null
+// become nullable, and unsupported keywords are dropped. It fails for schemas
+// the subset can't express, such as recursive definitions or objects without
+// declared properties.
+func geminiSchema(schema json.RawMessage) (map[string]any, error) {
+	var root map[string]any
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	c := geminiConverter{defs: make(map[string]any)}
+	for _, key := range []string{"$defs", "definitions"} {
+		defs, _ := root[key].(map[string]any)
+		for name, def := range defs {
+			c.defs["#/"+key+"/"+name] = def
+		}
+	}
+	return c.convert(root, "")
+}
+
+type geminiConverter struct {
+	defs  map[string]any // Definitions by $ref, e.g. "#/$defs/Product"
+	stack []string       // $refs being inlined, to detect recursion
+}
+
+func (c *geminiConverter) convert(node map[string]any, path string) (map[string]any, error) {
+	if ref, ok := node["$ref"].(string); ok {
+		if slices.Contains(c.stack, ref) {
+			return nil, fmt.Errorf("%s: recursive reference %s", path, ref)
+		}
+		def, ok := c.defs[ref].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: unresolved reference %s", path, ref)
+		}
+		c.stack = append(c.stack, ref)
+		out, err := c.convert(def, path)
+		c.stack = c.stack[:len(c.stack)-1]
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := node["description"].(string); ok {
+			out["description"] = d
+		}
+		return out, nil
+	}
+
+	out := make(map[string]any)
+	switch t := node["type"].(type) {
+	case string:
+		out["type"] = strings.ToUpper(t)
+	case []any:
+		for _, v := range t {
+			name, _ := v.(string)
+			if name == "null" {
+				out["nullable"] = true
+				continue
+			}
+			if _, ok := out["type"]; ok {
+				return nil, fmt.Errorf("%s: type union %v", path, t)
+			}
+			out["type"] = strings.ToUpper(name)
+		}
+	}
+
+	for _, key := range []string{"description", "minItems", "maxItems", "minimum", "maximum", "required"} {
+		if v, ok := node[key]; ok {
+			out[key] = v
+		}
+	}
+	if f, ok := node["format"].(string); ok && geminiFormats[f] {
+		out["format"] = f
+	}
+	if v, ok := node["const"]; ok {
+		out["enum"] = []any{v}
+	} else if v, ok := node["enum"].([]any); ok {
+		out["enum"] = v
+	}
+	if enum, ok := out["enum"].([]any); ok {
+		// Only string enums are supported
+		for _, v := range enum {
+			if _, ok := v.(string); !ok {
+				delete(out, "enum")
+				break
+			}
+		}
+	}
+
+	if props, ok := node["properties"].(map[string]any); ok && len(props) > 0 {
+		converted := make(map[string]any, len(props))
+		for _, name := range slices.Sorted(maps.Keys(props)) {
+			prop, _ := props[name].(map[string]any)
+			s, err := c.convert(prop, path+"/"+name)
+			if err != nil {
+				return nil, err
+			}
+			converted[name] = s
+		}
+		out["properties"] = converted
+	} else if out["type"] == "OBJECT" {
+		return nil, fmt.Errorf("%s: object without declared properties", path)
+	}
+
+	if items, ok := node["items"].(map[string]any); ok {
+		s, err := c.convert(items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		out["items"] = s
+	}
+
+	for _, key := range []string{"anyOf", "oneOf"} {
+		variants, ok := node[key].([]any)
+		if !ok {
+			continue
+		}
+		converted := make([]any, 0, len(variants))
+		for i, v := range variants {
+			variant, _ := v.(map[string]any)
+			s, err := c.convert(variant, fmt.Sprintf("%s/%s/%d", path, key, i))
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, s)
+		}
+		out["anyOf"] = converted
+	}
+	if _, ok := node["allOf"]; ok {
+		return nil, fmt.Errorf("%s: allOf is not supported", path)
+	}
+
+	return out, nil
+}
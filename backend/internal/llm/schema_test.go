@@ -0,0 +1,184 @@
+package llm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{"type": "object", "required": ["answer"], "properties": {"answer": {"type": "string"}}}`
+
+func TestGeminiSchema(t *testing.T) {
+	got, err := geminiSchema(json.RawMessage(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["product", "tags"],
+		"properties": {
+			"product": {"$ref": "#/$defs/Product", "description": "The product"},
+			"tags": {"type": ["array", "null"], "items": {"type": "string", "minLength": 1}},
+			"kind": {"const": "spec"},
+			"value": {"oneOf": [{"type": "string", "format": "uri"}, {"type": "integer", "format": "int64"}]}
+		},
+		"$defs": {
+			"Product": {"type": "object", "properties": {"name": {"type": "string", "enum": ["a", "b"]}}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("geminiSchema() error = %v", err)
+	}
+
+	var want map[string]any
+	json.Unmarshal([]byte(`{
+		"type": "OBJECT",
+		"required": ["product", "tags"],
+		"properties": {
+			"product": {"type": "OBJECT", "description": "The product", "properties": {"name": {"type": "STRING", "enum": ["a", "b"]}}},
+			"tags": {"type": "ARRAY", "nullable": true, "items": {"type": "STRING"}},
+			"kind": {"enum": ["spec"]},
+			"value": {"anyOf": [{"type": "STRING"}, {"type": "INTEGER", "format": "int64"}]}
+		}
+	}`), &want)
+	gotJSON, _ := json.Marshal(got)
+	var gotMap map[string]any
+	json.Unmarshal(gotJSON, &gotMap)
+	if !reflect.DeepEqual(gotMap, want) {
+		t.Errorf("geminiSchema() = %s", gotJSON)
+	}
+
+	for name, schema := range map[string]string{
+		"free-form object": `{"type": "object", "properties": {"body": {"type": "object", "additionalProperties": true}}}`,
+		"recursion":        `{"$ref": "#/$defs/Node", "$defs": {"Node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/Node"}}}}}}`,
+		"unresolved":       `{"type": "object", "properties": {"a": {"$ref": "other.json"}}}`,
+	} {
+		if _, err := geminiSchema(json.RawMessage(schema)); err == nil {
+			t.Errorf("%s: geminiSchema() error = nil, want unsupported", name)
+		}
+	}
+}
+
+func TestCompleteWithSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		client   func(url string) Client
+		check    func(t *testing.T, body map[string]any)
+	}{
+		{
+			name:     "openai",
+			response: `{"model":"gpt-test","choices":[{"message":{"content":"{\"answer\":\"42\"}"},"finish_reason":"stop"}]}`,
+			client: func(url string) Client {
+				c := NewOpenAIClient("key", "gpt-test")
+				c.endpoint = url
+				return c
+			},
+			check: func(t *testing.T, body map[string]any) {
+				format, _ := body["response_format"].(map[string]any)
+				schema, _ := format["json_schema"].(map[string]any)
+				if format["type"] != "json_schema" || schema["name"] != "answer_output" || schema["schema"] == nil {
+					t.Errorf("response_format = %v, want json_schema answer_output", body["response_format"])
+				}
+			},
+		},
+		{
+			name:     "anthropic",
+			response: `{"content":[{"type":"tool_use","name":"answer_output","input":{"answer":"42"}}],"stop_reason":"tool_use"}`,
+			client: func(url string) Client {
+				c := NewAnthropicClient("key", "claude-test")
+				c.endpoint = url
+				return c
+			},
+			check: func(t *testing.T, body map[string]any) {
+				tools, _ := body["tools"].([]any)
+				choice, _ := body["tool_choice"].(map[string]any)
+				if len(tools) != 1 || tools[0].(map[string]any)["input_schema"] == nil {
+					t.Errorf("tools = %v, want the schema as a tool input", body["tools"])
+				}
+				if choice["type"] != "tool" || choice["name"] != "answer_output" {
+					t.Errorf("tool_choice = %v, want the answer_output tool", body["tool_choice"])
+				}
+			},
+		},
+		{
+			name:     "gemini",
+			response: `{"candidates":[{"content":{"parts":[{"text":"{\"answer\":\"42\"}"}]},"finishReason":"STOP"}]}`,
+			client: func(url string) Client {
+				c := NewGeminiClient("key", "gemini-test")
+				c.baseURL = url
+				return c
+			},
+			check: func(t *testing.T, body map[string]any) {
+				config, _ := body["generationConfig"].(map[string]any)
+				schema, _ := config["responseSchema"].(map[string]any)
+				if schema["type"] != "OBJECT" {
+					t.Errorf("generationConfig = %v, want an OBJECT responseSchema", config)
+				}
+			},
+		},
+		{
+			name:     "ollama",
+			response: `{"model":"llama-test","message":{"role":"assistant","content":"{\"answer\":\"42\"}"},"done":true,"done_reason":"stop"}`,
+			client: func(url string) Client {
+				return NewOllamaClient(OllamaConfig{Host: url}, "llama-test")
+			},
+			check: func(t *testing.T, body map[string]any) {
+				if format, _ := body["format"].(map[string]any); format["type"] != "object" {
+					t.Errorf("format = %v, want the schema", body["format"])
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(data, &body); err != nil {
+					t.Errorf("request body %s: %v", data, err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tt.response)
+			}))
+			defer srv.Close()
+
+			resp, err := tt.client(srv.URL).Complete(streamContext(t), Request{
+				Messages: []Message{{Role: "user", Content: "answer"}},
+				Schema:   &Schema{Name: "answer_output", JSON: json.RawMessage(testSchema)},
+			})
+			if err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			if got := strings.ReplaceAll(resp.Content, " ", ""); got != `{"answer":"42"}` {
+				t.Errorf("content = %q, want the structured output", resp.Content)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestAnthropicStreamToolInput(t *testing.T) {
+	body := sseBody("message_start", `{"type":"message_start","message":{"usage":{"input_tokens":5,"output_tokens":1}}}`) +
+		sseBody("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","name":"answer_output","input":{}}}`) +
+		sseBody("content_block_delta",
+			`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"answer\": "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"42\"}"}}`) +
+		sseBody("message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":6}}`)
+	srv := standIn(t, "/v1/messages", "text/event-stream", body)
+
+	c := NewAnthropicClient("key", "claude-test")
+	c.endpoint = srv.URL + "/v1/messages"
+	resp, err := c.CompleteStream(streamContext(t), Request{
+		Schema: &Schema{Name: "answer_output", JSON: json.RawMessage(testSchema)},
+	}, nil)
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+	if want := `{"answer": "42"}`; resp.Content != want {
+		t.Errorf("content = %q, want %q", resp.Content, want)
+	}
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxStreamLine bounds a single line of a streamed response.
+const maxStreamLine = 4 * 1024 * 1024
+
+// readSSE reads a server-sent event stream, calling fn with each event's type
+// and data. It stops at the end of the stream or when fn returns an error.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment (keep-alive)
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return dispatch()
+}
+
+// readLines calls fn with each non-empty line of a newline-delimited JSON stream.
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return nil
+}
+
+// checkStreamStatus returns an APIError for a non-200 streaming response.
+func checkStreamStatus(provider Provider, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return newAPIError(provider, resp, body)
+}
+
+// streamAccumulator collects streamed output and forwards it as deltas.
+type streamAccumulator struct {
+	onDelta StreamFunc
+	content strings.Builder
+	tokens  int
+}
+
+// add records a chunk of output. reported is the provider's running output
+// token count, or 0 if it doesn't report one; then each chunk counts as a token.
+func (a *streamAccumulator) add(text string, reported int) {
+	tokens := a.tokens
+	if reported > 0 {
+		tokens = reported
+	} else if text != "" {
+		tokens++
+	}
+	if text == "" && tokens == a.tokens {
+		return
+	}
+	a.content.WriteString(text)
+	a.tokens = tokens
+	if a.onDelta != nil {
+		a.onDelta(StreamDelta{Text: text, OutputTokens: tokens})
+	}
+}
+
+// Ensure the provider clients implement StreamingClient
+var (
+	_ StreamingClient = (*AnthropicClient)(nil)
+	_ StreamingClient = (*OpenAIClient)(nil)
+	_ StreamingClient = (*GeminiClient)(nil)
+	_ StreamingClient = (*OllamaClient)(nil)
+)
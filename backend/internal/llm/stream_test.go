@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseBody formats each event as a server-sent event with the given type.
+func sseBody(event string, data ...string) string {
+	var b strings.Builder
+	for _, d := range data {
+		if event != "" {
+			fmt.Fprintf(&b, "event: %s\n", event)
+		}
+		fmt.Fprintf(&b, "data: %s\n\n", d)
+	}
+	return b.String()
+}
+
+// standIn starts a server that checks the request path and stream flag,
+// then writes body in flushed chunks.
+func standIn(t *testing.T, wantPath, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.RequestURI(); got != wantPath {
+			t.Errorf("request path = %s, want %s", got, wantPath)
+		}
+		reqBody, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(wantPath, "/v1") || wantPath == "/api/chat" {
+			var req struct {
+				Stream bool `json:"stream"`
+			}
+			if err := json.Unmarshal(reqBody, &req); err != nil || !req.Stream {
+				t.Errorf("request body %s does not enable streaming", reqBody)
+			}
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		flusher := w.(http.Flusher)
+		for _, line := range strings.SplitAfter(body, "\n") {
+			io.WriteString(w, line)
+			flusher.Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func streamContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestCompleteStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		client      func(url string) StreamingClient
+		wantTokens  int
+		wantUsage   Usage
+	}{
+		{
+			name:        "anthropic",
+			path:        "/v1/messages",
+			contentType: "text/event-stream",
+			body: sseBody("message_start", `{"type":"message_start","message":{"usage":{"input_tokens":10,"cache_read_input_tokens":4,"output_tokens":1}}}`) +
+				sseBody("content_block_delta",
+					`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"{\"spec\": "}}`,
+					`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"{\"product\": {}}}"}}`) +
+				sseBody("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`) +
+				sseBody("message_stop", `{"type":"message_stop"}`),
+			client: func(url string) StreamingClient {
+				c := NewAnthropicClient("key", "claude-test")
+				c.endpoint = url + "/v1/messages"
+				return c
+			},
+			wantTokens: 7,
+			wantUsage:  Usage{InputTokens: 14, OutputTokens: 7, CachedTokens: 4, StopReason: "end_turn"},
+		},
+		{
+			name:        "openai",
+			path:        "/v1/chat/completions",
+			contentType: "text/event-stream",
+			body: sseBody("",
+				`{"model":"gpt-test","choices":[{"delta":{"content":"{\"spec\": "}}]}`,
+				`{"model":"gpt-test","choices":[{"delta":{"content":"{\"product\": {}}}"},"finish_reason":"stop"}]}`,
+				`{"model":"gpt-test","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":6,"prompt_tokens_details":{"cached_tokens":2}}}`,
+				`[DONE]`),
+			client: func(url string) StreamingClient {
+				c := NewOpenAIClient("key", "gpt-test")
+				c.endpoint = url + "/v1/chat/completions"
+				return c
+			},
+			wantTokens: 6,
+			wantUsage:  Usage{InputTokens: 12, OutputTokens: 6, CachedTokens: 2, StopReason: "stop"},
+		},
+		{
+			name:        "gemini",
+			path:        "/models/gemini-test:streamGenerateContent?alt=sse",
+			contentType: "text/event-stream",
+			body: sseBody("",
+				`{"candidates":[{"content":{"parts":[{"text":"{\"spec\": "}]}}],"usageMetadata":{"candidatesTokenCount":3}}`,
+				`{"candidates":[{"content":{"parts":[{"text":"{\"product\": {}}}"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":8}}`),
+			client: func(url string) StreamingClient {
+				c := NewGeminiClient("key", "gemini-test")
+				c.baseURL = url
+				return c
+			},
+			wantTokens: 8,
+			wantUsage:  Usage{InputTokens: 9, OutputTokens: 8, StopReason: "STOP"},
+		},
+		{
+			name:        "ollama",
+			path:        "/api/chat",
+			contentType: "application/x-ndjson",
+			body: `{"model":"llama-test","message":{"role":"assistant","content":"{\"spec\": "},"done":false}` + "\n" +
+				`{"model":"llama-test","message":{"role":"assistant","content":"{\"product\": {}}}"},"done":false}` + "\n" +
+				`{"model":"llama-test","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":5}` + "\n",
+			client: func(url string) StreamingClient {
+				return NewOllamaClient(OllamaConfig{Host: url}, "llama-test")
+			},
+			wantTokens: 5,
+			wantUsage:  Usage{InputTokens: 4, OutputTokens: 5, StopReason: "stop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := standIn(t, tt.path, tt.contentType, tt.body)
+			client := tt.client(srv.URL)
+
+			var deltas []StreamDelta
+			resp, err := client.CompleteStream(streamContext(t), Request{
+				Messages: []Message{{Role: "user", Content: "compile"}},
+			}, func(d StreamDelta) { deltas = append(deltas, d) })
+			if err != nil {
+				t.Fatalf("CompleteStream() error = %v", err)
+			}
+
+			if want := `{"spec": {"product": {}}}`; resp.Content != want {
+				t.Errorf("content = %q, want %q", resp.Content, want)
+			}
+			var text strings.Builder
+			for i, d := range deltas {
+				text.WriteString(d.Text)
+				if i > 0 && d.OutputTokens < deltas[i-1].OutputTokens {
+					t.Errorf("token count went down: %d after %d", d.OutputTokens, deltas[i-1].OutputTokens)
+				}
+			}
+			if text.String() != resp.Content {
+				t.Errorf("deltas = %q, want the full content", text.String())
+			}
+			if len(deltas) < 2 {
+				t.Errorf("got %d deltas, want incremental output", len(deltas))
+			} else if got := deltas[len(deltas)-1].OutputTokens; got != tt.wantTokens {
+				t.Errorf("final token count = %d, want %d", got, tt.wantTokens)
+			}
+
+			usage := resp.Usage
+			usage.Latency = 0
+			if usage != tt.wantUsage {
+				t.Errorf("usage = %+v, want %+v", usage, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestCompleteStreamErrors(t *testing.T) {
+	t.Run("rate limit", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		c := NewOpenAIClient("key", "gpt-test")
+		c.endpoint = srv.URL
+		if _, err := c.CompleteStream(streamContext(t), Request{}, nil); !errors.Is(err, ErrRateLimit) {
+			t.Errorf("err = %v, want ErrRateLimit", err)
+		}
+	})
+
+	t.Run("error event", func(t *testing.T) {
+		body := sseBody("error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+		srv := standIn(t, "/v1/messages", "text/event-stream", body)
+
+		c := NewAnthropicClient("key", "claude-test")
+		c.endpoint = srv.URL + "/v1/messages"
+		_, err := c.CompleteStream(streamContext(t), Request{}, nil)
+		if !errors.Is(err, ErrProviderError) || !strings.Contains(err.Error(), "Overloaded") {
+			t.Errorf("err = %v, want provider error with message", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		body := `{"message":{"content":"{\"spec\""},"done":false}` + "\n" +
+			`{"message":{"content":""},"done":true,"done_reason":"length","eval_count":1}` + "\n"
+		srv := standIn(t, "/api/chat", "application/x-ndjson", body)
+
+		c := NewOllamaClient(OllamaConfig{Host: srv.URL}, "llama-test")
+		if _, err := c.CompleteStream(streamContext(t), Request{}, nil); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("err = %v, want ErrInvalidResponse", err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"strings"
+)
+
+// DefaultContextWindow is the context window assumed for a model that isn't
+// in the context window table.
+const DefaultContextWindow = 8192
+
+// DefaultOllamaContextWindow is the context Ollama gives a model unless
+// SPECBUILDER_OLLAMA_NUM_CTX sets another, whatever the model itself supports.
+const DefaultOllamaContextWindow = 4096
+
+// ContextWindowTable maps model names to the size of their context window in
+// tokens, shared by the prompt and the response. Like a PriceTable, a model
+// matches the longest entry that is a prefix of its name.
+type ContextWindowTable map[string]int
+
+// DefaultContextWindows lists the context windows of the models the factory
+// offers. Ollama models have no entries, since Ollama serves them with its own
+// context size; set it with SPECBUILDER_OLLAMA_NUM_CTX.
+var DefaultContextWindows = ContextWindowTable{
+	// Anthropic
+	"claude-": 200000,
+
+	// Google
+	"gemini-2.5":       1048576,
+	"gemini-2.0":       1048576,
+	"gemini-1.5-pro":   2097152,
+	"gemini-1.5-flash": 1048576,
+
+	// OpenAI
+	"gpt-5":       400000,
+	"gpt-4.1":     1047576,
+	"gpt-4o":      128000,
+	"gpt-4-turbo": 128000,
+	"o1":          200000,
+	"o1-mini":     128000,
+	"o3":          200000,
+	"o4-mini":     200000,
+}
+
+// Lookup returns the context window of model.
+func (t ContextWindowTable) Lookup(model string) (int, bool) {
+	model = strings.TrimPrefix(model, "models/") // Gemini's resource names
+	var best string
+	var window int
+	for prefix, w := range t {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, window = prefix, w
+		}
+	}
+	return window, best != ""
+}
+
+// Estimator returns the token estimator of a provider's model.
+func (t ContextWindowTable) Estimator(provider Provider, model string) TokenEstimator {
+	window, ok := t.Lookup(model)
+	switch {
+	case ok:
+	case provider == ProviderOllama:
+		window = DefaultOllamaContextWindow
+	default:
+		window = DefaultContextWindow
+	}
+	return TokenEstimator{ContextWindow: window, BytesPerToken: bytesPerToken(provider)}
+}
+
+// bytesPerToken is the average number of bytes per token of a provider's
+// tokenizers on prompts, which are mostly JSON. It errs low, so estimates err
+// high, for providers whose models use many different tokenizers.
+func bytesPerToken(provider Provider) float64 {
+	switch provider {
+	case ProviderOpenAI, ProviderGoogle:
+		return 3.5
+	case ProviderAnthropic:
+		return 3.2
+	default:
+		return 3
+	}
+}
+
+// TokenEstimator estimates how many tokens a model reads, without running its
+// tokenizer.
+type TokenEstimator struct {
+	ContextWindow int     // Tokens the model can read and write in one call
+	BytesPerToken float64 // Average bytes per token of the model's tokenizer
+}
+
+// Estimate returns the estimated number of tokens in text.
+func (e TokenEstimator) Estimate(text string) int {
+	return int(math.Ceil(float64(len(text)) / e.BytesPerToken))
+}
+
+// messageOverhead is the estimated number of tokens a chat format adds to
+// each message for its role and delimiters.
+const messageOverhead = 4
+
+// EstimateMessages returns the estimated number of prompt tokens of messages.
+func (e TokenEstimator) EstimateMessages(messages []Message) int {
+	n := 0
+	for _, m := range messages {
+		n += messageOverhead + e.Estimate(m.Content)
+	}
+	return n
+}
+
+// loadContextWindows returns DefaultContextWindows with overrides from
+// SPECBUILDER_LLM_CONTEXT_WINDOWS: a JSON object mapping model names (or
+// prefixes) to context windows in tokens, given inline or as the path of a
+// JSON file.
+func loadContextWindows(value string) (ContextWindowTable, error) {
+	table := maps.Clone(DefaultContextWindows)
+	var overrides ContextWindowTable
+	if err := readOverrides(value, &overrides); err != nil {
+		return nil, fmt.Errorf("context windows: %w", err)
+	}
+	maps.Copy(table, overrides)
+	return table, nil
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContextWindowEstimator(t *testing.T) {
+	tests := []struct {
+		provider Provider
+		model    string
+		want     int
+	}{
+		{ProviderAnthropic, "claude-sonnet-4-20250514", 200000},
+		{ProviderOpenAI, "gpt-4o-mini", 128000},
+		{ProviderOpenAI, "o1-mini-2024-09-12", 128000},
+		{ProviderGoogle, "models/gemini-2.5-flash", 1048576},
+		{ProviderOllama, "llama3.2", DefaultOllamaContextWindow},
+		{ProviderOpenAICompatible, "my-model", DefaultContextWindow},
+	}
+	for _, tt := range tests {
+		if got := DefaultContextWindows.Estimator(tt.provider, tt.model).ContextWindow; got != tt.want {
+			t.Errorf("Estimator(%s, %s).ContextWindow = %d, want %d", tt.provider, tt.model, got, tt.want)
+		}
+	}
+
+	est := TokenEstimator{ContextWindow: 1000, BytesPerToken: 4}
+	if got := est.Estimate("123456789"); got != 3 {
+		t.Errorf("Estimate(9 bytes) = %d, want 3", got)
+	}
+	if got := est.EstimateMessages([]Message{{Role: "system", Content: "1234"}, {Role: "user", Content: ""}}); got != 1+2*messageOverhead {
+		t.Errorf("EstimateMessages() = %d, want %d", got, 1+2*messageOverhead)
+	}
+}
+
+func TestLoadContextWindows(t *testing.T) {
+	table, err := loadContextWindows(`{"llama3.2": 131072, "gpt-4o": 64000}`)
+	if err != nil {
+		t.Fatalf("loadContextWindows() error = %v", err)
+	}
+	if got := table.Estimator(ProviderOllama, "llama3.2:3b").ContextWindow; got != 131072 {
+		t.Errorf("llama3.2:3b window = %d, want the override", got)
+	}
+	if w, _ := table.Lookup("gpt-4o"); w != 64000 {
+		t.Errorf("gpt-4o window = %d, want the override", w)
+	}
+	if DefaultContextWindows["gpt-4o"] == 64000 {
+		t.Error("override modified DefaultContextWindows")
+	}
+
+	path := filepath.Join(t.TempDir(), "windows.json")
+	if err := os.WriteFile(path, []byte(`{"file-model": 32000}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if table, err := loadContextWindows(path); err != nil || table["file-model"] != 32000 {
+		t.Errorf("loadContextWindows(file) = %v, %v; want the file's windows", table["file-model"], err)
+	}
+	if _, err := loadContextWindows("{not json"); err == nil {
+		t.Error("loadContextWindows(invalid) succeeded")
+	}
+}
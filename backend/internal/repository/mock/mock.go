@@ -2,7 +2,10 @@ package mock
 
 import (
 	"context"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/dshills/specbuilder/backend/internal/domain"
 	"github.com/dshills/specbuilder/backend/internal/repository"
@@ -16,7 +19,12 @@ type Repository struct {
 	questions map[uuid.UUID]*domain.Question
 	answers   map[uuid.UUID]*domain.Answer
 	snapshots map[uuid.UUID]*domain.SpecSnapshot
+	snapSeq   map[uuid.UUID]int // Insertion order, breaks CreatedAt ties
 	issues    map[uuid.UUID]*domain.Issue
+	jobs      map[uuid.UUID]*domain.Job
+	jobEvents map[uuid.UUID][]*domain.JobEvent
+	llmCalls  []*domain.LLMCall
+	llmAudit  []*domain.LLMAuditEntry // In insertion order
 	closed    bool
 }
 
@@ -27,7 +35,10 @@ func New() *Repository {
 		questions: make(map[uuid.UUID]*domain.Question),
 		answers:   make(map[uuid.UUID]*domain.Answer),
 		snapshots: make(map[uuid.UUID]*domain.SpecSnapshot),
+		snapSeq:   make(map[uuid.UUID]int),
 		issues:    make(map[uuid.UUID]*domain.Issue),
+		jobs:      make(map[uuid.UUID]*domain.Job),
+		jobEvents: make(map[uuid.UUID][]*domain.JobEvent),
 	}
 }
 
@@ -67,6 +78,14 @@ func (r *Repository) DeleteProject(ctx context.Context, id uuid.UUID) error {
 		return domain.ErrNotFound
 	}
 	// Delete related data
+	r.llmCalls = slices.DeleteFunc(r.llmCalls, func(c *domain.LLMCall) bool { return c.ProjectID == id })
+	r.llmAudit = slices.DeleteFunc(r.llmAudit, func(e *domain.LLMAuditEntry) bool { return e.ProjectID == id })
+	for jobID, job := range r.jobs {
+		if job.ProjectID == id {
+			delete(r.jobs, jobID)
+			delete(r.jobEvents, jobID)
+		}
+	}
 	for issueID, issue := range r.issues {
 		if issue.ProjectID == id {
 			delete(r.issues, issueID)
@@ -104,18 +123,25 @@ func (r *Repository) UpdateProject(ctx context.Context, project *domain.Project)
 func (r *Repository) GetLatestSnapshotID(ctx context.Context, projectID uuid.UUID) (*uuid.UUID, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.latestSnapshotID(projectID), nil
+}
+
+// latestSnapshotID must be called with r.mu held.
+func (r *Repository) latestSnapshotID(projectID uuid.UUID) *uuid.UUID {
 	var latest *domain.SpecSnapshot
 	for _, s := range r.snapshots {
-		if s.ProjectID == projectID {
-			if latest == nil || s.CreatedAt.After(latest.CreatedAt) {
-				latest = s
-			}
+		if s.ProjectID != projectID {
+			continue
+		}
+		if latest == nil || s.CreatedAt.After(latest.CreatedAt) ||
+			(s.CreatedAt.Equal(latest.CreatedAt) && r.snapSeq[s.ID] > r.snapSeq[latest.ID]) {
+			latest = s
 		}
 	}
 	if latest == nil {
-		return nil, nil
+		return nil
 	}
-	return &latest.ID, nil
+	return &latest.ID
 }
 
 // Questions
@@ -275,7 +301,13 @@ func (r *Repository) GetLatestAnswersForProject(ctx context.Context, projectID u
 func (r *Repository) CreateSnapshot(ctx context.Context, snapshot *domain.SpecSnapshot) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	latest := r.latestSnapshotID(snapshot.ProjectID)
+	if (latest == nil) != (snapshot.ParentSnapshotID == nil) ||
+		(latest != nil && *latest != *snapshot.ParentSnapshotID) {
+		return domain.ErrConflict
+	}
 	r.snapshots[snapshot.ID] = snapshot
+	r.snapSeq[snapshot.ID] = len(r.snapSeq)
 	return nil
 }
 
@@ -326,6 +358,183 @@ func (r *Repository) ListIssuesForSnapshot(ctx context.Context, snapshotID uuid.
 	return result, nil
 }
 
+// Jobs (stored by value: the job runner updates jobs while handlers read them)
+
+func (r *Repository) CreateJob(ctx context.Context, job *domain.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := *job
+	r.jobs[job.ID] = &j
+	return nil
+}
+
+func (r *Repository) GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	cp := *j
+	return &cp, nil
+}
+
+func (r *Repository) UpdateJob(ctx context.Context, job *domain.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.jobs[job.ID]; !ok {
+		return domain.ErrNotFound
+	}
+	j := *job
+	r.jobs[job.ID] = &j
+	return nil
+}
+
+func (r *Repository) ListJobs(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*domain.Job
+	for _, j := range r.jobs {
+		if j.ProjectID == projectID {
+			cp := *j
+			result = append(result, &cp)
+		}
+	}
+	sort.Slice(result, func(i, k int) bool { return result[i].CreatedAt.After(result[k].CreatedAt) })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (r *Repository) ListUnfinishedJobs(ctx context.Context) ([]*domain.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*domain.Job
+	for _, j := range r.jobs {
+		if !j.Status.IsFinished() {
+			cp := *j
+			result = append(result, &cp)
+		}
+	}
+	return result, nil
+}
+
+func (r *Repository) CreateJobEvent(ctx context.Context, event *domain.JobEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := *event
+	r.jobEvents[event.JobID] = append(r.jobEvents[event.JobID], &e)
+	return nil
+}
+
+func (r *Repository) ListJobEvents(ctx context.Context, jobID uuid.UUID, afterSeq int) ([]*domain.JobEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*domain.JobEvent
+	for _, e := range r.jobEvents[jobID] {
+		if e.Seq > afterSeq {
+			cp := *e
+			result = append(result, &cp)
+		}
+	}
+	return result, nil
+}
+
+// LLM usage
+
+func (r *Repository) CreateLLMCall(ctx context.Context, call *domain.LLMCall) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *call
+	r.llmCalls = append(r.llmCalls, &c)
+	return nil
+}
+
+func (r *Repository) GetProjectUsage(ctx context.Context, projectID uuid.UUID) (*domain.ProjectUsage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	usage := &domain.ProjectUsage{
+		ProjectID: projectID,
+		ByRole:    []domain.RoleUsage{},
+		ByModel:   []domain.ModelUsage{},
+	}
+	for _, c := range r.llmCalls {
+		if c.ProjectID == projectID {
+			var totals domain.UsageTotals
+			totals.Add(c)
+			usage.Add(c.Role, c.Provider, c.Model, totals)
+		}
+	}
+	return usage, nil
+}
+
+func (r *Repository) GetSnapshotUsage(ctx context.Context, snapshotIDs []uuid.UUID) (map[uuid.UUID]domain.UsageTotals, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	usage := make(map[uuid.UUID]domain.UsageTotals)
+	for _, c := range r.llmCalls {
+		if c.SnapshotID != nil && slices.Contains(snapshotIDs, *c.SnapshotID) {
+			totals := usage[*c.SnapshotID]
+			totals.Add(c)
+			usage[*c.SnapshotID] = totals
+		}
+	}
+	return usage, nil
+}
+
+func (r *Repository) GetUsageSince(ctx context.Context, projectID *uuid.UUID, since time.Time) (domain.UsageTotals, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var totals domain.UsageTotals
+	for _, c := range r.llmCalls {
+		if (projectID == nil || c.ProjectID == *projectID) && !c.CreatedAt.Before(since) {
+			totals.Add(c)
+		}
+	}
+	return totals, nil
+}
+
+// LLM audit log
+
+func (r *Repository) CreateLLMAuditEntry(ctx context.Context, entry *domain.LLMAuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := *entry
+	r.llmAudit = append(r.llmAudit, &e)
+	return nil
+}
+
+func (r *Repository) ListLLMAuditEntries(ctx context.Context, projectID uuid.UUID, filter domain.LLMAuditFilter) ([]*domain.LLMAuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	var result []*domain.LLMAuditEntry
+	for i := len(r.llmAudit) - 1; i >= 0 && len(result) < limit; i-- {
+		e := r.llmAudit[i]
+		if e.ProjectID != projectID ||
+			(filter.SnapshotID != nil && (e.SnapshotID == nil || *e.SnapshotID != *filter.SnapshotID)) ||
+			(filter.QuestionID != nil && !slices.Contains(e.QuestionIDs, *filter.QuestionID)) ||
+			(filter.Role != "" && e.Role != filter.Role) ||
+			(filter.Outcome != "" && e.Outcome != filter.Outcome) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+func (r *Repository) DeleteLLMAuditEntriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.llmAudit)
+	r.llmAudit = slices.DeleteFunc(r.llmAudit, func(e *domain.LLMAuditEntry) bool { return e.CreatedAt.Before(before) })
+	return int64(n - len(r.llmAudit)), nil
+}
+
 // Transaction support (simplified for testing)
 
 func (r *Repository) WithTx(ctx context.Context, fn func(repository.Repository) error) error {
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/dshills/specbuilder/backend/internal/domain"
 	"github.com/google/uuid"
@@ -33,6 +34,8 @@ type Repository interface {
 	GetLatestAnswersForProject(ctx context.Context, projectID uuid.UUID) ([]*domain.Answer, error)
 
 	// Snapshots
+	// CreateSnapshot returns domain.ErrConflict if snapshot.ParentSnapshotID is
+	// not the project's latest snapshot (nil when the project has none).
 	CreateSnapshot(ctx context.Context, snapshot *domain.SpecSnapshot) error
 	GetSnapshot(ctx context.Context, id uuid.UUID) (*domain.SpecSnapshot, error)
 	ListSnapshots(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.SpecSnapshot, error)
@@ -41,6 +44,34 @@ type Repository interface {
 	CreateIssue(ctx context.Context, issue *domain.Issue) error
 	ListIssuesForSnapshot(ctx context.Context, snapshotID uuid.UUID) ([]*domain.Issue, error)
 
+	// Jobs
+	CreateJob(ctx context.Context, job *domain.Job) error
+	GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error)
+	UpdateJob(ctx context.Context, job *domain.Job) error
+	ListJobs(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.Job, error)
+	ListUnfinishedJobs(ctx context.Context) ([]*domain.Job, error)
+	CreateJobEvent(ctx context.Context, event *domain.JobEvent) error
+	ListJobEvents(ctx context.Context, jobID uuid.UUID, afterSeq int) ([]*domain.JobEvent, error)
+
+	// LLM usage
+	CreateLLMCall(ctx context.Context, call *domain.LLMCall) error
+	// GetProjectUsage totals a project's LLM calls, overall, by role and by
+	// model. ByRole and ByModel are sorted by role and by provider and model.
+	GetProjectUsage(ctx context.Context, projectID uuid.UUID) (*domain.ProjectUsage, error)
+	// GetSnapshotUsage totals the LLM calls of each snapshot that has any.
+	GetSnapshotUsage(ctx context.Context, snapshotIDs []uuid.UUID) (map[uuid.UUID]domain.UsageTotals, error)
+	// GetUsageSince totals the LLM calls made at or after since, for one
+	// project or, if projectID is nil, for all projects.
+	GetUsageSince(ctx context.Context, projectID *uuid.UUID, since time.Time) (domain.UsageTotals, error)
+
+	// LLM audit log
+	CreateLLMAuditEntry(ctx context.Context, entry *domain.LLMAuditEntry) error
+	// ListLLMAuditEntries lists a project's audit entries, newest first.
+	ListLLMAuditEntries(ctx context.Context, projectID uuid.UUID, filter domain.LLMAuditFilter) ([]*domain.LLMAuditEntry, error)
+	// DeleteLLMAuditEntriesBefore deletes the audit entries of every project
+	// created before the given time, and returns how many it deleted.
+	DeleteLLMAuditEntriesBefore(ctx context.Context, before time.Time) (int64, error)
+
 	// Transaction support
 	WithTx(ctx context.Context, fn func(Repository) error) error
 
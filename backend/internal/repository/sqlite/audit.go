@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+const auditColumns = `id, project_id, snapshot_id, question_ids, role, stage, provider, model, prompt_version,
+	messages, response, outcome, error, input_tokens, output_tokens, latency_ms, stop_reason, cache_hit, created_at`
+
+// LLM audit log
+
+func (r *SQLiteRepository) CreateLLMAuditEntry(ctx context.Context, e *domain.LLMAuditEntry) error {
+	return createLLMAuditEntry(ctx, r.db, e)
+}
+
+func (r *SQLiteRepository) ListLLMAuditEntries(ctx context.Context, projectID uuid.UUID, filter domain.LLMAuditFilter) ([]*domain.LLMAuditEntry, error) {
+	return listLLMAuditEntries(ctx, r.db, projectID, filter)
+}
+
+func (r *SQLiteRepository) DeleteLLMAuditEntriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	return deleteLLMAuditEntriesBefore(ctx, r.db, before)
+}
+
+func (t *txRepository) CreateLLMAuditEntry(ctx context.Context, e *domain.LLMAuditEntry) error {
+	return createLLMAuditEntry(ctx, t.tx, e)
+}
+
+func (t *txRepository) ListLLMAuditEntries(ctx context.Context, projectID uuid.UUID, filter domain.LLMAuditFilter) ([]*domain.LLMAuditEntry, error) {
+	return listLLMAuditEntries(ctx, t.tx, projectID, filter)
+}
+
+func (t *txRepository) DeleteLLMAuditEntriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	return deleteLLMAuditEntriesBefore(ctx, t.tx, before)
+}
+
+func createLLMAuditEntry(ctx context.Context, db dbtx, e *domain.LLMAuditEntry) error {
+	questionIDs, err := json.Marshal(convertUUIDsToStrings(e.QuestionIDs))
+	if err != nil {
+		return err
+	}
+	messages, err := json.Marshal(e.Messages)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO llm_audit (`+auditColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID.String(), e.ProjectID.String(), nullableUUID(e.SnapshotID), string(questionIDs),
+		string(e.Role), e.Stage, e.Provider, e.Model, e.PromptVersion,
+		string(messages), e.Response, string(e.Outcome), e.Error,
+		e.InputTokens, e.OutputTokens, e.LatencyMs, e.StopReason, e.CacheHit,
+		e.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func listLLMAuditEntries(ctx context.Context, db dbtx, projectID uuid.UUID, filter domain.LLMAuditFilter) ([]*domain.LLMAuditEntry, error) {
+	query := `SELECT ` + auditColumns + ` FROM llm_audit WHERE project_id = ?`
+	args := []interface{}{projectID.String()}
+	if filter.SnapshotID != nil {
+		query += ` AND snapshot_id = ?`
+		args = append(args, filter.SnapshotID.String())
+	}
+	if filter.QuestionID != nil {
+		query += ` AND EXISTS (SELECT 1 FROM json_each(question_ids) WHERE value = ?)`
+		args = append(args, filter.QuestionID.String())
+	}
+	if filter.Role != "" {
+		query += ` AND role = ?`
+		args = append(args, string(filter.Role))
+	}
+	if filter.Outcome != "" {
+		query += ` AND outcome = ?`
+		args = append(args, string(filter.Outcome))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	query += ` ORDER BY created_at DESC, rowid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*domain.LLMAuditEntry
+	for rows.Next() {
+		e, err := scanLLMAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func scanLLMAuditEntry(rows *sql.Rows) (*domain.LLMAuditEntry, error) {
+	var e domain.LLMAuditEntry
+	var idStr, projStr, questionIDsStr, roleStr, messagesStr, outcomeStr, createdStr string
+	var snapshotStr sql.NullString
+	if err := rows.Scan(&idStr, &projStr, &snapshotStr, &questionIDsStr, &roleStr, &e.Stage, &e.Provider, &e.Model,
+		&e.PromptVersion, &messagesStr, &e.Response, &outcomeStr, &e.Error,
+		&e.InputTokens, &e.OutputTokens, &e.LatencyMs, &e.StopReason, &e.CacheHit, &createdStr); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if e.ID, err = uuid.Parse(idStr); err != nil {
+		return nil, err
+	}
+	if e.ProjectID, err = uuid.Parse(projStr); err != nil {
+		return nil, err
+	}
+	if snapshotStr.Valid {
+		id, err := uuid.Parse(snapshotStr.String)
+		if err != nil {
+			return nil, err
+		}
+		e.SnapshotID = &id
+	}
+	var questionIDs []string
+	if err := json.Unmarshal([]byte(questionIDsStr), &questionIDs); err != nil {
+		return nil, err
+	}
+	e.QuestionIDs = make([]uuid.UUID, 0, len(questionIDs))
+	for _, s := range questionIDs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		e.QuestionIDs = append(e.QuestionIDs, id)
+	}
+	if err := json.Unmarshal([]byte(messagesStr), &e.Messages); err != nil {
+		return nil, err
+	}
+	e.Role = domain.LLMRole(roleStr)
+	e.Outcome = domain.LLMCallOutcome(outcomeStr)
+	if e.CreatedAt, err = time.Parse(time.RFC3339, createdStr); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func deleteLLMAuditEntriesBefore(ctx context.Context, db dbtx, before time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM llm_audit WHERE created_at < ?`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LLM response cache. These methods make the repository an llm.CacheStore;
+// they aren't part of repository.Repository since only the LLM factory uses
+// them.
+
+// GetCachedResponse returns the cached value for key unless it is missing or
+// has expired.
+func (r *SQLiteRepository) GetCachedResponse(ctx context.Context, key string, now time.Time) ([]byte, bool, error) {
+	var value string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT value FROM llm_cache WHERE key = ? AND expires_at > ?`,
+		key, now.UTC().Format(time.RFC3339)).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(value), true, nil
+}
+
+// PutCachedResponse stores value under key until expiresAt, replacing any
+// existing entry, and removes expired entries.
+func (r *SQLiteRepository) PutCachedResponse(ctx context.Context, key string, value []byte, expiresAt time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM llm_cache WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO llm_cache (key, value, expires_at, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at, created_at = excluded.created_at`,
+		key, string(value), expiresAt.UTC().Format(time.RFC3339), now)
+	return err
+}
@@ -0,0 +1,248 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx, so job queries are shared by
+// SQLiteRepository and txRepository.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+const jobColumns = `id, project_id, kind, status, params, result, error, created_at, started_at, finished_at`
+
+// Jobs
+
+func (r *SQLiteRepository) CreateJob(ctx context.Context, j *domain.Job) error {
+	return createJob(ctx, r.db, j)
+}
+
+func (r *SQLiteRepository) GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
+	return getJob(ctx, r.db, id)
+}
+
+func (r *SQLiteRepository) UpdateJob(ctx context.Context, j *domain.Job) error {
+	return updateJob(ctx, r.db, j)
+}
+
+func (r *SQLiteRepository) ListJobs(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.Job, error) {
+	return listJobs(ctx, r.db, projectID, limit)
+}
+
+func (r *SQLiteRepository) ListUnfinishedJobs(ctx context.Context) ([]*domain.Job, error) {
+	return listUnfinishedJobs(ctx, r.db)
+}
+
+func (r *SQLiteRepository) CreateJobEvent(ctx context.Context, e *domain.JobEvent) error {
+	return createJobEvent(ctx, r.db, e)
+}
+
+func (r *SQLiteRepository) ListJobEvents(ctx context.Context, jobID uuid.UUID, afterSeq int) ([]*domain.JobEvent, error) {
+	return listJobEvents(ctx, r.db, jobID, afterSeq)
+}
+
+func (t *txRepository) CreateJob(ctx context.Context, j *domain.Job) error {
+	return createJob(ctx, t.tx, j)
+}
+
+func (t *txRepository) GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
+	return getJob(ctx, t.tx, id)
+}
+
+func (t *txRepository) UpdateJob(ctx context.Context, j *domain.Job) error {
+	return updateJob(ctx, t.tx, j)
+}
+
+func (t *txRepository) ListJobs(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.Job, error) {
+	return listJobs(ctx, t.tx, projectID, limit)
+}
+
+func (t *txRepository) ListUnfinishedJobs(ctx context.Context) ([]*domain.Job, error) {
+	return listUnfinishedJobs(ctx, t.tx)
+}
+
+func (t *txRepository) CreateJobEvent(ctx context.Context, e *domain.JobEvent) error {
+	return createJobEvent(ctx, t.tx, e)
+}
+
+func (t *txRepository) ListJobEvents(ctx context.Context, jobID uuid.UUID, afterSeq int) ([]*domain.JobEvent, error) {
+	return listJobEvents(ctx, t.tx, jobID, afterSeq)
+}
+
+func createJob(ctx context.Context, db dbtx, j *domain.Job) error {
+	params := string(j.Params)
+	if params == "" {
+		params = "{}"
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO jobs (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		j.ID.String(), j.ProjectID.String(), string(j.Kind), string(j.Status), params,
+		nullableJSON(j.Result), j.Error, j.CreatedAt.Format(time.RFC3339),
+		nullableTime(j.StartedAt), nullableTime(j.FinishedAt))
+	return err
+}
+
+func getJob(ctx context.Context, db dbtx, id uuid.UUID) (*domain.Job, error) {
+	row := db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id.String())
+	j, err := scanJob(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return j, err
+}
+
+func updateJob(ctx context.Context, db dbtx, j *domain.Job) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, result = ?, error = ?, started_at = ?, finished_at = ? WHERE id = ?`,
+		string(j.Status), nullableJSON(j.Result), j.Error,
+		nullableTime(j.StartedAt), nullableTime(j.FinishedAt), j.ID.String())
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func listJobs(ctx context.Context, db dbtx, projectID uuid.UUID, limit int) ([]*domain.Job, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE project_id = ? ORDER BY created_at DESC LIMIT ?`,
+		projectID.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func listUnfinishedJobs(ctx context.Context, db dbtx) ([]*domain.Job, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE status IN (?, ?) ORDER BY created_at`,
+		string(domain.JobStatusQueued), string(domain.JobStatusRunning))
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func createJobEvent(ctx context.Context, db dbtx, e *domain.JobEvent) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO job_events (job_id, seq, type, data, created_at) VALUES (?, ?, ?, ?, ?)`,
+		e.JobID.String(), e.Seq, e.Type, string(e.Data), e.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func listJobEvents(ctx context.Context, db dbtx, jobID uuid.UUID, afterSeq int) ([]*domain.JobEvent, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT job_id, seq, type, data, created_at FROM job_events WHERE job_id = ? AND seq > ? ORDER BY seq`,
+		jobID.String(), afterSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.JobEvent
+	for rows.Next() {
+		var e domain.JobEvent
+		var jobStr, dataStr, createdStr string
+		if err := rows.Scan(&jobStr, &e.Seq, &e.Type, &dataStr, &createdStr); err != nil {
+			return nil, err
+		}
+		if e.JobID, err = uuid.Parse(jobStr); err != nil {
+			return nil, err
+		}
+		if e.CreatedAt, err = time.Parse(time.RFC3339, createdStr); err != nil {
+			return nil, err
+		}
+		e.Data = json.RawMessage(dataStr)
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+func scanJobs(rows *sql.Rows) ([]*domain.Job, error) {
+	defer rows.Close()
+
+	var jobs []*domain.Job
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func scanJob(scan func(dest ...interface{}) error) (*domain.Job, error) {
+	var j domain.Job
+	var idStr, projStr, kindStr, statusStr, paramsStr, createdStr string
+	var resultStr, startedStr, finishedStr sql.NullString
+
+	if err := scan(&idStr, &projStr, &kindStr, &statusStr, &paramsStr, &resultStr, &j.Error,
+		&createdStr, &startedStr, &finishedStr); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if j.ID, err = uuid.Parse(idStr); err != nil {
+		return nil, err
+	}
+	if j.ProjectID, err = uuid.Parse(projStr); err != nil {
+		return nil, err
+	}
+	j.Kind = domain.JobKind(kindStr)
+	j.Status = domain.JobStatus(statusStr)
+	j.Params = json.RawMessage(paramsStr)
+	if resultStr.Valid {
+		j.Result = json.RawMessage(resultStr.String)
+	}
+	if j.CreatedAt, err = time.Parse(time.RFC3339, createdStr); err != nil {
+		return nil, err
+	}
+	if j.StartedAt, err = parseNullableTime(startedStr); err != nil {
+		return nil, err
+	}
+	if j.FinishedAt, err = parseNullableTime(finishedStr); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func nullableJSON(v json.RawMessage) interface{} {
+	if len(v) == 0 {
+		return nil
+	}
+	return string(v)
+}
+
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseNullableTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -29,7 +29,7 @@ type SQLiteRepository struct {
 
 // New creates a new SQLite repository.
 func New(dbPath string) (*SQLiteRepository, error) {
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_journal_mode=WAL")
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -87,10 +87,12 @@ func (r *SQLiteRepository) migrate() error {
 	CREATE TABLE IF NOT EXISTS snapshots (
 		id TEXT PRIMARY KEY,
 		project_id TEXT NOT NULL REFERENCES projects(id),
+		parent_snapshot_id TEXT REFERENCES snapshots(id),
 		spec TEXT NOT NULL, -- JSON object
 		created_at TEXT NOT NULL,
 		derived_from TEXT NOT NULL, -- JSON object: question_id -> version
-		compiler TEXT NOT NULL -- JSON object: CompilerConfig
+		compiler TEXT NOT NULL, -- JSON object: CompilerConfig
+		trace TEXT NOT NULL DEFAULT '{}' -- JSON object: spec_path_to_sources
 	);
 	CREATE INDEX IF NOT EXISTS idx_snapshots_project ON snapshots(project_id);
 	CREATE INDEX IF NOT EXISTS idx_snapshots_created ON snapshots(created_at DESC);
@@ -107,6 +109,81 @@ func (r *SQLiteRepository) migrate() error {
 		created_at TEXT NOT NULL
 	);
 	CREATE INDEX IF NOT EXISTS idx_issues_snapshot ON issues(snapshot_id);
+
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL REFERENCES projects(id),
+		kind TEXT NOT NULL,
+		status TEXT NOT NULL,
+		params TEXT NOT NULL DEFAULT '{}', -- JSON object
+		result TEXT, -- JSON object: complete or fail event payload
+		error TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		started_at TEXT,
+		finished_at TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_project ON jobs(project_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+
+	CREATE TABLE IF NOT EXISTS job_events (
+		job_id TEXT NOT NULL REFERENCES jobs(id),
+		seq INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		data TEXT NOT NULL, -- JSON object
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (job_id, seq)
+	);
+
+	CREATE TABLE IF NOT EXISTS llm_calls (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL REFERENCES projects(id),
+		snapshot_id TEXT REFERENCES snapshots(id),
+		role TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		input_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		cached_tokens INTEGER NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		stop_reason TEXT NOT NULL DEFAULT '',
+		cost_usd REAL, -- NULL when the model has no known price
+		cache_hit INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_llm_calls_project ON llm_calls(project_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_llm_calls_snapshot ON llm_calls(snapshot_id);
+
+	CREATE TABLE IF NOT EXISTS llm_cache (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL, -- JSON document
+		expires_at TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_llm_cache_expires ON llm_cache(expires_at);
+
+	CREATE TABLE IF NOT EXISTS llm_audit (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL REFERENCES projects(id),
+		snapshot_id TEXT REFERENCES snapshots(id),
+		question_ids TEXT NOT NULL DEFAULT '[]', -- JSON array
+		role TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		prompt_version TEXT NOT NULL DEFAULT '',
+		messages TEXT NOT NULL, -- JSON array, redacted
+		response TEXT NOT NULL, -- redacted
+		outcome TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		input_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		stop_reason TEXT NOT NULL DEFAULT '',
+		cache_hit INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_llm_audit_project ON llm_audit(project_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_llm_audit_created ON llm_audit(created_at);
 	`
 
 	_, err := r.db.Exec(schema)
@@ -117,6 +194,29 @@ func (r *SQLiteRepository) migrate() error {
 	// Migration: add mode column to existing projects table
 	_, _ = r.db.Exec(`ALTER TABLE projects ADD COLUMN mode TEXT NOT NULL DEFAULT 'advanced'`)
 
+	// Migration: store the compiler trace in its own column, backfilling it
+	// from the trace section embedded in existing specs
+	if _, err := r.db.Exec(`ALTER TABLE snapshots ADD COLUMN trace TEXT NOT NULL DEFAULT '{}'`); err == nil {
+		_, _ = r.db.Exec(`UPDATE snapshots SET trace = json_extract(spec, '$.trace')
+			WHERE json_type(spec, '$.trace') = 'object'`)
+	}
+
+	// Migration: link snapshots to the snapshot they were compiled on top of.
+	// Existing snapshots keep a NULL parent.
+	_, _ = r.db.Exec(`ALTER TABLE snapshots ADD COLUMN parent_snapshot_id TEXT REFERENCES snapshots(id)`)
+
+	// Migration: per-project LLM budget, stored as JSON (NULL for none)
+	_, _ = r.db.Exec(`ALTER TABLE projects ADD COLUMN budget TEXT`)
+
+	// Migration: per-project prompt version ('' for the server default)
+	_, _ = r.db.Exec(`ALTER TABLE projects ADD COLUMN prompt_version TEXT NOT NULL DEFAULT ''`)
+
+	// Migration: per-project model routing, stored as JSON (NULL for none)
+	_, _ = r.db.Exec(`ALTER TABLE projects ADD COLUMN model_routing TEXT`)
+
+	// Migration: flag LLM calls served from the response cache
+	_, _ = r.db.Exec(`ALTER TABLE llm_calls ADD COLUMN cache_hit INTEGER NOT NULL DEFAULT 0`)
+
 	return nil
 }
 
@@ -132,18 +232,18 @@ func (r *SQLiteRepository) CreateProject(ctx context.Context, p *domain.Project)
 		mode = string(domain.ProjectModeAdvanced)
 	}
 	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO projects (id, name, mode, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
-		p.ID.String(), p.Name, mode, p.CreatedAt.Format(time.RFC3339), p.UpdatedAt.Format(time.RFC3339))
+		`INSERT INTO projects (id, name, mode, budget, prompt_version, model_routing, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID.String(), p.Name, mode, budgetJSON(p.Budget), p.PromptVersion, routingJSON(p.ModelRouting), p.CreatedAt.Format(time.RFC3339), p.UpdatedAt.Format(time.RFC3339))
 	return err
 }
 
 func (r *SQLiteRepository) GetProject(ctx context.Context, id uuid.UUID) (*domain.Project, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id, name, mode, created_at, updated_at FROM projects WHERE id = ?`, id.String())
+	row := r.db.QueryRowContext(ctx, `SELECT id, name, mode, budget, prompt_version, model_routing, created_at, updated_at FROM projects WHERE id = ?`, id.String())
 	return scanProject(row)
 }
 
 func (r *SQLiteRepository) ListProjects(ctx context.Context) ([]*domain.Project, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, name, mode, created_at, updated_at FROM projects ORDER BY updated_at DESC`)
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, mode, budget, prompt_version, model_routing, created_at, updated_at FROM projects ORDER BY updated_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -162,8 +262,8 @@ func (r *SQLiteRepository) ListProjects(ctx context.Context) ([]*domain.Project,
 
 func (r *SQLiteRepository) UpdateProject(ctx context.Context, p *domain.Project) error {
 	res, err := r.db.ExecContext(ctx,
-		`UPDATE projects SET name = ?, updated_at = ? WHERE id = ?`,
-		p.Name, p.UpdatedAt.Format(time.RFC3339), p.ID.String())
+		`UPDATE projects SET name = ?, budget = ?, prompt_version = ?, model_routing = ?, updated_at = ? WHERE id = ?`,
+		p.Name, budgetJSON(p.Budget), p.PromptVersion, routingJSON(p.ModelRouting), p.UpdatedAt.Format(time.RFC3339), p.ID.String())
 	if err != nil {
 		return err
 	}
@@ -177,6 +277,18 @@ func (r *SQLiteRepository) UpdateProject(ctx context.Context, p *domain.Project)
 func (r *SQLiteRepository) DeleteProject(ctx context.Context, id uuid.UUID) error {
 	idStr := id.String()
 	// Delete in order respecting foreign key constraints
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM job_events WHERE job_id IN (SELECT id FROM jobs WHERE project_id = ?)`, idStr); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM jobs WHERE project_id = ?`, idStr); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM llm_calls WHERE project_id = ?`, idStr); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM llm_audit WHERE project_id = ?`, idStr); err != nil {
+		return err
+	}
 	if _, err := r.db.ExecContext(ctx, `DELETE FROM issues WHERE project_id = ?`, idStr); err != nil {
 		return err
 	}
@@ -203,7 +315,7 @@ func (r *SQLiteRepository) DeleteProject(ctx context.Context, id uuid.UUID) erro
 func (r *SQLiteRepository) GetLatestSnapshotID(ctx context.Context, projectID uuid.UUID) (*uuid.UUID, error) {
 	var idStr sql.NullString
 	err := r.db.QueryRowContext(ctx,
-		`SELECT id FROM snapshots WHERE project_id = ? ORDER BY created_at DESC LIMIT 1`,
+		`SELECT id FROM snapshots WHERE project_id = ? ORDER BY created_at DESC, rowid DESC LIMIT 1`,
 		projectID.String()).Scan(&idStr)
 	if err == sql.ErrNoRows || !idStr.Valid {
 		return nil, nil
@@ -221,7 +333,8 @@ func (r *SQLiteRepository) GetLatestSnapshotID(ctx context.Context, projectID uu
 func scanProject(row *sql.Row) (*domain.Project, error) {
 	var p domain.Project
 	var idStr, modeStr, createdStr, updatedStr string
-	if err := row.Scan(&idStr, &p.Name, &modeStr, &createdStr, &updatedStr); err != nil {
+	var budgetStr, routingStr sql.NullString
+	if err := row.Scan(&idStr, &p.Name, &modeStr, &budgetStr, &p.PromptVersion, &routingStr, &createdStr, &updatedStr); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, domain.ErrNotFound
 		}
@@ -236,6 +349,12 @@ func scanProject(row *sql.Row) (*domain.Project, error) {
 	if p.Mode == "" {
 		p.Mode = domain.ProjectModeAdvanced
 	}
+	if p.Budget, err = parseBudget(budgetStr); err != nil {
+		return nil, err
+	}
+	if p.ModelRouting, err = parseRouting(routingStr); err != nil {
+		return nil, err
+	}
 	p.CreatedAt, err = time.Parse(time.RFC3339, createdStr)
 	if err != nil {
 		return nil, err
@@ -250,7 +369,8 @@ func scanProject(row *sql.Row) (*domain.Project, error) {
 func scanProjectRow(rows *sql.Rows) (*domain.Project, error) {
 	var p domain.Project
 	var idStr, modeStr, createdStr, updatedStr string
-	if err := rows.Scan(&idStr, &p.Name, &modeStr, &createdStr, &updatedStr); err != nil {
+	var budgetStr, routingStr sql.NullString
+	if err := rows.Scan(&idStr, &p.Name, &modeStr, &budgetStr, &p.PromptVersion, &routingStr, &createdStr, &updatedStr); err != nil {
 		return nil, err
 	}
 	var err error
@@ -262,6 +382,12 @@ func scanProjectRow(rows *sql.Rows) (*domain.Project, error) {
 	if p.Mode == "" {
 		p.Mode = domain.ProjectModeAdvanced
 	}
+	if p.Budget, err = parseBudget(budgetStr); err != nil {
+		return nil, err
+	}
+	if p.ModelRouting, err = parseRouting(routingStr); err != nil {
+		return nil, err
+	}
 	p.CreatedAt, err = time.Parse(time.RFC3339, createdStr)
 	if err != nil {
 		return nil, err
@@ -582,17 +708,33 @@ func (r *SQLiteRepository) CreateSnapshot(ctx context.Context, s *domain.SpecSna
 	derivedJSON, _ := json.Marshal(convertDerivedFromToString(s.DerivedFrom))
 	compilerJSON, _ := json.Marshal(s.Compiler)
 
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO snapshots (id, project_id, spec, created_at, derived_from, compiler)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		s.ID.String(), s.ProjectID.String(), string(s.Spec),
-		s.CreatedAt.Format(time.RFC3339), string(derivedJSON), string(compilerJSON))
-	return err
+	trace := string(s.Trace)
+	if trace == "" {
+		trace = "{}"
+	}
+
+	// The insert only happens if the parent is still the latest snapshot, so
+	// two compiles racing from the same parent can't both succeed
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO snapshots (id, project_id, parent_snapshot_id, spec, created_at, derived_from, compiler, trace)
+		 SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		 WHERE (SELECT id FROM snapshots WHERE project_id = ? ORDER BY created_at DESC, rowid DESC LIMIT 1) IS ?`,
+		s.ID.String(), s.ProjectID.String(), nullableUUID(s.ParentSnapshotID), string(s.Spec),
+		s.CreatedAt.Format(time.RFC3339), string(derivedJSON), string(compilerJSON), trace,
+		s.ProjectID.String(), nullableUUID(s.ParentSnapshotID))
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return domain.ErrConflict
+	}
+	return nil
 }
 
 func (r *SQLiteRepository) GetSnapshot(ctx context.Context, id uuid.UUID) (*domain.SpecSnapshot, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, project_id, spec, created_at, derived_from, compiler FROM snapshots WHERE id = ?`,
+		`SELECT id, project_id, parent_snapshot_id, spec, created_at, derived_from, compiler, trace FROM snapshots WHERE id = ?`,
 		id.String())
 	return scanSnapshot(row)
 }
@@ -602,8 +744,8 @@ func (r *SQLiteRepository) ListSnapshots(ctx context.Context, projectID uuid.UUI
 		limit = 50
 	}
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, project_id, spec, created_at, derived_from, compiler
-		 FROM snapshots WHERE project_id = ? ORDER BY created_at DESC LIMIT ?`,
+		`SELECT id, project_id, parent_snapshot_id, spec, created_at, derived_from, compiler, trace
+		 FROM snapshots WHERE project_id = ? ORDER BY created_at DESC, rowid DESC LIMIT ?`,
 		projectID.String(), limit)
 	if err != nil {
 		return nil, err
@@ -623,28 +765,30 @@ func (r *SQLiteRepository) ListSnapshots(ctx context.Context, projectID uuid.UUI
 
 func scanSnapshot(row *sql.Row) (*domain.SpecSnapshot, error) {
 	var s domain.SpecSnapshot
-	var idStr, projStr, specStr, createdStr, derivedStr, compilerStr string
+	var idStr, projStr, specStr, createdStr, derivedStr, compilerStr, traceStr string
+	var parentStr sql.NullString
 
-	if err := row.Scan(&idStr, &projStr, &specStr, &createdStr, &derivedStr, &compilerStr); err != nil {
+	if err := row.Scan(&idStr, &projStr, &parentStr, &specStr, &createdStr, &derivedStr, &compilerStr, &traceStr); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, domain.ErrNotFound
 		}
 		return nil, err
 	}
-	return parseSnapshot(idStr, projStr, specStr, createdStr, derivedStr, compilerStr, &s)
+	return parseSnapshot(idStr, projStr, parentStr, specStr, createdStr, derivedStr, compilerStr, traceStr, &s)
 }
 
 func scanSnapshotFromRows(rows *sql.Rows) (*domain.SpecSnapshot, error) {
 	var s domain.SpecSnapshot
-	var idStr, projStr, specStr, createdStr, derivedStr, compilerStr string
+	var idStr, projStr, specStr, createdStr, derivedStr, compilerStr, traceStr string
+	var parentStr sql.NullString
 
-	if err := rows.Scan(&idStr, &projStr, &specStr, &createdStr, &derivedStr, &compilerStr); err != nil {
+	if err := rows.Scan(&idStr, &projStr, &parentStr, &specStr, &createdStr, &derivedStr, &compilerStr, &traceStr); err != nil {
 		return nil, err
 	}
-	return parseSnapshot(idStr, projStr, specStr, createdStr, derivedStr, compilerStr, &s)
+	return parseSnapshot(idStr, projStr, parentStr, specStr, createdStr, derivedStr, compilerStr, traceStr, &s)
 }
 
-func parseSnapshot(idStr, projStr, specStr, createdStr, derivedStr, compilerStr string, s *domain.SpecSnapshot) (*domain.SpecSnapshot, error) {
+func parseSnapshot(idStr, projStr string, parentStr sql.NullString, specStr, createdStr, derivedStr, compilerStr, traceStr string, s *domain.SpecSnapshot) (*domain.SpecSnapshot, error) {
 	var err error
 	s.ID, err = uuid.Parse(idStr)
 	if err != nil {
@@ -654,6 +798,13 @@ func parseSnapshot(idStr, projStr, specStr, createdStr, derivedStr, compilerStr
 	if err != nil {
 		return nil, err
 	}
+	if parentStr.Valid {
+		parentID, err := uuid.Parse(parentStr.String)
+		if err != nil {
+			return nil, err
+		}
+		s.ParentSnapshotID = &parentID
+	}
 	s.Spec = json.RawMessage(specStr)
 	s.CreatedAt, err = time.Parse(time.RFC3339, createdStr)
 	if err != nil {
@@ -676,6 +827,7 @@ func parseSnapshot(idStr, projStr, specStr, createdStr, derivedStr, compilerStr
 	if err := json.Unmarshal([]byte(compilerStr), &s.Compiler); err != nil {
 		return nil, err
 	}
+	s.Trace = json.RawMessage(traceStr)
 	return s, nil
 }
 
@@ -768,6 +920,53 @@ func scanIssueFromRows(rows *sql.Rows) (*domain.Issue, error) {
 	return &i, nil
 }
 
+// budgetJSON encodes a project budget for the budget column.
+func budgetJSON(b *domain.Budget) interface{} {
+	if b == nil {
+		return nil
+	}
+	data, _ := json.Marshal(b)
+	return string(data)
+}
+
+func parseBudget(s sql.NullString) (*domain.Budget, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	var b domain.Budget
+	if err := json.Unmarshal([]byte(s.String), &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// routingJSON encodes a project's model routing for the model_routing column.
+func routingJSON(r domain.ModelRouting) interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+func parseRouting(s sql.NullString) (domain.ModelRouting, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	var r domain.ModelRouting
+	if err := json.Unmarshal([]byte(s.String), &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func nullableUUID(id *uuid.UUID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return id.String()
+}
+
 func convertUUIDsToStrings(uuids []uuid.UUID) []string {
 	result := make([]string, len(uuids))
 	for i, u := range uuids {
@@ -818,18 +1017,18 @@ func (t *txRepository) CreateProject(ctx context.Context, p *domain.Project) err
 		mode = string(domain.ProjectModeAdvanced)
 	}
 	_, err := t.execContext(ctx,
-		`INSERT INTO projects (id, name, mode, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
-		p.ID.String(), p.Name, mode, p.CreatedAt.Format(time.RFC3339), p.UpdatedAt.Format(time.RFC3339))
+		`INSERT INTO projects (id, name, mode, budget, prompt_version, model_routing, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID.String(), p.Name, mode, budgetJSON(p.Budget), p.PromptVersion, routingJSON(p.ModelRouting), p.CreatedAt.Format(time.RFC3339), p.UpdatedAt.Format(time.RFC3339))
 	return err
 }
 
 func (t *txRepository) GetProject(ctx context.Context, id uuid.UUID) (*domain.Project, error) {
-	row := t.queryRowContext(ctx, `SELECT id, name, mode, created_at, updated_at FROM projects WHERE id = ?`, id.String())
+	row := t.queryRowContext(ctx, `SELECT id, name, mode, budget, prompt_version, model_routing, created_at, updated_at FROM projects WHERE id = ?`, id.String())
 	return scanProject(row)
 }
 
 func (t *txRepository) ListProjects(ctx context.Context) ([]*domain.Project, error) {
-	rows, err := t.queryContext(ctx, `SELECT id, name, mode, created_at, updated_at FROM projects ORDER BY updated_at DESC`)
+	rows, err := t.queryContext(ctx, `SELECT id, name, mode, budget, prompt_version, model_routing, created_at, updated_at FROM projects ORDER BY updated_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -848,8 +1047,8 @@ func (t *txRepository) ListProjects(ctx context.Context) ([]*domain.Project, err
 
 func (t *txRepository) UpdateProject(ctx context.Context, p *domain.Project) error {
 	res, err := t.execContext(ctx,
-		`UPDATE projects SET name = ?, updated_at = ? WHERE id = ?`,
-		p.Name, p.UpdatedAt.Format(time.RFC3339), p.ID.String())
+		`UPDATE projects SET name = ?, budget = ?, prompt_version = ?, model_routing = ?, updated_at = ? WHERE id = ?`,
+		p.Name, budgetJSON(p.Budget), p.PromptVersion, routingJSON(p.ModelRouting), p.UpdatedAt.Format(time.RFC3339), p.ID.String())
 	if err != nil {
 		return err
 	}
@@ -862,6 +1061,18 @@ func (t *txRepository) UpdateProject(ctx context.Context, p *domain.Project) err
 
 func (t *txRepository) DeleteProject(ctx context.Context, id uuid.UUID) error {
 	idStr := id.String()
+	if _, err := t.execContext(ctx, `DELETE FROM job_events WHERE job_id IN (SELECT id FROM jobs WHERE project_id = ?)`, idStr); err != nil {
+		return err
+	}
+	if _, err := t.execContext(ctx, `DELETE FROM jobs WHERE project_id = ?`, idStr); err != nil {
+		return err
+	}
+	if _, err := t.execContext(ctx, `DELETE FROM llm_calls WHERE project_id = ?`, idStr); err != nil {
+		return err
+	}
+	if _, err := t.execContext(ctx, `DELETE FROM llm_audit WHERE project_id = ?`, idStr); err != nil {
+		return err
+	}
 	if _, err := t.execContext(ctx, `DELETE FROM issues WHERE project_id = ?`, idStr); err != nil {
 		return err
 	}
@@ -888,7 +1099,7 @@ func (t *txRepository) DeleteProject(ctx context.Context, id uuid.UUID) error {
 func (t *txRepository) GetLatestSnapshotID(ctx context.Context, projectID uuid.UUID) (*uuid.UUID, error) {
 	var idStr sql.NullString
 	err := t.queryRowContext(ctx,
-		`SELECT id FROM snapshots WHERE project_id = ? ORDER BY created_at DESC LIMIT 1`,
+		`SELECT id FROM snapshots WHERE project_id = ? ORDER BY created_at DESC, rowid DESC LIMIT 1`,
 		projectID.String()).Scan(&idStr)
 	if err == sql.ErrNoRows || !idStr.Valid {
 		return nil, nil
@@ -1094,17 +1305,33 @@ func (t *txRepository) CreateSnapshot(ctx context.Context, s *domain.SpecSnapsho
 	derivedJSON, _ := json.Marshal(convertDerivedFromToString(s.DerivedFrom))
 	compilerJSON, _ := json.Marshal(s.Compiler)
 
-	_, err := t.execContext(ctx,
-		`INSERT INTO snapshots (id, project_id, spec, created_at, derived_from, compiler)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		s.ID.String(), s.ProjectID.String(), string(s.Spec),
-		s.CreatedAt.Format(time.RFC3339), string(derivedJSON), string(compilerJSON))
-	return err
+	trace := string(s.Trace)
+	if trace == "" {
+		trace = "{}"
+	}
+
+	// The insert only happens if the parent is still the latest snapshot, so
+	// two compiles racing from the same parent can't both succeed
+	res, err := t.execContext(ctx,
+		`INSERT INTO snapshots (id, project_id, parent_snapshot_id, spec, created_at, derived_from, compiler, trace)
+		 SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		 WHERE (SELECT id FROM snapshots WHERE project_id = ? ORDER BY created_at DESC, rowid DESC LIMIT 1) IS ?`,
+		s.ID.String(), s.ProjectID.String(), nullableUUID(s.ParentSnapshotID), string(s.Spec),
+		s.CreatedAt.Format(time.RFC3339), string(derivedJSON), string(compilerJSON), trace,
+		s.ProjectID.String(), nullableUUID(s.ParentSnapshotID))
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return domain.ErrConflict
+	}
+	return nil
 }
 
 func (t *txRepository) GetSnapshot(ctx context.Context, id uuid.UUID) (*domain.SpecSnapshot, error) {
 	row := t.queryRowContext(ctx,
-		`SELECT id, project_id, spec, created_at, derived_from, compiler FROM snapshots WHERE id = ?`,
+		`SELECT id, project_id, parent_snapshot_id, spec, created_at, derived_from, compiler, trace FROM snapshots WHERE id = ?`,
 		id.String())
 	return scanSnapshot(row)
 }
@@ -1114,8 +1341,8 @@ func (t *txRepository) ListSnapshots(ctx context.Context, projectID uuid.UUID, l
 		limit = 50
 	}
 	rows, err := t.queryContext(ctx,
-		`SELECT id, project_id, spec, created_at, derived_from, compiler
-		 FROM snapshots WHERE project_id = ? ORDER BY created_at DESC LIMIT ?`,
+		`SELECT id, project_id, parent_snapshot_id, spec, created_at, derived_from, compiler, trace
+		 FROM snapshots WHERE project_id = ? ORDER BY created_at DESC, rowid DESC LIMIT ?`,
 		projectID.String(), limit)
 	if err != nil {
 		return nil, err
@@ -51,6 +51,25 @@ func TestSQLiteRepository(t *testing.T) {
 			t.Errorf("Name mismatch: got %q, want %q", got.Name, project.Name)
 		}
 
+		if got.Budget != nil || got.ModelRouting != nil {
+			t.Errorf("Expected no budget or routing, got %+v, %+v", got.Budget, got.ModelRouting)
+		}
+		got.Budget = &domain.Budget{Period: domain.BudgetPeriodMonthly, MaxCostUSD: 25, WarnAt: 0.9}
+		got.ModelRouting = domain.ModelRouting{domain.LLMRolePlanner: {Provider: "openai", Model: "gpt-4o-mini"}}
+		if err := repo.UpdateProject(ctx, got); err != nil {
+			t.Fatalf("UpdateProject failed: %v", err)
+		}
+		got, err = repo.GetProject(ctx, project.ID)
+		if err != nil {
+			t.Fatalf("GetProject failed: %v", err)
+		}
+		if got.Budget == nil || *got.Budget != (domain.Budget{Period: domain.BudgetPeriodMonthly, MaxCostUSD: 25, WarnAt: 0.9}) {
+			t.Errorf("Budget mismatch: got %+v", got.Budget)
+		}
+		if r := got.ModelRouting[domain.LLMRolePlanner]; len(got.ModelRouting) != 1 || r.Provider != "openai" || r.Model != "gpt-4o-mini" {
+			t.Errorf("ModelRouting mismatch: got %+v", got.ModelRouting)
+		}
+
 		// Test not found
 		_, err = repo.GetProject(ctx, uuid.New())
 		if err != domain.ErrNotFound {
@@ -207,6 +226,7 @@ func TestSQLiteRepository(t *testing.T) {
 				PromptVersion: "v1",
 				Temperature:   0,
 			},
+			Trace: json.RawMessage(`{"spec_path_to_sources":{"/product/name":[]}}`),
 		}
 
 		if err := repo.CreateSnapshot(ctx, snapshot); err != nil {
@@ -224,6 +244,9 @@ func TestSQLiteRepository(t *testing.T) {
 		if got.DerivedFrom[questionID] != 1 {
 			t.Errorf("DerivedFrom mismatch")
 		}
+		if string(got.Trace) != string(snapshot.Trace) {
+			t.Errorf("Trace mismatch: got %s", got.Trace)
+		}
 
 		// Test GetLatestSnapshotID
 		latestID, err := repo.GetLatestSnapshotID(ctx, projectID)
@@ -244,6 +267,55 @@ func TestSQLiteRepository(t *testing.T) {
 		}
 	})
 
+	t.Run("Snapshot parent conflict", func(t *testing.T) {
+		projectID := uuid.New()
+		now := time.Now().UTC().Truncate(time.Second)
+		repo.CreateProject(ctx, &domain.Project{ID: projectID, Name: "P Test", CreatedAt: now, UpdatedAt: now})
+
+		newSnapshot := func(parentID *uuid.UUID) *domain.SpecSnapshot {
+			return &domain.SpecSnapshot{
+				ID: uuid.New(), ProjectID: projectID, ParentSnapshotID: parentID,
+				Spec: json.RawMessage(`{}`), CreatedAt: now, DerivedFrom: map[uuid.UUID]int{},
+				Compiler: domain.CompilerConfig{Model: "test"},
+			}
+		}
+
+		first := newSnapshot(nil)
+		if err := repo.CreateSnapshot(ctx, first); err != nil {
+			t.Fatalf("CreateSnapshot first failed: %v", err)
+		}
+		if err := repo.CreateSnapshot(ctx, newSnapshot(nil)); err != domain.ErrConflict {
+			t.Errorf("Expected ErrConflict for a second root snapshot, got %v", err)
+		}
+
+		// Same created_at second as the parent; insertion order decides the latest
+		second := newSnapshot(&first.ID)
+		if err := repo.CreateSnapshot(ctx, second); err != nil {
+			t.Fatalf("CreateSnapshot second failed: %v", err)
+		}
+		if err := repo.CreateSnapshot(ctx, newSnapshot(&first.ID)); err != domain.ErrConflict {
+			t.Errorf("Expected ErrConflict for a stale parent, got %v", err)
+		}
+
+		got, err := repo.GetSnapshot(ctx, second.ID)
+		if err != nil {
+			t.Fatalf("GetSnapshot failed: %v", err)
+		}
+		if got.ParentSnapshotID == nil || *got.ParentSnapshotID != first.ID {
+			t.Errorf("ParentSnapshotID = %v, want %s", got.ParentSnapshotID, first.ID)
+		}
+		if latestID, _ := repo.GetLatestSnapshotID(ctx, projectID); latestID == nil || *latestID != second.ID {
+			t.Errorf("Latest snapshot = %v, want %s", latestID, second.ID)
+		}
+		snapshots, err := repo.ListSnapshots(ctx, projectID, 10)
+		if err != nil {
+			t.Fatalf("ListSnapshots failed: %v", err)
+		}
+		if len(snapshots) != 2 || snapshots[0].ID != second.ID || snapshots[1].ID != first.ID {
+			t.Errorf("ListSnapshots = %d snapshots, want the second before the first", len(snapshots))
+		}
+	})
+
 	// Test Issue
 	t.Run("Issue", func(t *testing.T) {
 		projectID := uuid.New()
@@ -288,4 +360,260 @@ func TestSQLiteRepository(t *testing.T) {
 			t.Errorf("Issue type mismatch: got %q", issues[0].Type)
 		}
 	})
+
+	t.Run("Job", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		projectID := uuid.New()
+		project := &domain.Project{ID: projectID, Name: "J Test", CreatedAt: now, UpdatedAt: now}
+		repo.CreateProject(ctx, project)
+
+		job := &domain.Job{
+			ID:        uuid.New(),
+			ProjectID: projectID,
+			Kind:      domain.JobKindCompile,
+			Status:    domain.JobStatusQueued,
+			Params:    json.RawMessage(`{"mode":"latest_answers"}`),
+			CreatedAt: now,
+		}
+		if err := repo.CreateJob(ctx, job); err != nil {
+			t.Fatalf("CreateJob failed: %v", err)
+		}
+
+		unfinished, err := repo.ListUnfinishedJobs(ctx)
+		if err != nil {
+			t.Fatalf("ListUnfinishedJobs failed: %v", err)
+		}
+		if len(unfinished) != 1 || unfinished[0].ID != job.ID {
+			t.Errorf("Expected the queued job to be unfinished, got %d jobs", len(unfinished))
+		}
+
+		for i, typ := range []string{"stage", "complete"} {
+			event := &domain.JobEvent{JobID: job.ID, Seq: i + 1, Type: typ, Data: json.RawMessage(`{"stage":"` + typ + `"}`), CreatedAt: now}
+			if err := repo.CreateJobEvent(ctx, event); err != nil {
+				t.Fatalf("CreateJobEvent failed: %v", err)
+			}
+		}
+
+		job.Status = domain.JobStatusSucceeded
+		job.StartedAt = &now
+		job.FinishedAt = &now
+		job.Result = json.RawMessage(`{"stage":"complete"}`)
+		if err := repo.UpdateJob(ctx, job); err != nil {
+			t.Fatalf("UpdateJob failed: %v", err)
+		}
+
+		got, err := repo.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("GetJob failed: %v", err)
+		}
+		if got.Status != domain.JobStatusSucceeded || got.FinishedAt == nil || !got.FinishedAt.Equal(now) {
+			t.Errorf("Job not updated: %+v", got)
+		}
+		if string(got.Result) != `{"stage":"complete"}` {
+			t.Errorf("Result mismatch: got %s", got.Result)
+		}
+
+		events, err := repo.ListJobEvents(ctx, job.ID, 1)
+		if err != nil {
+			t.Fatalf("ListJobEvents failed: %v", err)
+		}
+		if len(events) != 1 || events[0].Seq != 2 || events[0].Type != "complete" {
+			t.Errorf("Expected only the complete event after seq 1, got %+v", events)
+		}
+
+		jobs, err := repo.ListJobs(ctx, projectID, 10)
+		if err != nil {
+			t.Fatalf("ListJobs failed: %v", err)
+		}
+		if len(jobs) != 1 {
+			t.Errorf("Expected 1 job, got %d", len(jobs))
+		}
+
+		if _, err := repo.GetJob(ctx, uuid.New()); err != domain.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("LLM usage", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		projectID := uuid.New()
+		repo.CreateProject(ctx, &domain.Project{ID: projectID, Name: "U Test", CreatedAt: now, UpdatedAt: now})
+
+		snapshot := &domain.SpecSnapshot{
+			ID:          uuid.New(),
+			ProjectID:   projectID,
+			Spec:        json.RawMessage(`{}`),
+			CreatedAt:   now,
+			DerivedFrom: map[uuid.UUID]int{},
+			Trace:       json.RawMessage(`{}`),
+		}
+		if err := repo.CreateSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+
+		cost := func(v float64) *float64 { return &v }
+		calls := []*domain.LLMCall{
+			{Role: domain.LLMRoleCompiler, Provider: "openai", Model: "gpt-4o", SnapshotID: &snapshot.ID,
+				InputTokens: 1000, OutputTokens: 500, CachedTokens: 200, CostUSD: cost(0.01)},
+			{Role: domain.LLMRoleValidator, Provider: "openai", Model: "gpt-4o", SnapshotID: &snapshot.ID,
+				InputTokens: 800, OutputTokens: 100, CostUSD: cost(0.003)},
+			{Role: domain.LLMRolePlanner, Provider: "custom", Model: "unpriced",
+				InputTokens: 300, OutputTokens: 50},
+			{Role: domain.LLMRoleCompiler, Provider: "openai", Model: "gpt-4o", CacheHit: true, CostUSD: cost(0)},
+		}
+		for _, c := range calls {
+			c.ID = uuid.New()
+			c.ProjectID = projectID
+			c.CreatedAt = now
+			if err := repo.CreateLLMCall(ctx, c); err != nil {
+				t.Fatalf("CreateLLMCall failed: %v", err)
+			}
+		}
+
+		usage, err := repo.GetProjectUsage(ctx, projectID)
+		if err != nil {
+			t.Fatalf("GetProjectUsage failed: %v", err)
+		}
+		if usage.Total.Calls != 4 || usage.Total.InputTokens != 2100 || usage.Total.OutputTokens != 650 ||
+			usage.Total.CachedTokens != 200 || usage.Total.UnpricedCalls != 1 || usage.Total.CacheHits != 1 {
+			t.Errorf("Unexpected totals: %+v", usage.Total)
+		}
+		if len(usage.ByRole) != 3 || usage.ByRole[0].Role != domain.LLMRoleCompiler {
+			t.Errorf("Expected 3 roles sorted by name, got %+v", usage.ByRole)
+		}
+		if len(usage.ByModel) != 2 || usage.ByModel[1].Model != "gpt-4o" || usage.ByModel[1].Calls != 3 {
+			t.Errorf("Expected gpt-4o to account for 3 calls, got %+v", usage.ByModel)
+		}
+
+		bySnapshot, err := repo.GetSnapshotUsage(ctx, []uuid.UUID{snapshot.ID, uuid.New()})
+		if err != nil {
+			t.Fatalf("GetSnapshotUsage failed: %v", err)
+		}
+		if len(bySnapshot) != 1 || bySnapshot[snapshot.ID].Calls != 2 || bySnapshot[snapshot.ID].CostUSD < 0.0129 {
+			t.Errorf("Unexpected snapshot usage: %+v", bySnapshot)
+		}
+
+		since, err := repo.GetUsageSince(ctx, &projectID, now)
+		if err != nil {
+			t.Fatalf("GetUsageSince failed: %v", err)
+		}
+		if since.Calls != 4 || since.InputTokens != 2100 || since.CacheHits != 1 {
+			t.Errorf("Unexpected usage since now: %+v", since)
+		}
+		since, err = repo.GetUsageSince(ctx, &projectID, now.Add(time.Second))
+		if err != nil {
+			t.Fatalf("GetUsageSince failed: %v", err)
+		}
+		if since != (domain.UsageTotals{}) {
+			t.Errorf("Expected no usage after now, got %+v", since)
+		}
+		if all, err := repo.GetUsageSince(ctx, nil, time.Time{}); err != nil || all.Calls < 4 {
+			t.Errorf("GetUsageSince(all projects) = %+v, %v; want at least this project's calls", all, err)
+		}
+
+		if err := repo.DeleteProject(ctx, projectID); err != nil {
+			t.Fatalf("DeleteProject failed: %v", err)
+		}
+		usage, err = repo.GetProjectUsage(ctx, projectID)
+		if err != nil {
+			t.Fatalf("GetProjectUsage after delete failed: %v", err)
+		}
+		if usage.Total.Calls != 0 {
+			t.Errorf("Expected usage to be deleted with the project, got %d calls", usage.Total.Calls)
+		}
+	})
+	t.Run("LLM audit", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		projectID := uuid.New()
+		repo.CreateProject(ctx, &domain.Project{ID: projectID, Name: "A Test", CreatedAt: now, UpdatedAt: now})
+		snapshot := &domain.SpecSnapshot{
+			ID:          uuid.New(),
+			ProjectID:   projectID,
+			Spec:        json.RawMessage(`{}`),
+			CreatedAt:   now,
+			DerivedFrom: map[uuid.UUID]int{},
+			Trace:       json.RawMessage(`{}`),
+		}
+		if err := repo.CreateSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+		questionID := uuid.New()
+
+		entries := []*domain.LLMAuditEntry{
+			{Role: domain.LLMRolePlanner, Stage: "planning", QuestionIDs: []uuid.UUID{questionID},
+				Response: `{"suggestions": []}`, Outcome: domain.LLMCallOK, CreatedAt: now.Add(-48 * time.Hour)},
+			{Role: domain.LLMRoleCompiler, Stage: "compiling", SnapshotID: &snapshot.ID, PromptVersion: "v1",
+				Messages: []domain.LLMMessage{{Role: "system", Content: "Compile"}, {Role: "user", Content: "{}"}},
+				Response: `{"spec": {}}`, Outcome: domain.LLMCallOK, InputTokens: 100, OutputTokens: 20, LatencyMs: 1500, CreatedAt: now},
+			{Role: domain.LLMRoleValidator, Stage: "validating", SnapshotID: &snapshot.ID,
+				Outcome: domain.LLMCallFailed, Error: "timeout", CreatedAt: now},
+		}
+		for _, e := range entries {
+			e.ID = uuid.New()
+			e.ProjectID = projectID
+			e.Provider, e.Model = "openai", "gpt-4o"
+			if err := repo.CreateLLMAuditEntry(ctx, e); err != nil {
+				t.Fatalf("CreateLLMAuditEntry failed: %v", err)
+			}
+		}
+
+		list, err := repo.ListLLMAuditEntries(ctx, projectID, domain.LLMAuditFilter{})
+		if err != nil {
+			t.Fatalf("ListLLMAuditEntries failed: %v", err)
+		}
+		if len(list) != 3 || list[0].ID != entries[2].ID || list[2].ID != entries[0].ID {
+			t.Fatalf("Expected 3 entries newest first, got %d", len(list))
+		}
+		if got := list[1]; got.PromptVersion != "v1" || len(got.Messages) != 2 || got.Messages[1].Content != "{}" ||
+			got.SnapshotID == nil || *got.SnapshotID != snapshot.ID || got.LatencyMs != 1500 || len(got.QuestionIDs) != 0 {
+			t.Errorf("Unexpected compiler entry: %+v", got)
+		}
+
+		for name, tt := range map[string]struct {
+			filter domain.LLMAuditFilter
+			want   int
+		}{
+			"by snapshot": {domain.LLMAuditFilter{SnapshotID: &snapshot.ID}, 2},
+			"by question": {domain.LLMAuditFilter{QuestionID: &questionID}, 1},
+			"by role":     {domain.LLMAuditFilter{Role: domain.LLMRoleCompiler}, 1},
+			"by outcome":  {domain.LLMAuditFilter{Outcome: domain.LLMCallFailed}, 1},
+			"limited":     {domain.LLMAuditFilter{Limit: 2}, 2},
+		} {
+			if list, err := repo.ListLLMAuditEntries(ctx, projectID, tt.filter); err != nil || len(list) != tt.want {
+				t.Errorf("ListLLMAuditEntries(%s) = %d entries, %v; want %d", name, len(list), err, tt.want)
+			}
+		}
+
+		deleted, err := repo.DeleteLLMAuditEntriesBefore(ctx, now.Add(-24*time.Hour))
+		if err != nil || deleted != 1 {
+			t.Errorf("DeleteLLMAuditEntriesBefore = %d, %v; want 1 deleted", deleted, err)
+		}
+
+		if err := repo.DeleteProject(ctx, projectID); err != nil {
+			t.Fatalf("DeleteProject failed: %v", err)
+		}
+		if list, err := repo.ListLLMAuditEntries(ctx, projectID, domain.LLMAuditFilter{}); err != nil || len(list) != 0 {
+			t.Errorf("Expected audit entries to be deleted with the project, got %d, %v", len(list), err)
+		}
+	})
+	t.Run("ResponseCache", func(t *testing.T) {
+		now := time.Now()
+		if _, ok, err := repo.GetCachedResponse(ctx, "key", now); err != nil || ok {
+			t.Fatalf("GetCachedResponse on empty cache = %v, %v; want a miss", ok, err)
+		}
+		if err := repo.PutCachedResponse(ctx, "key", []byte(`{"content":"old"}`), now.Add(time.Hour)); err != nil {
+			t.Fatalf("PutCachedResponse failed: %v", err)
+		}
+		if err := repo.PutCachedResponse(ctx, "key", []byte(`{"content":"new"}`), now.Add(time.Hour)); err != nil {
+			t.Fatalf("PutCachedResponse (replace) failed: %v", err)
+		}
+
+		value, ok, err := repo.GetCachedResponse(ctx, "key", now)
+		if err != nil || !ok || string(value) != `{"content":"new"}` {
+			t.Errorf("GetCachedResponse = %s, %v, %v; want the replaced entry", value, ok, err)
+		}
+		if _, ok, _ := repo.GetCachedResponse(ctx, "key", now.Add(2*time.Hour)); ok {
+			t.Error("Expected an expired entry to be a miss")
+		}
+	})
 }
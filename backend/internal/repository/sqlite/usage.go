@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// LLM usage
+
+func (r *SQLiteRepository) CreateLLMCall(ctx context.Context, c *domain.LLMCall) error {
+	return createLLMCall(ctx, r.db, c)
+}
+
+func (r *SQLiteRepository) GetProjectUsage(ctx context.Context, projectID uuid.UUID) (*domain.ProjectUsage, error) {
+	return getProjectUsage(ctx, r.db, projectID)
+}
+
+func (r *SQLiteRepository) GetSnapshotUsage(ctx context.Context, snapshotIDs []uuid.UUID) (map[uuid.UUID]domain.UsageTotals, error) {
+	return getSnapshotUsage(ctx, r.db, snapshotIDs)
+}
+
+func (r *SQLiteRepository) GetUsageSince(ctx context.Context, projectID *uuid.UUID, since time.Time) (domain.UsageTotals, error) {
+	return getUsageSince(ctx, r.db, projectID, since)
+}
+
+func (t *txRepository) CreateLLMCall(ctx context.Context, c *domain.LLMCall) error {
+	return createLLMCall(ctx, t.tx, c)
+}
+
+func (t *txRepository) GetProjectUsage(ctx context.Context, projectID uuid.UUID) (*domain.ProjectUsage, error) {
+	return getProjectUsage(ctx, t.tx, projectID)
+}
+
+func (t *txRepository) GetSnapshotUsage(ctx context.Context, snapshotIDs []uuid.UUID) (map[uuid.UUID]domain.UsageTotals, error) {
+	return getSnapshotUsage(ctx, t.tx, snapshotIDs)
+}
+
+func (t *txRepository) GetUsageSince(ctx context.Context, projectID *uuid.UUID, since time.Time) (domain.UsageTotals, error) {
+	return getUsageSince(ctx, t.tx, projectID, since)
+}
+
+// usageTotalsColumns aggregates llm_calls rows into the fields of a domain.UsageTotals.
+const usageTotalsColumns = `COUNT(*), SUM(input_tokens), SUM(output_tokens), SUM(cached_tokens),
+	COALESCE(SUM(cost_usd), 0), SUM(CASE WHEN cost_usd IS NULL THEN 1 ELSE 0 END), SUM(cache_hit)`
+
+func createLLMCall(ctx context.Context, db dbtx, c *domain.LLMCall) error {
+	var cost interface{}
+	if c.CostUSD != nil {
+		cost = *c.CostUSD
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO llm_calls (id, project_id, snapshot_id, role, provider, model,
+			input_tokens, output_tokens, cached_tokens, latency_ms, stop_reason, cost_usd, cache_hit, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID.String(), c.ProjectID.String(), nullableUUID(c.SnapshotID), string(c.Role), c.Provider, c.Model,
+		c.InputTokens, c.OutputTokens, c.CachedTokens, c.LatencyMs, c.StopReason, cost, c.CacheHit,
+		c.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func getProjectUsage(ctx context.Context, db dbtx, projectID uuid.UUID) (*domain.ProjectUsage, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT role, provider, model, `+usageTotalsColumns+`
+		FROM llm_calls WHERE project_id = ? GROUP BY role, provider, model`,
+		projectID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := &domain.ProjectUsage{
+		ProjectID: projectID,
+		ByRole:    []domain.RoleUsage{},
+		ByModel:   []domain.ModelUsage{},
+	}
+	for rows.Next() {
+		var role, provider, model string
+		var totals domain.UsageTotals
+		if err := rows.Scan(&role, &provider, &model, &totals.Calls, &totals.InputTokens, &totals.OutputTokens,
+			&totals.CachedTokens, &totals.CostUSD, &totals.UnpricedCalls, &totals.CacheHits); err != nil {
+			return nil, err
+		}
+		usage.Add(domain.LLMRole(role), provider, model, totals)
+	}
+	return usage, rows.Err()
+}
+
+func getSnapshotUsage(ctx context.Context, db dbtx, snapshotIDs []uuid.UUID) (map[uuid.UUID]domain.UsageTotals, error) {
+	usage := make(map[uuid.UUID]domain.UsageTotals)
+	if len(snapshotIDs) == 0 {
+		return usage, nil
+	}
+
+	placeholders := make([]string, len(snapshotIDs))
+	args := make([]interface{}, len(snapshotIDs))
+	for i, id := range snapshotIDs {
+		placeholders[i] = "?"
+		args[i] = id.String()
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT snapshot_id, `+usageTotalsColumns+`
+		FROM llm_calls WHERE snapshot_id IN (`+strings.Join(placeholders, ",")+`) GROUP BY snapshot_id`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idStr string
+		var totals domain.UsageTotals
+		if err := rows.Scan(&idStr, &totals.Calls, &totals.InputTokens, &totals.OutputTokens,
+			&totals.CachedTokens, &totals.CostUSD, &totals.UnpricedCalls, &totals.CacheHits); err != nil {
+			return nil, err
+		}
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return nil, err
+		}
+		usage[id] = totals
+	}
+	return usage, rows.Err()
+}
+
+func getUsageSince(ctx context.Context, db dbtx, projectID *uuid.UUID, since time.Time) (domain.UsageTotals, error) {
+	// COALESCE keeps the sums at zero when no calls match
+	query := `SELECT COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+		COALESCE(SUM(cached_tokens), 0), COALESCE(SUM(cost_usd), 0),
+		COALESCE(SUM(CASE WHEN cost_usd IS NULL THEN 1 ELSE 0 END), 0), COALESCE(SUM(cache_hit), 0)
+		FROM llm_calls WHERE created_at >= ?`
+	args := []interface{}{since.UTC().Format(time.RFC3339)}
+	if projectID != nil {
+		query += ` AND project_id = ?`
+		args = append(args, projectID.String())
+	}
+
+	var totals domain.UsageTotals
+	err := db.QueryRowContext(ctx, query, args...).Scan(&totals.Calls, &totals.InputTokens, &totals.OutputTokens,
+		&totals.CachedTokens, &totals.CostUSD, &totals.UnpricedCalls, &totals.CacheHits)
+	return totals, err
+}
@@ -0,0 +1,180 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+)
+
+// CheckCoverage compares a compiled spec with its trace and returns issue drafts for:
+//   - populated spec paths that no trace entry covers (type missing), reported
+//     at the highest untraced subtree so one untraced section yields one issue
+//   - trace entries citing a question, answer, or version that was not part
+//     of the compile's QA bundle (type conflict)
+//
+// known lists the answer versions the spec was compiled from. The spec's own
+// "trace" section is not checked for coverage.
+func CheckCoverage(spec json.RawMessage, t *domain.Trace, known []domain.TraceSource) []domain.IssueDraft {
+	drafts := make([]domain.IssueDraft, 0)
+
+	var root map[string]any
+	if err := json.Unmarshal(spec, &root); err != nil {
+		return drafts
+	}
+	delete(root, "trace")
+
+	traced := make(map[string]bool, len(t.SpecPathToSources))
+	for path := range t.SpecPathToSources {
+		traced[NormalizePath(path)] = true
+	}
+
+	for _, path := range uncoveredPaths("", root, traced) {
+		drafts = append(drafts, domain.IssueDraft{
+			Type:               domain.IssueTypeMissing,
+			Severity:           domain.IssueSeverityWarn,
+			Message:            fmt.Sprintf("No trace sources for populated spec path %s", path),
+			RelatedSpecPaths:   []string{path},
+			RelatedQuestionIDs: []string{},
+		})
+	}
+
+	return append(drafts, unknownSources(t, known)...)
+}
+
+// uncoveredPaths returns the highest populated paths under node whose subtree
+// has no trace entry, either on the path itself, an ancestor, or a descendant.
+func uncoveredPaths(path string, node any, traced map[string]bool) []string {
+	if traced[path] {
+		return nil
+	}
+	if path != "" && !hasTracedDescendant(path, traced) {
+		if isPopulated(node) {
+			return []string{path}
+		}
+		return nil
+	}
+
+	var paths []string
+	switch v := node.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			paths = append(paths, uncoveredPaths(path+"/"+escapePointer(k), v[k], traced)...)
+		}
+	case []any:
+		for i, item := range v {
+			paths = append(paths, uncoveredPaths(path+"/"+strconv.Itoa(i), item, traced)...)
+		}
+	}
+	return paths
+}
+
+func hasTracedDescendant(path string, traced map[string]bool) bool {
+	for p := range traced {
+		if strings.HasPrefix(p, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isPopulated reports whether a value carries content: non-empty strings,
+// numbers, booleans, or containers holding at least one populated value.
+func isPopulated(node any) bool {
+	switch v := node.(type) {
+	case nil:
+		return false
+	case string:
+		return strings.TrimSpace(v) != ""
+	case map[string]any:
+		for _, child := range v {
+			if isPopulated(child) {
+				return true
+			}
+		}
+		return false
+	case []any:
+		for _, child := range v {
+			if isPopulated(child) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// unknownSources returns one conflict issue per cited source that doesn't match
+// a known answer version, listing every spec path that cites it.
+func unknownSources(t *domain.Trace, known []domain.TraceSource) []domain.IssueDraft {
+	byQuestion := make(map[string]domain.TraceSource, len(known))
+	for _, src := range known {
+		byQuestion[strings.ToLower(src.QuestionID)] = src
+	}
+
+	type citation struct {
+		src   domain.TraceSource
+		paths []string
+	}
+	bad := make(map[domain.TraceSource]*citation)
+	for path, sources := range t.SpecPathToSources {
+		for _, src := range sources {
+			k, ok := byQuestion[strings.ToLower(src.QuestionID)]
+			if ok && strings.EqualFold(k.AnswerID, src.AnswerID) && k.AnswerVersion == src.AnswerVersion {
+				continue
+			}
+			if bad[src] == nil {
+				bad[src] = &citation{src: src}
+			}
+			bad[src].paths = append(bad[src].paths, NormalizePath(path))
+		}
+	}
+
+	citations := make([]*citation, 0, len(bad))
+	for _, c := range bad {
+		sort.Strings(c.paths)
+		citations = append(citations, c)
+	}
+	sort.Slice(citations, func(i, j int) bool {
+		return citations[i].paths[0] < citations[j].paths[0]
+	})
+
+	drafts := make([]domain.IssueDraft, 0, len(citations))
+	for _, c := range citations {
+		relatedQuestions := []string{}
+		var reason string
+		k, ok := byQuestion[strings.ToLower(c.src.QuestionID)]
+		switch {
+		case !ok:
+			reason = fmt.Sprintf("question %s was not part of this compile", c.src.QuestionID)
+		case !strings.EqualFold(k.AnswerID, c.src.AnswerID):
+			reason = fmt.Sprintf("answer %s is not the answer compiled for question %s", c.src.AnswerID, c.src.QuestionID)
+			relatedQuestions = append(relatedQuestions, k.QuestionID)
+		default:
+			reason = fmt.Sprintf("answer %s was compiled at version %d, not %d", c.src.AnswerID, k.AnswerVersion, c.src.AnswerVersion)
+			relatedQuestions = append(relatedQuestions, k.QuestionID)
+		}
+		drafts = append(drafts, domain.IssueDraft{
+			Type:               domain.IssueTypeConflict,
+			Severity:           domain.IssueSeverityError,
+			Message:            fmt.Sprintf("Trace cites an unknown source: %s", reason),
+			RelatedSpecPaths:   c.paths,
+			RelatedQuestionIDs: relatedQuestions,
+		})
+	}
+	return drafts
+}
+
+// escapePointer escapes an object key for use as a JSON-pointer segment (RFC 6901).
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+)
+
+func TestCheckCoverage(t *testing.T) {
+	spec := json.RawMessage(`{
+		"product": {"name": "App", "purpose": "Do things"},
+		"scope": {"in_scope": ["A", "B"], "out_of_scope": [], "assumptions": []},
+		"requirements": {"functional": [{"id": "FR-001", "title": "One"}, {"id": "FR-002", "title": "Two"}]},
+		"ui": {"screens": []},
+		"trace": {"spec_path_to_sources": {}}
+	}`)
+	known := []domain.TraceSource{
+		{QuestionID: "q1", AnswerID: "a1", AnswerVersion: 1},
+		{QuestionID: "q2", AnswerID: "a2", AnswerVersion: 3},
+	}
+	tr := &domain.Trace{SpecPathToSources: map[string][]domain.TraceSource{
+		"/product":                         {{QuestionID: "q1", AnswerID: "a1", AnswerVersion: 1}},
+		"/requirements/functional/0":       {{QuestionID: "q2", AnswerID: "a2", AnswerVersion: 3}},
+		"requirements.functional[1].title": {{QuestionID: "q2", AnswerID: "a2", AnswerVersion: 2}},
+		"/scope/in_scope/0":                {{QuestionID: "q9", AnswerID: "a9", AnswerVersion: 1}},
+	}}
+
+	drafts := CheckCoverage(spec, tr, known)
+
+	var missing, conflicts []domain.IssueDraft
+	for _, d := range drafts {
+		switch d.Type {
+		case domain.IssueTypeMissing:
+			missing = append(missing, d)
+		case domain.IssueTypeConflict:
+			conflicts = append(conflicts, d)
+		}
+	}
+
+	// /requirements/functional/1/id is untraced (its sibling title is traced);
+	// /scope/in_scope/1 is untraced; empty arrays and the trace section are ignored
+	var missingPaths []string
+	for _, d := range missing {
+		missingPaths = append(missingPaths, d.RelatedSpecPaths...)
+		if d.Severity != domain.IssueSeverityWarn {
+			t.Errorf("missing issue severity = %s, want warn", d.Severity)
+		}
+	}
+	wantMissing := []string{"/requirements/functional/1/id", "/scope/in_scope/1"}
+	if !reflect.DeepEqual(missingPaths, wantMissing) {
+		t.Errorf("missing paths = %v, want %v", missingPaths, wantMissing)
+	}
+
+	if len(conflicts) != 2 {
+		t.Fatalf("got %d conflict issues, want 2: %+v", len(conflicts), conflicts)
+	}
+	if !strings.Contains(conflicts[0].Message, "version 3, not 2") || conflicts[0].RelatedQuestionIDs[0] != "q2" {
+		t.Errorf("conflicts[0] = %+v, want version mismatch for q2", conflicts[0])
+	}
+	if !strings.Contains(conflicts[1].Message, "question q9 was not part of this compile") {
+		t.Errorf("conflicts[1] = %+v, want unknown question q9", conflicts[1])
+	}
+}
+
+func TestCheckCoverageUntracedSection(t *testing.T) {
+	spec := json.RawMessage(`{"product": {"name": "App"}, "data_model": {"entities": [{"name": "Item", "fields": [{"name": "id"}]}]}}`)
+	tr := &domain.Trace{SpecPathToSources: map[string][]domain.TraceSource{
+		"/product/name": {{QuestionID: "q1", AnswerID: "a1", AnswerVersion: 1}},
+	}}
+
+	drafts := CheckCoverage(spec, tr, []domain.TraceSource{{QuestionID: "q1", AnswerID: "a1", AnswerVersion: 1}})
+
+	// A fully untraced section is reported once, not per field
+	if len(drafts) != 1 || drafts[0].RelatedSpecPaths[0] != "/data_model" {
+		t.Errorf("CheckCoverage() = %+v, want a single issue for /data_model", drafts)
+	}
+}
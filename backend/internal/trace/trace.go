@@ -0,0 +1,114 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+)
+
+// Parse decodes a trace document. Empty input yields an empty trace.
+func Parse(raw json.RawMessage) (*domain.Trace, error) {
+	t := &domain.Trace{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, t); err != nil {
+			return nil, fmt.Errorf("parse trace: %w", err)
+		}
+	}
+	if t.SpecPathToSources == nil {
+		t.SpecPathToSources = make(map[string][]domain.TraceSource)
+	}
+	return t, nil
+}
+
+// FromSpec extracts the trace section embedded in a ProjectImplementationSpec.
+// It returns nil if the spec has no trace.
+func FromSpec(spec json.RawMessage) json.RawMessage {
+	var specWithTrace struct {
+		Trace json.RawMessage `json:"trace"`
+	}
+	if err := json.Unmarshal(spec, &specWithTrace); err != nil {
+		return nil
+	}
+	if string(specWithTrace.Trace) == "null" {
+		return nil
+	}
+	return specWithTrace.Trace
+}
+
+// ForSnapshot returns the snapshot's trace, falling back to the trace embedded
+// in the spec for snapshots created before traces were stored separately.
+func ForSnapshot(s *domain.SpecSnapshot) json.RawMessage {
+	if len(s.Trace) > 0 && string(s.Trace) != "{}" && string(s.Trace) != "null" {
+		return s.Trace
+	}
+	if t := FromSpec(s.Spec); t != nil {
+		return t
+	}
+	return json.RawMessage(`{}`)
+}
+
+// NormalizePath converts a spec path to JSON-pointer form. Dotted paths with
+// array indexes ("requirements.functional[3]") become "/requirements/functional/3".
+func NormalizePath(path string) string {
+	p := strings.TrimSpace(path)
+	if p == "" || p == "/" {
+		return ""
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = strings.NewReplacer(".", "/", "[", "/", "]", "").Replace(p)
+		p = "/" + p
+	}
+	return strings.TrimSuffix(p, "/")
+}
+
+// SourcesForPath returns the trace entries that explain a spec path: entries
+// for the path itself, for any ancestor (a trace on "/requirements" covers
+// "/requirements/functional/3"), and for any descendant.
+func SourcesForPath(t *domain.Trace, path string) []domain.TraceEntry {
+	target := NormalizePath(path)
+	entries := make([]domain.TraceEntry, 0)
+	for specPath, sources := range t.SpecPathToSources {
+		p := NormalizePath(specPath)
+		if !isPrefix(p, target) && !isPrefix(target, p) {
+			continue
+		}
+		for _, src := range sources {
+			entries = append(entries, domain.TraceEntry{SpecPath: specPath, TraceSource: src})
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// PathsForAnswer returns the trace entries derived from an answer. If
+// questionID is set, entries for any version of that question's answers match too.
+func PathsForAnswer(t *domain.Trace, answerID, questionID string) []domain.TraceEntry {
+	entries := make([]domain.TraceEntry, 0)
+	for specPath, sources := range t.SpecPathToSources {
+		for _, src := range sources {
+			if (answerID != "" && strings.EqualFold(src.AnswerID, answerID)) ||
+				(questionID != "" && strings.EqualFold(src.QuestionID, questionID)) {
+				entries = append(entries, domain.TraceEntry{SpecPath: specPath, TraceSource: src})
+			}
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// isPrefix reports whether pointer a is equal to or an ancestor of pointer b.
+func isPrefix(a, b string) bool {
+	return a == b || a == "" || strings.HasPrefix(b, a+"/")
+}
+
+func sortEntries(entries []domain.TraceEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].SpecPath != entries[j].SpecPath {
+			return entries[i].SpecPath < entries[j].SpecPath
+		}
+		return entries[i].AnswerID < entries[j].AnswerID
+	})
+}
@@ -0,0 +1,103 @@
+package trace
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dshills/specbuilder/backend/internal/domain"
+)
+
+const testTrace = `{"spec_path_to_sources": {
+	"/product/name": [{"question_id": "q1", "answer_id": "a1", "answer_version": 1}],
+	"/requirements": [{"question_id": "q2", "answer_id": "a2", "answer_version": 2}],
+	"/requirements/functional/3/title": [{"question_id": "q3", "answer_id": "a3", "answer_version": 1}],
+	"/requirements/functional/30": [{"question_id": "q4", "answer_id": "a4", "answer_version": 1}],
+	"/api/endpoints/0": [{"question_id": "q2", "answer_id": "a2", "answer_version": 2}]
+}}`
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/requirements/functional/3", "/requirements/functional/3"},
+		{"requirements.functional[3]", "/requirements/functional/3"},
+		{"requirements.functional.3.title", "/requirements/functional/3/title"},
+		{"/product/", "/product"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := NormalizePath(tt.path); got != tt.want {
+				t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcesForPath(t *testing.T) {
+	tr, err := Parse(json.RawMessage(testTrace))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	entries := SourcesForPath(tr, "requirements.functional[3]")
+
+	// Ancestor (/requirements) and descendant (/requirements/functional/3/title),
+	// but not the sibling index /requirements/functional/30
+	if len(entries) != 2 {
+		t.Fatalf("SourcesForPath() returned %d entries, want 2: %v", len(entries), entries)
+	}
+	if entries[0].SpecPath != "/requirements" || entries[0].AnswerID != "a2" {
+		t.Errorf("entries[0] = %+v, want /requirements from a2", entries[0])
+	}
+	if entries[1].SpecPath != "/requirements/functional/3/title" || entries[1].AnswerID != "a3" {
+		t.Errorf("entries[1] = %+v, want /requirements/functional/3/title from a3", entries[1])
+	}
+}
+
+func TestPathsForAnswer(t *testing.T) {
+	tr, err := Parse(json.RawMessage(testTrace))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	entries := PathsForAnswer(tr, "a2", "")
+	if len(entries) != 2 {
+		t.Fatalf("PathsForAnswer() returned %d entries, want 2: %v", len(entries), entries)
+	}
+	if entries[0].SpecPath != "/api/endpoints/0" || entries[1].SpecPath != "/requirements" {
+		t.Errorf("PathsForAnswer() paths = [%s %s], want [/api/endpoints/0 /requirements]", entries[0].SpecPath, entries[1].SpecPath)
+	}
+
+	if got := PathsForAnswer(tr, "", "q1"); len(got) != 1 || got[0].SpecPath != "/product/name" {
+		t.Errorf("PathsForAnswer() by question = %v, want /product/name", got)
+	}
+	if got := PathsForAnswer(tr, "missing", ""); len(got) != 0 {
+		t.Errorf("PathsForAnswer() for unknown answer = %v, want none", got)
+	}
+}
+
+func TestForSnapshot(t *testing.T) {
+	stored := &domain.SpecSnapshot{
+		Spec:  json.RawMessage(`{"trace": {"spec_path_to_sources": {"/old": []}}}`),
+		Trace: json.RawMessage(`{"spec_path_to_sources": {"/new": []}}`),
+	}
+	if got := string(ForSnapshot(stored)); got != string(stored.Trace) {
+		t.Errorf("ForSnapshot() = %s, want stored trace", got)
+	}
+
+	legacy := &domain.SpecSnapshot{
+		Spec:  json.RawMessage(`{"trace": {"spec_path_to_sources": {"/old": []}}}`),
+		Trace: json.RawMessage(`{}`),
+	}
+	if got := string(ForSnapshot(legacy)); got != `{"spec_path_to_sources": {"/old": []}}` {
+		t.Errorf("ForSnapshot() = %s, want trace embedded in spec", got)
+	}
+
+	empty := &domain.SpecSnapshot{Spec: json.RawMessage(`{}`)}
+	if got := string(ForSnapshot(empty)); got != `{}` {
+		t.Errorf("ForSnapshot() = %s, want {}", got)
+	}
+}
@@ -9,6 +9,9 @@ import type {
   GetSnapshotResponse,
   ListSnapshotsResponse,
   ListModelsResponse,
+  ProjectUsage,
+  Budget,
+  BudgetResponse,
   SuggestionsResponse,
   Provider,
   ProjectMode,
@@ -23,6 +26,9 @@ import type {
 // In production (Docker), use relative paths. In dev, fall back to localhost:8080
 const API_BASE = import.meta.env.VITE_API_URL || (import.meta.env.PROD ? '' : 'http://localhost:8080');
 
+// How many times a dropped stream may reconnect before the error is reported
+const MAX_STREAM_RECONNECTS = 5;
+
 class ApiClient {
   private async request<T>(
     path: string,
@@ -167,6 +173,7 @@ class ApiClient {
     const eventSource = new EventSource(url);
     let hasReceivedEvent = false;
     let isComplete = false;
+    let reconnects = 0;
 
     eventSource.addEventListener('stage', (e) => {
       hasReceivedEvent = true;
@@ -191,6 +198,12 @@ class ApiClient {
 
     eventSource.onerror = () => {
       if (!isComplete) {
+        // The job keeps running on the server, so let EventSource reconnect;
+        // it resumes the same job via Last-Event-ID
+        if (hasReceivedEvent && eventSource.readyState === EventSource.CONNECTING && reconnects < MAX_STREAM_RECONNECTS) {
+          reconnects++;
+          return;
+        }
         if (!hasReceivedEvent) {
           onError({ error: 'connection_error', message: 'Unable to connect to server for question generation. Check that the backend is running and try again.' });
         } else {
@@ -264,6 +277,7 @@ class ApiClient {
     const eventSource = new EventSource(url);
     let hasReceivedEvent = false;
     let isComplete = false;
+    let reconnects = 0;
 
     eventSource.addEventListener('stage', (e) => {
       hasReceivedEvent = true;
@@ -289,6 +303,12 @@ class ApiClient {
     eventSource.onerror = () => {
       // Only report error if we haven't completed successfully
       if (!isComplete) {
+        // The job keeps running on the server, so let EventSource reconnect;
+        // it resumes the same job via Last-Event-ID
+        if (hasReceivedEvent && eventSource.readyState === EventSource.CONNECTING && reconnects < MAX_STREAM_RECONNECTS) {
+          reconnects++;
+          return;
+        }
         if (!hasReceivedEvent) {
           onError({ error: 'connection_error', message: 'Unable to connect to server for compilation. Check that the backend is running and try again.' });
         } else {
@@ -321,6 +341,22 @@ class ApiClient {
     );
   }
 
+  // Usage
+  async getUsage(projectId: string): Promise<ProjectUsage> {
+    return this.request<ProjectUsage>(`/projects/${projectId}/usage`);
+  }
+
+  async getBudget(projectId: string): Promise<BudgetResponse> {
+    return this.request<BudgetResponse>(`/projects/${projectId}/budget`);
+  }
+
+  async setBudget(projectId: string, budget: Budget | null): Promise<BudgetResponse> {
+    return this.request<BudgetResponse>(`/projects/${projectId}/budget`, {
+      method: 'PUT',
+      body: JSON.stringify({ budget }),
+    });
+  }
+
   // Export
   getExportUrl(projectId: string, snapshotId?: string, format?: ExportFormat): string {
     const base = `${API_BASE}/projects/${projectId}/export`;
@@ -363,6 +399,7 @@ class ApiClient {
     const eventSource = new EventSource(url);
     let hasReceivedEvent = false;
     let isComplete = false;
+    let reconnects = 0;
 
     eventSource.addEventListener('stage', (e) => {
       hasReceivedEvent = true;
@@ -387,6 +424,12 @@ class ApiClient {
 
     eventSource.onerror = () => {
       if (!isComplete) {
+        // The job keeps running on the server, so let EventSource reconnect;
+        // it resumes the same job via Last-Event-ID
+        if (hasReceivedEvent && eventSource.readyState === EventSource.CONNECTING && reconnects < MAX_STREAM_RECONNECTS) {
+          reconnects++;
+          return;
+        }
         if (!hasReceivedEvent) {
           onError({ error: 'connection_error', message: 'Unable to connect to server for suggestions. Check that the backend is running.' });
         } else {
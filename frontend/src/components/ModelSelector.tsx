@@ -31,11 +31,13 @@ export function ModelSelector({
       : '';
 
   const handleChange = (e: React.ChangeEvent<HTMLSelectElement>) => {
-    const parts = e.target.value.split(':');
-    if (parts.length < 2 || !parts[0] || !parts[1]) {
+    // Split on the first colon only: model IDs may contain colons (e.g. "qwen2.5:7b")
+    const sep = e.target.value.indexOf(':');
+    const provider = e.target.value.slice(0, sep) as Provider;
+    const model = e.target.value.slice(sep + 1);
+    if (sep < 0 || !provider || !model) {
       return; // Invalid format, ignore
     }
-    const [provider, model] = parts as [Provider, string];
     onSelect(provider, model);
   };
 
@@ -14,12 +14,14 @@ interface SpecViewerProps {
 const STAGE_LABELS: Record<CompileStage, string> = {
   preparing: 'Preparing',
   compiling: 'Compiling',
+  repairing: 'Repairing',
+  merging: 'Merging',
   saving: 'Saving',
   validating: 'Validating',
   complete: 'Complete',
 };
 
-const STAGES: CompileStage[] = ['preparing', 'compiling', 'saving', 'validating', 'complete'];
+const STAGES: CompileStage[] = ['preparing', 'compiling', 'repairing', 'merging', 'saving', 'validating', 'complete'];
 
 function formatTime(ms: number): string {
   if (ms < 1000) return `${ms}ms`;
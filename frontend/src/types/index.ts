@@ -6,10 +6,22 @@ export interface Project {
   id: string;
   name: string;
   mode: ProjectMode;
+  budget?: Budget;
+  prompt_version?: string;
+  model_routing?: ModelRouting;
   created_at: string;
   updated_at: string;
 }
 
+export type BudgetPeriod = 'monthly' | 'lifetime';
+
+export interface Budget {
+  period: BudgetPeriod;
+  max_tokens?: number;
+  max_cost_usd?: number;
+  warn_at?: number;
+}
+
 export type QuestionType = 'single' | 'multi' | 'freeform';
 export type QuestionMode = 'basic' | 'advanced';
 export type QuestionStatus = 'unanswered' | 'answered' | 'skipped' | 'superseded';
@@ -41,19 +53,102 @@ export interface Answer {
 export interface SpecSnapshot {
   id: string;
   project_id: string;
+  parent_snapshot_id: string | null;
   spec: Record<string, unknown>;
   created_at: string;
   derived_from: Record<string, number>;
   compiler: CompilerConfig;
+  usage?: UsageTotals;
 }
 
 export interface CompilerConfig {
   model: string;
   prompt_version: string;
   temperature: number;
+  sections?: string[];
+  models?: ModelRef[];
+}
+
+export interface ModelRef {
+  provider: string;
+  model: string;
+}
+
+export type LLMRole = 'planner' | 'asker' | 'compiler' | 'validator' | 'suggester';
+
+export interface UsageTotals {
+  calls: number;
+  input_tokens: number;
+  output_tokens: number;
+  cached_tokens: number;
+  cost_usd: number;
+  unpriced_calls: number;
+  cache_hits: number;
+}
+
+export interface RoleUsage extends UsageTotals {
+  role: LLMRole;
+}
+
+export interface ModelUsage extends UsageTotals {
+  provider: string;
+  model: string;
 }
 
-export type IssueType = 'schema_violation' | 'semantic_conflict' | 'missing_info' | 'assumption' | 'ambiguity';
+export interface BudgetStatus {
+  scope: 'project' | 'server';
+  budget: Budget;
+  usage: UsageTotals;
+  since?: string;
+  estimate?: UsageTotals; // Set only when refusing an LLM call that could exceed the budget
+}
+
+export interface BudgetResponse {
+  budgets: BudgetStatus[];
+}
+
+export interface ProjectUsage {
+  project_id: string;
+  total: UsageTotals;
+  by_role: RoleUsage[];
+  by_model: ModelUsage[];
+}
+
+export type LLMCallOutcome = 'ok' | 'invalid_json' | 'failed';
+
+export interface LLMMessage {
+  role: string;
+  content: string;
+}
+
+export interface LLMAuditEntry {
+  id: string;
+  project_id: string;
+  snapshot_id: string | null;
+  question_ids: string[];
+  role: LLMRole;
+  stage: string;
+  provider: string;
+  model: string;
+  prompt_version?: string;
+  messages: LLMMessage[];
+  response: string;
+  outcome: LLMCallOutcome;
+  error?: string;
+  input_tokens: number;
+  output_tokens: number;
+  latency_ms: number;
+  stop_reason?: string;
+  cache_hit: boolean;
+  created_at: string;
+}
+
+export interface ListLLMCallsResponse {
+  enabled: boolean;
+  calls: LLMAuditEntry[];
+}
+
+export type IssueType = 'schema_violation' | 'semantic_conflict' | 'missing_info' | 'assumption' | 'ambiguity' | 'budget';
 export type IssueSeverity = 'error' | 'warning' | 'info';
 
 export interface Issue {
@@ -91,11 +186,19 @@ export interface SubmitAnswerResponse {
   answer_id: string;
   snapshot_id: string | null;
   issues: Issue[];
+  compile_in_progress?: boolean;
+}
+
+export interface NotIncludedAnswer {
+  question_id: string;
+  answer_id: string;
+  version: number;
 }
 
 export interface CompileResponse {
   snapshot_id: string;
   issues: Issue[];
+  answers_not_included: NotIncludedAnswer[];
 }
 
 export interface NextQuestionsResponse {
@@ -118,7 +221,7 @@ export interface ApiError {
 }
 
 // LLM Models
-export type Provider = 'google' | 'openai' | 'anthropic';
+export type Provider = 'google' | 'openai' | 'anthropic' | 'ollama' | 'openai_compatible';
 
 export interface ModelInfo {
   id: string;
@@ -133,10 +236,27 @@ export interface ProviderInfo {
   models: ModelInfo[];
 }
 
+export interface ModelRef {
+  provider: Provider;
+  model: string;
+}
+
+// Models of LLM roles; roles left out use the server's routing
+export type ModelRouting = Partial<Record<LLMRole, ModelRef>>;
+
+export type RouteSource = 'default' | 'server' | 'project';
+
+export interface Route {
+  provider: Provider;
+  model: string;
+  source: RouteSource;
+}
+
 export interface ListModelsResponse {
   providers: ProviderInfo[];
   default_provider: Provider;
   default_model: string;
+  routing: Record<LLMRole, Route>;
 }
 
 // Suggestions
@@ -153,8 +273,33 @@ export interface SuggestionsResponse {
   suggestions: Suggestion[];
 }
 
+// Set on stage events when a failed LLM call is about to be retried or fail over
+export interface RetryNotice {
+  attempt: number;
+  max_attempts: number;
+  delay_ms: number;
+  error: string;
+  fallback?: string; // Set when failing over to another model ("provider/model")
+}
+
+// Inputs cut from an LLM prompt to fit the model's context window
+export interface ContextTrim {
+  context_window: number;
+  estimated_tokens: number; // Estimated prompt tokens of the full inputs
+  trimmed_tokens: number; // Estimated prompt tokens sent
+  inputs: TrimmedInput[];
+}
+
+export interface TrimmedInput {
+  name: 'spec' | 'issues' | 'questions' | 'answers' | 'unanswered_questions';
+  total: number;
+  summarized: number; // For the spec, the sections left out
+  dropped: number;
+  sections?: string[];
+}
+
 // Compile streaming types
-export type CompileStage = 'preparing' | 'compiling' | 'saving' | 'validating' | 'complete';
+export type CompileStage = 'preparing' | 'compiling' | 'repairing' | 'merging' | 'saving' | 'validating' | 'complete';
 
 export interface CompileStageEvent {
   stage: CompileStage;
@@ -163,6 +308,13 @@ export interface CompileStageEvent {
   total_ms: number;
   snapshot_id?: string;
   issue_count?: number;
+  answers_not_included?: NotIncludedAnswer[];
+  // Set on progress events while the model streams its output
+  tokens?: number;
+  section?: string;
+  model?: string;
+  retry?: RetryNotice;
+  cached?: boolean; // An LLM response came from the server's response cache
 }
 
 export interface CompileErrorEvent {
@@ -179,6 +331,11 @@ export interface NextQuestionsStageEvent {
   elapsed_ms: number;
   total_ms: number;
   question_count?: number;
+  tokens?: number;
+  section?: string;
+  retry?: RetryNotice;
+  cached?: boolean;
+  trimmed?: ContextTrim;
 }
 
 // Suggestions streaming types
@@ -191,6 +348,10 @@ export interface SuggestionsStageEvent {
   total_ms: number;
   suggestion_count?: number;
   suggestions?: Suggestion[];
+  tokens?: number;
+  retry?: RetryNotice;
+  cached?: boolean;
+  trimmed?: ContextTrim;
 }
 
 // Export format types